@@ -45,6 +45,10 @@ var (
 	logToStdErr       bool
 	versionOnly       bool
 	profiling         bool
+	outputDirectory   string
+	stateFile         string
+	slotName          string
+	rewindLSN         string
 )
 
 func main() {
@@ -85,6 +89,77 @@ func main() {
 			},
 		},
 		Action: start,
+		Commands: []cli.Command{
+			{
+				Name:  "dump-proto",
+				Usage: "Generates the Protobuf definitions (.proto files) for all replicated hypertables and tables",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "output,o",
+						Value:       ".",
+						Usage:       "Write the .proto files into `DIRECTORY`",
+						Destination: &outputDirectory,
+					},
+				},
+				Action: dumpProto,
+			},
+			{
+				Name:  "state",
+				Usage: "Inspects and modifies the state (offsets, snapshots, known tables) in the configured state storage",
+				Subcommands: []cli.Command{
+					{
+						Name:   "inspect",
+						Usage:  "Prints the stored state as human-readable JSON",
+						Action: inspectState,
+					},
+					{
+						Name:  "export",
+						Usage: "Exports the stored state as JSON",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:        "output,o",
+								Value:       "",
+								Usage:       "Write the export into `FILE` instead of stdout",
+								Destination: &stateFile,
+							},
+						},
+						Action: exportState,
+					},
+					{
+						Name:  "import",
+						Usage: "Imports a state export into the state storage, the streamer must not be running",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:        "input,i",
+								Value:       "",
+								Usage:       "Read the export from `FILE` instead of stdin",
+								Destination: &stateFile,
+							},
+						},
+						Action: importState,
+					},
+					{
+						Name:  "rewind",
+						Usage: "Sets the LSN to restart replication from, the streamer must not be running",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:        "lsn",
+								Value:       "",
+								Usage:       "Restart replication at `LSN` (e.g. 0/16B3748)",
+								Destination: &rewindLSN,
+							},
+							&cli.StringFlag{
+								Name:        "slot",
+								Value:       "",
+								Usage:       "Rewind the offset of replication slot `NAME` instead of the configured one",
+								Destination: &slotName,
+							},
+						},
+						Action: rewindState,
+					},
+				},
+			},
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -117,6 +192,163 @@ func start(
 		}()
 	}
 
+	config, err := loadConfiguration(log)
+	if err != nil {
+		return err
+	}
+
+	systemConfig := sysconfig.NewSystemConfig(config)
+	streamer, exitErr := internal.NewStreamer(systemConfig)
+	if exitErr != nil {
+		return exitErr
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+
+	done := waiting.NewWaiter()
+	var failure error
+	go func() {
+		select {
+		case <-signals:
+		case failure = <-streamer.Failure():
+		}
+		if err := streamer.Stop(); err != nil {
+			fmt.Fprintf(log, "Hard error when stopping replication: %v\n", err)
+			os.Exit(1)
+		}
+		done.Signal()
+	}()
+
+	if err := streamer.Start(); err != nil {
+		return err
+	}
+
+	if err := done.Await(); err != nil {
+		return erroring.AdaptError(err, 10)
+	}
+
+	if failure != nil {
+		return erroring.AdaptErrorWithMessage(failure, "replication failed", 11)
+	}
+	return nil
+}
+
+func dumpProto(
+	_ *cli.Context,
+) error {
+
+	config, err := loadConfiguration(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	systemConfig := sysconfig.NewSystemConfig(config)
+	if err := internal.DumpProtobufDefinitions(systemConfig, outputDirectory); err != nil {
+		return err
+	}
+	return nil
+}
+
+func inspectState(
+	_ *cli.Context,
+) error {
+
+	systemConfig, err := loadStateConfiguration()
+	if err != nil {
+		return err
+	}
+
+	if err := internal.InspectState(systemConfig, os.Stdout); err != nil {
+		return err
+	}
+	return nil
+}
+
+func exportState(
+	_ *cli.Context,
+) error {
+
+	systemConfig, err := loadStateConfiguration()
+	if err != nil {
+		return err
+	}
+
+	writer := io.Writer(os.Stdout)
+	if stateFile != "" {
+		f, err := os.Create(stateFile)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("State export file couldn't be created: %v", err), 7)
+		}
+		defer f.Close()
+		writer = f
+	}
+
+	if err := internal.ExportState(systemConfig, writer); err != nil {
+		return err
+	}
+	return nil
+}
+
+func importState(
+	_ *cli.Context,
+) error {
+
+	systemConfig, err := loadStateConfiguration()
+	if err != nil {
+		return err
+	}
+
+	reader := io.Reader(os.Stdin)
+	if stateFile != "" {
+		f, err := os.Open(stateFile)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("State export file couldn't be opened: %v", err), 3)
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	if err := internal.ImportState(systemConfig, reader); err != nil {
+		return err
+	}
+	return nil
+}
+
+func rewindState(
+	_ *cli.Context,
+) error {
+
+	if rewindLSN == "" {
+		return cli.NewExitError("LSN (--lsn) required to rewind the state", 6)
+	}
+
+	systemConfig, err := loadStateConfiguration()
+	if err != nil {
+		return err
+	}
+
+	if err := internal.RewindState(systemConfig, slotName, rewindLSN); err != nil {
+		return err
+	}
+	return nil
+}
+
+func loadStateConfiguration() (*sysconfig.SystemConfig, error) {
+	// Stdout is reserved for the JSON output
+	logToStdErr = true
+
+	config, err := loadConfiguration(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return sysconfig.NewSystemConfig(config), nil
+}
+
+func loadConfiguration(
+	log io.Writer,
+) (*spiconfig.Config, error) {
+
 	logging.WithCaller = withCaller
 	logging.WithVerbose = verbose
 
@@ -134,54 +366,27 @@ func start(
 		fmt.Fprintf(log, "Loading configuration file: %s\n", configurationFile)
 		f, err := os.Open(configurationFile)
 		if err != nil {
-			return cli.NewExitError(fmt.Sprintf("Configuration file couldn't be opened: %v\n", err), 3)
+			return nil, cli.NewExitError(fmt.Sprintf("Configuration file couldn't be opened: %v\n", err), 3)
 		}
 
 		b, err := io.ReadAll(f)
 		if err != nil {
-			return cli.NewExitError(fmt.Sprintf("Configuration file couldn't be read: %v\n", err), 4)
+			return nil, cli.NewExitError(fmt.Sprintf("Configuration file couldn't be read: %v\n", err), 4)
 		}
 
 		tomlConfig := filepath.Ext(strings.ToLower(configurationFile)) == ".toml"
 		if err := spiconfig.Unmarshall(b, config, tomlConfig); err != nil {
-			return cli.NewExitError(fmt.Sprintf("Configuration file couldn't be decoded: %v\n", err), 5)
+			return nil, cli.NewExitError(fmt.Sprintf("Configuration file couldn't be decoded: %v\n", err), 5)
 		}
 	}
 
 	if err := logging.InitializeLogging(config, logToStdErr); err != nil {
-		return err
+		return nil, err
 	}
 
 	if spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlConnection, "") == "" {
-		return cli.NewExitError("PostgreSQL connection string required", 6)
+		return nil, cli.NewExitError("PostgreSQL connection string required", 6)
 	}
 
-	systemConfig := sysconfig.NewSystemConfig(config)
-	streamer, err := internal.NewStreamer(systemConfig)
-	if err != nil {
-		return err
-	}
-
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-
-	done := waiting.NewWaiter()
-	go func() {
-		<-signals
-		if err := streamer.Stop(); err != nil {
-			fmt.Fprintf(log, "Hard error when stopping replication: %v\n", err)
-			os.Exit(1)
-		}
-		done.Signal()
-	}()
-
-	if err := streamer.Start(); err != nil {
-		return err
-	}
-
-	if err := done.Await(); err != nil {
-		return erroring.AdaptError(err, 10)
-	}
-
-	return nil
+	return config, nil
 }
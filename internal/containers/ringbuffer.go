@@ -18,7 +18,9 @@
 package containers
 
 import (
+	"github.com/noctarius/timescaledb-event-streamer/internal/functional"
 	"runtime"
+	"sync"
 )
 
 // Channel is based on https://github.com/jtarchie/ringbuffer, but
@@ -73,3 +75,106 @@ func (c *Channel[T]) ReceiveChannel() <-chan T {
 func (c *Channel[T]) Close() {
 	close(c.input)
 }
+
+// RingBuffer is a bounded buffer which overwrites the oldest values
+// when full. Values are addressed by their absolute position, which
+// enables multiple readers to independently follow the buffer and to
+// detect if they fell behind and values were overwritten.
+type RingBuffer[T any] struct {
+	mutex  sync.Mutex
+	values []T
+	next   uint64
+	notify chan struct{}
+	closed bool
+}
+
+func NewRingBuffer[T any](
+	capacity int,
+) *RingBuffer[T] {
+
+	return &RingBuffer[T]{
+		values: make([]T, capacity),
+		notify: make(chan struct{}),
+	}
+}
+
+// Append adds the value to the buffer, potentially overwriting
+// the oldest value, and returns the position of the value
+func (r *RingBuffer[T]) Append(
+	value T,
+) uint64 {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	position := r.next
+	r.values[position%uint64(len(r.values))] = value
+	r.next++
+
+	// Wake up all waiting readers
+	close(r.notify)
+	r.notify = make(chan struct{})
+	return position
+}
+
+// Get returns the value at the given position, or false if
+// the value was already overwritten or isn't written yet
+func (r *RingBuffer[T]) Get(
+	position uint64,
+) (T, bool) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if position < r.oldest() || position >= r.next {
+		return functional.Zero[T](), false
+	}
+	return r.values[position%uint64(len(r.values))], true
+}
+
+// Oldest returns the position of the oldest value still available
+func (r *RingBuffer[T]) Oldest() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.oldest()
+}
+
+// Next returns the position the next appended value will have
+func (r *RingBuffer[T]) Next() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.next
+}
+
+// Wait returns a channel which is closed when the next value
+// is appended or the buffer is closed. To not miss any value,
+// the channel needs to be retrieved before checking Next.
+func (r *RingBuffer[T]) Wait() <-chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.notify
+}
+
+// Close wakes up all waiting readers, the buffer
+// must not be appended to after being closed
+func (r *RingBuffer[T]) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.closed {
+		r.closed = true
+		close(r.notify)
+	}
+}
+
+func (r *RingBuffer[T]) Closed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.closed
+}
+
+func (r *RingBuffer[T]) oldest() uint64 {
+	if r.next < uint64(len(r.values)) {
+		return 0
+	}
+	return r.next - uint64(len(r.values))
+}
@@ -0,0 +1,78 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package containers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_RingBuffer_Overwrites_Oldest(
+	t *testing.T,
+) {
+
+	buffer := NewRingBuffer[int](3)
+	assert.Equal(t, uint64(0), buffer.Oldest())
+	assert.Equal(t, uint64(0), buffer.Next())
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, uint64(i), buffer.Append(i*10))
+	}
+	assert.Equal(t, uint64(0), buffer.Oldest())
+	assert.Equal(t, uint64(3), buffer.Next())
+
+	value, present := buffer.Get(0)
+	assert.True(t, present)
+	assert.Equal(t, 0, value)
+
+	// Not yet written
+	_, present = buffer.Get(3)
+	assert.False(t, present)
+
+	assert.Equal(t, uint64(3), buffer.Append(30))
+	assert.Equal(t, uint64(1), buffer.Oldest())
+
+	// Overwritten
+	_, present = buffer.Get(0)
+	assert.False(t, present)
+
+	value, present = buffer.Get(3)
+	assert.True(t, present)
+	assert.Equal(t, 30, value)
+}
+
+func Test_RingBuffer_Wait(
+	t *testing.T,
+) {
+
+	buffer := NewRingBuffer[int](3)
+
+	wait := buffer.Wait()
+	select {
+	case <-wait:
+		t.Fatal("wait channel closed before append")
+	default:
+	}
+
+	buffer.Append(1)
+	<-wait
+
+	wait = buffer.Wait()
+	buffer.Close()
+	<-wait
+	assert.True(t, buffer.Closed())
+}
@@ -0,0 +1,102 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package eventemitting
+
+import (
+	"container/list"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"sync"
+)
+
+type pendingAcknowledgement struct {
+	xld          pgtypes.XLogData
+	processedLSN *pgtypes.LSN
+	done         bool
+}
+
+// acknowledgementTracker keeps track of emitted but not yet confirmed
+// events. The processed LSN is only advanced once all prior events
+// were confirmed by the sink, independently of the order in which
+// asynchronous sinks confirm the delivery. A failed delivery stays
+// pending and holds back the processed LSN until replication restarts.
+type acknowledgementTracker struct {
+	replicationContext replicationcontext.ReplicationContext
+
+	mutex   sync.Mutex
+	pending *list.List
+}
+
+func newAcknowledgementTracker(
+	replicationContext replicationcontext.ReplicationContext,
+) *acknowledgementTracker {
+
+	return &acknowledgementTracker{
+		replicationContext: replicationContext,
+		mutex:              sync.Mutex{},
+		pending:            list.New(),
+	}
+}
+
+// track registers a new pending acknowledgement which needs to be
+// completed
+func (at *acknowledgementTracker) track(
+	xld pgtypes.XLogData,
+) *list.Element {
+
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+	return at.pending.PushBack(&pendingAcknowledgement{xld: xld})
+}
+
+// acknowledge acknowledges the given position as soon as all
+// prior pending acknowledgements are confirmed
+func (at *acknowledgementTracker) acknowledge(
+	xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+) error {
+
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+	at.pending.PushBack(&pendingAcknowledgement{xld: xld, processedLSN: processedLSN, done: true})
+	return at.drain()
+}
+
+// complete marks a pending acknowledgement as confirmed by the sink
+func (at *acknowledgementTracker) complete(
+	element *list.Element,
+) error {
+
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+	element.Value.(*pendingAcknowledgement).done = true
+	return at.drain()
+}
+
+func (at *acknowledgementTracker) drain() error {
+	for element := at.pending.Front(); element != nil; element = at.pending.Front() {
+		pending := element.Value.(*pendingAcknowledgement)
+		if !pending.done {
+			return nil
+		}
+		at.pending.Remove(element)
+		if err := at.replicationContext.AcknowledgeProcessed(pending.xld, pending.processedLSN); err != nil {
+			return errors.Wrap(err, 0)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package eventemitting
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type recordingReplicationContext struct {
+	replicationcontext.ReplicationContext
+	acknowledged []pgtypes.LSN
+}
+
+func (r *recordingReplicationContext) AcknowledgeProcessed(
+	xld pgtypes.XLogData, processedLSN *pgtypes.LSN,
+) error {
+
+	lsn := pgtypes.LSN(xld.WALStart)
+	if processedLSN != nil {
+		lsn = *processedLSN
+	}
+	r.acknowledged = append(r.acknowledged, lsn)
+	return nil
+}
+
+func Test_Acknowledgement_Tracker_Delivery_Order(
+	t *testing.T,
+) {
+
+	replicationContext := &recordingReplicationContext{}
+	tracker := newAcknowledgementTracker(replicationContext)
+
+	first := tracker.track(xldAt(10))
+	second := tracker.track(xldAt(20))
+
+	// Transaction end must wait for all pending events
+	assert.NoError(t, tracker.acknowledge(xldAt(20), lsnPtr(30)))
+	assert.Empty(t, replicationContext.acknowledged)
+
+	// Out of order confirmation doesn't advance the LSN
+	assert.NoError(t, tracker.complete(second))
+	assert.Empty(t, replicationContext.acknowledged)
+
+	assert.NoError(t, tracker.complete(first))
+	assert.Equal(t, []pgtypes.LSN{10, 20, 30}, replicationContext.acknowledged)
+}
+
+func Test_Acknowledgement_Tracker_Failed_Delivery(
+	t *testing.T,
+) {
+
+	replicationContext := &recordingReplicationContext{}
+	tracker := newAcknowledgementTracker(replicationContext)
+
+	// The first event failed and is never completed
+	tracker.track(xldAt(10))
+	second := tracker.track(xldAt(20))
+	assert.NoError(t, tracker.complete(second))
+
+	// Events and transactions finished later are held back as well
+	assert.NoError(t, tracker.acknowledge(xldAt(30), lsnPtr(40)))
+	assert.Empty(t, replicationContext.acknowledged)
+}
+
+func xldAt(
+	lsn pgtypes.LSN,
+) pgtypes.XLogData {
+
+	return pgtypes.XLogData{
+		XLogData: pglogrepl.XLogData{
+			WALStart: pglogrepl.LSN(lsn),
+		},
+	}
+}
+
+func lsnPtr(
+	lsn pgtypes.LSN,
+) *pgtypes.LSN {
+
+	return &lsn
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
 	"github.com/noctarius/timescaledb-event-streamer/spi/task"
 	"github.com/samber/lo"
+	"sync/atomic"
 	"time"
 )
 
@@ -67,6 +68,12 @@ type EventEmitter struct {
 	statsReporter      *stats.Reporter
 	backOff            backoff.BackOff
 	logger             *logging.Logger
+	acknowledgements   *acknowledgementTracker
+	failed             atomic.Bool
+	failure            chan error
+
+	genHypertableSchemaEvent bool
+	genPostgresqlSchemaEvent bool
 
 	stats *eventEmitterStats
 }
@@ -82,7 +89,20 @@ func NewEventEmitterFromConfig(
 		return nil, err
 	}
 
-	return NewEventEmitter(replicationContext, streamManager, typeManager, taskManager, statsService, filters)
+	eventEmitter, err := NewEventEmitter(
+		replicationContext, streamManager, typeManager, taskManager, statsService, filters,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	eventEmitter.genHypertableSchemaEvent = config.GetOrDefault(
+		c, config.PropertyHypertableEventsSchema, false,
+	)
+	eventEmitter.genPostgresqlSchemaEvent = config.GetOrDefault(
+		c, config.PropertyPostgresqlEventsSchema, false,
+	)
+	return eventEmitter, nil
 }
 
 func NewEventEmitter(
@@ -105,6 +125,8 @@ func NewEventEmitter(
 		logger:             logger,
 		statsReporter:      statsService.NewReporter("streamer_eventemitter"),
 		backOff:            backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 8),
+		acknowledgements:   newAcknowledgementTracker(replicationContext),
+		failure:            make(chan error, 1),
 		stats:              &eventEmitterStats{},
 	}, nil
 }
@@ -115,7 +137,29 @@ func (ee *EventEmitter) PostConstruct() error {
 }
 
 func (ee *EventEmitter) Start() error {
-	return ee.streamManager.Start()
+	if err := ee.streamManager.Start(); err != nil {
+		return err
+	}
+
+	// Transactional sinks store the last committed LSN themselves, which
+	// may be ahead of the state storage if the streamer crashed before
+	// the state storage was persisted
+	committedLSN, present, err := ee.streamManager.CommittedLSN()
+	if err != nil {
+		return err
+	}
+	if present {
+		ee.logger.Infof("Resuming from sink committed LSN %s", committedLSN)
+		xld := pgtypes.XLogData{
+			XLogData: pglogrepl.XLogData{
+				WALStart:     pglogrepl.LSN(committedLSN),
+				ServerWALEnd: pglogrepl.LSN(committedLSN),
+				ServerTime:   time.Now(),
+			},
+		}
+		return ee.replicationContext.AcknowledgeProcessed(xld, &committedLSN)
+	}
+	return nil
 }
 
 func (ee *EventEmitter) Stop() error {
@@ -126,6 +170,13 @@ func (ee *EventEmitter) Stop1() error {
 	return ee.streamManager.Stop()
 }
 
+// Failure returns a channel which receives the error of the first event
+// the sink failed to deliver. No further events are emitted afterwards,
+// and replication needs to be restarted from the last processed LSN.
+func (ee *EventEmitter) Failure() <-chan error {
+	return ee.failure
+}
+
 func (ee *EventEmitter) NewEventHandler() eventhandlers.BaseReplicationEventHandler {
 	return &eventEmitterEventHandler{
 		eventEmitter: ee,
@@ -137,20 +188,37 @@ func (ee *EventEmitter) emit(
 	xld pgtypes.XLogData, stream stream.Stream, key, value schema.Struct,
 ) error {
 
+	if err := ee.ensureNotFailed(); err != nil {
+		return err
+	}
+
 	// Start time
 	start := time.Now()
 	retries := uint(0)
 
+	// The event is acknowledged as soon as the sink confirmed it
+	// and all previously emitted events are acknowledged
+	pending := ee.acknowledgements.track(xld)
+
 	// Retryable operation
 	operation := func() error {
 		ee.logger.Tracef("Publishing event: %+v", value)
-		return stream.Emit(key, value)
+		return stream.EmitAsync(key, value, func(err error) {
+			if err != nil {
+				ee.fail(err)
+				return
+			}
+			if err := ee.acknowledgements.complete(pending); err != nil {
+				ee.logger.Errorf("Failed to acknowledge processed events: %+v", err)
+			}
+		})
 	}
 
 	// Run with backoff (it'll automatically reset before starting)
 	if err := backoff.RetryNotify(operation, ee.backOff, func(_ error, _ time.Duration) {
 		retries++
 	}); err != nil {
+		ee.fail(err)
 		return err
 	}
 
@@ -160,12 +228,36 @@ func (ee *EventEmitter) emit(
 	ee.stats.calls.retry = retries
 	ee.statsReporter.Report(ee.stats)
 
-	return ee.replicationContext.AcknowledgeProcessed(xld, nil)
+	return nil
+}
+
+// fail stops the emission of events after the sink failed to deliver
+// an event. Sinks retry transient errors themselves, and emitting the
+// event again would put it behind later events of the same key. The
+// failed event stays pending, which holds back the processed LSN, so
+// a restarted replication resumes with the failed event.
+func (ee *EventEmitter) fail(
+	cause error,
+) {
+
+	if ee.failed.CompareAndSwap(false, true) {
+		ee.logger.Errorf("Failed to deliver event, stopping replication: %+v", cause)
+		ee.failure <- errors.Errorf("failed to deliver event: %s", cause.Error())
+	}
+}
+
+func (ee *EventEmitter) ensureNotFailed() error {
+	if ee.failed.Load() {
+		return errors.Errorf("event not emitted, a previous event failed to be delivered")
+	}
+	return nil
 }
 
 type eventEmitterEventHandler struct {
 	eventEmitter *EventEmitter
 	typeManager  pgtypes.TypeManager
+	walStart     pglogrepl.LSN
+	ordinal      int
 }
 
 func (e *eventEmitterEventHandler) OnReadEvent(
@@ -315,6 +407,63 @@ func (e *eventEmitterEventHandler) OnChunkDecompressedEvent(
 	)
 }
 
+func (e *eventEmitterEventHandler) OnSchemaChangedEvent(
+	xld pgtypes.XLogData, table schema.TableAlike, version uint32,
+	oldColumns, newColumns []systemcatalog.Column, statements []string,
+) error {
+
+	// Cached streams carry the old table schema, make sure they're recreated
+	e.eventEmitter.streamManager.InvalidateStream(table)
+
+	if !e.schemaEventsEnabled(table) {
+		return nil
+	}
+
+	selectedStream := e.eventEmitter.streamManager.GetOrCreateSchemaStream(table)
+
+	keyStruct, err := selectedStream.Key(nil)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	source := schema.Source(
+		xld.ServerWALEnd, e.sequence(xld), xld.ServerTime, false, xld.DatabaseName,
+		table.SchemaName(), table.TableName(), &xld.Xid,
+	)
+
+	payloadStruct := schema.SchemaChangeEvent(
+		version, schemaChangeColumns(oldColumns), schemaChangeColumns(newColumns), statements, source,
+	)
+
+	key := schema.Envelope(selectedStream.KeySchema(), keyStruct)
+	value := schema.Envelope(selectedStream.PayloadSchema(), payloadStruct)
+
+	success, err := e.eventEmitter.filter.Evaluate(table, key, value)
+	if err != nil {
+		return err
+	}
+
+	// If unsuccessful we'll discard the event and not send it to the sink
+	if !success {
+		return e.eventEmitter.acknowledgements.acknowledge(xld, nil)
+	}
+
+	return e.eventEmitter.emit(xld, selectedStream, key, value)
+}
+
+func (e *eventEmitterEventHandler) schemaEventsEnabled(
+	table schema.TableAlike,
+) bool {
+
+	switch table.(type) {
+	case *systemcatalog.Hypertable:
+		return e.eventEmitter.genHypertableSchemaEvent
+	case *systemcatalog.PgTable:
+		return e.eventEmitter.genPostgresqlSchemaEvent
+	}
+	return false
+}
+
 func (e *eventEmitterEventHandler) OnRelationEvent(
 	_ pgtypes.XLogData, _ *pgtypes.RelationMessage,
 ) error {
@@ -322,9 +471,13 @@ func (e *eventEmitterEventHandler) OnRelationEvent(
 }
 
 func (e *eventEmitterEventHandler) OnBeginEvent(
-	_ pgtypes.XLogData, _ *pgtypes.BeginMessage,
+	_ pgtypes.XLogData, msg *pgtypes.BeginMessage,
 ) error {
-	return nil
+
+	if err := e.eventEmitter.ensureNotFailed(); err != nil {
+		return err
+	}
+	return e.eventEmitter.streamManager.BeginTransaction(msg.Xid, pgtypes.LSN(msg.FinalLSN))
 }
 
 func (e *eventEmitterEventHandler) OnCommitEvent(
@@ -349,11 +502,39 @@ func (e *eventEmitterEventHandler) OnTransactionFinishedEvent(
 	xld pgtypes.XLogData, msg *pgtypes.CommitMessage,
 ) error {
 
+	// Committing the transaction would commit it without the failed event
+	if err := e.eventEmitter.ensureNotFailed(); err != nil {
+		return err
+	}
+
 	e.eventEmitter.logger.Debugf(
 		"Transaction xid=%d (LSN: %s) marked as processed", xld.Xid, msg.TransactionEndLSN,
 	)
 	transactionEndLSN := pgtypes.LSN(msg.TransactionEndLSN)
-	return e.eventEmitter.replicationContext.AcknowledgeProcessed(xld, &transactionEndLSN)
+	if err := e.eventEmitter.streamManager.CommitTransaction(transactionEndLSN); err != nil {
+		return err
+	}
+	return e.eventEmitter.acknowledgements.acknowledge(xld, &transactionEndLSN)
+}
+
+// sequence returns the unique position of an event in the WAL, the
+// start of the change's WAL record and the ordinal of the event among
+// the events of the record. Changes of a transaction (e.g. two updates
+// of the same row) are distinguished by their WAL record, while events
+// sharing a record, like snapshot reads, are distinguished by the
+// ordinal. Since the ordinal restarts with every record, events get
+// the same sequence when replication resumes inside a transaction.
+func (e *eventEmitterEventHandler) sequence(
+	xld pgtypes.XLogData,
+) string {
+
+	if xld.WALStart != e.walStart {
+		e.walStart = xld.WALStart
+		e.ordinal = 0
+	} else {
+		e.ordinal++
+	}
+	return fmt.Sprintf("%s-%d", xld.WALStart, e.ordinal)
 }
 
 func (e *eventEmitterEventHandler) emit(
@@ -380,7 +561,7 @@ func (e *eventEmitterEventHandler) emit0(
 	}
 
 	source := schema.Source(
-		xld.ServerWALEnd, xld.ServerTime, snapshot, xld.DatabaseName,
+		xld.ServerWALEnd, e.sequence(xld), xld.ServerTime, snapshot, xld.DatabaseName,
 		hypertable.SchemaName(), hypertable.TableName(), &xld.Xid,
 	)
 
@@ -399,7 +580,7 @@ func (e *eventEmitterEventHandler) emit0(
 
 	// If unsuccessful we'll discard the event and not send it to the sink
 	if !success {
-		return e.eventEmitter.replicationContext.AcknowledgeProcessed(xld, nil)
+		return e.eventEmitter.acknowledgements.acknowledge(xld, nil)
 	}
 
 	return e.eventEmitter.emit(xld, selectedStream, key, value)
@@ -427,7 +608,7 @@ func (e *eventEmitterEventHandler) emitMessageEvent(
 	}
 
 	source := schema.Source(
-		xld.ServerWALEnd, timestamp, false, xld.DatabaseName, "", "", transactionId,
+		xld.ServerWALEnd, e.sequence(xld), timestamp, false, xld.DatabaseName, "", "", transactionId,
 	)
 
 	keyStruct, err := selectedStream.Key(map[string]any{"prefix": msg.Prefix})
@@ -488,3 +669,17 @@ func (e *eventEmitterEventHandler) convertColumnValues(
 	}
 	return result, nil
 }
+
+func schemaChangeColumns(
+	columns []systemcatalog.Column,
+) []schema.Struct {
+
+	result := make([]schema.Struct, 0, len(columns))
+	for _, column := range columns {
+		result = append(result, schema.SchemaChangeColumn(
+			column.Name(), column.TypeDefinition(), column.DataType(), column.IsNullable(),
+			column.IsPrimaryKey(), column.IsDimension(), column.DefaultValue(),
+		))
+	}
+	return result
+}
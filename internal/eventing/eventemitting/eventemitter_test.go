@@ -0,0 +1,119 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package eventemitting
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/stats"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/stream"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type recordingStream struct {
+	stream.Stream
+	acks []sink.AcknowledgeFunc
+}
+
+func (r *recordingStream) EmitAsync(
+	_, _ schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	r.acks = append(r.acks, ack)
+	return nil
+}
+
+func Test_Event_Emitter_Stops_After_Failed_Delivery(
+	t *testing.T,
+) {
+
+	replicationContext := &recordingReplicationContext{}
+	eventEmitter := newTestEventEmitter(t, replicationContext)
+
+	s := &recordingStream{}
+	assert.NoError(t, eventEmitter.emit(xldAt(10), s, nil, nil))
+	assert.NoError(t, eventEmitter.emit(xldAt(20), s, nil, nil))
+
+	// The failed event isn't emitted again and holds back the processed LSN
+	s.acks[0](assert.AnError)
+	s.acks[1](nil)
+	assert.Len(t, s.acks, 2)
+	assert.Empty(t, replicationContext.acknowledged)
+	assert.Error(t, <-eventEmitter.Failure())
+
+	// Later events aren't emitted anymore
+	assert.Error(t, eventEmitter.emit(xldAt(30), s, nil, nil))
+	assert.Len(t, s.acks, 2)
+	assert.Empty(t, replicationContext.acknowledged)
+}
+
+func Test_Event_Emitter_Sequence(
+	t *testing.T,
+) {
+
+	handler := &eventEmitterEventHandler{}
+	xld := func(walStart pglogrepl.LSN) pgtypes.XLogData {
+		return pgtypes.XLogData{
+			XLogData: pglogrepl.XLogData{
+				WALStart:     walStart,
+				ServerWALEnd: pglogrepl.LSN(0x16B3900),
+			},
+		}
+	}
+
+	// Two updates of the same row in one transaction
+	assert.Equal(t, "0/16B3790-0", handler.sequence(xld(0x16B3790)))
+	assert.Equal(t, "0/16B3810-0", handler.sequence(xld(0x16B3810)))
+
+	// Events sharing the same WAL record, e.g. snapshot reads
+	assert.Equal(t, "0/16B3900-0", handler.sequence(xld(0x16B3900)))
+	assert.Equal(t, "0/16B3900-1", handler.sequence(xld(0x16B3900)))
+}
+
+func newTestEventEmitter(
+	t *testing.T, replicationContext *recordingReplicationContext,
+) *EventEmitter {
+
+	logger, err := logging.NewLogger("EventEmitter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statsService := stats.NewStatsService(&config.Config{
+		Stats: config.StatsConfig{
+			Enabled: lo.ToPtr(false),
+			Runtime: config.RuntimeStatsConfig{Enabled: lo.ToPtr(false)},
+		},
+	})
+
+	return &EventEmitter{
+		replicationContext: replicationContext,
+		logger:             logger,
+		statsReporter:      statsService.NewReporter("streamer_eventemitter"),
+		backOff:            &backoff.StopBackOff{},
+		acknowledgements:   newAcknowledgementTracker(replicationContext),
+		failure:            make(chan error, 1),
+		stats:              &eventEmitterStats{},
+	}
+}
@@ -29,16 +29,16 @@ import (
 
 type EventFilter interface {
 	Evaluate(
-		table schema.TableAlike, key, value schema.Struct,
+		table systemcatalog.SystemEntity, key, value schema.Struct,
 	) (bool, error)
 }
 
 type eventFilterFunc func(
-	table schema.TableAlike, key, value schema.Struct,
+	table systemcatalog.SystemEntity, key, value schema.Struct,
 ) (bool, error)
 
 func (eff eventFilterFunc) Evaluate(
-	table schema.TableAlike, key, value schema.Struct,
+	table systemcatalog.SystemEntity, key, value schema.Struct,
 ) (bool, error) {
 
 	return eff(table, key, value)
@@ -86,7 +86,7 @@ func NewEventFilter(
 }
 
 var acceptAllFilter eventFilterFunc = func(
-	_ schema.TableAlike, _, _ schema.Struct,
+	_ systemcatalog.SystemEntity, _, _ schema.Struct,
 ) (bool, error) {
 
 	return true, nil
@@ -98,7 +98,7 @@ var compositeFilter = func(
 
 	return eventFilterFunc(
 		func(
-			table schema.TableAlike, key, value schema.Struct,
+			table systemcatalog.SystemEntity, key, value schema.Struct,
 		) (bool, error) {
 
 			for i, tableFilter := range tableFilters {
@@ -128,11 +128,17 @@ func (f *eventFilter) evaluate(
 	key, value schema.Struct,
 ) (bool, error) {
 
+	// Events without a key (e.g. truncate events) have no key payload
+	keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct)
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	valuePayload, _ := value[schema.FieldNamePayload].(schema.Struct)
+	valueSchema, _ := value[schema.FieldNameSchema].(schema.Struct)
+
 	env := map[string]schema.Struct{
-		"key":         key[schema.FieldNamePayload].(schema.Struct),
-		"keySchema":   key[schema.FieldNameSchema].(schema.Struct),
-		"value":       value[schema.FieldNamePayload].(schema.Struct),
-		"valueSchema": value[schema.FieldNameSchema].(schema.Struct),
+		"key":         keyPayload,
+		"keySchema":   keySchema,
+		"value":       valuePayload,
+		"valueSchema": valueSchema,
 	}
 
 	result, err := f.vm.Run(f.prog, env)
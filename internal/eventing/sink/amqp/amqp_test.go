@@ -0,0 +1,65 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package amqp
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Amqp_Publishing(
+	t *testing.T,
+) {
+
+	txId := uint32(42)
+	envelope := schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: "c",
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: "public",
+			schema.FieldNameTable:  "metrics",
+			schema.FieldNameLSN:    "0/16B3748",
+			schema.FieldNameTxId:   &txId,
+		},
+	})
+
+	timestamp := time.Date(2023, 3, 25, 0, 0, 0, 0, time.UTC)
+	a := &amqpSink{deliveryMode: amqp091.Persistent}
+	publishing := a.newPublishing(timestamp, []byte(`{"id":1}`), []byte(`{}`), envelope)
+
+	assert.Equal(t, amqp091.Persistent, publishing.DeliveryMode)
+	assert.Equal(t, timestamp, publishing.Timestamp)
+	assert.Equal(t, []byte(`{}`), publishing.Body)
+	assert.Equal(t, amqp091.Table{
+		headerKey:         []byte(`{"id":1}`),
+		headerOperation:   "c",
+		headerSourceTable: "public.metrics",
+		headerSourceLSN:   "0/16B3748",
+		headerSourceTxId:  "42",
+	}, publishing.Headers)
+	assert.NoError(t, publishing.Headers.Validate())
+
+	// Events without a key or source information only carry what is available
+	a = &amqpSink{deliveryMode: amqp091.Transient}
+	publishing = a.newPublishing(timestamp, nil, []byte(`{}`), schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: "t",
+	}))
+	assert.Equal(t, amqp091.Transient, publishing.DeliveryMode)
+	assert.Equal(t, amqp091.Table{headerOperation: "t"}, publishing.Headers)
+}
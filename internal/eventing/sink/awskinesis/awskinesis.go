@@ -20,10 +20,18 @@ package awskinesis
 import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/cenkalti/backoff/v4"
 	"github.com/go-errors/errors"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/batching"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/objectstore"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/oversize"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/partitioning"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
@@ -32,14 +40,25 @@ import (
 	"time"
 )
 
+const (
+	// Limits of a PutRecords request
+	maxBatchRecords    = 500
+	maxBatchBytes      = 5 * 1024 * 1024
+	maxRecordBytes     = 1024 * 1024
+	maxPartitionKeyLen = 256
+)
+
 func init() {
 	sinkimpl.RegisterSink(config.AwsKinesis, newAwsKinesisSink)
 }
 
 type awsKinesisSink struct {
-	streamName *string
-	awsKinesis *kinesis.Kinesis
-	encoder    *encoding.JsonEncoder
+	streamName  *string
+	awsKinesis  kinesisiface.KinesisAPI
+	encoder     encoding.Encoder
+	partitioner partitioning.Partitioner
+	oversize    *oversize.Handler
+	batcher     *batching.Batcher[*kinesis.PutRecordsRequestEntry]
 }
 
 func newAwsKinesisSink(
@@ -114,38 +133,183 @@ func newAwsKinesisSink(
 		}
 	}
 
-	return &awsKinesisSink{
-		streamName: streamName,
-		awsKinesis: awsKinesis,
-		encoder:    encoding.NewJsonEncoderWithConfig(c),
-	}, nil
+	return newAwsKinesisSinkWithClient(c, streamName, awsKinesis)
+}
+
+func newAwsKinesisSinkWithClient(
+	c *config.Config, streamName *string, awsKinesis kinesisiface.KinesisAPI,
+) (*awsKinesisSink, error) {
+
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	partitioner, err := partitioning.NewPartitioner(c,
+		config.PropertyKinesisPartitioningStrategy,
+		config.PropertyKinesisPartitioningColumns,
+		config.PropertyKinesisPartitioningExpression,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := config.GetOrDefault(c, config.PropertyKinesisBatchSize, maxBatchRecords)
+	if batchSize < 1 || batchSize > maxBatchRecords {
+		return nil, errors.Errorf("AWS Kinesis sink batch size must be between 1 and %d", maxBatchRecords)
+	}
+
+	logger, err := logging.NewLogger("AwsKinesisSink")
+	if err != nil {
+		return nil, err
+	}
+
+	oversizeHandler, err := oversize.NewHandler(c, config.PropertyKinesisOversizeStrategy, objectstore.Properties{
+		Path:               config.PropertyKinesisOversizePath,
+		Bucket:             config.PropertyKinesisOversizeS3Bucket,
+		AwsRegion:          config.PropertyKinesisOversizeS3AwsRegion,
+		AwsEndpoint:        config.PropertyKinesisOversizeS3AwsEndpoint,
+		AwsAccessKeyId:     config.PropertyKinesisOversizeS3AwsAccessKeyId,
+		AwsSecretAccessKey: config.PropertyKinesisOversizeS3AwsSecretAccessKey,
+		AwsSessionToken:    config.PropertyKinesisOversizeS3AwsSessionToken,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &awsKinesisSink{
+		streamName:  streamName,
+		awsKinesis:  awsKinesis,
+		encoder:     encoder,
+		partitioner: partitioner,
+		oversize:    oversizeHandler,
+	}
+
+	// PutRecords doesn't guarantee the order of records inside a single
+	// request, and failed records are retried after the successful ones
+	// were written, hence a batch carries at most one record per partition key
+	a.batcher = batching.NewBatcher(batching.Options{
+		MaxRecords: batchSize,
+		MaxBytes:   maxBatchBytes,
+		Linger: time.Duration(config.GetOrDefault(
+			c, config.PropertyKinesisBatchLinger, 100,
+		)) * time.Millisecond,
+		DistinctKeys: true,
+		BackOff: batching.ExponentialBackOff(
+			config.GetOrDefault(c, config.PropertyKinesisRetriesMax, 5),
+			time.Duration(config.GetOrDefault(
+				c, config.PropertyKinesisRetriesBackoffMin, 100,
+			))*time.Millisecond,
+			time.Duration(config.GetOrDefault(
+				c, config.PropertyKinesisRetriesBackoffMax, 10000,
+			))*time.Millisecond,
+		),
+	}, a.putRecords, logger)
+	return a, nil
 }
 
 func (a *awsKinesisSink) Start() error {
+	a.batcher.Start()
 	return nil
 }
 
 func (a *awsKinesisSink) Stop() error {
+	a.batcher.Stop()
 	return nil
 }
 
 func (a *awsKinesisSink) Emit(
-	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	done := make(chan error, 1)
+	if err := a.EmitAsync(context, timestamp, topicName, key, envelope, func(err error) {
+		done <- err
+	}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+func (a *awsKinesisSink) EmitAsync(
+	_ sink.Context, _ time.Time, topicName string,
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
 ) error {
 
-	envelopeData, err := a.encoder.Marshal(envelope)
+	envelopeData, err := a.encoder.EncodeEnvelope(topicName, envelope)
 	if err != nil {
 		return err
 	}
 
-	_, err = a.awsKinesis.PutRecord(&kinesis.PutRecordInput{
-		StreamName:   a.streamName,
-		PartitionKey: aws.String(topicName),
-		Data:         envelopeData,
-	})
+	partitionKey, err := a.partitioner(topicName, key, envelope)
 	if err != nil {
 		return err
 	}
+	partitionKey = partitioning.Constrain(partitionKey, maxPartitionKeyLen, nil)
 
-	return nil
+	// The partition key counts towards the record size limit
+	if limit := maxRecordBytes - len(partitionKey); len(envelopeData) > limit {
+		payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+		source, _ := payload[schema.FieldNameSource].(schema.Struct)
+		lsn, _ := source[schema.FieldNameLSN].(string)
+
+		if envelopeData, err = a.oversize.Handle(topicName, lsn, envelopeData, limit); err != nil {
+			return err
+		}
+		if envelopeData == nil {
+			ack(nil)
+			return nil
+		}
+	}
+
+	return a.batcher.Add(&batching.Record[*kinesis.PutRecordsRequestEntry]{
+		Value: &kinesis.PutRecordsRequestEntry{
+			PartitionKey: aws.String(partitionKey),
+			Data:         envelopeData,
+		},
+		Size:         len(envelopeData) + len(partitionKey),
+		PartitionKey: partitionKey,
+		Ack:          ack,
+	})
+}
+
+func (a *awsKinesisSink) putRecords(
+	batch []*batching.Record[*kinesis.PutRecordsRequestEntry],
+) ([]batching.Failure[*kinesis.PutRecordsRequestEntry], error) {
+
+	entries := make([]*kinesis.PutRecordsRequestEntry, 0, len(batch))
+	for _, record := range batch {
+		entries = append(entries, record.Value)
+	}
+
+	output, err := a.awsKinesis.PutRecords(&kinesis.PutRecordsInput{
+		StreamName: a.streamName,
+		Records:    entries,
+	})
+	if err != nil {
+		if request.IsErrorRetryable(err) || request.IsErrorThrottle(err) {
+			return nil, err
+		}
+		return nil, backoff.Permanent(err)
+	}
+
+	if aws.Int64Value(output.FailedRecordCount) == 0 {
+		return nil, nil
+	}
+
+	// Failed records (throttled or internal failures) are
+	// returned in the same position as in the request
+	failed := make([]batching.Failure[*kinesis.PutRecordsRequestEntry], 0)
+	for i, result := range output.Records {
+		if result.ErrorCode != nil {
+			failed = append(failed, batching.Failure[*kinesis.PutRecordsRequestEntry]{
+				Record: batch[i],
+				Err: errors.Errorf(
+					"AWS Kinesis rejected record: %s (%s)",
+					aws.StringValue(result.ErrorCode), aws.StringValue(result.ErrorMessage),
+				),
+			})
+		}
+	}
+	return failed, nil
 }
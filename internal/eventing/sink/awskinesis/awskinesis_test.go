@@ -18,10 +18,18 @@
 package awskinesis
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
 	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func IGNORE_Test_AWS_Kinesis_Config_Loading(
@@ -57,12 +65,162 @@ func IGNORE_Test_AWS_Kinesis_Config_Loading(
 	awsSink := sink.(*awsKinesisSink)
 	assert.Equal(t, "stream_name", *awsSink.streamName)
 
-	credentials, err := awsSink.awsKinesis.Config.Credentials.Get()
+	awsKinesis := awsSink.awsKinesis.(*kinesis.Kinesis)
+	credentials, err := awsKinesis.Config.Credentials.Get()
 	if err != nil {
 		t.Error(err)
 	}
-	assert.Equal(t, "aws_region", *awsSink.awsKinesis.Config.Region)
+	assert.Equal(t, "aws_region", *awsKinesis.Config.Region)
 	assert.Equal(t, "aws_access_key_id", credentials.AccessKeyID)
 	assert.Equal(t, "aws_secret_access_key", credentials.SecretAccessKey)
 	assert.Equal(t, "aws_session_token", credentials.SessionToken)
 }
+
+type testKinesis struct {
+	kinesisiface.KinesisAPI
+	requests [][]string
+}
+
+func (k *testKinesis) PutRecords(
+	input *kinesis.PutRecordsInput,
+) (*kinesis.PutRecordsOutput, error) {
+
+	data := make([]string, 0, len(input.Records))
+	results := make([]*kinesis.PutRecordsResultEntry, 0, len(input.Records))
+	failed := int64(0)
+	for i, record := range input.Records {
+		data = append(data, string(record.Data))
+		// The second record of the first request is throttled
+		if len(k.requests) == 0 && i == 1 {
+			failed++
+			results = append(results, &kinesis.PutRecordsResultEntry{
+				ErrorCode:    aws.String(kinesis.ErrCodeProvisionedThroughputExceededException),
+				ErrorMessage: aws.String("Rate exceeded"),
+			})
+			continue
+		}
+		results = append(results, &kinesis.PutRecordsResultEntry{
+			SequenceNumber: aws.String(strconv.Itoa(i)),
+			ShardId:        aws.String("shardId-000000000000"),
+		})
+	}
+	k.requests = append(k.requests, data)
+
+	return &kinesis.PutRecordsOutput{
+		FailedRecordCount: aws.Int64(failed),
+		Records:           results,
+	}, nil
+}
+
+func testEnvelope(
+	value string,
+) schema.Struct {
+
+	return schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: "c",
+		schema.FieldNameAfter: schema.Struct{
+			"value": value,
+		},
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameLSN: "0/16B3748",
+		},
+	})
+}
+
+func Test_AWS_Kinesis_Partial_Failure_Retry(
+	t *testing.T,
+) {
+
+	client := &testKinesis{}
+	awsSink, err := newAwsKinesisSinkWithClient(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.AwsKinesis,
+			AwsKinesis: spiconfig.AwsKinesisConfig{
+				Partitioning: spiconfig.PartitioningConfig{
+					Strategy: spiconfig.ColumnPartitioning,
+					Columns:  []string{"value"},
+				},
+				Batch: spiconfig.AwsBatchConfig{
+					Linger: 3600000,
+				},
+				Retries: spiconfig.AwsRetryConfig{
+					Backoff: spiconfig.AwsRetryBackoffConfig{
+						Min: 1,
+						Max: 1,
+					},
+				},
+			},
+		},
+	}, aws.String("stream"), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := awsSink.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	acks := 0
+	for _, value := range []string{"a", "b", "c"} {
+		if err := awsSink.EmitAsync(nil, time.Now(), "topic", nil, testEnvelope(value), func(err error) {
+			assert.NoError(t, err)
+			acks++
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := awsSink.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, acks)
+	assert.Len(t, client.requests, 2)
+	assert.Len(t, client.requests[0], 3)
+	assert.Len(t, client.requests[1], 1)
+	assert.Contains(t, client.requests[1][0], `"value":"b"`)
+}
+
+func Test_AWS_Kinesis_Oversize_Dead_Letter(
+	t *testing.T,
+) {
+
+	directory := t.TempDir()
+	client := &testKinesis{}
+	awsSink, err := newAwsKinesisSinkWithClient(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.AwsKinesis,
+			AwsKinesis: spiconfig.AwsKinesisConfig{
+				Oversize: spiconfig.AwsOversizeConfig{
+					Strategy: spiconfig.OversizeDeadLetter,
+					Path:     directory,
+				},
+			},
+		},
+	}, aws.String("stream"), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := awsSink.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	acked := false
+	envelope := testEnvelope(strings.Repeat("x", maxRecordBytes))
+	if err := awsSink.EmitAsync(nil, time.Now(), "topic", nil, envelope, func(err error) {
+		assert.NoError(t, err)
+		acked = true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := awsSink.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, acked)
+	assert.Empty(t, client.requests)
+
+	files, err := filepath.Glob(filepath.Join(directory, "topic", "0-16B3748-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, files, 1)
+}
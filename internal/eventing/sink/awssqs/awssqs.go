@@ -22,25 +22,45 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/cenkalti/backoff/v4"
 	"github.com/go-errors/errors"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/batching"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/objectstore"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/oversize"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/partitioning"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strconv"
 	"time"
 )
 
+const (
+	// Limits of a SendMessageBatch request
+	maxBatchRecords   = 10
+	maxBatchBytes     = 256 * 1024
+	maxMessageBytes   = 256 * 1024
+	maxMessageGroupId = 128
+)
+
 func init() {
 	sinkimpl.RegisterSink(config.AwsSQS, newAwsSqsSink)
 }
 
 type awsSqsSink struct {
-	queueUrl *string
-	awsSqs   *sqs.SQS
-	encoder  *encoding.JsonEncoder
+	queueUrl    *string
+	awsSqs      sqsiface.SQSAPI
+	encoder     encoding.Encoder
+	partitioner partitioning.Partitioner
+	oversize    *oversize.Handler
+	batcher     *batching.Batcher[*sqs.SendMessageBatchRequestEntry]
 }
 
 func newAwsSqsSink(
@@ -74,26 +94,110 @@ func newAwsSqsSink(
 		return nil, err
 	}
 
-	return &awsSqsSink{
-		queueUrl: queueUrl,
-		awsSqs:   sqs.New(awsSession),
-		encoder:  encoding.NewJsonEncoderWithConfig(c),
-	}, nil
+	return newAwsSqsSinkWithClient(c, queueUrl, sqs.New(awsSession))
+}
+
+func newAwsSqsSinkWithClient(
+	c *config.Config, queueUrl *string, awsSqs sqsiface.SQSAPI,
+) (*awsSqsSink, error) {
+
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	partitioner, err := partitioning.NewPartitioner(c,
+		config.PropertySqsPartitioningStrategy,
+		config.PropertySqsPartitioningColumns,
+		config.PropertySqsPartitioningExpression,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := config.GetOrDefault(c, config.PropertySqsBatchSize, maxBatchRecords)
+	if batchSize < 1 || batchSize > maxBatchRecords {
+		return nil, errors.Errorf("AWS SQS sink batch size must be between 1 and %d", maxBatchRecords)
+	}
+
+	logger, err := logging.NewLogger("AwsSqsSink")
+	if err != nil {
+		return nil, err
+	}
+
+	oversizeHandler, err := oversize.NewHandler(c, config.PropertySqsOversizeStrategy, objectstore.Properties{
+		Path:               config.PropertySqsOversizePath,
+		Bucket:             config.PropertySqsOversizeS3Bucket,
+		AwsRegion:          config.PropertySqsOversizeS3AwsRegion,
+		AwsEndpoint:        config.PropertySqsOversizeS3AwsEndpoint,
+		AwsAccessKeyId:     config.PropertySqsOversizeS3AwsAccessKeyId,
+		AwsSecretAccessKey: config.PropertySqsOversizeS3AwsSecretAccessKey,
+		AwsSessionToken:    config.PropertySqsOversizeS3AwsSessionToken,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &awsSqsSink{
+		queueUrl:    queueUrl,
+		awsSqs:      awsSqs,
+		encoder:     encoder,
+		partitioner: partitioner,
+		oversize:    oversizeHandler,
+	}
+
+	// Failed messages are retried after the successful ones of the same
+	// batch were enqueued, hence a batch carries at most one message per
+	// message group to keep the order inside a message group
+	a.batcher = batching.NewBatcher(batching.Options{
+		MaxRecords: batchSize,
+		MaxBytes:   maxBatchBytes,
+		Linger: time.Duration(config.GetOrDefault(
+			c, config.PropertySqsBatchLinger, 100,
+		)) * time.Millisecond,
+		DistinctKeys: true,
+		BackOff: batching.ExponentialBackOff(
+			config.GetOrDefault(c, config.PropertySqsRetriesMax, 5),
+			time.Duration(config.GetOrDefault(
+				c, config.PropertySqsRetriesBackoffMin, 100,
+			))*time.Millisecond,
+			time.Duration(config.GetOrDefault(
+				c, config.PropertySqsRetriesBackoffMax, 10000,
+			))*time.Millisecond,
+		),
+	}, a.sendMessages, logger)
+	return a, nil
 }
 
 func (a *awsSqsSink) Start() error {
+	a.batcher.Start()
 	return nil
 }
 
 func (a *awsSqsSink) Stop() error {
+	a.batcher.Stop()
 	return nil
 }
 
 func (a *awsSqsSink) Emit(
-	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	done := make(chan error, 1)
+	if err := a.EmitAsync(context, timestamp, topicName, key, envelope, func(err error) {
+		done <- err
+	}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+func (a *awsSqsSink) EmitAsync(
+	_ sink.Context, _ time.Time, topicName string,
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
 ) error {
 
-	envelopeData, err := a.encoder.Marshal(envelope)
+	envelopeData, err := a.encoder.EncodeEnvelope(topicName, envelope)
 	if err != nil {
 		return err
 	}
@@ -114,12 +218,88 @@ func (a *awsSqsSink) Emit(
 	hash.Write([]byte(msgDeduplicationIdContent))
 	msgDeduplicationId := fmt.Sprintf("%X", hash.Sum(nil))
 
-	_, err = a.awsSqs.SendMessage(&sqs.SendMessageInput{
-		DelaySeconds:           aws.Int64(0),
-		MessageBody:            aws.String(string(envelopeData)),
-		MessageGroupId:         aws.String(topicName),
-		MessageDeduplicationId: aws.String(msgDeduplicationId),
-		QueueUrl:               a.queueUrl,
+	messageGroupId, err := a.partitioner(topicName, key, envelope)
+	if err != nil {
+		return err
+	}
+	messageGroupId = partitioning.Constrain(messageGroupId, maxMessageGroupId, validMessageGroupIdRune)
+
+	if len(envelopeData) > maxMessageBytes {
+		if envelopeData, err = a.oversize.Handle(topicName, lsn, envelopeData, maxMessageBytes); err != nil {
+			return err
+		}
+		if envelopeData == nil {
+			ack(nil)
+			return nil
+		}
+	}
+
+	return a.batcher.Add(&batching.Record[*sqs.SendMessageBatchRequestEntry]{
+		Value: &sqs.SendMessageBatchRequestEntry{
+			DelaySeconds:           aws.Int64(0),
+			MessageBody:            aws.String(string(envelopeData)),
+			MessageGroupId:         aws.String(messageGroupId),
+			MessageDeduplicationId: aws.String(msgDeduplicationId),
+		},
+		Size:         len(envelopeData),
+		PartitionKey: messageGroupId,
+		Ack:          ack,
+	})
+}
+
+func (a *awsSqsSink) sendMessages(
+	batch []*batching.Record[*sqs.SendMessageBatchRequestEntry],
+) ([]batching.Failure[*sqs.SendMessageBatchRequestEntry], error) {
+
+	entries := make([]*sqs.SendMessageBatchRequestEntry, 0, len(batch))
+	for i, record := range batch {
+		// Entry ids only need to be unique inside a single request
+		record.Value.Id = aws.String(strconv.Itoa(i))
+		entries = append(entries, record.Value)
+	}
+
+	output, err := a.awsSqs.SendMessageBatch(&sqs.SendMessageBatchInput{
+		QueueUrl: a.queueUrl,
+		Entries:  entries,
 	})
-	return err
+	if err != nil {
+		if request.IsErrorRetryable(err) || request.IsErrorThrottle(err) {
+			return nil, err
+		}
+		return nil, backoff.Permanent(err)
+	}
+
+	failed := make([]batching.Failure[*sqs.SendMessageBatchRequestEntry], 0)
+	for _, entry := range output.Failed {
+		i, err := strconv.Atoi(aws.StringValue(entry.Id))
+		if err != nil || i < 0 || i >= len(batch) {
+			return nil, backoff.Permanent(errors.Errorf(
+				"AWS SQS returned unknown entry id: %s", aws.StringValue(entry.Id),
+			))
+		}
+
+		err = errors.Errorf(
+			"AWS SQS rejected message: %s (%s)",
+			aws.StringValue(entry.Code), aws.StringValue(entry.Message),
+		)
+		// Messages rejected due to the sender's fault (e.g. invalid
+		// content) won't succeed when being sent again
+		if aws.BoolValue(entry.SenderFault) {
+			err = backoff.Permanent(err)
+		}
+		failed = append(failed, batching.Failure[*sqs.SendMessageBatchRequestEntry]{
+			Record: batch[i],
+			Err:    err,
+		})
+	}
+	return failed, nil
+}
+
+// validMessageGroupIdRune checks for the characters allowed in
+// message group ids, alphanumeric characters and punctuation
+func validMessageGroupIdRune(
+	r rune,
+) bool {
+
+	return r >= '!' && r <= '~'
 }
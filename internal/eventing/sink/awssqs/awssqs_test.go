@@ -18,10 +18,17 @@
 package awssqs
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_AWS_SQS_Config_Loading(
@@ -54,12 +61,181 @@ func Test_AWS_SQS_Config_Loading(
 	awsSink := sink.(*awsSqsSink)
 	assert.Equal(t, "https://test_url", *awsSink.queueUrl)
 
-	credentials, err := awsSink.awsSqs.Config.Credentials.Get()
+	awsSqs := awsSink.awsSqs.(*sqs.SQS)
+	credentials, err := awsSqs.Config.Credentials.Get()
 	if err != nil {
 		t.Error(err)
 	}
-	assert.Equal(t, "aws_region", *awsSink.awsSqs.Config.Region)
+	assert.Equal(t, "aws_region", *awsSqs.Config.Region)
 	assert.Equal(t, "aws_access_key_id", credentials.AccessKeyID)
 	assert.Equal(t, "aws_secret_access_key", credentials.SecretAccessKey)
 	assert.Equal(t, "aws_session_token", credentials.SessionToken)
 }
+
+type testSqs struct {
+	sqsiface.SQSAPI
+	senderFault bool
+	requests    [][]string
+}
+
+func (s *testSqs) SendMessageBatch(
+	input *sqs.SendMessageBatchInput,
+) (*sqs.SendMessageBatchOutput, error) {
+
+	bodies := make([]string, 0, len(input.Entries))
+	output := &sqs.SendMessageBatchOutput{}
+	for i, entry := range input.Entries {
+		bodies = append(bodies, aws.StringValue(entry.MessageBody))
+		// The first message of the first request fails
+		if len(s.requests) == 0 && i == 0 {
+			output.Failed = append(output.Failed, &sqs.BatchResultErrorEntry{
+				Id:          entry.Id,
+				Code:        aws.String("InternalError"),
+				Message:     aws.String("internal error"),
+				SenderFault: aws.Bool(s.senderFault),
+			})
+			continue
+		}
+		output.Successful = append(output.Successful, &sqs.SendMessageBatchResultEntry{
+			Id:        entry.Id,
+			MessageId: aws.String(strconv.Itoa(i)),
+		})
+	}
+	s.requests = append(s.requests, bodies)
+	return output, nil
+}
+
+func testEnvelope(
+	value string,
+) schema.Struct {
+
+	return schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: "c",
+		schema.FieldNameAfter: schema.Struct{
+			"value": value,
+		},
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameLSN: "0/16B3748",
+		},
+	})
+}
+
+func newTestSqsSink(
+	t *testing.T, client *testSqs,
+) *awsSqsSink {
+
+	awsSink, err := newAwsSqsSinkWithClient(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.AwsSQS,
+			AwsSqs: spiconfig.AwsSqsConfig{
+				Partitioning: spiconfig.PartitioningConfig{
+					Strategy: spiconfig.ColumnPartitioning,
+					Columns:  []string{"value"},
+				},
+				Batch: spiconfig.AwsBatchConfig{
+					Linger: 3600000,
+				},
+				Retries: spiconfig.AwsRetryConfig{
+					Backoff: spiconfig.AwsRetryBackoffConfig{
+						Min: 1,
+						Max: 1,
+					},
+				},
+			},
+		},
+	}, aws.String("https://test_url"), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := awsSink.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return awsSink
+}
+
+func Test_AWS_SQS_Partial_Failure_Retry(
+	t *testing.T,
+) {
+
+	client := &testSqs{}
+	awsSink := newTestSqsSink(t, client)
+
+	acks := 0
+	for _, value := range []string{"a", "b", "c"} {
+		if err := awsSink.EmitAsync(nil, time.Now(), "topic", nil, testEnvelope(value), func(err error) {
+			assert.NoError(t, err)
+			acks++
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := awsSink.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, acks)
+	assert.Len(t, client.requests, 2)
+	assert.Len(t, client.requests[0], 3)
+	assert.Len(t, client.requests[1], 1)
+	assert.Contains(t, client.requests[1][0], `"value":"a"`)
+}
+
+func Test_AWS_SQS_Sender_Fault_Not_Retried(
+	t *testing.T,
+) {
+
+	client := &testSqs{senderFault: true}
+	awsSink := newTestSqsSink(t, client)
+
+	acks := make(map[string]error)
+	for _, value := range []string{"a", "b"} {
+		value := value
+		if err := awsSink.EmitAsync(nil, time.Now(), "topic", nil, testEnvelope(value), func(err error) {
+			acks[value] = err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := awsSink.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the rejected message fails, the accepted one
+	// must not be sent again
+	assert.Len(t, acks, 2)
+	assert.ErrorContains(t, acks["a"], "InternalError")
+	assert.NoError(t, acks["b"])
+	assert.Len(t, client.requests, 1)
+}
+
+func Test_AWS_SQS_Oversize_Fail(
+	t *testing.T,
+) {
+
+	client := &testSqs{}
+	awsSink := newTestSqsSink(t, client)
+	defer awsSink.Stop()
+
+	envelope := testEnvelope(strings.Repeat("x", maxMessageBytes))
+	err := awsSink.EmitAsync(nil, time.Now(), "topic", nil, envelope, func(error) {
+		t.Fatal("oversized message must not be acknowledged")
+	})
+	assert.Error(t, err)
+}
+
+func Test_AWS_SQS_Oversize_Offload_Needs_Bucket(
+	t *testing.T,
+) {
+
+	_, err := newAwsSqsSinkWithClient(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.AwsSQS,
+			AwsSqs: spiconfig.AwsSqsConfig{
+				Oversize: spiconfig.AwsOversizeConfig{
+					Strategy: spiconfig.OversizeOffload,
+				},
+			},
+		},
+	}, aws.String("https://test_url"), &testSqs{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,271 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package batching
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sync"
+	"time"
+)
+
+// Record is a single event waiting to be sent as part of a batch
+type Record[T any] struct {
+	Value        T
+	Size         int
+	PartitionKey string
+	Ack          sink.AcknowledgeFunc
+}
+
+// Failure is a record which wasn't accepted by the target, together
+// with the reason. Failures with an error wrapped with backoff.Permanent
+// aren't retried.
+type Failure[T any] struct {
+	Record *Record[T]
+	Err    error
+}
+
+// Sender sends a batch of records and returns the records which
+// weren't accepted by the target. All other records of the batch
+// are considered delivered. If an error is returned, the whole
+// batch failed. Errors wrapped with backoff.Permanent aren't retried.
+type Sender[T any] func(
+	batch []*Record[T],
+) (failed []Failure[T], err error)
+
+type Options struct {
+	// MaxRecords is the maximum number of records in a batch
+	MaxRecords int
+	// MaxBytes is the maximum accumulated size of the records in a batch
+	MaxBytes int
+	// Linger is the maximum time a record waits for the batch to fill up
+	Linger time.Duration
+	// DistinctKeys limits a batch to a single record per partition key,
+	// which is required if the target doesn't guarantee the order of
+	// records inside a batch
+	DistinctKeys bool
+	// BackOff creates the backoff policy used to retry failed records,
+	// without a backoff policy failed records aren't retried
+	BackOff func() backoff.BackOff
+}
+
+// Batcher collects records into batches and sends a batch as soon as
+// the maximum number of records or bytes is reached, or the linger
+// time of the first record in the batch has passed.
+type Batcher[T any] struct {
+	options   Options
+	sender    Sender[T]
+	records   chan *Record[T]
+	waitGroup sync.WaitGroup
+	mutex     sync.RWMutex
+	stopped   bool
+	logger    *logging.Logger
+}
+
+func NewBatcher[T any](
+	options Options, sender Sender[T], logger *logging.Logger,
+) *Batcher[T] {
+
+	return &Batcher[T]{
+		options: options,
+		sender:  sender,
+		records: make(chan *Record[T], options.MaxRecords*2),
+		logger:  logger,
+	}
+}
+
+func (b *Batcher[T]) Start() {
+	b.waitGroup.Add(1)
+	go b.processRecords()
+}
+
+// Stop flushes the current batch, which makes sure all
+// pending acknowledgements are called
+func (b *Batcher[T]) Stop() {
+	b.mutex.Lock()
+	if b.stopped {
+		b.mutex.Unlock()
+		return
+	}
+	b.stopped = true
+	close(b.records)
+	b.mutex.Unlock()
+	b.waitGroup.Wait()
+}
+
+// Add queues the record for the next batch. Records can't be added
+// after the batcher was stopped.
+func (b *Batcher[T]) Add(
+	record *Record[T],
+) error {
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if b.stopped {
+		return errors.Errorf("batcher already stopped")
+	}
+	b.records <- record
+	return nil
+}
+
+func (b *Batcher[T]) processRecords() {
+	defer b.waitGroup.Done()
+
+	var batch []*Record[T]
+	var batchBytes int
+	var partitionKeys map[string]bool
+	var lingerTimer *time.Timer
+	var lingerC <-chan time.Time
+
+	flush := func() {
+		if lingerTimer != nil {
+			lingerTimer.Stop()
+			lingerTimer = nil
+			lingerC = nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+
+		b.send(batch)
+		batch = nil
+		batchBytes = 0
+		partitionKeys = nil
+	}
+
+	for {
+		select {
+		case record, ok := <-b.records:
+			if !ok {
+				flush()
+				return
+			}
+
+			if len(batch) > 0 && batchBytes+record.Size > b.options.MaxBytes {
+				flush()
+			}
+			if b.options.DistinctKeys && partitionKeys[record.PartitionKey] {
+				flush()
+			}
+
+			batch = append(batch, record)
+			batchBytes += record.Size
+			if b.options.DistinctKeys {
+				if partitionKeys == nil {
+					partitionKeys = make(map[string]bool)
+				}
+				partitionKeys[record.PartitionKey] = true
+			}
+
+			if len(batch) >= b.options.MaxRecords || batchBytes >= b.options.MaxBytes {
+				flush()
+			} else if lingerTimer == nil {
+				lingerTimer = time.NewTimer(b.options.Linger)
+				lingerC = lingerTimer.C
+			}
+
+		case <-lingerC:
+			flush()
+		}
+	}
+}
+
+// send sends the batch and retries the records which failed. Records
+// are acknowledged as soon as they were accepted by the target, hence
+// aren't sent again. Records which finally failed are acknowledged with
+// their error, which makes the event emitter stop the replication.
+func (b *Batcher[T]) send(
+	batch []*Record[T],
+) {
+
+	pending := batch
+	var causes map[*Record[T]]error
+	operation := func() error {
+		causes = make(map[*Record[T]]error)
+		failures, err := b.sender(pending)
+		if err != nil {
+			return err
+		}
+
+		failed := make(map[*Record[T]]bool, len(failures))
+		retries := make([]*Record[T], 0, len(failures))
+		for _, failure := range failures {
+			failed[failure.Record] = true
+			var permanent *backoff.PermanentError
+			if errors.As(failure.Err, &permanent) {
+				b.logger.Errorf("Failed to deliver record: %+v", permanent.Err)
+				failure.Record.Ack(permanent.Err)
+				continue
+			}
+			causes[failure.Record] = failure.Err
+			retries = append(retries, failure.Record)
+		}
+		for _, record := range pending {
+			if !failed[record] {
+				record.Ack(nil)
+			}
+		}
+
+		if len(retries) > 0 {
+			b.logger.Warnf("Failed to deliver %d of %d records, retrying", len(retries), len(pending))
+			pending = retries
+			return errors.Errorf("failed to deliver %d records", len(retries))
+		}
+		pending = nil
+		return nil
+	}
+
+	var err error
+	if b.options.BackOff == nil {
+		err = operation()
+	} else {
+		err = backoff.Retry(operation, b.options.BackOff())
+	}
+	if err == nil {
+		return
+	}
+	var permanent *backoff.PermanentError
+	if errors.As(err, &permanent) {
+		err = permanent.Err
+	}
+
+	b.logger.Errorf("Failed to deliver %d records: %+v", len(pending), err)
+	for _, record := range pending {
+		if cause, present := causes[record]; present {
+			record.Ack(cause)
+		} else {
+			record.Ack(err)
+		}
+	}
+}
+
+// ExponentialBackOff creates backoff policies retrying up to maxAttempts
+// times, with exponentially growing intervals between min and max
+func ExponentialBackOff(
+	maxAttempts int, min, max time.Duration,
+) func() backoff.BackOff {
+
+	return func() backoff.BackOff {
+		exponentialBackOff := backoff.NewExponentialBackOff()
+		exponentialBackOff.InitialInterval = min
+		exponentialBackOff.MaxInterval = max
+		exponentialBackOff.MaxElapsedTime = 0
+		return backoff.WithMaxRetries(exponentialBackOff, uint64(maxAttempts))
+	}
+}
@@ -0,0 +1,266 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package batching
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSender struct {
+	mutex   sync.Mutex
+	batches [][]string
+	err     error
+}
+
+func (s *testSender) send(
+	batch []*Record[string],
+) ([]Failure[string], error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	values := make([]string, 0, len(batch))
+	for _, record := range batch {
+		values = append(values, record.Value)
+	}
+	s.batches = append(s.batches, values)
+	return nil, s.err
+}
+
+func newTestBatcher(
+	t *testing.T, options Options, sender *testSender,
+) *Batcher[string] {
+
+	logger, err := logging.NewLogger("Test_Batcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batcher := NewBatcher[string](options, sender.send, logger)
+	batcher.Start()
+	return batcher
+}
+
+func Test_Batcher_Limits(
+	t *testing.T,
+) {
+
+	sender := &testSender{}
+	batcher := newTestBatcher(t, Options{
+		MaxRecords: 3,
+		MaxBytes:   10,
+		Linger:     time.Hour,
+	}, sender)
+
+	acks := 0
+	for _, value := range []string{"a", "b", "c", "d", "eeeeeeeeee", "f"} {
+		assert.NoError(t, batcher.Add(&Record[string]{
+			Value: value,
+			Size:  len(value),
+			Ack: func(err error) {
+				assert.NoError(t, err)
+				acks++
+			},
+		}))
+	}
+	batcher.Stop()
+
+	assert.Equal(t, 6, acks)
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"d"}, {"eeeeeeeeee"}, {"f"}}, sender.batches)
+}
+
+func Test_Batcher_Distinct_Keys(
+	t *testing.T,
+) {
+
+	sender := &testSender{}
+	batcher := newTestBatcher(t, Options{
+		MaxRecords:   10,
+		MaxBytes:     1024,
+		Linger:       time.Hour,
+		DistinctKeys: true,
+	}, sender)
+
+	for _, value := range []string{"a1", "b1", "a2", "c1", "b2"} {
+		assert.NoError(t, batcher.Add(&Record[string]{
+			Value:        value,
+			Size:         len(value),
+			PartitionKey: value[:1],
+			Ack:          func(error) {},
+		}))
+	}
+	batcher.Stop()
+
+	assert.Equal(t, [][]string{{"a1", "b1"}, {"a2", "c1", "b2"}}, sender.batches)
+}
+
+func Test_Batcher_Linger_And_Failure(
+	t *testing.T,
+) {
+
+	sender := &testSender{err: errors.Errorf("failed")}
+	batcher := newTestBatcher(t, Options{
+		MaxRecords: 10,
+		MaxBytes:   1024,
+		Linger:     10 * time.Millisecond,
+	}, sender)
+
+	acks := make(chan error, 2)
+	assert.NoError(t, batcher.Add(&Record[string]{Value: "a", Ack: func(err error) {
+		acks <- err
+	}}))
+	assert.Error(t, <-acks)
+
+	// A failed batch doesn't affect later batches
+	sender.mutex.Lock()
+	sender.err = nil
+	sender.mutex.Unlock()
+	assert.NoError(t, batcher.Add(&Record[string]{Value: "b", Ack: func(err error) {
+		acks <- err
+	}}))
+	assert.NoError(t, <-acks)
+	batcher.Stop()
+
+	assert.Equal(t, [][]string{{"a"}, {"b"}}, sender.batches)
+}
+
+func Test_Batcher_Add_After_Stop(
+	t *testing.T,
+) {
+
+	batcher := newTestBatcher(t, Options{
+		MaxRecords: 10,
+		MaxBytes:   1024,
+		Linger:     time.Hour,
+	}, &testSender{})
+	batcher.Stop()
+
+	assert.Error(t, batcher.Add(&Record[string]{Value: "a", Ack: func(error) {}}))
+	batcher.Stop()
+}
+
+func Test_Batcher_Retries_Failed_Records(
+	t *testing.T,
+) {
+
+	var batches [][]string
+	attempts := 0
+	sender := func(batch []*Record[string]) ([]Failure[string], error) {
+		values := make([]string, 0, len(batch))
+		for _, record := range batch {
+			values = append(values, record.Value)
+		}
+		batches = append(batches, values)
+
+		// The first attempt fails the second and fourth record
+		attempts++
+		if attempts == 1 {
+			return []Failure[string]{
+				{Record: batch[1], Err: assert.AnError},
+				{Record: batch[3], Err: assert.AnError},
+			}, nil
+		}
+		return nil, nil
+	}
+
+	logger, err := logging.NewLogger("Test_Batcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batcher := NewBatcher[string](Options{
+		MaxRecords: 4,
+		MaxBytes:   1024,
+		Linger:     time.Hour,
+		BackOff: func() backoff.BackOff {
+			return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+		},
+	}, sender, logger)
+	batcher.Start()
+
+	acks := 0
+	for _, value := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, batcher.Add(&Record[string]{Value: value, Ack: func(err error) {
+			assert.NoError(t, err)
+			acks++
+		}}))
+	}
+	batcher.Stop()
+
+	assert.Equal(t, 4, acks)
+	assert.Equal(t, [][]string{{"a", "b", "c", "d"}, {"b", "d"}}, batches)
+}
+
+func Test_Batcher_Fails_Only_Rejected_Records(
+	t *testing.T,
+) {
+
+	var batches [][]string
+	sender := func(batch []*Record[string]) ([]Failure[string], error) {
+		values := make([]string, 0, len(batch))
+		failures := make([]Failure[string], 0)
+		for _, record := range batch {
+			values = append(values, record.Value)
+			switch record.Value {
+			case "b":
+				failures = append(failures, Failure[string]{Record: record, Err: backoff.Permanent(assert.AnError)})
+			case "d":
+				failures = append(failures, Failure[string]{Record: record, Err: assert.AnError})
+			}
+		}
+		batches = append(batches, values)
+		return failures, nil
+	}
+
+	logger, err := logging.NewLogger("Test_Batcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batcher := NewBatcher[string](Options{
+		MaxRecords: 4,
+		MaxBytes:   1024,
+		Linger:     time.Hour,
+		BackOff: func() backoff.BackOff {
+			return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2)
+		},
+	}, sender, logger)
+	batcher.Start()
+
+	acks := make(map[string]error)
+	for _, value := range []string{"a", "b", "c", "d"} {
+		value := value
+		assert.NoError(t, batcher.Add(&Record[string]{Value: value, Ack: func(err error) {
+			_, present := acks[value]
+			assert.False(t, present, "record %s acknowledged twice", value)
+			acks[value] = err
+		}}))
+	}
+	batcher.Stop()
+
+	// Accepted records aren't failed with the batch, the permanently
+	// rejected record isn't retried, and only the other one is
+	assert.Equal(t, [][]string{{"a", "b", "c", "d"}, {"d"}, {"d"}}, batches)
+	assert.Len(t, acks, 4)
+	assert.NoError(t, acks["a"])
+	assert.NoError(t, acks["c"])
+	assert.ErrorIs(t, acks["b"], assert.AnError)
+	assert.ErrorIs(t, acks["d"], assert.AnError)
+}
@@ -0,0 +1,687 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sink
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventfiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type namedSink struct {
+	name        string
+	sink        sink.Sink
+	tableFilter *tablefiltering.TableFilter
+	eventFilter eventfiltering.EventFilter
+	topicPrefix string
+	deliveries  *sinkDeliveries
+}
+
+// fanOutSink emits events to multiple named sinks at the same time. Each
+// named sink has its own configuration, including the encoding, and only
+// receives the events matching its table routing and filters. Events are
+// acknowledged after all sinks that received the event acknowledged it.
+// Failed deliveries are retried for the failing sink only, to not send
+// the event a second time to the sinks which already received it. To
+// keep the events of a key in order, the failed event and all events
+// emitted to the sink after it are delivered again, while emitting new
+// events waits for the redelivery.
+type fanOutSink struct {
+	sinks       []*namedSink
+	topicPrefix string
+	logger      *logging.Logger
+	stopped     atomic.Bool
+	// newBackOff creates the backoff of redeliveries to a single sink
+	newBackOff func() backoff.BackOff
+}
+
+// NewFanOutSink instantiates the named sinks defined in the
+// sink configuration and combines them into a single Sink
+func NewFanOutSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	if c.Sink.Type != "" {
+		return nil, errors.Errorf(
+			"sink.type '%s' can't be combined with named sinks, define it as a named sink instead", c.Sink.Type,
+		)
+	}
+
+	logger, err := logging.NewLogger("FanOutSink")
+	if err != nil {
+		return nil, err
+	}
+
+	// Map iteration order is random, sinks are started in a stable order
+	names := make([]string, 0, len(c.Sink.Sinks))
+	for name := range c.Sink.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sinks := make([]*namedSink, 0, len(names))
+	for _, name := range names {
+		s, err := newNamedSink(c, name, c.Sink.Sinks[name])
+		if err != nil {
+			return nil, errors.Errorf("failed to create sink '%s': %s", name, err.Error())
+		}
+		sinks = append(sinks, s)
+	}
+
+	return &fanOutSink{
+		sinks:       sinks,
+		topicPrefix: c.Topic.Prefix,
+		logger:      logger,
+		newBackOff:  newRedeliveryBackOff,
+	}, nil
+}
+
+// newRedeliveryBackOff retries a failed delivery with up to one minute
+// between attempts, and gives up after the default elapsed time of 15
+// minutes, failing the delivery
+func newRedeliveryBackOff() backoff.BackOff {
+	redelivery := backoff.NewExponentialBackOff()
+	redelivery.MaxInterval = time.Minute
+	return redelivery
+}
+
+func newNamedSink(
+	c *config.Config, name string, namedConfig config.NamedSinkConfig,
+) (*namedSink, error) {
+
+	if namedConfig.Type == "" {
+		return nil, errors.Errorf("sink type isn't defined")
+	}
+	if len(namedConfig.Sinks) > 0 {
+		return nil, errors.Errorf("named sinks can't be nested")
+	}
+
+	// Topic names are rewritten by replacing the topic prefix, which
+	// only works for topic names starting with the prefix
+	namingStrategy := config.GetOrDefault(c, config.PropertyNamingStrategy, config.Debezium)
+	if namedConfig.Topic.Prefix != "" && namingStrategy != config.Debezium {
+		return nil, errors.Errorf(
+			"topic.prefix can't be combined with the naming strategy '%s'", namingStrategy,
+		)
+	}
+
+	tableFilter, err := tablefiltering.NewTableFilter(
+		namedConfig.Tables.Excludes, namedConfig.Tables.Includes, len(namedConfig.Tables.Includes) == 0,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var eventFilter eventfiltering.EventFilter
+	if len(namedConfig.Filters) > 0 {
+		if eventFilter, err = eventfiltering.NewEventFilter(namedConfig.Filters); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sink reads its settings from a copy of the configuration
+	// with the sink section replaced by the named sink's section
+	sinkConfig := *c
+	sinkConfig.Sink = namedConfig.SinkConfig
+	if namedConfig.Topic.Prefix != "" {
+		sinkConfig.Topic.Prefix = namedConfig.Topic.Prefix
+	}
+
+	s, err := NewSink(namedConfig.Type, &sinkConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &namedSink{
+		name:        name,
+		sink:        s,
+		tableFilter: tableFilter,
+		eventFilter: eventFilter,
+		topicPrefix: namedConfig.Topic.Prefix,
+		deliveries:  newSinkDeliveries(),
+	}, nil
+}
+
+func (f *fanOutSink) Start() error {
+	for i, s := range f.sinks {
+		if err := s.sink.Start(); err != nil {
+			// Stop the already started sinks to not leak connections
+			for _, started := range f.sinks[:i] {
+				if err := started.sink.Stop(); err != nil {
+					f.logger.Warnf("Failed to stop sink '%s': %+v", started.name, err)
+				}
+			}
+			return errors.Errorf("failed to start sink '%s': %s", s.name, err.Error())
+		}
+		f.logger.Infof("Started sink '%s'", s.name)
+	}
+	return nil
+}
+
+func (f *fanOutSink) Stop() error {
+	f.stopped.Store(true)
+	for _, s := range f.sinks {
+		s.deliveries.wakeUp()
+	}
+
+	var result error
+	for _, s := range f.sinks {
+		if err := s.sink.Stop(); err != nil {
+			f.logger.Errorf("Failed to stop sink '%s': %+v", s.name, err)
+			if result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
+
+func (f *fanOutSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	targets, err := f.route(key, envelope)
+	if err != nil {
+		return err
+	}
+	for _, s := range targets {
+		if err := s.sink.Emit(
+			namespacedContext{s.name, context}, timestamp, f.topicName(s, topicName), key, envelope,
+		); err != nil {
+			return errors.Errorf("sink '%s' failed to emit event: %s", s.name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (f *fanOutSink) EmitAsync(
+	context sink.Context, timestamp time.Time, topicName string,
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	targets, err := f.route(key, envelope)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		ack(nil)
+		return nil
+	}
+
+	acknowledgement := &fanOutAcknowledgement{
+		remaining: len(targets),
+		ack:       ack,
+	}
+	for _, s := range targets {
+		f.deliver(&fanOutDelivery{
+			target:          s,
+			context:         namespacedContext{s.name, context},
+			timestamp:       timestamp,
+			topicName:       f.topicName(s, topicName),
+			key:             key,
+			envelope:        envelope,
+			acknowledgement: acknowledgement,
+		})
+	}
+	return nil
+}
+
+func (f *fanOutSink) deliver(
+	delivery *fanOutDelivery,
+) {
+
+	// Transactional sinks abort the whole transaction on a failure,
+	// which can't be repaired by emitting single events again
+	if _, ok := delivery.target.sink.(sink.TransactionalSink); ok {
+		if err := f.emitAsync(delivery, delivery.complete); err != nil {
+			delivery.complete(err)
+		}
+		return
+	}
+
+	deliveries := delivery.target.deliveries
+	if !deliveries.add(delivery, f.stopped.Load) {
+		delivery.complete(errors.Errorf("sink stopped"))
+		return
+	}
+
+	if err := f.emitAsync(delivery, func(err error) {
+		f.delivered(delivery, err)
+	}); err != nil {
+		f.delivered(delivery, err)
+	}
+}
+
+func (f *fanOutSink) delivered(
+	delivery *fanOutDelivery, err error,
+) {
+
+	if err != nil {
+		f.logger.Errorf("Sink '%s' failed to emit event: %+v", delivery.target.name, err)
+	}
+
+	completed, redeliver := delivery.target.deliveries.delivered(delivery, err)
+	for _, d := range completed {
+		d.complete(nil)
+	}
+	if redeliver {
+		go f.redeliver(delivery.target)
+	}
+}
+
+// redeliver emits the failed event, and all events emitted after it,
+// to the sink again, in order and waiting for each delivery to be
+// confirmed. If the delivery of an event finally fails, the remaining
+// events are acknowledged with the failure.
+func (f *fanOutSink) redeliver(
+	target *namedSink,
+) {
+
+	deliveries := target.deliveries
+	for _, delivery := range deliveries.redeliveries() {
+		operation := func() error {
+			if f.stopped.Load() {
+				return backoff.Permanent(errors.Errorf("sink stopped"))
+			}
+			done := make(chan error, 1)
+			if err := f.emitAsync(delivery, func(err error) {
+				done <- err
+			}); err != nil {
+				return err
+			}
+			return <-done
+		}
+
+		if err := backoff.RetryNotify(operation, f.newBackOff(), func(err error, delay time.Duration) {
+			f.logger.Errorf("Sink '%s' failed to emit event, retrying in %s: %+v", target.name, delay, err)
+		}); err != nil {
+			for _, d := range deliveries.redelivered(delivery, false) {
+				d.complete(err)
+			}
+			return
+		}
+
+		for _, d := range deliveries.redelivered(delivery, true) {
+			d.complete(nil)
+		}
+	}
+}
+
+func (f *fanOutSink) emitAsync(
+	delivery *fanOutDelivery, ack sink.AcknowledgeFunc,
+) error {
+
+	return emitAsync(
+		delivery.target.sink, delivery.context, delivery.timestamp,
+		delivery.topicName, delivery.key, delivery.envelope, ack,
+	)
+}
+
+func (f *fanOutSink) BeginTransaction(
+	xid uint32,
+) error {
+
+	for _, s := range f.sinks {
+		if transactionalSink, ok := s.sink.(sink.TransactionalSink); ok {
+			if err := transactionalSink.BeginTransaction(xid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fanOutSink) OnBeginTransaction(
+	xid uint32, commitLSN pgtypes.LSN,
+) error {
+
+	for _, s := range f.sinks {
+		if transactionAwareSink, ok := s.sink.(sink.TransactionAwareSink); ok {
+			if err := transactionAwareSink.OnBeginTransaction(xid, commitLSN); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fanOutSink) OnCommitTransaction(
+	transactionEndLSN pgtypes.LSN,
+) error {
+
+	for _, s := range f.sinks {
+		if transactionAwareSink, ok := s.sink.(sink.TransactionAwareSink); ok {
+			if err := transactionAwareSink.OnCommitTransaction(transactionEndLSN); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fanOutSink) CommitTransaction(
+	transactionEndLSN pgtypes.LSN,
+) error {
+
+	for _, s := range f.sinks {
+		if transactionalSink, ok := s.sink.(sink.TransactionalSink); ok {
+			if err := transactionalSink.CommitTransaction(transactionEndLSN); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CommittedLSN returns the oldest LSN committed by all sinks. If any of
+// the sinks isn't transactional, the state storage is the only reliable
+// restart point and no committed LSN is returned.
+func (f *fanOutSink) CommittedLSN() (lsn pgtypes.LSN, present bool, err error) {
+	for _, s := range f.sinks {
+		transactionalSink, ok := s.sink.(sink.TransactionalSink)
+		if !ok {
+			return 0, false, nil
+		}
+		committedLSN, committed, err := transactionalSink.CommittedLSN()
+		if err != nil {
+			return 0, false, err
+		}
+		if !committed {
+			return 0, false, nil
+		}
+		if !present || committedLSN < lsn {
+			lsn = committedLSN
+			present = true
+		}
+	}
+	return lsn, present, nil
+}
+
+func (f *fanOutSink) OnTableSchema(
+	table schema.TableAlike,
+) error {
+
+	for _, s := range f.sinks {
+		if !s.tableFilter.Enabled(table) {
+			continue
+		}
+		if schemaAwareSink, ok := s.sink.(sink.SchemaAwareSink); ok {
+			if err := schemaAwareSink.OnTableSchema(table); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fanOutSink) route(
+	key, envelope schema.Struct,
+) ([]*namedSink, error) {
+
+	table := eventEntity(envelope)
+	targets := make([]*namedSink, 0, len(f.sinks))
+	for _, s := range f.sinks {
+		if !s.tableFilter.Enabled(table) {
+			continue
+		}
+		if s.eventFilter != nil {
+			success, err := s.eventFilter.Evaluate(table, key, envelope)
+			if err != nil {
+				return nil, errors.Errorf("filter of sink '%s' failed: %s", s.name, err.Error())
+			}
+			if !success {
+				continue
+			}
+		}
+		targets = append(targets, s)
+	}
+	return targets, nil
+}
+
+func (f *fanOutSink) topicName(
+	s *namedSink, topicName string,
+) string {
+
+	if s.topicPrefix == "" || s.topicPrefix == f.topicPrefix {
+		return topicName
+	}
+	if strings.HasPrefix(topicName, f.topicPrefix+".") {
+		return s.topicPrefix + topicName[len(f.topicPrefix):]
+	}
+	return topicName
+}
+
+// eventEntity returns the table an event belongs to. Events without
+// a table, like replication messages, result in an empty entity.
+func eventEntity(
+	envelope schema.Struct,
+) systemcatalog.SystemEntity {
+
+	var schemaName, tableName string
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+		schemaName, _ = source[schema.FieldNameSchema].(string)
+		tableName, _ = source[schema.FieldNameTable].(string)
+	}
+	return systemcatalog.NewSystemEntity(schemaName, tableName)
+}
+
+// fanOutDelivery is the delivery of an event to a single sink
+type fanOutDelivery struct {
+	target          *namedSink
+	context         sink.Context
+	timestamp       time.Time
+	topicName       string
+	key             schema.Struct
+	envelope        schema.Struct
+	acknowledgement *fanOutAcknowledgement
+	delivered       bool
+}
+
+func (d *fanOutDelivery) complete(
+	err error,
+) {
+
+	if err != nil {
+		err = errors.Errorf("sink '%s' failed to emit event: %s", d.target.name, err.Error())
+	}
+	d.acknowledgement.complete(err)
+}
+
+// sinkDeliveries keeps the unconfirmed deliveries to a single sink in
+// emission order. A delivery is completed once it and all deliveries
+// before it are confirmed. After a failed delivery, new deliveries wait
+// until the events in flight settled and the failed event and all
+// events after it were delivered again.
+type sinkDeliveries struct {
+	lock         sync.Mutex
+	cond         *sync.Cond
+	pending      []*fanOutDelivery
+	inFlight     int
+	failed       bool
+	redelivering bool
+}
+
+func newSinkDeliveries() *sinkDeliveries {
+	d := &sinkDeliveries{}
+	d.cond = sync.NewCond(&d.lock)
+	return d
+}
+
+// add registers a new delivery, waiting for a failure being redelivered.
+// Returns false if the sink was stopped in the meantime.
+func (d *sinkDeliveries) add(
+	delivery *fanOutDelivery, stopped func() bool,
+) bool {
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for d.failed && !stopped() {
+		d.cond.Wait()
+	}
+	if stopped() {
+		return false
+	}
+	d.pending = append(d.pending, delivery)
+	d.inFlight++
+	return true
+}
+
+// delivered records the outcome of a delivery and returns the deliveries
+// which are completed. If a delivery failed, redeliver is true once no
+// more deliveries are in flight.
+func (d *sinkDeliveries) delivered(
+	delivery *fanOutDelivery, err error,
+) (completed []*fanOutDelivery, redeliver bool) {
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.inFlight--
+	if err != nil {
+		d.failed = true
+	} else {
+		delivery.delivered = true
+	}
+
+	for len(d.pending) > 0 && d.pending[0].delivered {
+		completed = append(completed, d.pending[0])
+		d.pending = d.pending[1:]
+	}
+
+	if d.failed && d.inFlight == 0 && !d.redelivering {
+		d.redelivering = true
+		redeliver = true
+	}
+	return completed, redeliver
+}
+
+// redeliveries returns the deliveries to emit again, starting with the
+// oldest one, which is the first failed delivery
+func (d *sinkDeliveries) redeliveries() []*fanOutDelivery {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]*fanOutDelivery{}, d.pending...)
+}
+
+// redelivered records the outcome of a redelivery and returns the
+// deliveries which are completed. Once the last delivery is completed,
+// or a redelivery failed, waiting deliveries continue.
+func (d *sinkDeliveries) redelivered(
+	delivery *fanOutDelivery, success bool,
+) (completed []*fanOutDelivery) {
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if success {
+		completed = []*fanOutDelivery{delivery}
+		d.pending = d.pending[1:]
+	} else {
+		completed = d.pending
+		d.pending = nil
+	}
+
+	if len(d.pending) == 0 {
+		d.failed = false
+		d.redelivering = false
+		d.cond.Broadcast()
+	}
+	return completed
+}
+
+// wakeUp lets deliveries waiting for a redelivery recheck their state
+func (d *sinkDeliveries) wakeUp() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.cond.Broadcast()
+}
+
+// fanOutAcknowledgement acknowledges an event once all
+// sinks it was emitted to acknowledged it, reporting
+// the first error, if any
+type fanOutAcknowledgement struct {
+	lock      sync.Mutex
+	remaining int
+	err       error
+	ack       sink.AcknowledgeFunc
+}
+
+func (a *fanOutAcknowledgement) complete(
+	err error,
+) {
+
+	a.lock.Lock()
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+	a.remaining--
+	done := a.remaining == 0
+	a.lock.Unlock()
+
+	if done {
+		a.ack(a.err)
+	}
+}
+
+// namespacedContext separates the attributes of named
+// sinks sharing the same underlying sink context
+type namespacedContext struct {
+	name    string
+	context sink.Context
+}
+
+func (n namespacedContext) SetTransientAttribute(
+	key string, value string,
+) {
+
+	n.context.SetTransientAttribute(n.name+"/"+key, value)
+}
+
+func (n namespacedContext) TransientAttribute(
+	key string,
+) (value string, present bool) {
+
+	return n.context.TransientAttribute(n.name + "/" + key)
+}
+
+func (n namespacedContext) SetAttribute(
+	key string, value string,
+) {
+
+	n.context.SetAttribute(n.name+"/"+key, value)
+}
+
+func (n namespacedContext) Attribute(
+	key string,
+) (value string, present bool) {
+
+	return n.context.Attribute(n.name + "/" + key)
+}
@@ -0,0 +1,413 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sink
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSinkType config.SinkType = "fanout-test"
+
+type emittedEvent struct {
+	topicName string
+	envelope  schema.Struct
+}
+
+type testSink struct {
+	mutex   sync.Mutex
+	name    string
+	events  []emittedEvent
+	pending []sink.AcknowledgeFunc
+	// failures is the number of upcoming emits to fail
+	failures int
+}
+
+var testSinks = make(map[string]*testSink)
+
+func init() {
+	RegisterSink(testSinkType, func(c *config.Config) (sink.Sink, error) {
+		// The file path is abused to identify the named sink
+		s := &testSink{name: c.Sink.File.Path}
+		testSinks[s.name] = s
+		return s, nil
+	})
+}
+
+func (t *testSink) Start() error {
+	return nil
+}
+
+func (t *testSink) Stop() error {
+	return nil
+}
+
+func (t *testSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
+) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.failures > 0 {
+		t.failures--
+		return assert.AnError
+	}
+	t.events = append(t.events, emittedEvent{topicName, envelope})
+	return nil
+}
+
+func (t *testSink) EmitAsync(
+	context sink.Context, timestamp time.Time, topicName string,
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	if err := t.Emit(context, timestamp, topicName, key, envelope); err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pending = append(t.pending, ack)
+	return nil
+}
+
+func (t *testSink) acknowledge(
+	index int, err error,
+) {
+
+	t.mutex.Lock()
+	ack := t.pending[index]
+	t.mutex.Unlock()
+	ack(err)
+}
+
+func (t *testSink) emitted() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.events)
+}
+
+func Test_FanOut_Routing(
+	t *testing.T,
+) {
+
+	f := newFanOut(t, map[string]config.NamedSinkConfig{
+		"all": namedTestSink("all"),
+		"metrics": func() config.NamedSinkConfig {
+			c := namedTestSink("metrics")
+			c.Tables.Includes = []string{"public.metrics"}
+			c.Topic.Prefix = "state"
+			return c
+		}(),
+		"creates": func() config.NamedSinkConfig {
+			c := namedTestSink("creates")
+			c.Filters = map[string]config.EventFilterConfig{
+				"creates": {Condition: `value.op == "c"`},
+			}
+			return c
+		}(),
+	})
+
+	assert.NoError(t, f.Emit(nil, time.Now(), "tsdb.public.metrics", nil, testEnvelope("metrics", "u")))
+	assert.NoError(t, f.Emit(nil, time.Now(), "tsdb.public.other", nil, testEnvelope("other", "c")))
+
+	assert.Equal(t, []string{"tsdb.public.metrics", "tsdb.public.other"}, topicNames(testSinks["all"]))
+	assert.Equal(t, []string{"state.public.metrics"}, topicNames(testSinks["metrics"]))
+	assert.Equal(t, []string{"tsdb.public.other"}, topicNames(testSinks["creates"]))
+}
+
+func Test_FanOut_Acknowledges_After_All_Sinks(
+	t *testing.T,
+) {
+
+	f := newFanOut(t, map[string]config.NamedSinkConfig{
+		"first":  namedTestSink("first"),
+		"second": namedTestSink("second"),
+	})
+
+	var acknowledged []error
+	ack := func(err error) {
+		acknowledged = append(acknowledged, err)
+	}
+
+	envelope := testEnvelope("metrics", "c")
+	assert.NoError(t, f.EmitAsync(nil, time.Now(), "tsdb.public.metrics", nil, envelope, ack))
+
+	testSinks["first"].acknowledge(0, nil)
+	assert.Len(t, acknowledged, 0)
+	testSinks["second"].acknowledge(0, nil)
+	assert.Equal(t, []error{nil}, acknowledged)
+}
+
+func Test_FanOut_Redelivers_To_Failed_Sinks_Only(
+	t *testing.T,
+) {
+
+	f := newFanOut(t, map[string]config.NamedSinkConfig{
+		"first":  namedTestSink("first"),
+		"second": namedTestSink("second"),
+		"third":  namedTestSink("third"),
+	})
+	f.newBackOff = func() backoff.BackOff {
+		return backoff.NewConstantBackOff(time.Millisecond)
+	}
+
+	acknowledged := make(chan error, 1)
+	ack := func(err error) {
+		acknowledged <- err
+	}
+
+	// The second sink fails the delivery, the third sink fails to emit
+	testSinks["third"].failures = 2
+	envelope := testEnvelope("metrics", "c")
+	assert.NoError(t, f.EmitAsync(nil, time.Now(), "tsdb.public.metrics", nil, envelope, ack))
+	testSinks["first"].acknowledge(0, nil)
+	testSinks["second"].acknowledge(0, assert.AnError)
+
+	assert.Eventually(t, func() bool {
+		return testSinks["second"].emitted() == 2 && testSinks["third"].emitted() == 1
+	}, time.Second, time.Millisecond)
+	testSinks["second"].acknowledge(1, nil)
+	testSinks["third"].acknowledge(0, nil)
+
+	assert.NoError(t, <-acknowledged)
+	assert.Equal(t, 1, testSinks["first"].emitted())
+	assert.Equal(t, 2, testSinks["second"].emitted())
+	assert.Equal(t, 1, testSinks["third"].emitted())
+}
+
+func Test_FanOut_Redelivers_In_Order(
+	t *testing.T,
+) {
+
+	f := newFanOut(t, map[string]config.NamedSinkConfig{
+		"first": namedTestSink("first"),
+	})
+	f.newBackOff = func() backoff.BackOff {
+		return backoff.NewConstantBackOff(time.Millisecond)
+	}
+
+	acknowledged := make(chan error, 3)
+	ack := func(err error) {
+		acknowledged <- err
+	}
+
+	first := testSinks["first"]
+	assert.NoError(t, f.EmitAsync(nil, time.Now(), "tsdb.public.metrics", nil, testEnvelope("metrics", "c"), ack))
+	assert.NoError(t, f.EmitAsync(nil, time.Now(), "tsdb.public.metrics", nil, testEnvelope("metrics", "u"), ack))
+
+	// The first event fails after the second one was already delivered
+	first.acknowledge(1, nil)
+	first.acknowledge(0, assert.AnError)
+
+	// New events wait for the redelivery of the failed and all later events
+	emitted := make(chan error, 1)
+	go func() {
+		emitted <- f.EmitAsync(nil, time.Now(), "tsdb.public.metrics", nil, testEnvelope("metrics", "d"), ack)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return first.emitted() == 3
+	}, time.Second, time.Millisecond)
+	first.acknowledge(2, nil)
+	assert.Eventually(t, func() bool {
+		return first.emitted() == 4
+	}, time.Second, time.Millisecond)
+	first.acknowledge(3, nil)
+
+	assert.NoError(t, <-emitted)
+	first.acknowledge(4, nil)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-acknowledged)
+	}
+	assert.Equal(t, []string{"c", "u", "c", "u", "d"}, operations(first))
+}
+
+func Test_FanOut_Reports_Permanent_Failures(
+	t *testing.T,
+) {
+
+	f := newFanOut(t, map[string]config.NamedSinkConfig{
+		"first": namedTestSink("first"),
+	})
+
+	acknowledged := make(chan error, 2)
+	ack := func(err error) {
+		acknowledged <- err
+	}
+
+	first := testSinks["first"]
+	assert.NoError(t, f.EmitAsync(nil, time.Now(), "tsdb.public.metrics", nil, testEnvelope("metrics", "c"), ack))
+	assert.NoError(t, f.EmitAsync(nil, time.Now(), "tsdb.public.metrics", nil, testEnvelope("metrics", "u"), ack))
+	first.acknowledge(0, assert.AnError)
+	first.acknowledge(1, nil)
+
+	// The redelivery fails permanently, which fails all remaining events
+	assert.Eventually(t, func() bool {
+		return first.emitted() == 3
+	}, time.Second, time.Millisecond)
+	first.acknowledge(2, backoff.Permanent(assert.AnError))
+
+	assert.Error(t, <-acknowledged)
+	assert.Error(t, <-acknowledged)
+	assert.Equal(t, 3, first.emitted())
+}
+
+func Test_FanOut_Reports_Failures_After_Stop(
+	t *testing.T,
+) {
+
+	f := newFanOut(t, map[string]config.NamedSinkConfig{
+		"first":  namedTestSink("first"),
+		"second": namedTestSink("second"),
+	})
+
+	acknowledged := make(chan error, 1)
+	ack := func(err error) {
+		acknowledged <- err
+	}
+
+	assert.NoError(t, f.EmitAsync(nil, time.Now(), "tsdb.public.metrics", nil, testEnvelope("metrics", "c"), ack))
+	assert.NoError(t, f.Stop())
+
+	testSinks["first"].acknowledge(0, nil)
+	testSinks["second"].acknowledge(0, assert.AnError)
+	assert.Error(t, <-acknowledged)
+	assert.Equal(t, 1, testSinks["second"].emitted())
+}
+
+func Test_FanOut_Rejects_Single_Sink_Type(
+	t *testing.T,
+) {
+
+	_, err := NewFanOutSink(&config.Config{
+		Sink: config.SinkConfig{
+			Type:  config.Stdout,
+			Sinks: map[string]config.NamedSinkConfig{"all": namedTestSink("all")},
+		},
+	})
+	assert.Error(t, err)
+
+	_, err = NewFanOutSink(&config.Config{
+		Sink: config.SinkConfig{
+			Sinks: map[string]config.NamedSinkConfig{"untyped": {}},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func Test_FanOut_Rejects_Topic_Prefix_With_Custom_Naming_Strategy(
+	t *testing.T,
+) {
+
+	named := namedTestSink("prefixed")
+	named.Topic.Prefix = "state"
+
+	_, err := NewFanOutSink(&config.Config{
+		Sink: config.SinkConfig{Sinks: map[string]config.NamedSinkConfig{"prefixed": named}},
+		Topic: config.TopicConfig{
+			Prefix:         "tsdb",
+			NamingStrategy: config.TopicNamingStrategyConfig{Type: "custom"},
+		},
+	})
+	assert.Error(t, err)
+
+	_, err = NewFanOutSink(&config.Config{
+		Sink: config.SinkConfig{Sinks: map[string]config.NamedSinkConfig{"prefixed": named}},
+		Topic: config.TopicConfig{
+			Prefix:         "tsdb",
+			NamingStrategy: config.TopicNamingStrategyConfig{Type: config.Debezium},
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func newFanOut(
+	t *testing.T, sinks map[string]config.NamedSinkConfig,
+) *fanOutSink {
+
+	s, err := NewFanOutSink(&config.Config{
+		Sink:  config.SinkConfig{Sinks: sinks},
+		Topic: config.TopicConfig{Prefix: "tsdb"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*fanOutSink)
+}
+
+func namedTestSink(
+	name string,
+) config.NamedSinkConfig {
+
+	return config.NamedSinkConfig{
+		SinkConfig: config.SinkConfig{
+			Type: testSinkType,
+			File: config.FileSinkConfig{Path: name},
+		},
+	}
+}
+
+func testEnvelope(
+	tableName, operation string,
+) schema.Struct {
+
+	return schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: operation,
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: "public",
+			schema.FieldNameTable:  tableName,
+		},
+	})
+}
+
+func operations(
+	s *testSink,
+) []string {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	operations := make([]string, 0, len(s.events))
+	for _, event := range s.events {
+		payload := event.envelope[schema.FieldNamePayload].(schema.Struct)
+		operations = append(operations, payload[schema.FieldNameOperation].(string))
+	}
+	return operations
+}
+
+func topicNames(
+	s *testSink,
+) []string {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names := make([]string, 0, len(s.events))
+	for _, event := range s.events {
+		names = append(names, event.topicName)
+	}
+	return names
+}
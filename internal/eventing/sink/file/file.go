@@ -0,0 +1,200 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package file
+
+import (
+	stderrors "errors"
+	"github.com/go-errors/errors"
+	"github.com/inhies/go-bytesize"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultMaxSize bytesize.ByteSize = 104857600
+
+func init() {
+	sinkimpl.RegisterSink(config.File, newFileSink)
+}
+
+type fileSink struct {
+	path        string
+	encoder     encoding.Encoder
+	delimited   bool
+	maxSize     int64
+	maxDuration time.Duration
+	compression config.FileCompressionType
+	writers     map[string]*segmentWriter
+	mutex       sync.Mutex
+	shutdown    chan struct{}
+	waitGroup   sync.WaitGroup
+	logger      *logging.Logger
+}
+
+func newFileSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize := defaultMaxSize
+	if size := config.GetOrDefault[*string](c, config.PropertyFileSinkMaxSize, nil); size != nil {
+		if maxSize, err = bytesize.Parse(*size); err != nil {
+			return nil, errors.Errorf("Failed to parse max size property '%s' => %s", *size, err.Error())
+		}
+	}
+
+	compression := config.GetOrDefault(c, config.PropertyFileSinkCompression, config.FileCompressionNone)
+	switch compression {
+	case config.FileCompressionNone, config.FileCompressionGzip, config.FileCompressionZstd:
+	default:
+		return nil, errors.Errorf("unknown file compression type: %s", compression)
+	}
+
+	logger, err := logging.NewLogger("FileSink")
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON envelopes are written newline-delimited, binary
+	// encodings are written with a length prefix instead
+	_, delimited := encoder.(*encoding.JsonEncoder)
+
+	return &fileSink{
+		path:      config.GetOrDefault(c, config.PropertyFileSinkPath, "./events"),
+		encoder:   encoder,
+		delimited: delimited,
+		maxSize:   int64(maxSize),
+		maxDuration: time.Duration(config.GetOrDefault(
+			c, config.PropertyFileSinkMaxDuration, 3600,
+		)) * time.Second,
+		compression: compression,
+		writers:     make(map[string]*segmentWriter),
+		shutdown:    make(chan struct{}),
+		logger:      logger,
+	}, nil
+}
+
+func (f *fileSink) Start() error {
+	if err := os.MkdirAll(f.path, 0o755); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if f.maxDuration > 0 {
+		f.waitGroup.Add(1)
+		go f.rotateExpiredSegments()
+	}
+	return nil
+}
+
+func (f *fileSink) Stop() error {
+	close(f.shutdown)
+	f.waitGroup.Wait()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// Seal the active segments, otherwise they'd
+	// miss compression and the manifest entry
+	var err error
+	for _, writer := range f.writers {
+		err = stderrors.Join(err, writer.seal())
+	}
+	return err
+}
+
+func (f *fileSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
+) error {
+
+	data, err := f.encoder.EncodeEnvelope(topicName, envelope)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	writer, present := f.writers[topicName]
+	if !present {
+		writer, err = newSegmentWriter(f.path, topicName, f.delimited, f.compression)
+		if err != nil {
+			return err
+		}
+		f.writers[topicName] = writer
+	}
+
+	// Rotate before the segment exceeds the maximum size, a single
+	// record larger than the maximum size ends up in its own segment
+	if writer.size > 0 && writer.size+writer.recordSize(data) > f.maxSize {
+		if err := writer.seal(); err != nil {
+			return err
+		}
+	}
+
+	return writer.write(data, lsnOf(envelope))
+}
+
+// rotateExpiredSegments periodically seals segments which are
+// open longer than the maximum duration. Segments of topics
+// without any further events would never be rotated otherwise.
+func (f *fileSink) rotateExpiredSegments() {
+	defer f.waitGroup.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.shutdown:
+			return
+		case now := <-ticker.C:
+			f.mutex.Lock()
+			for topicName, writer := range f.writers {
+				if writer.expired(now, f.maxDuration) {
+					if err := writer.seal(); err != nil {
+						f.logger.Errorf("Failed to rotate segment of topic %s: %+v", topicName, err)
+					}
+				}
+			}
+			f.mutex.Unlock()
+		}
+	}
+}
+
+func lsnOf(
+	envelope schema.Struct,
+) string {
+
+	if payload, ok := envelope[schema.FieldNamePayload].(schema.Struct); ok {
+		if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+			if lsn, ok := source[schema.FieldNameLSN].(string); ok {
+				return lsn
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"github.com/goccy/go-json"
+	"github.com/klauspost/compress/zstd"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestFileSink(
+	t *testing.T, path string, maxSize string, compression spiconfig.FileCompressionType,
+) *fileSink {
+
+	s, err := newFileSink(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.File,
+			File: spiconfig.FileSinkConfig{
+				Path:        path,
+				MaxSize:     lo.ToPtr(maxSize),
+				MaxDuration: lo.ToPtr(-1),
+				Compression: compression,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return s.(*fileSink)
+}
+
+func testEnvelope(
+	lsn string,
+) schema.Struct {
+
+	return schema.Struct{
+		schema.FieldNamePayload: schema.Struct{
+			schema.FieldNameOperation: "c",
+			schema.FieldNameSource: schema.Struct{
+				schema.FieldNameLSN: lsn,
+			},
+		},
+	}
+}
+
+func readManifest(
+	t *testing.T, directory string,
+) []manifestEntry {
+
+	manifest, err := os.Open(filepath.Join(directory, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifest.Close()
+
+	entries := make([]manifestEntry, 0)
+	scanner := bufio.NewScanner(manifest)
+	for scanner.Scan() {
+		var entry manifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func readLines(
+	t *testing.T, path string, decompress func(reader io.Reader) (io.Reader, error),
+) int {
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := decompress(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func Test_File_Rotates_And_Compresses_Segments(
+	t *testing.T,
+) {
+
+	path := t.TempDir()
+	s := newTestFileSink(t, path, "100B", spiconfig.FileCompressionGzip)
+
+	lsns := []string{"0/1", "0/2", "0/3", "0/4", "0/5"}
+	for _, lsn := range lsns {
+		assert.NoError(t, s.Emit(nil, time.Now(), "topic", nil, testEnvelope(lsn)))
+	}
+	assert.NoError(t, s.Emit(nil, time.Now(), "other", nil, testEnvelope("0/6")))
+	assert.NoError(t, s.Stop())
+
+	directory := filepath.Join(path, "topic")
+	entries := readManifest(t, directory)
+	assert.Equal(t, 3, len(entries))
+
+	events := 0
+	for i, entry := range entries {
+		assert.Equal(t, lsns[events], entry.FirstLSN)
+		events += entry.Events
+		assert.Equal(t, lsns[events-1], entry.LastLSN)
+
+		assert.Equal(t, entry.Events, readLines(t, filepath.Join(directory, entry.Segment),
+			func(reader io.Reader) (io.Reader, error) {
+				return gzip.NewReader(reader)
+			},
+		))
+
+		// Uncompressed segments are removed after compression
+		_, err := os.Stat(filepath.Join(directory, entry.Segment[:len(entry.Segment)-3]))
+		assert.True(t, os.IsNotExist(err), "segment %d wasn't removed", i)
+	}
+	assert.Equal(t, len(lsns), events)
+
+	otherEntries := readManifest(t, filepath.Join(path, "other"))
+	assert.Equal(t, 1, len(otherEntries))
+	assert.Equal(t, "0/6", otherEntries[0].FirstLSN)
+}
+
+func Test_File_Zstd_Compression_And_Sequence_Continuation(
+	t *testing.T,
+) {
+
+	path := t.TempDir()
+	s := newTestFileSink(t, path, "1MB", spiconfig.FileCompressionZstd)
+	assert.NoError(t, s.Emit(nil, time.Now(), "topic", nil, testEnvelope("0/1")))
+	assert.NoError(t, s.Stop())
+
+	// A restarted sink continues the segment sequence
+	s = newTestFileSink(t, path, "1MB", spiconfig.FileCompressionZstd)
+	assert.NoError(t, s.Emit(nil, time.Now(), "topic", nil, testEnvelope("0/2")))
+	assert.NoError(t, s.Stop())
+
+	directory := filepath.Join(path, "topic")
+	entries := readManifest(t, directory)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "topic-0000000001.ndjson.zst", entries[0].Segment)
+	assert.Equal(t, "topic-0000000002.ndjson.zst", entries[1].Segment)
+
+	for _, entry := range entries {
+		assert.Equal(t, 1, readLines(t, filepath.Join(directory, entry.Segment),
+			func(reader io.Reader) (io.Reader, error) {
+				return zstd.NewReader(reader)
+			},
+		))
+	}
+}
@@ -0,0 +1,301 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package file
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/goccy/go-json"
+	"github.com/klauspost/compress/zstd"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const manifestFileName = "manifest.ndjson"
+
+// manifestEntry describes a sealed segment. The manifest is
+// written newline-delimited and only ever appended to.
+type manifestEntry struct {
+	Segment  string    `json:"segment"`
+	FirstLSN string    `json:"firstLsn"`
+	LastLSN  string    `json:"lastLsn"`
+	Events   int       `json:"events"`
+	Bytes    int64     `json:"bytes"`
+	OpenedAt time.Time `json:"openedAt"`
+	SealedAt time.Time `json:"sealedAt"`
+}
+
+// segmentWriter writes the records of a single topic into a sequence of
+// segment files inside the topic's directory. The active segment is always
+// uncompressed and gets compressed when it is sealed.
+type segmentWriter struct {
+	directory   string
+	topicName   string
+	delimited   bool
+	compression config.FileCompressionType
+
+	sequence uint64
+	file     *os.File
+	size     int64
+	events   int
+	firstLSN string
+	lastLSN  string
+	openedAt time.Time
+}
+
+func newSegmentWriter(
+	path, topicName string, delimited bool, compression config.FileCompressionType,
+) (*segmentWriter, error) {
+
+	directory := filepath.Join(path, strings.ReplaceAll(topicName, string(os.PathSeparator), "_"))
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	// Continue the sequence of segments of a previous run
+	sequence, err := lastSequence(directory, topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &segmentWriter{
+		directory:   directory,
+		topicName:   topicName,
+		delimited:   delimited,
+		compression: compression,
+		sequence:    sequence,
+	}, nil
+}
+
+func (s *segmentWriter) recordSize(
+	data []byte,
+) int64 {
+
+	// Newline or the length prefix
+	if s.delimited {
+		return int64(len(data) + 1)
+	}
+	return int64(len(data) + 4)
+}
+
+func (s *segmentWriter) write(
+	data []byte, lsn string,
+) error {
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, 0, s.recordSize(data))
+	if s.delimited {
+		record = append(append(record, data...), '\n')
+	} else {
+		record = binary.BigEndian.AppendUint32(record, uint32(len(data)))
+		record = append(record, data...)
+	}
+
+	if _, err := s.file.Write(record); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	s.size += int64(len(record))
+	s.events++
+	if lsn != "" {
+		if s.firstLSN == "" {
+			s.firstLSN = lsn
+		}
+		s.lastLSN = lsn
+	}
+	return nil
+}
+
+func (s *segmentWriter) expired(
+	now time.Time, maxDuration time.Duration,
+) bool {
+
+	return s.file != nil && now.Sub(s.openedAt) >= maxDuration
+}
+
+func (s *segmentWriter) open() error {
+	s.sequence++
+	file, err := os.OpenFile(s.segmentPath(""), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	s.file = file
+	s.size = 0
+	s.events = 0
+	s.firstLSN = ""
+	s.lastLSN = ""
+	s.openedAt = time.Now()
+	return nil
+}
+
+// seal closes the active segment, compresses it (if configured),
+// and records it in the manifest. Without an active segment,
+// seal is a no-op.
+func (s *segmentWriter) seal() error {
+	if s.file == nil {
+		return nil
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if err := s.file.Close(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	s.file = nil
+
+	segmentPath, err := s.compress()
+	if err != nil {
+		return err
+	}
+
+	return s.appendManifest(manifestEntry{
+		Segment:  filepath.Base(segmentPath),
+		FirstLSN: s.firstLSN,
+		LastLSN:  s.lastLSN,
+		Events:   s.events,
+		Bytes:    s.size,
+		OpenedAt: s.openedAt,
+		SealedAt: time.Now(),
+	})
+}
+
+func (s *segmentWriter) compress() (string, error) {
+	var suffix string
+	var newWriter func(writer io.Writer) (io.WriteCloser, error)
+
+	switch s.compression {
+	case config.FileCompressionGzip:
+		suffix = ".gz"
+		newWriter = func(writer io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(writer), nil
+		}
+	case config.FileCompressionZstd:
+		suffix = ".zst"
+		newWriter = func(writer io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(writer)
+		}
+	default:
+		return s.segmentPath(""), nil
+	}
+
+	source, err := os.Open(s.segmentPath(""))
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(s.segmentPath(suffix), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	defer target.Close()
+
+	compressor, err := newWriter(target)
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	if _, err := io.Copy(compressor, source); err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	if err := compressor.Close(); err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	if err := target.Sync(); err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+
+	// The uncompressed segment is only removed after the
+	// compressed one was completely written to disk
+	if err := os.Remove(s.segmentPath("")); err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	return s.segmentPath(suffix), nil
+}
+
+func (s *segmentWriter) appendManifest(
+	entry manifestEntry,
+) error {
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	manifest, err := os.OpenFile(
+		filepath.Join(s.directory, manifestFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644,
+	)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer manifest.Close()
+
+	if _, err := manifest.Write(append(data, '\n')); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return manifest.Sync()
+}
+
+func (s *segmentWriter) segmentPath(
+	suffix string,
+) string {
+
+	extension := ".bin"
+	if s.delimited {
+		extension = ".ndjson"
+	}
+	return filepath.Join(s.directory, fmt.Sprintf("%s-%010d%s%s", s.topicName, s.sequence, extension, suffix))
+}
+
+// lastSequence returns the highest segment sequence number
+// found in the directory, or zero if no segment exists
+func lastSequence(
+	directory, topicName string,
+) (uint64, error) {
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+
+	prefix := topicName + "-"
+	sequence := uint64(0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		number, _, _ := strings.Cut(strings.TrimPrefix(name, prefix), ".")
+		if n, err := strconv.ParseUint(number, 10, 64); err == nil && n > sequence {
+			sequence = n
+		}
+	}
+	return sequence, nil
+}
@@ -0,0 +1,322 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package grpc
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/containers"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+const serviceName = "timescaledb.eventstreamer.v1.EventStream"
+
+var serviceDesc = googlegrpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*any)(nil),
+	Streams: []googlegrpc.StreamDesc{{
+		StreamName:    "Subscribe",
+		Handler:       subscribeHandler,
+		ServerStreams: true,
+	}},
+	Metadata: "eventstream.proto",
+}
+
+func init() {
+	sinkimpl.RegisterSink(config.Grpc, newGrpcSink)
+}
+
+// position identifies an event by its LSN and the ordinal
+// within all events sharing the same LSN
+type position struct {
+	lsn     pglogrepl.LSN
+	ordinal uint32
+}
+
+func (p position) after(
+	other position,
+) bool {
+
+	return p.lsn > other.lsn || (p.lsn == other.lsn && p.ordinal > other.ordinal)
+}
+
+type bufferedEvent struct {
+	position position
+	table    string
+	event    *event
+}
+
+type grpcSink struct {
+	address  string
+	server   *googlegrpc.Server
+	listener net.Listener
+	encoder  encoding.Encoder
+	buffer   *containers.RingBuffer[*bufferedEvent]
+	capacity int
+	logger   *logging.Logger
+
+	emitLock sync.Mutex
+	last     *position
+	evicted  *position
+}
+
+func newGrpcSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	capacity := config.GetOrDefault(c, config.PropertyGrpcBufferSize, 10000)
+	if capacity <= 0 {
+		return nil, errors.Errorf("gRPC buffer size must be positive, but was %d", capacity)
+	}
+
+	options := []googlegrpc.ServerOption{
+		googlegrpc.ForceServerCodec(codec{}),
+	}
+
+	certFile := config.GetOrDefault(c, config.PropertyGrpcTlsCertFile, "")
+	keyFile := config.GetOrDefault(c, config.PropertyGrpcTlsKeyFile, "")
+	if certFile != "" || keyFile != "" {
+		serverCredentials, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		options = append(options, googlegrpc.Creds(serverCredentials))
+	}
+
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := logging.NewLogger("GrpcSink")
+	if err != nil {
+		return nil, err
+	}
+
+	g := &grpcSink{
+		address:  config.GetOrDefault(c, config.PropertyGrpcAddress, ":9090"),
+		encoder:  encoder,
+		buffer:   containers.NewRingBuffer[*bufferedEvent](capacity),
+		capacity: capacity,
+		logger:   logger,
+	}
+
+	g.server = googlegrpc.NewServer(options...)
+	g.server.RegisterService(&serviceDesc, g)
+	return g, nil
+}
+
+func (g *grpcSink) Start() error {
+	listener, err := net.Listen("tcp", g.address)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	g.listener = listener
+
+	go func() {
+		if err := g.server.Serve(listener); err != nil {
+			g.logger.Errorf("gRPC server stopped: %+v", err)
+		}
+	}()
+	g.logger.Infof("gRPC server listening on %s", listener.Addr())
+	return nil
+}
+
+func (g *grpcSink) Stop() error {
+	// Closing the buffer ends all subscriptions, which
+	// is required for the graceful stop to finish
+	g.buffer.Close()
+	g.server.GracefulStop()
+	return nil
+}
+
+func (g *grpcSink) Emit(
+	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	keyData, err := g.encoder.EncodeKey(topicName, key)
+	if err != nil {
+		return err
+	}
+	envelopeData, err := g.encoder.EncodeEnvelope(topicName, envelope)
+	if err != nil {
+		return err
+	}
+
+	var lsn pglogrepl.LSN
+	var table string
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+		if l, ok := source[schema.FieldNameLSN].(string); ok {
+			if lsn, err = pglogrepl.ParseLSN(l); err != nil {
+				return errors.Wrap(err, 0)
+			}
+		}
+		schemaName, _ := source[schema.FieldNameSchema].(string)
+		tableName, _ := source[schema.FieldNameTable].(string)
+		table = fmt.Sprintf("%s.%s", schemaName, tableName)
+	}
+
+	g.emitLock.Lock()
+	defer g.emitLock.Unlock()
+
+	eventPosition := position{lsn: lsn}
+	if g.last != nil && g.last.lsn == lsn {
+		eventPosition.ordinal = g.last.ordinal + 1
+	}
+	g.last = &eventPosition
+
+	// Remember the last overwritten event, to detect if
+	// a resume position isn't available anymore
+	if g.buffer.Next()-g.buffer.Oldest() == uint64(g.capacity) {
+		if oldest, ok := g.buffer.Get(g.buffer.Oldest()); ok {
+			g.evicted = &oldest.position
+		}
+	}
+
+	g.buffer.Append(&bufferedEvent{
+		position: eventPosition,
+		table:    table,
+		event: &event{
+			topic:     topicName,
+			lsn:       lsn.String(),
+			ordinal:   eventPosition.ordinal,
+			key:       keyData,
+			envelope:  envelopeData,
+			timestamp: timestamp.UnixMilli(),
+		},
+	})
+	return nil
+}
+
+func subscribeHandler(
+	srv any, stream googlegrpc.ServerStream,
+) error {
+
+	request := &subscribeRequest{}
+	if err := stream.RecvMsg(request); err != nil {
+		return err
+	}
+	return srv.(*grpcSink).subscribe(request, stream)
+}
+
+func (g *grpcSink) subscribe(
+	request *subscribeRequest, stream googlegrpc.ServerStream,
+) error {
+
+	cursor, err := g.startCursor(request)
+	if err != nil {
+		return err
+	}
+
+	// Sending the headers signals the client that the subscription
+	// is established, and no subsequent event will be missed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	topics := make(map[string]bool, len(request.topics))
+	for _, topic := range request.topics {
+		topics[topic] = true
+	}
+
+	for {
+		// Retrieve the wait channel first to not miss appends
+		wait := g.buffer.Wait()
+
+		if buffered, ok := g.buffer.Get(cursor); ok {
+			cursor++
+			if len(topics) == 0 || topics[buffered.event.topic] || topics[buffered.table] {
+				if err := stream.SendMsg(buffered.event); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if cursor < g.buffer.Oldest() {
+			return status.Error(codes.ResourceExhausted,
+				"subscriber fell behind and events were overwritten, resume from the last received event",
+			)
+		}
+
+		if g.buffer.Closed() {
+			return status.Error(codes.Unavailable, "event stream is shutting down")
+		}
+
+		select {
+		case <-wait:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// startCursor returns the buffer position of the first event to send
+func (g *grpcSink) startCursor(
+	request *subscribeRequest,
+) (uint64, error) {
+
+	g.emitLock.Lock()
+	defer g.emitLock.Unlock()
+
+	if request.fromOldest {
+		return g.buffer.Oldest(), nil
+	}
+	if request.resumeLsn == "" {
+		return g.buffer.Next(), nil
+	}
+
+	lsn, err := pglogrepl.ParseLSN(request.resumeLsn)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid resume LSN: %s", request.resumeLsn)
+	}
+
+	resume := position{lsn: lsn, ordinal: math.MaxUint32}
+	if request.resumeOrdinal != nil {
+		resume.ordinal = *request.resumeOrdinal
+	}
+
+	if g.evicted != nil && g.evicted.after(resume) {
+		return 0, status.Errorf(codes.OutOfRange,
+			"resume position %s isn't available anymore", request.resumeLsn,
+		)
+	}
+
+	next := g.buffer.Next()
+	for cursor := g.buffer.Oldest(); cursor < next; cursor++ {
+		if buffered, ok := g.buffer.Get(cursor); ok && buffered.position.after(resume) {
+			return cursor, nil
+		}
+	}
+	return next, nil
+}
@@ -0,0 +1,195 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package grpc
+
+import (
+	"context"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func Test_Grpc_Messages(
+	t *testing.T,
+) {
+
+	request := &subscribeRequest{
+		topics:        []string{"tsdb.public.metrics", "public.other"},
+		resumeLsn:     "0/16B3748",
+		resumeOrdinal: lo.ToPtr(uint32(0)),
+		fromOldest:    true,
+	}
+	decodedRequest := &subscribeRequest{}
+	assert.NoError(t, decodedRequest.unmarshal(request.marshal()))
+	assert.Equal(t, request, decodedRequest)
+
+	// An absent ordinal is distinguished from ordinal 0
+	decodedRequest = &subscribeRequest{}
+	assert.NoError(t, decodedRequest.unmarshal((&subscribeRequest{resumeLsn: "0/1"}).marshal()))
+	assert.Nil(t, decodedRequest.resumeOrdinal)
+
+	e := &event{
+		topic:     "tsdb.public.metrics",
+		lsn:       "0/16B3748",
+		ordinal:   3,
+		key:       []byte(`{"id":1}`),
+		envelope:  []byte(`{}`),
+		timestamp: 1679702400000,
+	}
+	decodedEvent := &event{}
+	assert.NoError(t, decodedEvent.unmarshal(e.marshal()))
+	assert.Equal(t, e, decodedEvent)
+
+	assert.Error(t, decodedEvent.unmarshal([]byte{0x0a, 0xff}))
+}
+
+func Test_Grpc_Subscribe_And_Resume(
+	t *testing.T,
+) {
+
+	g := startSink(t, 4)
+
+	emit(t, g, "tsdb.public.metrics", "public", "metrics", "0/100")
+	emit(t, g, "tsdb.public.metrics", "public", "metrics", "0/100")
+	emit(t, g, "tsdb.public.other", "public", "other", "0/200")
+
+	// Resuming after the first event of LSN 0/100
+	stream := subscribe(t, g, &subscribeRequest{resumeLsn: "0/100", resumeOrdinal: lo.ToPtr(uint32(0))})
+	assertEvent(t, stream, "tsdb.public.metrics", "0/100", 1)
+	assertEvent(t, stream, "tsdb.public.other", "0/200", 0)
+
+	// Resuming after all events of LSN 0/100, filtered by hypertable name
+	stream = subscribe(t, g, &subscribeRequest{topics: []string{"public.metrics"}, resumeLsn: "0/0"})
+	assertEvent(t, stream, "tsdb.public.metrics", "0/100", 0)
+	assertEvent(t, stream, "tsdb.public.metrics", "0/100", 1)
+
+	// New events are streamed to all subscribers
+	live := subscribe(t, g, &subscribeRequest{topics: []string{"tsdb.public.metrics"}})
+	emit(t, g, "tsdb.public.metrics", "public", "metrics", "0/300")
+	assertEvent(t, stream, "tsdb.public.metrics", "0/300", 0)
+	assertEvent(t, live, "tsdb.public.metrics", "0/300", 0)
+
+	// Overwrites the first event of 0/100
+	emit(t, g, "tsdb.public.metrics", "public", "metrics", "0/400")
+	stream = subscribe(t, g, &subscribeRequest{resumeLsn: "0/0"})
+	err := stream.RecvMsg(&event{})
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	stream = subscribe(t, g, &subscribeRequest{fromOldest: true})
+	assertEvent(t, stream, "tsdb.public.metrics", "0/100", 1)
+}
+
+func startSink(
+	t *testing.T, bufferSize int,
+) *grpcSink {
+
+	s, err := newGrpcSink(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Grpc: spiconfig.GrpcSinkConfig{
+				Address: "127.0.0.1:0",
+				Buffer: spiconfig.GrpcBufferConfig{
+					Size: bufferSize,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Stop()
+	})
+	return s.(*grpcSink)
+}
+
+func emit(
+	t *testing.T, g *grpcSink, topicName, schemaName, tableName, lsn string,
+) {
+
+	envelope := schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: "c",
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: schemaName,
+			schema.FieldNameTable:  tableName,
+			schema.FieldNameLSN:    lsn,
+		},
+	})
+	if err := g.Emit(nil, time.Now(), topicName, nil, envelope); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func subscribe(
+	t *testing.T, g *grpcSink, request *subscribeRequest,
+) googlegrpc.ClientStream {
+
+	conn, err := googlegrpc.Dial(
+		g.listener.Addr().String(),
+		googlegrpc.WithTransportCredentials(insecure.NewCredentials()),
+		googlegrpc.WithDefaultCallOptions(googlegrpc.ForceCodec(codec{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(func() {
+		cancel()
+		conn.Close()
+	})
+
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/Subscribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(request); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the subscription to be established, failed
+	// subscriptions are reported when receiving the first event
+	stream.Header()
+	return stream
+}
+
+func assertEvent(
+	t *testing.T, stream googlegrpc.ClientStream, topicName, lsn string, ordinal uint32,
+) {
+
+	t.Helper()
+	received := &event{}
+	if err := stream.RecvMsg(received); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, topicName, received.topic)
+	assert.Equal(t, lsn, received.lsn)
+	assert.Equal(t, ordinal, received.ordinal)
+	assert.Contains(t, string(received.envelope), `"op":"c"`)
+}
@@ -0,0 +1,203 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package grpc
+
+import (
+	"github.com/go-errors/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// subscribeRequest is the SubscribeRequest message of eventstream.proto
+type subscribeRequest struct {
+	topics        []string
+	resumeLsn     string
+	resumeOrdinal *uint32
+	fromOldest    bool
+}
+
+func (s *subscribeRequest) marshal() []byte {
+	data := make([]byte, 0, 64)
+	for _, topic := range s.topics {
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendString(data, topic)
+	}
+	if s.resumeLsn != "" {
+		data = protowire.AppendTag(data, 2, protowire.BytesType)
+		data = protowire.AppendString(data, s.resumeLsn)
+	}
+	if s.resumeOrdinal != nil {
+		data = protowire.AppendTag(data, 3, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(*s.resumeOrdinal))
+	}
+	if s.fromOldest {
+		data = protowire.AppendTag(data, 4, protowire.VarintType)
+		data = protowire.AppendVarint(data, protowire.EncodeBool(true))
+	}
+	return data
+}
+
+func (s *subscribeRequest) unmarshal(
+	data []byte,
+) error {
+
+	return consumeFields(data, func(number protowire.Number, kind protowire.Type, data []byte) int {
+		switch {
+		case number == 1 && kind == protowire.BytesType:
+			topic, n := protowire.ConsumeString(data)
+			s.topics = append(s.topics, topic)
+			return n
+		case number == 2 && kind == protowire.BytesType:
+			lsn, n := protowire.ConsumeString(data)
+			s.resumeLsn = lsn
+			return n
+		case number == 3 && kind == protowire.VarintType:
+			ordinal, n := protowire.ConsumeVarint(data)
+			resumeOrdinal := uint32(ordinal)
+			s.resumeOrdinal = &resumeOrdinal
+			return n
+		case number == 4 && kind == protowire.VarintType:
+			fromOldest, n := protowire.ConsumeVarint(data)
+			s.fromOldest = protowire.DecodeBool(fromOldest)
+			return n
+		}
+		return protowire.ConsumeFieldValue(number, kind, data)
+	})
+}
+
+// event is the Event message of eventstream.proto
+type event struct {
+	topic     string
+	lsn       string
+	ordinal   uint32
+	key       []byte
+	envelope  []byte
+	timestamp int64
+}
+
+func (e *event) marshal() []byte {
+	data := make([]byte, 0, len(e.topic)+len(e.lsn)+len(e.key)+len(e.envelope)+32)
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	data = protowire.AppendString(data, e.topic)
+	data = protowire.AppendTag(data, 2, protowire.BytesType)
+	data = protowire.AppendString(data, e.lsn)
+	if e.ordinal != 0 {
+		data = protowire.AppendTag(data, 3, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(e.ordinal))
+	}
+	if len(e.key) > 0 {
+		data = protowire.AppendTag(data, 4, protowire.BytesType)
+		data = protowire.AppendBytes(data, e.key)
+	}
+	if len(e.envelope) > 0 {
+		data = protowire.AppendTag(data, 5, protowire.BytesType)
+		data = protowire.AppendBytes(data, e.envelope)
+	}
+	data = protowire.AppendTag(data, 6, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(e.timestamp))
+	return data
+}
+
+func (e *event) unmarshal(
+	data []byte,
+) error {
+
+	return consumeFields(data, func(number protowire.Number, kind protowire.Type, data []byte) int {
+		switch {
+		case number == 1 && kind == protowire.BytesType:
+			topic, n := protowire.ConsumeString(data)
+			e.topic = topic
+			return n
+		case number == 2 && kind == protowire.BytesType:
+			lsn, n := protowire.ConsumeString(data)
+			e.lsn = lsn
+			return n
+		case number == 3 && kind == protowire.VarintType:
+			ordinal, n := protowire.ConsumeVarint(data)
+			e.ordinal = uint32(ordinal)
+			return n
+		case number == 4 && kind == protowire.BytesType:
+			key, n := protowire.ConsumeBytes(data)
+			e.key = append([]byte(nil), key...)
+			return n
+		case number == 5 && kind == protowire.BytesType:
+			envelope, n := protowire.ConsumeBytes(data)
+			e.envelope = append([]byte(nil), envelope...)
+			return n
+		case number == 6 && kind == protowire.VarintType:
+			timestamp, n := protowire.ConsumeVarint(data)
+			e.timestamp = int64(timestamp)
+			return n
+		}
+		return protowire.ConsumeFieldValue(number, kind, data)
+	})
+}
+
+// consumeFields calls the consumer for every field, which returns
+// the number of bytes consumed, or a negative value on error
+func consumeFields(
+	data []byte, consumer func(number protowire.Number, kind protowire.Type, data []byte) int,
+) error {
+
+	for len(data) > 0 {
+		number, kind, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errors.Wrap(protowire.ParseError(n), 0)
+		}
+		data = data[n:]
+
+		n = consumer(number, kind, data)
+		if n < 0 {
+			return errors.Wrap(protowire.ParseError(n), 0)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// codec replaces the generated code based default codec, to
+// encode and decode the hand-written messages of this package
+type codec struct{}
+
+func (codec) Marshal(
+	v any,
+) ([]byte, error) {
+
+	switch message := v.(type) {
+	case *event:
+		return message.marshal(), nil
+	case *subscribeRequest:
+		return message.marshal(), nil
+	}
+	return nil, errors.Errorf("unsupported message type %T", v)
+}
+
+func (codec) Unmarshal(
+	data []byte, v any,
+) error {
+
+	switch message := v.(type) {
+	case *event:
+		return message.unmarshal(data)
+	case *subscribeRequest:
+		return message.unmarshal(data)
+	}
+	return errors.Errorf("unsupported message type %T", v)
+}
+
+func (codec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,84 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	nethttp "net/http"
+)
+
+const defaultSignatureHeader = "X-Signature"
+
+// authenticator adds the configured authentication to the
+// request. The body is passed to enable request signing.
+type authenticator func(request *nethttp.Request, body []byte)
+
+func newAuthenticator(
+	c *config.Config,
+) (authenticator, error) {
+
+	authenticationType := config.GetOrDefault(
+		c, config.PropertyHttpAuthenticationType, config.HttpAuthenticationNone,
+	)
+
+	switch authenticationType {
+	case config.HttpAuthenticationNone:
+		return func(_ *nethttp.Request, _ []byte) {}, nil
+
+	case config.HttpAuthenticationBasic:
+		username := config.GetOrDefault(c, config.PropertyHttpBasicUsername, "")
+		password := config.GetOrDefault(c, config.PropertyHttpBasicPassword, "")
+		return func(request *nethttp.Request, _ []byte) {
+			request.SetBasicAuth(username, password)
+		}, nil
+
+	case config.HttpAuthenticationBearer:
+		token := config.GetOrDefault(c, config.PropertyHttpBearerToken, "")
+		if token == "" {
+			return nil, errors.Errorf("HTTP sink bearer authentication needs a token to be configured")
+		}
+		return func(request *nethttp.Request, _ []byte) {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}, nil
+
+	case config.HttpAuthenticationHmac:
+		secret := config.GetOrDefault(c, config.PropertyHttpHmacSecret, "")
+		if secret == "" {
+			return nil, errors.Errorf("HTTP sink hmac authentication needs a secret to be configured")
+		}
+		header := config.GetOrDefault(c, config.PropertyHttpHmacHeader, defaultSignatureHeader)
+		return func(request *nethttp.Request, body []byte) {
+			request.Header.Set(header, signature([]byte(secret), body))
+		}, nil
+	}
+	return nil, errors.Errorf("unknown HTTP authentication type: %s", authenticationType)
+}
+
+// signature calculates the HMAC-SHA256 of the body, formatted
+// as sha256=<hex>, the format commonly used by webhook providers
+func signature(
+	secret, body []byte,
+) string {
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,240 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/goccy/go-json"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/batching"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"io"
+	nethttp "net/http"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.Http, newHttpSink)
+}
+
+// httpRecord is the wire representation of a single event. With the JSON
+// encoding, key and value are embedded as JSON documents, otherwise they
+// are transferred as base64 encoded byte arrays.
+type httpRecord struct {
+	Topic string `json:"topic"`
+	Key   any    `json:"key"`
+	Value any    `json:"value"`
+}
+
+type httpSink struct {
+	client        *nethttp.Client
+	url           string
+	headers       map[string]string
+	authenticator authenticator
+	encoder       encoding.Encoder
+	rawJson       bool
+	retryPolicy   *retryPolicy
+	batcher       *batching.Batcher[httpRecord]
+	logger        *logging.Logger
+}
+
+func newHttpSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	url := config.GetOrDefault(c, config.PropertyHttpUrl, "")
+	if url == "" {
+		return nil, errors.Errorf("HTTP sink needs the url to be configured")
+	}
+
+	authenticator, err := newAuthenticator(c)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := logging.NewLogger("HttpSink")
+	if err != nil {
+		return nil, err
+	}
+
+	transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+	if config.GetOrDefault(c, config.PropertyHttpTlsEnabled, false) {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: config.GetOrDefault(
+				c, config.PropertyHttpTlsSkipVerify, false,
+			),
+			ClientAuth: config.GetOrDefault(
+				c, config.PropertyHttpTlsClientAuth, tls.NoClientCert,
+			),
+		}
+	}
+
+	h := &httpSink{
+		client: &nethttp.Client{
+			Transport: transport,
+			Timeout: time.Duration(config.GetOrDefault(
+				c, config.PropertyHttpTimeout, 30,
+			)) * time.Second,
+		},
+		url: url,
+		headers: config.GetOrDefault(
+			c, config.PropertyHttpHeaders, map[string]string{},
+		),
+		authenticator: authenticator,
+		encoder:       encoder,
+		rawJson: config.GetOrDefault(
+			c, config.PropertyEncodingType, config.JsonEncoding,
+		) == config.JsonEncoding,
+		retryPolicy: newRetryPolicy(c),
+		logger:      logger,
+	}
+
+	h.batcher = batching.NewBatcher(batching.Options{
+		MaxRecords: config.GetOrDefault(
+			c, config.PropertyHttpBatchSize, 100,
+		),
+		MaxBytes: config.GetOrDefault(
+			c, config.PropertyHttpBatchBytes, 1048576,
+		),
+		Linger: time.Duration(config.GetOrDefault(
+			c, config.PropertyHttpBatchLinger, 100,
+		)) * time.Millisecond,
+		BackOff: h.retryPolicy.newBackOff,
+	}, h.sendBatch, logger)
+	return h, nil
+}
+
+func (h *httpSink) Start() error {
+	h.batcher.Start()
+	return nil
+}
+
+func (h *httpSink) Stop() error {
+	h.batcher.Stop()
+	return nil
+}
+
+func (h *httpSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	done := make(chan error, 1)
+	if err := h.EmitAsync(context, timestamp, topicName, key, envelope, func(err error) {
+		done <- err
+	}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+func (h *httpSink) EmitAsync(
+	_ sink.Context, _ time.Time, topicName string,
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	keyData, err := h.encoder.EncodeKey(topicName, key)
+	if err != nil {
+		return err
+	}
+	envelopeData, err := h.encoder.EncodeEnvelope(topicName, envelope)
+	if err != nil {
+		return err
+	}
+
+	record := httpRecord{
+		Topic: topicName,
+		Key:   keyData,
+		Value: envelopeData,
+	}
+	if h.rawJson {
+		record.Key = json.RawMessage(keyData)
+		record.Value = json.RawMessage(envelopeData)
+	}
+
+	return h.batcher.Add(&batching.Record[httpRecord]{
+		Value: record,
+		Size:  len(keyData) + len(envelopeData),
+		Ack:   ack,
+	})
+}
+
+// sendBatch posts the batch as a single request. The batcher retries
+// failed requests, unless the status code is considered permanent.
+func (h *httpSink) sendBatch(
+	batch []*batching.Record[httpRecord],
+) ([]batching.Failure[httpRecord], error) {
+
+	records := make([]httpRecord, 0, len(batch))
+	for _, record := range batch {
+		records = append(records, record.Value)
+	}
+
+	body, err := json.Marshal(records)
+	if err != nil {
+		return nil, backoff.Permanent(errors.Wrap(err, 0))
+	}
+	return nil, h.send(body)
+}
+
+func (h *httpSink) send(
+	body []byte,
+) error {
+
+	request, err := nethttp.NewRequest(nethttp.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return backoff.Permanent(errors.Wrap(err, 0))
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range h.headers {
+		request.Header.Set(name, value)
+	}
+	h.authenticator(request, body)
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		// Transport errors (connection refused, timeouts, ...) are always retried
+		h.logger.Warnf("Failed to send request, retrying: %v", err)
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("HTTP endpoint responded with status %s", response.Status)
+	if !h.retryPolicy.retryable(response.StatusCode) {
+		return backoff.Permanent(err)
+	}
+	h.logger.Warnf("%s, retrying", err)
+	return err
+}
@@ -0,0 +1,245 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package http
+
+import (
+	"github.com/goccy/go-json"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type capturedRequest struct {
+	headers nethttp.Header
+	body    []byte
+}
+
+func newTestServer(
+	t *testing.T, statusCodes ...int,
+) (*httptest.Server, func() []capturedRequest) {
+
+	var mutex sync.Mutex
+	var requests []capturedRequest
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		statusCode := nethttp.StatusOK
+		if len(requests) < len(statusCodes) {
+			statusCode = statusCodes[len(requests)]
+		}
+		requests = append(requests, capturedRequest{headers: r.Header.Clone(), body: body})
+		w.WriteHeader(statusCode)
+	}))
+
+	return server, func() []capturedRequest {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return requests
+	}
+}
+
+func newTestSink(
+	t *testing.T, httpConfig spiconfig.HttpConfig,
+) *httpSink {
+
+	s, err := newHttpSink(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.Http,
+			Http: httpConfig,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return s.(*httpSink)
+}
+
+func emitRecords(
+	t *testing.T, s *httpSink, count int,
+) []error {
+
+	var waitGroup sync.WaitGroup
+	errs := make([]error, count)
+	for i := 0; i < count; i++ {
+		waitGroup.Add(1)
+		index := i
+		key := schema.Struct{"id": i}
+		envelope := schema.Struct{schema.FieldNamePayload: schema.Struct{"id": i}}
+		if err := s.EmitAsync(nil, time.Now(), "topic", key, envelope, func(err error) {
+			errs[index] = err
+			waitGroup.Done()
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitGroup.Wait()
+	return errs
+}
+
+func Test_Http_Batches_Records_And_Signs_Body(
+	t *testing.T,
+) {
+
+	server, requests := newTestServer(t)
+	defer server.Close()
+
+	s := newTestSink(t, spiconfig.HttpConfig{
+		Url:     server.URL,
+		Headers: map[string]string{"X-Static": "static"},
+		Authentication: spiconfig.HttpAuthenticationConfig{
+			Type: spiconfig.HttpAuthenticationHmac,
+			Hmac: spiconfig.HttpHmacAuthenticationConfig{Secret: "secret"},
+		},
+		Batch: spiconfig.HttpBatchConfig{Size: 2, Linger: 10000},
+	})
+
+	for _, err := range emitRecords(t, s, 4) {
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.Stop())
+
+	captured := requests()
+	assert.Equal(t, 2, len(captured))
+	for _, request := range captured {
+		assert.Equal(t, "static", request.headers.Get("X-Static"))
+		assert.Equal(t, "application/json", request.headers.Get("Content-Type"))
+		assert.Equal(t, signature([]byte("secret"), request.body), request.headers.Get(defaultSignatureHeader))
+
+		var records []map[string]any
+		assert.NoError(t, json.Unmarshal(request.body, &records))
+		assert.Equal(t, 2, len(records))
+		assert.Equal(t, "topic", records[0]["topic"])
+	}
+}
+
+func Test_Http_Flushes_Batch_After_Linger(
+	t *testing.T,
+) {
+
+	server, requests := newTestServer(t)
+	defer server.Close()
+
+	s := newTestSink(t, spiconfig.HttpConfig{
+		Url: server.URL,
+		Authentication: spiconfig.HttpAuthenticationConfig{
+			Type:   spiconfig.HttpAuthenticationBearer,
+			Bearer: spiconfig.HttpBearerAuthenticationConfig{Token: "token"},
+		},
+		Batch: spiconfig.HttpBatchConfig{Size: 100, Linger: 10},
+	})
+	defer s.Stop()
+
+	assert.NoError(t, emitRecords(t, s, 1)[0])
+
+	captured := requests()
+	assert.Equal(t, 1, len(captured))
+	assert.Equal(t, "Bearer token", captured[0].headers.Get("Authorization"))
+}
+
+func Test_Http_Retries_Transient_Status_Codes(
+	t *testing.T,
+) {
+
+	server, requests := newTestServer(t,
+		nethttp.StatusServiceUnavailable, nethttp.StatusTooManyRequests,
+	)
+	defer server.Close()
+
+	s := newTestSink(t, spiconfig.HttpConfig{
+		Url:     server.URL,
+		Batch:   spiconfig.HttpBatchConfig{Size: 1},
+		Retries: spiconfig.HttpRetryConfig{Backoff: spiconfig.HttpRetryBackoffConfig{Min: 1, Max: 1}},
+	})
+	defer s.Stop()
+
+	assert.NoError(t, emitRecords(t, s, 1)[0])
+	assert.Equal(t, 3, len(requests()))
+}
+
+func Test_Http_Fails_Permanent_Status_Codes(
+	t *testing.T,
+) {
+
+	server, requests := newTestServer(t, nethttp.StatusBadRequest)
+	defer server.Close()
+
+	s := newTestSink(t, spiconfig.HttpConfig{
+		Url:     server.URL,
+		Batch:   spiconfig.HttpBatchConfig{Size: 1},
+		Retries: spiconfig.HttpRetryConfig{Backoff: spiconfig.HttpRetryBackoffConfig{Min: 1, Max: 1}},
+	})
+	defer s.Stop()
+
+	errs := emitRecords(t, s, 2)
+	assert.Error(t, errs[0])
+	// A permanent failure isn't retried and doesn't affect later batches
+	assert.NoError(t, errs[1])
+	assert.Equal(t, 2, len(requests()))
+}
+
+func Test_Http_Emit_After_Stop(
+	t *testing.T,
+) {
+
+	server, requests := newTestServer(t)
+	defer server.Close()
+
+	s := newTestSink(t, spiconfig.HttpConfig{Url: server.URL})
+	assert.NoError(t, s.Stop())
+
+	err := s.EmitAsync(nil, time.Now(), "topic", schema.Struct{}, schema.Struct{}, func(error) {
+		t.Error("acknowledgement must not be called")
+	})
+	assert.Error(t, err)
+	assert.Empty(t, requests())
+}
+
+func Test_Http_Retry_Policy_Classification(
+	t *testing.T,
+) {
+
+	defaultPolicy := newRetryPolicy(&spiconfig.Config{})
+	assert.True(t, defaultPolicy.retryable(nethttp.StatusRequestTimeout))
+	assert.True(t, defaultPolicy.retryable(nethttp.StatusTooManyRequests))
+	assert.True(t, defaultPolicy.retryable(nethttp.StatusBadGateway))
+	assert.False(t, defaultPolicy.retryable(nethttp.StatusBadRequest))
+	assert.False(t, defaultPolicy.retryable(nethttp.StatusUnauthorized))
+
+	configuredPolicy := newRetryPolicy(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Http: spiconfig.HttpConfig{
+				Retries: spiconfig.HttpRetryConfig{StatusCodes: []int{409}},
+			},
+		},
+	})
+	assert.True(t, configuredPolicy.retryable(nethttp.StatusConflict))
+	assert.False(t, configuredPolicy.retryable(nethttp.StatusServiceUnavailable))
+}
@@ -0,0 +1,82 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package http
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	nethttp "net/http"
+	"time"
+)
+
+type retryPolicy struct {
+	maxAttempts int
+	backoffMin  time.Duration
+	backoffMax  time.Duration
+	statusCodes map[int]bool
+}
+
+func newRetryPolicy(
+	c *config.Config,
+) *retryPolicy {
+
+	statusCodes := make(map[int]bool)
+	for _, statusCode := range config.GetOrDefault(
+		c, config.PropertyHttpRetriesStatusCodes, []int{},
+	) {
+		statusCodes[statusCode] = true
+	}
+
+	return &retryPolicy{
+		maxAttempts: config.GetOrDefault(
+			c, config.PropertyHttpRetriesMax, 5,
+		),
+		backoffMin: time.Duration(config.GetOrDefault(
+			c, config.PropertyHttpRetriesBackoffMin, 100,
+		)) * time.Millisecond,
+		backoffMax: time.Duration(config.GetOrDefault(
+			c, config.PropertyHttpRetriesBackoffMax, 10000,
+		)) * time.Millisecond,
+		statusCodes: statusCodes,
+	}
+}
+
+// retryable returns true if a request, answered with the given status
+// code, should be retried. Without explicitly configured status codes,
+// timeouts, rate limiting and server errors are considered transient.
+func (r *retryPolicy) retryable(
+	statusCode int,
+) bool {
+
+	if len(r.statusCodes) > 0 {
+		return r.statusCodes[statusCode]
+	}
+
+	switch statusCode {
+	case nethttp.StatusRequestTimeout, nethttp.StatusTooManyRequests:
+		return true
+	}
+	return statusCode >= 500
+}
+
+func (r *retryPolicy) newBackOff() backoff.BackOff {
+	exponentialBackOff := backoff.NewExponentialBackOff()
+	exponentialBackOff.InitialInterval = r.backoffMin
+	exponentialBackOff.MaxInterval = r.backoffMax
+	exponentialBackOff.MaxElapsedTime = 0
+	return backoff.WithMaxRetries(exponentialBackOff, uint64(r.maxAttempts))
+}
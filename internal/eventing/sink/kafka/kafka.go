@@ -19,22 +19,38 @@ package kafka
 
 import (
 	"crypto/tls"
+	"fmt"
 	"github.com/IBM/sarama"
+	"github.com/go-errors/errors"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	headerOperation   = "operation"
+	headerSourceTable = "source.table"
+	headerSourceLSN   = "source.lsn"
+	headerSourceTxId  = "source.txid"
+)
+
 func init() {
 	sinkimpl.RegisterSink(config.Kafka, newKafkaSink)
 }
 
 type kafkaSink struct {
-	producer sarama.SyncProducer
-	encoder  *encoding.JsonEncoder
+	producer       sarama.SyncProducer
+	asyncProducer  sarama.AsyncProducer
+	encoder        encoding.Encoder
+	partitionKeyFn partitionKeyFn
+	staticHeaders  []sarama.RecordHeader
+	eventHeaders   bool
+	waitGroup      sync.WaitGroup
 }
 
 func newKafkaSink(
@@ -42,13 +58,87 @@ func newKafkaSink(
 ) (sink.Sink, error) {
 
 	kafkaConfig := sarama.NewConfig()
-	kafkaConfig.ClientID = "event-stream-prototype"
+	kafkaConfig.ClientID = config.GetOrDefault(
+		c, config.PropertyKafkaClientId, "event-stream-prototype",
+	)
 	kafkaConfig.Producer.Idempotent = config.GetOrDefault(
-		c, "sink.kafka.idempotent", false,
+		c, config.PropertyKafkaIdempotent, false,
 	)
+
+	// Exactly-once delivery requires an idempotent, transactional producer
+	transactional := config.GetOrDefault(c, config.PropertyKafkaTransactionEnabled, false)
+	transactionId := config.GetOrDefault(
+		c, config.PropertyKafkaTransactionId, "timescaledb-event-streamer",
+	)
+	if transactional {
+		kafkaConfig.Producer.Idempotent = true
+		kafkaConfig.Producer.Transaction.ID = transactionId
+		kafkaConfig.Producer.Transaction.Timeout = time.Duration(config.GetOrDefault(
+			c, config.PropertyKafkaTransactionTimeout, 60000,
+		)) * time.Millisecond
+		kafkaConfig.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
 	kafkaConfig.Producer.Return.Successes = true
-	kafkaConfig.Producer.RequiredAcks = sarama.WaitForLocal
-	kafkaConfig.Producer.Retry.Max = 10
+	kafkaConfig.Producer.Retry.Max = config.GetOrDefault(
+		c, config.PropertyKafkaRetries, 10,
+	)
+	kafkaConfig.Producer.MaxMessageBytes = config.GetOrDefault(
+		c, config.PropertyKafkaMaxMessageBytes, kafkaConfig.Producer.MaxMessageBytes,
+	)
+	kafkaConfig.Producer.Partitioner = newPartitionKeyPartitioner
+
+	// Idempotent producers require acknowledgement by all in-sync replicas
+	defaultAcks := config.KafkaAcksLocal
+	if kafkaConfig.Producer.Idempotent {
+		defaultAcks = config.KafkaAcksAll
+		kafkaConfig.Net.MaxOpenRequests = 1
+	}
+	requiredAcks, err := requiredAcks(config.GetOrDefault(c, config.PropertyKafkaAcks, defaultAcks))
+	if err != nil {
+		return nil, err
+	}
+	kafkaConfig.Producer.RequiredAcks = requiredAcks
+
+	partitionKeyFn, err := newPartitionKeyFn(c)
+	if err != nil {
+		return nil, err
+	}
+
+	staticHeaders := make([]sarama.RecordHeader, 0)
+	for name, value := range config.GetOrDefault(
+		c, config.PropertyKafkaHeadersStatic, map[string]string{},
+	) {
+		staticHeaders = append(staticHeaders, sarama.RecordHeader{
+			Key:   []byte(name),
+			Value: []byte(value),
+		})
+	}
+	eventHeaders := config.GetOrDefault(c, config.PropertyKafkaHeadersEvent, false)
+
+	compression := config.GetOrDefault(
+		c, config.PropertyKafkaCompression, config.KafkaCompressionNone,
+	)
+	if err := kafkaConfig.Producer.Compression.UnmarshalText([]byte(compression)); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	// Transactions are always used with the asynchronous producer, since
+	// messages only need to be confirmed when the transaction commits
+	async := config.GetOrDefault(c, config.PropertyKafkaAsync, false) || transactional
+	if async {
+		// Batching only makes sense with the asynchronous producer, since
+		// the synchronous producer waits for every single message anyway
+		kafkaConfig.Producer.Return.Errors = true
+		kafkaConfig.Producer.Flush.Messages = config.GetOrDefault(
+			c, config.PropertyKafkaBatchSize, 1000,
+		)
+		kafkaConfig.Producer.Flush.Bytes = config.GetOrDefault(
+			c, config.PropertyKafkaBatchBytes, 1024*1024,
+		)
+		kafkaConfig.Producer.Flush.Frequency = time.Duration(config.GetOrDefault(
+			c, config.PropertyKafkaBatchLinger, 5,
+		)) * time.Millisecond
+	}
 
 	if config.GetOrDefault(c, config.PropertyKafkaSaslEnabled, false) {
 		kafkaConfig.Net.SASL.Enable = true
@@ -75,47 +165,217 @@ func newKafkaSink(
 		}
 	}
 
-	producer, err := sarama.NewSyncProducer(
-		config.GetOrDefault(c, config.PropertyKafkaBrokers, []string{"localhost:9092"}), kafkaConfig,
-	)
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	brokers := config.GetOrDefault(c, config.PropertyKafkaBrokers, []string{"localhost:9092"})
+
+	if async {
+		asyncProducer, err := sarama.NewAsyncProducer(brokers, kafkaConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if transactional {
+			offsetsTopic := config.GetOrDefault(
+				c, config.PropertyKafkaTransactionOffsets, "timescaledb-event-streamer-offsets",
+			)
+			return newTransactionalKafkaSink(&kafkaSink{
+				asyncProducer:  asyncProducer,
+				encoder:        encoder,
+				partitionKeyFn: partitionKeyFn,
+				staticHeaders:  staticHeaders,
+				eventHeaders:   eventHeaders,
+			}, brokers, kafkaConfig, transactionId, offsetsTopic), nil
+		}
+
+		return &kafkaSink{
+			asyncProducer:  asyncProducer,
+			encoder:        encoder,
+			partitionKeyFn: partitionKeyFn,
+			staticHeaders:  staticHeaders,
+			eventHeaders:   eventHeaders,
+		}, nil
+	}
+
+	producer, err := sarama.NewSyncProducer(brokers, kafkaConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	return &kafkaSink{
-		producer: producer,
-		encoder:  encoding.NewJsonEncoderWithConfig(c),
+		producer:       producer,
+		encoder:        encoder,
+		partitionKeyFn: partitionKeyFn,
+		staticHeaders:  staticHeaders,
+		eventHeaders:   eventHeaders,
 	}, nil
 }
 
 func (k *kafkaSink) Start() error {
+	if k.asyncProducer != nil {
+		k.waitGroup.Add(2)
+		go k.processSuccesses()
+		go k.processErrors()
+	}
 	return nil
 }
 
 func (k *kafkaSink) Stop() error {
+	if k.asyncProducer != nil {
+		// Flushes all buffered messages before the result channels are
+		// closed, which makes sure all pending acknowledgements are called
+		k.asyncProducer.AsyncClose()
+		k.waitGroup.Wait()
+		return nil
+	}
 	return k.producer.Close()
 }
 
 func (k *kafkaSink) Emit(
-	_ sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	keyData, err := k.encoder.Marshal(key)
+	if k.asyncProducer != nil {
+		done := make(chan error, 1)
+		if err := k.EmitAsync(context, timestamp, topicName, key, envelope, func(err error) {
+			done <- err
+		}); err != nil {
+			return err
+		}
+		return <-done
+	}
+
+	msg, err := k.newProducerMessage(timestamp, topicName, key, envelope)
 	if err != nil {
 		return err
 	}
-	envelopeData, err := k.encoder.Marshal(envelope)
+
+	_, _, err = k.producer.SendMessage(msg)
+	return err
+}
+
+func (k *kafkaSink) EmitAsync(
+	context sink.Context, timestamp time.Time, topicName string,
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	if k.asyncProducer == nil {
+		if err := k.Emit(context, timestamp, topicName, key, envelope); err != nil {
+			return err
+		}
+		ack(nil)
+		return nil
+	}
+
+	msg, err := k.newProducerMessage(timestamp, topicName, key, envelope)
 	if err != nil {
 		return err
 	}
 
-	msg := &sarama.ProducerMessage{
+	// The acknowledgement is carried with the message and
+	// called when the message was confirmed or failed
+	msg.Metadata.(*messageMetadata).ack = ack
+	k.asyncProducer.Input() <- msg
+	return nil
+}
+
+func (k *kafkaSink) newProducerMessage(
+	timestamp time.Time, topicName string, key, envelope schema.Struct,
+) (*sarama.ProducerMessage, error) {
+
+	keyData, err := k.encoder.EncodeKey(topicName, key)
+	if err != nil {
+		return nil, err
+	}
+	envelopeData, err := k.encoder.EncodeEnvelope(topicName, envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionKey, err := k.partitionKeyFn(topicName, key, envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sarama.ProducerMessage{
 		Topic:     topicName,
 		Key:       sarama.ByteEncoder(keyData),
 		Value:     sarama.ByteEncoder(envelopeData),
+		Headers:   k.messageHeaders(envelope),
 		Timestamp: timestamp,
+		Metadata: &messageMetadata{
+			partitionKey: partitionKey,
+		},
+	}, nil
+}
+
+// messageHeaders returns the static headers and, if enabled, the
+// event headers, which enable consumers to route events without
+// decoding the message value
+func (k *kafkaSink) messageHeaders(
+	envelope schema.Struct,
+) []sarama.RecordHeader {
+
+	headers := make([]sarama.RecordHeader, 0, len(k.staticHeaders)+4)
+	headers = append(headers, k.staticHeaders...)
+	if !k.eventHeaders {
+		return headers
 	}
 
-	_, _, err = k.producer.SendMessage(msg)
-	return err
+	appendHeader := func(name string, value string) {
+		if value != "" {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(name), Value: []byte(value)})
+		}
+	}
+
+	payload := payloadOf(envelope)
+	if operation, ok := payload[schema.FieldNameOperation].(string); ok {
+		appendHeader(headerOperation, operation)
+	}
+	if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+		schemaName, _ := source[schema.FieldNameSchema].(string)
+		tableName, _ := source[schema.FieldNameTable].(string)
+		if tableName != "" {
+			appendHeader(headerSourceTable, fmt.Sprintf("%s.%s", schemaName, tableName))
+		}
+		if lsn, ok := source[schema.FieldNameLSN].(string); ok {
+			appendHeader(headerSourceLSN, lsn)
+		}
+		if txId, ok := source[schema.FieldNameTxId].(*uint32); ok && txId != nil {
+			appendHeader(headerSourceTxId, strconv.FormatUint(uint64(*txId), 10))
+		}
+	}
+	return headers
+}
+
+func requiredAcks(
+	acks config.KafkaAcksType,
+) (sarama.RequiredAcks, error) {
+
+	switch acks {
+	case config.KafkaAcksNone:
+		return sarama.NoResponse, nil
+	case config.KafkaAcksLocal:
+		return sarama.WaitForLocal, nil
+	case config.KafkaAcksAll:
+		return sarama.WaitForAll, nil
+	}
+	return 0, errors.Errorf("unknown kafka acks value: %s", acks)
+}
+
+func (k *kafkaSink) processSuccesses() {
+	defer k.waitGroup.Done()
+	for msg := range k.asyncProducer.Successes() {
+		msg.Metadata.(*messageMetadata).ack(nil)
+	}
+}
+
+func (k *kafkaSink) processErrors() {
+	defer k.waitGroup.Done()
+	for producerError := range k.asyncProducer.Errors() {
+		producerError.Msg.Metadata.(*messageMetadata).ack(producerError.Err)
+	}
 }
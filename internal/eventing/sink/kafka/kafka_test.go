@@ -0,0 +1,259 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kafka
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Kafka_Partition_Key_Hypertable(
+	t *testing.T,
+) {
+
+	c := &config.Config{
+		Sink: config.SinkConfig{
+			Kafka: config.KafkaConfig{
+				Partitioner: config.KafkaPartitionerConfig{
+					Type: config.KafkaPartitionerHypertable,
+				},
+			},
+		},
+	}
+
+	partitionKeyFn, err := newPartitionKeyFn(c)
+	assert.NoError(t, err)
+
+	partitionKey, err := partitionKeyFn("prefix.public.metrics", nil, testEnvelope())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("public.metrics"), partitionKey)
+}
+
+func Test_Kafka_Partition_Key_Expression(
+	t *testing.T,
+) {
+
+	c := &config.Config{
+		Sink: config.SinkConfig{
+			Kafka: config.KafkaConfig{
+				Partitioner: config.KafkaPartitionerConfig{
+					Type:       config.KafkaPartitionerExpression,
+					Expression: "key.device_id",
+				},
+			},
+		},
+	}
+
+	partitionKeyFn, err := newPartitionKeyFn(c)
+	assert.NoError(t, err)
+
+	key := schema.Envelope(schema.Struct{}, schema.Struct{"device_id": 42})
+	partitionKey, err := partitionKeyFn("prefix.public.metrics", key, testEnvelope())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("42"), partitionKey)
+
+	// Same partition key, same partition
+	partitioner := newPartitionKeyPartitioner("prefix.public.metrics")
+	first, err := partitioner.Partition(&sarama.ProducerMessage{
+		Metadata: &messageMetadata{partitionKey: partitionKey},
+	}, 16)
+	assert.NoError(t, err)
+	second, err := partitioner.Partition(&sarama.ProducerMessage{
+		Metadata: &messageMetadata{partitionKey: []byte("42")},
+	}, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+}
+
+func Test_Kafka_Partition_Key_Expression_Concurrent(
+	t *testing.T,
+) {
+
+	c := &config.Config{
+		Sink: config.SinkConfig{
+			Kafka: config.KafkaConfig{
+				Partitioner: config.KafkaPartitionerConfig{
+					Type:       config.KafkaPartitionerExpression,
+					Expression: "key.device_id",
+				},
+			},
+		},
+	}
+
+	partitionKeyFn, err := newPartitionKeyFn(c)
+	assert.NoError(t, err)
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+		go func(deviceId int) {
+			defer waitGroup.Done()
+			key := schema.Envelope(schema.Struct{}, schema.Struct{"device_id": deviceId})
+			partitionKey, err := partitionKeyFn("prefix.public.metrics", key, testEnvelope())
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(strconv.Itoa(deviceId)), partitionKey)
+		}(i)
+	}
+	waitGroup.Wait()
+}
+
+func Test_Kafka_Partition_Key_Expression_Missing(
+	t *testing.T,
+) {
+
+	c := &config.Config{
+		Sink: config.SinkConfig{
+			Kafka: config.KafkaConfig{
+				Partitioner: config.KafkaPartitionerConfig{
+					Type: config.KafkaPartitionerExpression,
+				},
+			},
+		},
+	}
+
+	_, err := newPartitionKeyFn(c)
+	assert.Error(t, err)
+}
+
+func Test_Kafka_Message_Headers(
+	t *testing.T,
+) {
+
+	k := &kafkaSink{
+		staticHeaders: []sarama.RecordHeader{{Key: []byte("env"), Value: []byte("test")}},
+		eventHeaders:  true,
+	}
+
+	headers := lo.SliceToMap(k.messageHeaders(testEnvelope()), func(header sarama.RecordHeader) (string, string) {
+		return string(header.Key), string(header.Value)
+	})
+
+	assert.Equal(t, map[string]string{
+		"env":             "test",
+		headerOperation:   "c",
+		headerSourceTable: "public.metrics",
+		headerSourceLSN:   "0/64",
+		headerSourceTxId:  "815",
+	}, headers)
+}
+
+func Test_Kafka_Transactional_Acknowledges_On_Commit(
+	t *testing.T,
+) {
+
+	kafkaConfig := mocks.NewTestConfig()
+	kafkaConfig.Producer.Return.Errors = true
+	kafkaConfig.Producer.Partitioner = newPartitionKeyPartitioner
+
+	offsets := make(chan string, 1)
+	producer := mocks.NewAsyncProducer(t, kafkaConfig).
+		ExpectInputAndSucceed().
+		ExpectInputAndSucceed().
+		ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			value, err := msg.Value.Encode()
+			offsets <- msg.Topic + "=" + string(value)
+			return err
+		})
+
+	s := newTransactionalKafkaSink(&kafkaSink{
+		asyncProducer: producer,
+		encoder:       encoding.NewJsonEncoder(false),
+		partitionKeyFn: func(_ string, _, _ schema.Struct) ([]byte, error) {
+			return nil, nil
+		},
+	}, nil, kafkaConfig, "streamer", "offsets").(*transactionalKafkaSink)
+	assert.NoError(t, s.kafkaSink.Start())
+
+	acknowledged := 0
+	ack := func(err error) {
+		assert.NoError(t, err)
+		acknowledged++
+	}
+
+	assert.NoError(t, s.BeginTransaction(815))
+	assert.NoError(t, s.EmitAsync(nil, time.Now(), "prefix.public.metrics", schema.Struct{}, testEnvelope(), ack))
+	assert.NoError(t, s.EmitAsync(nil, time.Now(), "prefix.public.metrics", schema.Struct{}, testEnvelope(), ack))
+	assert.Equal(t, 0, acknowledged)
+
+	assert.NoError(t, s.CommitTransaction(pgtypes.LSN(100)))
+	assert.Equal(t, 2, acknowledged)
+	assert.Equal(t, "offsets=0/64", <-offsets)
+
+	assert.NoError(t, s.Stop())
+}
+
+func Test_Kafka_Transactional_Rejects_Events_After_Abort(
+	t *testing.T,
+) {
+
+	kafkaConfig := mocks.NewTestConfig()
+	kafkaConfig.Producer.Return.Errors = true
+	kafkaConfig.Producer.Partitioner = newPartitionKeyPartitioner
+
+	producer := mocks.NewAsyncProducer(t, kafkaConfig).
+		ExpectInputAndSucceed().
+		ExpectInputAndSucceed()
+
+	s := newTransactionalKafkaSink(&kafkaSink{
+		asyncProducer: producer,
+		encoder:       encoding.NewJsonEncoder(false),
+		partitionKeyFn: func(_ string, _, _ schema.Struct) ([]byte, error) {
+			return nil, nil
+		},
+	}, nil, kafkaConfig, "streamer", "offsets").(*transactionalKafkaSink)
+	assert.NoError(t, s.kafkaSink.Start())
+
+	var acknowledged []error
+	ack := func(err error) {
+		acknowledged = append(acknowledged, err)
+	}
+
+	assert.NoError(t, s.BeginTransaction(815))
+	assert.NoError(t, s.EmitAsync(nil, time.Now(), "prefix.public.metrics", schema.Struct{}, testEnvelope(), ack))
+
+	// The delivery failure aborts the transaction on commit
+	s.recordError(assert.AnError)
+	assert.Error(t, s.CommitTransaction(pgtypes.LSN(100)))
+	assert.Len(t, acknowledged, 1)
+	assert.Error(t, acknowledged[0])
+
+	// Later transactions and events are rejected
+	assert.Error(t, s.BeginTransaction(816))
+	assert.Error(t, s.EmitAsync(nil, time.Now(), "prefix.public.metrics", schema.Struct{}, testEnvelope(), ack))
+	assert.Error(t, s.CommitTransaction(pgtypes.LSN(200)))
+	assert.Len(t, acknowledged, 1)
+
+	assert.NoError(t, s.Stop())
+}
+
+func testEnvelope() schema.Struct {
+	source := schema.Source(
+		pglogrepl.LSN(100), "0/64-0", time.Now(), false, "tsdb", "public", "metrics", lo.ToPtr(uint32(815)),
+	)
+	return schema.Envelope(schema.Struct{}, schema.CreateEvent(map[string]any{"device_id": 42}, source))
+}
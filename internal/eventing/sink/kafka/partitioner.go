@@ -0,0 +1,146 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kafka
+
+import (
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/antonmedv/expr"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"hash/fnv"
+)
+
+// messageMetadata is attached to every produced message to
+// carry information required after the message was handed over
+// to the producer
+type messageMetadata struct {
+	ack          func(err error)
+	partitionKey []byte
+}
+
+// partitionKeyFn calculates the partition key for an event. A nil
+// partition key falls back to hashing the encoded message key.
+type partitionKeyFn func(
+	topicName string, key, envelope schema.Struct,
+) ([]byte, error)
+
+func newPartitionKeyFn(
+	c *config.Config,
+) (partitionKeyFn, error) {
+
+	partitionerType := config.GetOrDefault(
+		c, config.PropertyKafkaPartitionerType, config.KafkaPartitionerHash,
+	)
+
+	switch partitionerType {
+	case config.KafkaPartitionerHash:
+		return func(_ string, _, _ schema.Struct) ([]byte, error) {
+			return nil, nil
+		}, nil
+
+	case config.KafkaPartitionerHypertable:
+		return func(topicName string, _, envelope schema.Struct) ([]byte, error) {
+			if source, ok := payloadOf(envelope)[schema.FieldNameSource].(schema.Struct); ok {
+				schemaName, _ := source[schema.FieldNameSchema].(string)
+				tableName, _ := source[schema.FieldNameTable].(string)
+				if tableName != "" {
+					return []byte(fmt.Sprintf("%s.%s", schemaName, tableName)), nil
+				}
+			}
+			// Events without a source table (like logical replication messages)
+			return []byte(topicName), nil
+		}, nil
+
+	case config.KafkaPartitionerExpression:
+		expression := config.GetOrDefault(c, config.PropertyKafkaPartitionerExpression, "")
+		if expression == "" {
+			return nil, errors.Errorf("kafka partitioner expression must be set for partitioner type expression")
+		}
+		prog, err := expr.Compile(expression)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return func(_ string, key, envelope schema.Struct) ([]byte, error) {
+			env := map[string]schema.Struct{
+				"key":   payloadOf(key),
+				"value": payloadOf(envelope),
+			}
+			// The sink may be called from multiple goroutines, a
+			// VM can't be shared, expr.Run uses a new one per call
+			result, err := expr.Run(prog, env)
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+			if result == nil {
+				return nil, nil
+			}
+			return []byte(fmt.Sprintf("%v", result)), nil
+		}, nil
+	}
+	return nil, errors.Errorf("unknown kafka partitioner type: %s", partitionerType)
+}
+
+// partitionKeyPartitioner selects the partition based on the partition
+// key calculated by the sink, if available, otherwise the message is
+// partitioned by the hash of its key
+type partitionKeyPartitioner struct {
+	hashPartitioner sarama.Partitioner
+}
+
+func newPartitionKeyPartitioner(
+	topic string,
+) sarama.Partitioner {
+
+	return &partitionKeyPartitioner{
+		hashPartitioner: sarama.NewHashPartitioner(topic),
+	}
+}
+
+func (p *partitionKeyPartitioner) Partition(
+	message *sarama.ProducerMessage, numPartitions int32,
+) (int32, error) {
+
+	if metadata, ok := message.Metadata.(*messageMetadata); ok && metadata.partitionKey != nil {
+		hasher := fnv.New32a()
+		if _, err := hasher.Write(metadata.partitionKey); err != nil {
+			return -1, err
+		}
+		partition := int32(hasher.Sum32()) % numPartitions
+		if partition < 0 {
+			partition = -partition
+		}
+		return partition, nil
+	}
+	return p.hashPartitioner.Partition(message, numPartitions)
+}
+
+func (p *partitionKeyPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+func payloadOf(
+	envelope schema.Struct,
+) schema.Struct {
+
+	if envelope == nil {
+		return nil
+	}
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	return payload
+}
@@ -0,0 +1,357 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kafka
+
+import (
+	stderrors "errors"
+	"github.com/IBM/sarama"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sync"
+	"time"
+)
+
+const offsetsTopicReadTimeout = time.Second
+
+// transactionalKafkaSink maps PostgreSQL transactions onto Kafka
+// transactions. Events are only acknowledged after the Kafka transaction
+// was committed, together with the end LSN of the PostgreSQL transaction,
+// which is stored in the offsets topic. Events emitted outside a
+// PostgreSQL transaction (such as snapshots) are collected into an
+// implicit transaction, committed with the next transaction boundary.
+// After a transaction was aborted, the sink rejects all further events,
+// since the events of the aborted transaction can't be added to a later
+// transaction. Replication needs to restart from the committed LSN.
+type transactionalKafkaSink struct {
+	*kafkaSink
+	brokers       []string
+	kafkaConfig   *sarama.Config
+	transactionId string
+	offsetsTopic  string
+
+	mutex         sync.Mutex
+	inTransaction bool
+	pendingAcks   []sink.AcknowledgeFunc
+	abortCause    error
+
+	// Delivery errors are reported by the producer's error goroutine
+	// while the transaction mutex may be held by a committing emitter
+	errorMutex       sync.Mutex
+	transactionError error
+}
+
+func newTransactionalKafkaSink(
+	kafkaSink *kafkaSink, brokers []string, kafkaConfig *sarama.Config, transactionId, offsetsTopic string,
+) sink.Sink {
+
+	return &transactionalKafkaSink{
+		kafkaSink:     kafkaSink,
+		brokers:       brokers,
+		kafkaConfig:   kafkaConfig,
+		transactionId: transactionId,
+		offsetsTopic:  offsetsTopic,
+		pendingAcks:   make([]sink.AcknowledgeFunc, 0),
+	}
+}
+
+func (t *transactionalKafkaSink) Start() error {
+	if err := t.ensureOffsetsTopic(); err != nil {
+		return err
+	}
+	return t.kafkaSink.Start()
+}
+
+func (t *transactionalKafkaSink) Stop() error {
+	t.mutex.Lock()
+	// An unfinished transaction is never committed, the
+	// events will be replicated again after restart
+	var err error
+	if t.inTransaction {
+		err = t.abortTransaction(errors.Errorf("sink stopped before transaction was committed"))
+	}
+	t.mutex.Unlock()
+	return stderrors.Join(err, t.kafkaSink.Stop())
+}
+
+func (t *transactionalKafkaSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	return t.EmitAsync(context, timestamp, topicName, key, envelope, func(_ error) {})
+}
+
+func (t *transactionalKafkaSink) EmitAsync(
+	_ sink.Context, timestamp time.Time, topicName string,
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.ensureNotAborted(); err != nil {
+		return err
+	}
+
+	if !t.inTransaction {
+		if err := t.beginTransaction(); err != nil {
+			return err
+		}
+	}
+
+	msg, err := t.newProducerMessage(timestamp, topicName, key, envelope)
+	if err != nil {
+		return err
+	}
+	msg.Metadata.(*messageMetadata).ack = t.recordError
+
+	t.pendingAcks = append(t.pendingAcks, ack)
+	t.asyncProducer.Input() <- msg
+	return nil
+}
+
+func (t *transactionalKafkaSink) BeginTransaction(
+	_ uint32,
+) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.ensureNotAborted(); err != nil {
+		return err
+	}
+
+	// Events emitted outside a transaction are committed right before the
+	// next transaction starts, there's no LSN to be stored for them
+	if t.inTransaction {
+		if err := t.commitTransaction(nil); err != nil {
+			return err
+		}
+	}
+	return t.beginTransaction()
+}
+
+func (t *transactionalKafkaSink) CommitTransaction(
+	transactionEndLSN pgtypes.LSN,
+) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.ensureNotAborted(); err != nil {
+		return err
+	}
+
+	// Transactions without any emitted events (for example since all
+	// events were filtered) don't need to be committed to Kafka
+	if !t.inTransaction || len(t.pendingAcks) == 0 {
+		if t.inTransaction {
+			return t.abortTransaction(nil)
+		}
+		return nil
+	}
+	return t.commitTransaction(&transactionEndLSN)
+}
+
+func (t *transactionalKafkaSink) CommittedLSN() (lsn pgtypes.LSN, present bool, err error) {
+	client, err := sarama.NewClient(t.brokers, t.kafkaConfig)
+	if err != nil {
+		return 0, false, errors.Wrap(err, 0)
+	}
+	defer client.Close()
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return 0, false, errors.Wrap(err, 0)
+	}
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(t.offsetsTopic)
+	if err != nil {
+		return 0, false, errors.Wrap(err, 0)
+	}
+
+	for _, partition := range partitions {
+		l, p, err := t.readPartitionLSN(client, consumer, partition)
+		if err != nil {
+			return 0, false, err
+		}
+		if p && (!present || l > lsn) {
+			lsn = l
+			present = true
+		}
+	}
+	return lsn, present, nil
+}
+
+func (t *transactionalKafkaSink) readPartitionLSN(
+	client sarama.Client, consumer sarama.Consumer, partition int32,
+) (lsn pgtypes.LSN, present bool, err error) {
+
+	oldest, err := client.GetOffset(t.offsetsTopic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, false, errors.Wrap(err, 0)
+	}
+	newest, err := client.GetOffset(t.offsetsTopic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, false, errors.Wrap(err, 0)
+	}
+	if newest <= oldest {
+		return 0, false, nil
+	}
+
+	partitionConsumer, err := consumer.ConsumePartition(t.offsetsTopic, partition, oldest)
+	if err != nil {
+		return 0, false, errors.Wrap(err, 0)
+	}
+	defer partitionConsumer.Close()
+
+	// Transaction markers and aborted records are never delivered with
+	// read-committed isolation, hence the last offset may never be seen
+	for {
+		select {
+		case msg := <-partitionConsumer.Messages():
+			if string(msg.Key) == t.transactionId {
+				l, err := pglogrepl.ParseLSN(string(msg.Value))
+				if err != nil {
+					return 0, false, errors.Wrap(err, 0)
+				}
+				lsn = pgtypes.LSN(l)
+				present = true
+			}
+			if msg.Offset >= newest-1 {
+				return lsn, present, nil
+			}
+		case err := <-partitionConsumer.Errors():
+			return 0, false, errors.Wrap(err, 0)
+		case <-time.After(offsetsTopicReadTimeout):
+			return lsn, present, nil
+		}
+	}
+}
+
+func (t *transactionalKafkaSink) ensureOffsetsTopic() error {
+	admin, err := sarama.NewClusterAdmin(t.brokers, t.kafkaConfig)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer admin.Close()
+
+	cleanupPolicy := "compact"
+	if err := admin.CreateTopic(t.offsetsTopic, &sarama.TopicDetail{
+		NumPartitions:     1,
+		ReplicationFactor: -1,
+		ConfigEntries: map[string]*string{
+			"cleanup.policy": &cleanupPolicy,
+		},
+	}, false); err != nil && !stderrors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (t *transactionalKafkaSink) beginTransaction() error {
+	if err := t.asyncProducer.BeginTxn(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	t.inTransaction = true
+	t.errorMutex.Lock()
+	t.transactionError = nil
+	t.errorMutex.Unlock()
+	return nil
+}
+
+func (t *transactionalKafkaSink) commitTransaction(
+	transactionEndLSN *pgtypes.LSN,
+) error {
+
+	if transactionEndLSN != nil {
+		t.asyncProducer.Input() <- &sarama.ProducerMessage{
+			Topic: t.offsetsTopic,
+			Key:   sarama.StringEncoder(t.transactionId),
+			Value: sarama.StringEncoder(transactionEndLSN.String()),
+			Metadata: &messageMetadata{
+				ack: t.recordError,
+			},
+		}
+	}
+
+	err := t.asyncProducer.CommitTxn()
+	if err == nil {
+		t.errorMutex.Lock()
+		err = t.transactionError
+		t.errorMutex.Unlock()
+	}
+	if err != nil {
+		return t.abortTransaction(err)
+	}
+
+	t.inTransaction = false
+	acks := t.pendingAcks
+	t.pendingAcks = make([]sink.AcknowledgeFunc, 0)
+	for _, ack := range acks {
+		ack(nil)
+	}
+	return nil
+}
+
+func (t *transactionalKafkaSink) abortTransaction(
+	cause error,
+) error {
+
+	err := t.asyncProducer.AbortTxn()
+	t.inTransaction = false
+
+	acks := t.pendingAcks
+	t.pendingAcks = make([]sink.AcknowledgeFunc, 0)
+	if cause != nil {
+		t.abortCause = cause
+		for _, ack := range acks {
+			ack(cause)
+		}
+	}
+	if err != nil {
+		return stderrors.Join(cause, errors.Wrap(err, 0))
+	}
+	return cause
+}
+
+func (t *transactionalKafkaSink) ensureNotAborted() error {
+	if t.abortCause != nil {
+		return errors.Errorf(
+			"kafka transaction was aborted, replication needs to restart from the committed LSN: %s",
+			t.abortCause.Error(),
+		)
+	}
+	return nil
+}
+
+func (t *transactionalKafkaSink) recordError(
+	err error,
+) {
+
+	if err == nil {
+		return
+	}
+	t.errorMutex.Lock()
+	defer t.errorMutex.Unlock()
+	if t.transactionError == nil {
+		t.transactionError = err
+	}
+}
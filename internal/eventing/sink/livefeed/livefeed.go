@@ -0,0 +1,488 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package livefeed
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/gorilla/websocket"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventfiltering"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queryParamTables    = "tables"
+	queryParamCondition = "condition"
+)
+
+const (
+	shutdownTimeout = time.Second * 5
+	pingInterval    = time.Second * 30
+	pongTimeout     = time.Second * 60
+	writeTimeout    = time.Second * 10
+	sseKeepAlive    = time.Second * 15
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.LiveFeed, newLiveFeedSink)
+}
+
+// feedEvent is an event encoded once on emit and shared
+// between all connected subscribers
+type feedEvent struct {
+	entity   systemcatalog.SystemEntity
+	lsn      string
+	key      schema.Struct
+	envelope schema.Struct
+	data     []byte
+}
+
+type liveFeedSink struct {
+	address        string
+	webSocketPath  string
+	ssePath        string
+	allowedOrigins []string
+	bufferSize     int
+	binary         bool
+	encoder        encoding.Encoder
+	upgrader       websocket.Upgrader
+	server         *http.Server
+	listener       net.Listener
+	logger         *logging.Logger
+
+	lock        sync.Mutex
+	subscribers map[*subscriber]bool
+	stopped     bool
+}
+
+func newLiveFeedSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	bufferSize := config.GetOrDefault(c, config.PropertyLiveFeedBuffer, 1000)
+	if bufferSize <= 0 {
+		return nil, errors.Errorf("live feed buffer size must be positive, but was %d", bufferSize)
+	}
+
+	webSocketPath := config.GetOrDefault(c, config.PropertyLiveFeedPathWebSocket, "/ws")
+	ssePath := config.GetOrDefault(c, config.PropertyLiveFeedPathSse, "/events")
+	if webSocketPath == ssePath {
+		return nil, errors.Errorf("live feed WebSocket and SSE paths must differ, but both are %s", ssePath)
+	}
+
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := logging.NewLogger("LiveFeedSink")
+	if err != nil {
+		return nil, err
+	}
+
+	l := &liveFeedSink{
+		address:        config.GetOrDefault(c, config.PropertyLiveFeedAddress, ":8080"),
+		webSocketPath:  webSocketPath,
+		ssePath:        ssePath,
+		allowedOrigins: config.GetOrDefault[[]string](c, config.PropertyLiveFeedAllowedOrigins, nil),
+		bufferSize:     bufferSize,
+		binary:         config.GetOrDefault(c, config.PropertyEncodingType, config.JsonEncoding) != config.JsonEncoding,
+		encoder:        encoder,
+		logger:         logger,
+		subscribers:    make(map[*subscriber]bool),
+	}
+
+	l.upgrader = websocket.Upgrader{}
+	if len(l.allowedOrigins) > 0 {
+		l.upgrader.CheckOrigin = func(r *http.Request) bool {
+			return l.allowedOrigin(r.Header.Get("Origin")) != ""
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(webSocketPath, l.handleWebSocket)
+	mux.HandleFunc(ssePath, l.handleSse)
+	l.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+	return l, nil
+}
+
+func (l *liveFeedSink) Start() error {
+	listener, err := net.Listen("tcp", l.address)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	l.listener = listener
+
+	go func() {
+		if err := l.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			l.logger.Errorf("Live feed server stopped: %+v", err)
+		}
+	}()
+	l.logger.Infof("Live feed listening on %s (WebSocket: %s, SSE: %s)",
+		listener.Addr(), l.webSocketPath, l.ssePath)
+	return nil
+}
+
+func (l *liveFeedSink) Stop() error {
+	// Closing all subscriber queues ends the long-running
+	// connection handlers, which is required for the
+	// shutdown to finish
+	l.lock.Lock()
+	l.stopped = true
+	for s := range l.subscribers {
+		delete(l.subscribers, s)
+		close(s.events)
+	}
+	l.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := l.server.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (l *liveFeedSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// Nobody is listening, no need to encode the event
+	if len(l.subscribers) == 0 {
+		return nil
+	}
+
+	data, err := l.encoder.EncodeEnvelope(topicName, envelope)
+	if err != nil {
+		return err
+	}
+
+	event := &feedEvent{
+		key:      key,
+		envelope: envelope,
+		data:     data,
+	}
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+		schemaName, _ := source[schema.FieldNameSchema].(string)
+		tableName, _ := source[schema.FieldNameTable].(string)
+		event.entity = systemcatalog.NewSystemEntity(schemaName, tableName)
+		event.lsn, _ = source[schema.FieldNameLSN].(string)
+	}
+
+	// The feed must never hold back replication, subscribers
+	// which can't keep up are disconnected instead
+	for s := range l.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			l.logger.Warnf("Disconnecting live feed subscriber %s, queue is full", s.remoteAddr)
+			delete(l.subscribers, s)
+			s.overflowed = true
+			close(s.events)
+		}
+	}
+	return nil
+}
+
+func (l *liveFeedSink) register(
+	s *subscriber,
+) bool {
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.stopped {
+		return false
+	}
+	l.subscribers[s] = true
+	return true
+}
+
+func (l *liveFeedSink) unregister(
+	s *subscriber,
+) {
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, present := l.subscribers[s]; present {
+		delete(l.subscribers, s)
+		close(s.events)
+	}
+}
+
+func (l *liveFeedSink) newSubscriber(
+	r *http.Request,
+) (*subscriber, error) {
+
+	s := &subscriber{
+		remoteAddr: r.RemoteAddr,
+		events:     make(chan *feedEvent, l.bufferSize),
+	}
+
+	query := r.URL.Query()
+	tables := make([]string, 0)
+	for _, value := range query[queryParamTables] {
+		for _, table := range strings.Split(value, ",") {
+			if table = strings.TrimSpace(table); table != "" {
+				tables = append(tables, table)
+			}
+		}
+	}
+	if len(tables) > 0 {
+		tableFilter, err := tablefiltering.NewTableFilter(nil, tables, false)
+		if err != nil {
+			return nil, err
+		}
+		s.tableFilter = tableFilter
+	}
+
+	if condition := strings.TrimSpace(query.Get(queryParamCondition)); condition != "" {
+		eventFilter, err := eventfiltering.NewEventFilter(map[string]config.EventFilterConfig{
+			"subscriber": {Condition: condition},
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.eventFilter = eventFilter
+	}
+	return s, nil
+}
+
+// allowedOrigin returns the value for the Access-Control-Allow-Origin
+// header, or an empty string if the origin isn't allowed
+func (l *liveFeedSink) allowedOrigin(
+	origin string,
+) string {
+
+	for _, allowed := range l.allowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+func (l *liveFeedSink) handleWebSocket(
+	w http.ResponseWriter, r *http.Request,
+) {
+
+	s, err := l.newSubscriber(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid subscription: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// Register before the handshake completes, so no event emitted
+	// after the client sees the connection established is missed
+	if !l.register(s) {
+		http.Error(w, "live feed is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer l.unregister(s)
+
+	conn, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already responded with an error
+		return
+	}
+	defer conn.Close()
+
+	// Incoming messages aren't expected, but reading is
+	// required to process pongs and close frames
+	closed := make(chan struct{})
+	_ = conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	messageType := websocket.TextMessage
+	if l.binary {
+		messageType = websocket.BinaryMessage
+	}
+
+	closeWith := func(code int, reason string) {
+		message := websocket.FormatCloseMessage(code, reason)
+		_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-s.events:
+			if !ok {
+				if s.overflowed {
+					closeWith(websocket.CloseTryAgainLater, "subscriber too slow")
+				} else {
+					closeWith(websocket.CloseGoingAway, "live feed shutting down")
+				}
+				return
+			}
+
+			accepted, err := s.accepts(event)
+			if err != nil {
+				closeWith(websocket.ClosePolicyViolation, err.Error())
+				return
+			}
+			if !accepted {
+				continue
+			}
+
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(messageType, event.data); err != nil {
+				l.logger.Debugf("Writing to WebSocket subscriber %s failed: %+v", s.remoteAddr, err)
+				return
+			}
+
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (l *liveFeedSink) handleSse(
+	w http.ResponseWriter, r *http.Request,
+) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" && len(l.allowedOrigins) > 0 {
+		allowed := l.allowedOrigin(origin)
+		if allowed == "" {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+	}
+
+	s, err := l.newSubscriber(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid subscription: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if !l.register(s) {
+		http.Error(w, "live feed is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer l.unregister(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-s.events:
+			if !ok {
+				if s.overflowed {
+					_, _ = fmt.Fprint(w, "event: error\ndata: subscriber too slow\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+
+			accepted, err := s.accepts(event)
+			if err != nil {
+				_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+				flusher.Flush()
+				return
+			}
+			if !accepted {
+				continue
+			}
+
+			data := string(event.data)
+			if l.binary {
+				data = base64.StdEncoding.EncodeToString(event.data)
+			}
+			if event.lsn != "" {
+				_, _ = fmt.Fprintf(w, "id: %s\n", event.lsn)
+			}
+			// JSON may be pretty printed, every line needs its own data field
+			for _, line := range strings.Split(data, "\n") {
+				_, _ = fmt.Fprintf(w, "data: %s\n", line)
+			}
+			if _, err := fmt.Fprint(w, "\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,185 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package livefeed
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/gorilla/websocket"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_LiveFeed_WebSocket_Filters(
+	t *testing.T,
+) {
+
+	l := startSink(t, 10)
+
+	query := url.Values{}
+	query.Set("tables", "public.metrics")
+	query.Set("condition", `value.op == "u"`)
+	conn, _, err := websocket.DefaultDialer.Dial(
+		fmt.Sprintf("ws://%s/ws?%s", l.listener.Addr(), query.Encode()), nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	emit(t, l, "public", "metrics", "c", "0/100")
+	emit(t, l, "public", "other", "u", "0/200")
+	emit(t, l, "public", "metrics", "u", "0/300")
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, websocket.TextMessage, messageType)
+	assert.Contains(t, string(data), `"op":"u"`)
+	assert.Contains(t, string(data), `"lsn":"0/300"`)
+}
+
+func Test_LiveFeed_Sse_Filters(
+	t *testing.T,
+) {
+
+	l := startSink(t, 10)
+
+	response, err := http.Get(fmt.Sprintf("http://%s/events?tables=public.other,public.metrics&condition=%s",
+		l.listener.Addr(), url.QueryEscape(`value.op != "d"`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	emit(t, l, "public", "metrics", "d", "0/100")
+	emit(t, l, "public", "unrelated", "c", "0/200")
+	emit(t, l, "public", "other", "c", "0/300")
+
+	reader := bufio.NewReader(response.Body)
+	assert.Equal(t, "id: 0/300", readLine(t, reader))
+	data := readLine(t, reader)
+	assert.True(t, strings.HasPrefix(data, "data: {"))
+	assert.Contains(t, data, `"table":"other"`)
+	assert.Equal(t, "", readLine(t, reader))
+}
+
+func Test_LiveFeed_Invalid_Condition(
+	t *testing.T,
+) {
+
+	l := startSink(t, 10)
+
+	response, err := http.Get(fmt.Sprintf("http://%s/events?condition=%s",
+		l.listener.Addr(), url.QueryEscape(`value.op ==`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	_, response, err = websocket.DefaultDialer.Dial(
+		fmt.Sprintf("ws://%s/ws?condition=%s", l.listener.Addr(), url.QueryEscape(`value.op ==`)), nil,
+	)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func Test_LiveFeed_Slow_Subscriber_Disconnected(
+	t *testing.T,
+) {
+
+	l := startSink(t, 1)
+
+	slow := &subscriber{events: make(chan *feedEvent, 1)}
+	assert.True(t, l.register(slow))
+
+	emit(t, l, "public", "metrics", "c", "0/100")
+	emit(t, l, "public", "metrics", "c", "0/200")
+
+	// The first event is still queued, afterwards the queue is closed
+	event, ok := <-slow.events
+	assert.True(t, ok)
+	assert.Equal(t, "0/100", event.lsn)
+	_, ok = <-slow.events
+	assert.False(t, ok)
+	assert.True(t, slow.overflowed)
+	assert.Len(t, l.subscribers, 0)
+}
+
+func startSink(
+	t *testing.T, bufferSize int,
+) *liveFeedSink {
+
+	s, err := newLiveFeedSink(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			LiveFeed: spiconfig.LiveFeedSinkConfig{
+				Address: "127.0.0.1:0",
+				Buffer:  bufferSize,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Stop()
+	})
+	return s.(*liveFeedSink)
+}
+
+func emit(
+	t *testing.T, l *liveFeedSink, schemaName, tableName, operation, lsn string,
+) {
+
+	envelope := schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: operation,
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: schemaName,
+			schema.FieldNameTable:  tableName,
+			schema.FieldNameLSN:    lsn,
+		},
+	})
+	if err := l.Emit(nil, time.Now(), fmt.Sprintf("tsdb.%s.%s", schemaName, tableName), nil, envelope); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readLine(
+	t *testing.T, reader *bufio.Reader,
+) string {
+
+	t.Helper()
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
@@ -0,0 +1,48 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package livefeed
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/eventfiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+)
+
+// subscriber is a single WebSocket or SSE connection with its
+// own queue and filters. Filters are evaluated on the connection's
+// goroutine, keeping the emitting side free of per-connection work.
+type subscriber struct {
+	remoteAddr  string
+	events      chan *feedEvent
+	tableFilter *tablefiltering.TableFilter
+	eventFilter eventfiltering.EventFilter
+	// overflowed is set before events gets closed, and therefore
+	// safe to read after the channel close was observed
+	overflowed bool
+}
+
+func (s *subscriber) accepts(
+	event *feedEvent,
+) (bool, error) {
+
+	if s.tableFilter != nil && !s.tableFilter.Enabled(event.entity) {
+		return false, nil
+	}
+	if s.eventFilter == nil {
+		return true, nil
+	}
+	return s.eventFilter.Evaluate(event.entity, event.key, event.envelope)
+}
@@ -0,0 +1,178 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package mqtt
+
+import (
+	"context"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-errors/errors"
+	"net/url"
+	"time"
+)
+
+const (
+	connectTimeout    = time.Second * 30
+	publishTimeout    = time.Minute
+	disconnectTimeout = time.Second * 5
+)
+
+// mqtt311Client publishes using MQTT 3.1.1, which doesn't support
+// user properties, hence those are dropped
+type mqtt311Client struct {
+	client pahomqtt.Client
+}
+
+func newMqtt311Client(
+	options mqttClientOptions,
+) (mqttClient, error) {
+
+	clientOptions := pahomqtt.NewClientOptions().
+		AddBroker(options.address).
+		SetClientID(options.clientId).
+		SetUsername(options.username).
+		SetPassword(options.password).
+		SetKeepAlive(options.keepAlive).
+		SetProtocolVersion(4).
+		SetAutoReconnect(true)
+
+	if options.tlsConfig != nil {
+		clientOptions.SetTLSConfig(options.tlsConfig)
+	}
+
+	client := pahomqtt.NewClient(clientOptions)
+	token := client.Connect()
+	if !token.WaitTimeout(connectTimeout) {
+		return nil, errors.Errorf("timed out connecting to MQTT broker %s", options.address)
+	}
+	if err := token.Error(); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	return &mqtt311Client{
+		client: client,
+	}, nil
+}
+
+func (m *mqtt311Client) publish(
+	topic string, qos byte, retained bool, payload []byte, _ []property,
+) error {
+
+	token := m.client.Publish(topic, qos, retained, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return errors.Errorf("timed out publishing MQTT message to %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (m *mqtt311Client) disconnect() error {
+	m.client.Disconnect(uint(disconnectTimeout.Milliseconds()))
+	return nil
+}
+
+// mqtt5Client publishes using MQTT 5, the connection manager
+// transparently reconnects if the connection was lost
+type mqtt5Client struct {
+	connection *autopaho.ConnectionManager
+}
+
+func newMqtt5Client(
+	options mqttClientOptions,
+) (mqttClient, error) {
+
+	brokerUrl, err := url.Parse(options.address)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	clientConfig := autopaho.ClientConfig{
+		BrokerUrls: []*url.URL{brokerUrl},
+		TlsCfg:     options.tlsConfig,
+		KeepAlive:  uint16(options.keepAlive.Seconds()),
+		ClientConfig: paho.ClientConfig{
+			ClientID: options.clientId,
+		},
+	}
+	if options.username != "" {
+		clientConfig.SetUsernamePassword(options.username, []byte(options.password))
+	}
+
+	connection, err := autopaho.NewConnection(context.Background(), clientConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := connection.AwaitConnection(ctx); err != nil {
+		connection.Disconnect(context.Background())
+		return nil, errors.Errorf("timed out connecting to MQTT broker %s", options.address)
+	}
+
+	return &mqtt5Client{
+		connection: connection,
+	}, nil
+}
+
+func (m *mqtt5Client) publish(
+	topic string, qos byte, retained bool, payload []byte, properties []property,
+) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if err := m.connection.AwaitConnection(ctx); err != nil {
+		return errors.Errorf("timed out waiting for MQTT connection to publish to %s", topic)
+	}
+
+	publish := &paho.Publish{
+		Topic:   topic,
+		QoS:     qos,
+		Retain:  retained,
+		Payload: payload,
+	}
+	if len(properties) > 0 {
+		userProperties := make(paho.UserProperties, 0, len(properties))
+		for _, p := range properties {
+			userProperties = append(userProperties, paho.UserProperty{
+				Key:   p.key,
+				Value: p.value,
+			})
+		}
+		publish.Properties = &paho.PublishProperties{
+			User: userProperties,
+		}
+	}
+
+	if _, err := m.connection.Publish(ctx, publish); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (m *mqtt5Client) disconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	if err := m.connection.Disconnect(ctx); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package mqtt
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	propertyOperation   = "operation"
+	propertySourceTable = "source.table"
+	propertySourceLSN   = "source.lsn"
+	propertySourceTxId  = "source.txid"
+)
+
+// levelReplacer replaces characters which are not allowed inside
+// a single MQTT topic level, since they'd either be interpreted as
+// level separator or wildcards by subscribers
+var levelReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_", "\x00", "_")
+
+func init() {
+	sinkimpl.RegisterSink(config.MQTT, newMqttSink)
+}
+
+type property struct {
+	key   string
+	value string
+}
+
+// mqttClient abstracts the MQTT 3.1.1 and MQTT 5 client implementations.
+// Publish blocks until the message is delivered according to the QoS.
+type mqttClient interface {
+	publish(topic string, qos byte, retained bool, payload []byte, properties []property) error
+	disconnect() error
+}
+
+type mqttClientOptions struct {
+	address   string
+	clientId  string
+	username  string
+	password  string
+	keepAlive time.Duration
+	tlsConfig *tls.Config
+}
+
+type mqttSink struct {
+	client    mqttClient
+	encoder   encoding.Encoder
+	qos       byte
+	retained  bool
+	keyLevels bool
+}
+
+func newMqttSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	qos := config.GetOrDefault(c, config.PropertyMqttQoS, 1)
+	if qos < 0 || qos > 2 {
+		return nil, errors.Errorf("MQTT QoS must be 0, 1 or 2, but was %d", qos)
+	}
+
+	options := mqttClientOptions{
+		address:  config.GetOrDefault(c, config.PropertyMqttAddress, "tcp://localhost:1883"),
+		clientId: config.GetOrDefault(c, config.PropertyMqttClientId, "timescaledb-event-streamer"),
+		username: config.GetOrDefault(c, config.PropertyMqttUsername, ""),
+		password: config.GetOrDefault(c, config.PropertyMqttPassword, ""),
+		keepAlive: time.Duration(config.GetOrDefault(
+			c, config.PropertyMqttKeepAlive, 30,
+		)) * time.Second,
+	}
+
+	if config.GetOrDefault(c, config.PropertyMqttTlsEnabled, false) {
+		options.tlsConfig = &tls.Config{
+			InsecureSkipVerify: config.GetOrDefault(
+				c, config.PropertyMqttTlsSkipVerify, false,
+			),
+			ClientAuth: config.GetOrDefault(
+				c, config.PropertyMqttTlsClientAuth, tls.NoClientCert,
+			),
+		}
+	}
+
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var client mqttClient
+	version := config.GetOrDefault(c, config.PropertyMqttVersion, config.Mqtt5)
+	switch version {
+	case config.Mqtt311:
+		client, err = newMqtt311Client(options)
+	case config.Mqtt5:
+		client, err = newMqtt5Client(options)
+	default:
+		return nil, errors.Errorf("MQTT version '%s' doesn't exist", version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &mqttSink{
+		client:    client,
+		encoder:   encoder,
+		qos:       byte(qos),
+		retained:  config.GetOrDefault(c, config.PropertyMqttRetained, false),
+		keyLevels: config.GetOrDefault(c, config.PropertyMqttTopicKey, true),
+	}, nil
+}
+
+func (m *mqttSink) Start() error {
+	return nil
+}
+
+func (m *mqttSink) Stop() error {
+	return m.client.disconnect()
+}
+
+func (m *mqttSink) Emit(
+	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	envelopeData, err := m.encoder.EncodeEnvelope(topicName, envelope)
+	if err != nil {
+		return err
+	}
+
+	topic := m.mqttTopic(topicName, key)
+	properties := eventProperties(envelope)
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	operation, _ := payload[schema.FieldNameOperation].(string)
+
+	switch operation {
+	case "r", "c", "u":
+		return m.client.publish(topic, m.qos, m.retained, envelopeData, properties)
+
+	case "d":
+		if err := m.client.publish(topic, m.qos, false, envelopeData, properties); err != nil {
+			return err
+		}
+		if m.retained {
+			// A zero-length retained message removes the retained
+			// latest state of the deleted row from the broker
+			return m.client.publish(topic, m.qos, true, []byte{}, nil)
+		}
+		return nil
+	}
+
+	// Truncates, messages and other events don't represent a row
+	// state, hence they'd overwrite the retained latest state
+	return m.client.publish(topic, m.qos, false, envelopeData, properties)
+}
+
+// mqttTopic maps the topic name to an MQTT topic hierarchy, and optionally
+// appends the key values as additional topic levels, i.e. the topic name
+// prefix.schema.table turns into prefix/schema/table/<key>
+func (m *mqttSink) mqttTopic(
+	topicName string, key schema.Struct,
+) string {
+
+	levels := strings.Split(topicName, ".")
+	if m.keyLevels {
+		levels = append(levels, keyValues(key)...)
+	}
+	for i, level := range levels {
+		levels[i] = levelReplacer.Replace(level)
+	}
+	return strings.Join(levels, "/")
+}
+
+// keyValues returns the key values in key column order
+func keyValues(
+	key schema.Struct,
+) []string {
+
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	fields, _ := keySchema[schema.FieldNameFields].([]schema.Struct)
+	keyPayload, _ := key[schema.FieldNamePayload].(schema.Struct)
+
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		name, _ := field[schema.FieldNameField].(string)
+		values = append(values, fmt.Sprint(keyPayload[name]))
+	}
+	return values
+}
+
+// eventProperties returns the event metadata, which is passed as user
+// properties with MQTT 5 to enable consumers to filter events without
+// decoding the payload
+func eventProperties(
+	envelope schema.Struct,
+) []property {
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return nil
+	}
+
+	properties := make([]property, 0, 4)
+	if operation, ok := payload[schema.FieldNameOperation].(string); ok {
+		properties = append(properties, property{propertyOperation, operation})
+	}
+	if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+		schemaName, _ := source[schema.FieldNameSchema].(string)
+		tableName, _ := source[schema.FieldNameTable].(string)
+		if tableName != "" {
+			properties = append(properties, property{
+				propertySourceTable, fmt.Sprintf("%s.%s", schemaName, tableName),
+			})
+		}
+		if lsn, ok := source[schema.FieldNameLSN].(string); ok && lsn != "" {
+			properties = append(properties, property{propertySourceLSN, lsn})
+		}
+		if txId, ok := source[schema.FieldNameTxId].(*uint32); ok && txId != nil {
+			properties = append(properties, property{
+				propertySourceTxId, strconv.FormatUint(uint64(*txId), 10),
+			})
+		}
+	}
+	return properties
+}
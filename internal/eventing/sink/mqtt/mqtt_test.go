@@ -0,0 +1,199 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package mqtt
+
+import (
+	"fmt"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_Mqtt_Topic_Mapping(
+	t *testing.T,
+) {
+
+	key := testKey(schema.Struct{"device_id": "a/b+#", "ts": "2023-03-25T00:00:00Z"})
+
+	m := &mqttSink{keyLevels: true}
+	assert.Equal(t, "tsdb/public/metrics/a_b__/2023-03-25T00:00:00Z", m.mqttTopic("tsdb.public.metrics", key))
+
+	m = &mqttSink{keyLevels: false}
+	assert.Equal(t, "tsdb/public/metrics", m.mqttTopic("tsdb.public.metrics", key))
+
+	// Tables without a key don't get additional levels
+	m = &mqttSink{keyLevels: true}
+	assert.Equal(t, "tsdb/public/metrics", m.mqttTopic("tsdb.public.metrics", nil))
+}
+
+func Test_Mqtt311_Sink(
+	t *testing.T,
+) {
+
+	testMqttSink(t, spiconfig.Mqtt311, func(pk packets.Packet) {
+		assert.Empty(t, pk.Properties.User)
+	})
+}
+
+func Test_Mqtt5_Sink(
+	t *testing.T,
+) {
+
+	testMqttSink(t, spiconfig.Mqtt5, func(pk packets.Packet) {
+		assert.Equal(t, []packets.UserProperty{
+			{Key: propertyOperation, Val: "c"},
+			{Key: propertySourceTable, Val: "public.metrics"},
+			{Key: propertySourceLSN, Val: "0/16B3748"},
+		}, pk.Properties.User)
+	})
+}
+
+func testMqttSink(
+	t *testing.T, version spiconfig.MqttVersion, assertProperties func(pk packets.Packet),
+) {
+
+	server, address := startBroker(t)
+
+	received := make(chan packets.Packet, 10)
+	if err := server.Subscribe("tsdb/#", 1, func(_ *mochi.Client, _ packets.Subscription, pk packets.Packet) {
+		received <- pk
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newMqttSink(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Mqtt: spiconfig.MqttConfig{
+				Address:  address,
+				Version:  version,
+				ClientId: fmt.Sprintf("test-%s", version),
+				QoS:      lo.ToPtr(2),
+				Retained: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	key := testKey(schema.Struct{"device_id": "1"})
+	if err := s.Emit(nil, time.Now(), "tsdb.public.metrics", key, testEnvelope("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	pk := awaitPacket(t, received)
+	assert.Equal(t, "tsdb/public/metrics/1", pk.TopicName)
+	assert.Contains(t, string(pk.Payload), `"op":"c"`)
+	assertProperties(pk)
+
+	// The latest state of the row is retained
+	retained := server.Topics.Messages("tsdb/public/metrics/1")
+	if assert.Len(t, retained, 1) {
+		assert.Equal(t, pk.Payload, retained[0].Payload)
+	}
+
+	// Deletes are published and remove the retained state
+	if err := s.Emit(nil, time.Now(), "tsdb.public.metrics", key, testEnvelope("d")); err != nil {
+		t.Fatal(err)
+	}
+	pk = awaitPacket(t, received)
+	assert.Contains(t, string(pk.Payload), `"op":"d"`)
+	pk = awaitPacket(t, received)
+	assert.Empty(t, pk.Payload)
+	assert.Empty(t, server.Topics.Messages("tsdb/public/metrics/1"))
+}
+
+func startBroker(
+	t *testing.T,
+) (*mochi.Server, string) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddListener(listeners.NewTCP("tcp", address, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+	})
+	return server, fmt.Sprintf("tcp://%s", address)
+}
+
+func awaitPacket(
+	t *testing.T, received <-chan packets.Packet,
+) packets.Packet {
+
+	select {
+	case pk := <-received:
+		return pk
+	case <-time.After(time.Second * 10):
+		t.Fatal("timed out waiting for MQTT message")
+	}
+	return packets.Packet{}
+}
+
+func testKey(
+	values schema.Struct,
+) schema.Struct {
+
+	builder := schema.NewSchemaBuilder(schema.STRUCT)
+	index := 0
+	for _, name := range []string{"device_id", "ts"} {
+		if _, present := values[name]; present {
+			builder = builder.Field(name, index, schema.String())
+			index++
+		}
+	}
+	return schema.Envelope(builder.Build(), values)
+}
+
+func testEnvelope(
+	operation string,
+) schema.Struct {
+
+	return schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: operation,
+		schema.FieldNameAfter:     schema.Struct{"device_id": "1", "value": 1.5},
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: "public",
+			schema.FieldNameTable:  "metrics",
+			schema.FieldNameLSN:    "0/16B3748",
+		},
+	})
+}
@@ -19,9 +19,12 @@ package nats
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"github.com/goccy/go-json"
 	"github.com/nats-io/nats.go"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
@@ -36,7 +39,8 @@ func init() {
 type natsSink struct {
 	client           *nats.Conn
 	jetStreamContext nats.JetStreamContext
-	encoder          *encoding.JsonEncoder
+	encoder          encoding.Encoder
+	logger           *logging.Logger
 }
 
 func newNatsSink(
@@ -96,21 +100,47 @@ func connectJetStreamContext(
 		nats.MaxReconnects(-1),
 	)
 
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := nats.Connect(address, options...)
 	if err != nil {
 		return nil, err
 	}
 
-	jetStreamContext, err := client.JetStream()
+	logger, err := logging.NewLogger("NatsSink")
 	if err != nil {
 		return nil, err
 	}
 
-	return &natsSink{
-		client:           client,
-		jetStreamContext: jetStreamContext,
-		encoder:          encoding.NewJsonEncoderWithConfig(c),
-	}, nil
+	n := &natsSink{
+		client:  client,
+		encoder: encoder,
+		logger:  logger,
+	}
+
+	mode := config.GetOrDefault(c, config.PropertyNatsMode, config.NatsJetStream)
+	switch mode {
+	case config.NatsCore:
+		return n, nil
+
+	case config.NatsJetStream:
+		jetStreamContext, err := client.JetStream()
+		if err != nil {
+			return nil, err
+		}
+		n.jetStreamContext = jetStreamContext
+
+		if config.GetOrDefault(c, config.PropertyNatsStreamCreate, false) {
+			if err := n.provisionStream(c); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("NATS mode '%s' doesn't exist", mode)
 }
 
 func (n *natsSink) Start() error {
@@ -118,6 +148,13 @@ func (n *natsSink) Start() error {
 }
 
 func (n *natsSink) Stop() error {
+	// Core NATS publishing is buffered by the client, flushing
+	// makes sure all messages were handed to the server
+	if n.jetStreamContext == nil {
+		if err := n.client.Flush(); err != nil {
+			n.logger.Warnf("Failed to flush pending messages: %v", err)
+		}
+	}
 	n.client.Close()
 	return nil
 }
@@ -126,25 +163,66 @@ func (n *natsSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	keyData, err := n.encoder.Marshal(key)
+	keyData, err := n.encoder.EncodeKey(topicName, key)
 	if err != nil {
 		return err
 	}
-	envelopeData, err := n.encoder.Marshal(envelope)
+	envelopeData, err := n.encoder.EncodeEnvelope(topicName, envelope)
 	if err != nil {
 		return err
 	}
 
 	header := nats.Header{}
 	header.Add("key", string(keyData))
+	header.Add(nats.MsgIdHdr, messageId(topicName, key, envelope, keyData))
 
-	_, err = n.jetStreamContext.PublishMsg(
-		&nats.Msg{
-			Subject: topicName,
-			Header:  header,
-			Data:    envelopeData,
-		},
-		nats.Context(context.Background()),
-	)
+	msg := &nats.Msg{
+		Subject: topicName,
+		Header:  header,
+		Data:    envelopeData,
+	}
+
+	if n.jetStreamContext == nil {
+		return n.client.PublishMsg(msg)
+	}
+
+	_, err = n.jetStreamContext.PublishMsg(msg, nats.Context(context.Background()))
 	return err
 }
+
+// messageId derives the message id JetStream uses to deduplicate messages,
+// which are published again after a restart of the streamer. The sequence
+// and transaction id identify the change, since the LSN is shared by many
+// changes (e.g. two updates of the same row in one transaction). The topic
+// and key additionally distinguish snapshot reads, and events of tables
+// without a key are distinguished by their row values.
+func messageId(
+	topicName string, key, envelope schema.Struct, keyData []byte,
+) string {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	sequence, _ := source[schema.FieldNameSequence].(string)
+	operation, _ := payload[schema.FieldNameOperation].(string)
+
+	hash := sha256.New()
+	hash.Write([]byte(topicName))
+	hash.Write([]byte(operation))
+	if keyValues, _ := key[schema.FieldNamePayload].(schema.Struct); len(keyValues) > 0 {
+		hash.Write(keyData)
+	} else {
+		for _, field := range []string{schema.FieldNameBefore, schema.FieldNameAfter} {
+			if values, ok := payload[field]; ok {
+				if data, err := json.Marshal(values); err == nil {
+					hash.Write(data)
+				}
+			}
+		}
+	}
+	digest := hash.Sum(nil)
+
+	if txId, ok := source[schema.FieldNameTxId].(*uint32); ok && txId != nil {
+		return fmt.Sprintf("%s-%d-%X", sequence, *txId, digest[:8])
+	}
+	return fmt.Sprintf("%s-%X", sequence, digest[:8])
+}
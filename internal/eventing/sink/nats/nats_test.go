@@ -0,0 +1,140 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nats
+
+import (
+	"github.com/nats-io/nats.go"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testEnvelope(
+	sequence string, txId *uint32, values schema.Struct,
+) schema.Struct {
+
+	return testEventEnvelope("r", sequence, txId, nil, values)
+}
+
+func testEventEnvelope(
+	operation, sequence string, txId *uint32, before, after schema.Struct,
+) schema.Struct {
+
+	payload := schema.Struct{
+		schema.FieldNameOperation: operation,
+		schema.FieldNameAfter:     after,
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameLSN:      "0/16B3748",
+			schema.FieldNameSequence: sequence,
+			schema.FieldNameTxId:     txId,
+		},
+	}
+	if before != nil {
+		payload[schema.FieldNameBefore] = before
+	}
+	return schema.Envelope(nil, payload)
+}
+
+func Test_Nats_Message_Id(
+	t *testing.T,
+) {
+
+	key1 := schema.Envelope(nil, schema.Struct{"id": 1})
+	key2 := schema.Envelope(nil, schema.Struct{"id": 2})
+	envelope := testEnvelope("0/16B3748-0", lo.ToPtr(uint32(742)), schema.Struct{"value": 1})
+
+	id := messageId("topic", key1, envelope, []byte(`{"id":1}`))
+	assert.Regexp(t, `^0/16B3748-0-742-[0-9A-F]{16}$`, id)
+
+	// Replays of the same event lead to the same id
+	assert.Equal(t, id, messageId("topic", key1, envelope, []byte(`{"id":1}`)))
+
+	// Snapshot reads share the same LSN
+	assert.NotEqual(t, id, messageId("topic", key2, envelope, []byte(`{"id":2}`)))
+	assert.NotEqual(t, id, messageId("other", key1, envelope, []byte(`{"id":1}`)))
+
+	// Tables without a key are distinguished by their values
+	noKey := schema.Envelope(nil, schema.Struct{})
+	row1 := testEnvelope("0/16B3748-0", nil, schema.Struct{"value": 1})
+	row2 := testEnvelope("0/16B3748-0", nil, schema.Struct{"value": 2})
+	assert.Regexp(t, `^0/16B3748-0-[0-9A-F]{16}$`, messageId("topic", noKey, row1, nil))
+	assert.NotEqual(t, messageId("topic", noKey, row1, nil), messageId("topic", noKey, row2, nil))
+}
+
+func Test_Nats_Message_Id_Updates_In_Transaction(
+	t *testing.T,
+) {
+
+	// Two updates of the same row in one transaction share the LSN,
+	// the transaction id, and the key, and may even carry the same
+	// values (e.g. a value set and reset), but are different changes
+	key := schema.Envelope(nil, schema.Struct{"id": 1})
+	keyData := []byte(`{"id":1}`)
+	txId := lo.ToPtr(uint32(742))
+
+	first := testEventEnvelope("u", "0/16B3790-0", txId,
+		schema.Struct{"id": 1, "value": 1}, schema.Struct{"id": 1, "value": 2},
+	)
+	second := testEventEnvelope("u", "0/16B3810-0", txId,
+		schema.Struct{"id": 1, "value": 2}, schema.Struct{"id": 1, "value": 1},
+	)
+
+	firstId := messageId("topic", key, first, keyData)
+	secondId := messageId("topic", key, second, keyData)
+	assert.NotEqual(t, firstId, secondId)
+
+	// Replaying the transaction leads to the same ids
+	assert.Equal(t, firstId, messageId("topic", key, first, keyData))
+	assert.Equal(t, secondId, messageId("topic", key, second, keyData))
+}
+
+func Test_Nats_Stream_Config(
+	t *testing.T,
+) {
+
+	streamConfig, err := newStreamConfig(&spiconfig.Config{
+		Topic: spiconfig.TopicConfig{
+			Prefix: "tsdb",
+		},
+		Sink: spiconfig.SinkConfig{
+			Nats: spiconfig.NatsConfig{
+				Stream: spiconfig.NatsStreamConfig{
+					Name:      "events",
+					Retention: spiconfig.NatsRetentionWorkQueue,
+					Replicas:  3,
+					MaxAge:    3600,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "events", streamConfig.Name)
+	assert.Equal(t, []string{"tsdb.>"}, streamConfig.Subjects)
+	assert.Equal(t, nats.WorkQueuePolicy, streamConfig.Retention)
+	assert.Equal(t, 3, streamConfig.Replicas)
+	assert.Equal(t, time.Hour, streamConfig.MaxAge)
+	assert.Equal(t, 2*time.Minute, streamConfig.Duplicates)
+
+	_, err = newStreamConfig(&spiconfig.Config{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package nats
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/nats-io/nats.go"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"time"
+)
+
+// provisionStream creates the JetStream stream if it doesn't exist yet.
+// Existing streams are left untouched.
+func (n *natsSink) provisionStream(
+	c *config.Config,
+) error {
+
+	streamConfig, err := newStreamConfig(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := n.jetStreamContext.StreamInfo(streamConfig.Name); err == nil {
+		n.logger.Infof("JetStream stream %s already exists", streamConfig.Name)
+		return nil
+	} else if !stderrors.Is(err, nats.ErrStreamNotFound) {
+		return errors.Wrap(err, 0)
+	}
+
+	n.logger.Infof("Creating JetStream stream %s with subjects %v", streamConfig.Name, streamConfig.Subjects)
+	if _, err := n.jetStreamContext.AddStream(streamConfig); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func newStreamConfig(
+	c *config.Config,
+) (*nats.StreamConfig, error) {
+
+	name := config.GetOrDefault(c, config.PropertyNatsStreamName, "")
+	if name == "" {
+		return nil, errors.Errorf("NATS stream creation needs the stream name to be configured")
+	}
+
+	// By default, the stream captures all topics of this streamer
+	subjects := config.GetOrDefault(c, config.PropertyNatsStreamSubjects, []string{})
+	if len(subjects) == 0 {
+		subjects = []string{fmt.Sprintf("%s.>", c.Topic.Prefix)}
+	}
+
+	var retention nats.RetentionPolicy
+	switch r := config.GetOrDefault(c, config.PropertyNatsStreamRetention, config.NatsRetentionLimits); r {
+	case config.NatsRetentionLimits:
+		retention = nats.LimitsPolicy
+	case config.NatsRetentionInterest:
+		retention = nats.InterestPolicy
+	case config.NatsRetentionWorkQueue:
+		retention = nats.WorkQueuePolicy
+	default:
+		return nil, errors.Errorf("NATS stream retention '%s' doesn't exist", r)
+	}
+
+	return &nats.StreamConfig{
+		Name:      name,
+		Subjects:  subjects,
+		Retention: retention,
+		Replicas:  config.GetOrDefault(c, config.PropertyNatsStreamReplicas, 1),
+		MaxAge: time.Duration(config.GetOrDefault(
+			c, config.PropertyNatsStreamMaxAge, 0,
+		)) * time.Second,
+		Duplicates: time.Duration(config.GetOrDefault(
+			c, config.PropertyNatsStreamDuplicates, 120,
+		)) * time.Second,
+	}, nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package objectstore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/go-errors/errors"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Properties defines the configuration properties of an object store.
+// If no bucket is configured, objects are written to the local path,
+// otherwise they are uploaded to S3 using the path as key prefix.
+type Properties struct {
+	Path               string
+	Bucket             string
+	AwsRegion          string
+	AwsEndpoint        string
+	AwsAccessKeyId     string
+	AwsSecretAccessKey string
+	AwsSessionToken    string
+}
+
+// Location describes where an object was stored
+type Location struct {
+	// Url is the file path, or the s3:// url of the object
+	Url    string `json:"url"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// Store writes objects to a local directory or an S3-compatible bucket
+type Store interface {
+	Write(
+		name string, data []byte,
+	) (Location, error)
+}
+
+func NewStore(
+	c *config.Config, properties Properties, defaultPath string,
+) (Store, error) {
+
+	bucket := config.GetOrDefault(c, properties.Bucket, "")
+	if bucket == "" {
+		return &localStore{
+			root: config.GetOrDefault(c, properties.Path, defaultPath),
+		}, nil
+	}
+
+	awsRegion := config.GetOrDefault[*string](c, properties.AwsRegion, nil)
+	endpoint := config.GetOrDefault(c, properties.AwsEndpoint, "")
+	accessKeyId := config.GetOrDefault[*string](c, properties.AwsAccessKeyId, nil)
+	secretAccessKey := config.GetOrDefault[*string](c, properties.AwsSecretAccessKey, nil)
+	sessionToken := config.GetOrDefault[*string](c, properties.AwsSessionToken, nil)
+
+	awsConfig := aws.NewConfig().WithEndpoint(endpoint)
+	if endpoint != "" {
+		// S3-compatible object storages commonly don't support
+		// virtual-hosted-style requests
+		awsConfig = awsConfig.WithS3ForcePathStyle(true)
+	}
+	if accessKeyId != nil && secretAccessKey != nil && sessionToken != nil {
+		awsConfig = awsConfig.WithCredentials(
+			credentials.NewStaticCredentials(*accessKeyId, *secretAccessKey, *sessionToken),
+		)
+	}
+	if awsRegion != nil {
+		awsConfig = awsConfig.WithRegion(*awsRegion)
+	}
+
+	awsSession, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Store{
+		bucket:   bucket,
+		prefix:   config.GetOrDefault(c, properties.Path, ""),
+		uploader: s3manager.NewUploader(awsSession),
+	}, nil
+}
+
+type localStore struct {
+	root string
+}
+
+func (l *localStore) Write(
+	name string, data []byte,
+) (Location, error) {
+
+	target := filepath.Join(l.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return Location{}, errors.Wrap(err, 0)
+	}
+
+	// Files are written under a temporary name and renamed afterwards,
+	// readers never see partially written files
+	temporary := target + ".tmp"
+	if err := os.WriteFile(temporary, data, 0o644); err != nil {
+		return Location{}, errors.Wrap(err, 0)
+	}
+	if err := os.Rename(temporary, target); err != nil {
+		return Location{}, errors.Wrap(err, 0)
+	}
+	return Location{Url: target}, nil
+}
+
+type s3Store struct {
+	bucket   string
+	prefix   string
+	uploader *s3manager.Uploader
+}
+
+func (s *s3Store) Write(
+	name string, data []byte,
+) (Location, error) {
+
+	key := path.Join(s.prefix, name)
+	if _, err := s.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	}); err != nil {
+		return Location{}, errors.Wrap(err, 0)
+	}
+	return Location{
+		Url:    fmt.Sprintf("s3://%s/%s", s.bucket, key),
+		Bucket: s.bucket,
+		Key:    key,
+	}, nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package oversize
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/goccy/go-json"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/objectstore"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"strings"
+)
+
+// Pointer is the message sent in place of an
+// event which was offloaded to an object store
+type Pointer struct {
+	Offloaded objectstore.Location `json:"offloaded"`
+	Topic     string               `json:"topic"`
+	Lsn       string               `json:"lsn"`
+	Size      int                  `json:"size"`
+}
+
+// Handler applies the configured strategy
+// to events exceeding the payload limit
+type Handler struct {
+	strategy  config.OversizeStrategy
+	store     objectstore.Store
+	extension string
+	logger    *logging.Logger
+}
+
+func NewHandler(
+	c *config.Config, strategyProperty string, properties objectstore.Properties, logger *logging.Logger,
+) (*Handler, error) {
+
+	strategy := config.GetOrDefault(c, strategyProperty, config.OversizeFail)
+
+	var store objectstore.Store
+	switch strategy {
+	case config.OversizeFail:
+	case config.OversizeDeadLetter:
+		s, err := objectstore.NewStore(c, properties, "./deadletter")
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	case config.OversizeOffload:
+		// Consumers need to be able to retrieve offloaded events,
+		// hence a local directory isn't an option
+		if config.GetOrDefault(c, properties.Bucket, "") == "" {
+			return nil, errors.Errorf("oversize offloading needs the S3 bucket to be configured")
+		}
+		s, err := objectstore.NewStore(c, properties, "")
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	default:
+		return nil, errors.Errorf("illegal oversize strategy: %s", strategy)
+	}
+
+	extension := "bin"
+	if config.GetOrDefault(c, config.PropertyEncodingType, config.JsonEncoding) == config.JsonEncoding {
+		extension = "json"
+	}
+
+	return &Handler{
+		strategy:  strategy,
+		store:     store,
+		extension: extension,
+		logger:    logger,
+	}, nil
+}
+
+// Handle is called for events exceeding the payload limit. It returns the
+// data to be sent instead, or nil if the event must not be sent at all.
+func (h *Handler) Handle(
+	topicName, lsn string, data []byte, limit int,
+) ([]byte, error) {
+
+	switch h.strategy {
+	case config.OversizeDeadLetter:
+		location, err := h.store.Write(h.objectName(topicName, lsn, data), data)
+		if err != nil {
+			return nil, err
+		}
+		h.logger.Warnf(
+			"Event of %d bytes on topic %s exceeds the limit of %d bytes, written to dead-letter location %s",
+			len(data), topicName, limit, location.Url,
+		)
+		return nil, nil
+
+	case config.OversizeOffload:
+		location, err := h.store.Write(h.objectName(topicName, lsn, data), data)
+		if err != nil {
+			return nil, err
+		}
+		pointer, err := json.Marshal(Pointer{
+			Offloaded: location,
+			Topic:     topicName,
+			Lsn:       lsn,
+			Size:      len(data),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return pointer, nil
+	}
+
+	return nil, errors.Errorf(
+		"event of %d bytes on topic %s exceeds the limit of %d bytes", len(data), topicName, limit,
+	)
+}
+
+func (h *Handler) objectName(
+	topicName, lsn string, data []byte,
+) string {
+
+	hash := sha256.Sum256(data)
+	return fmt.Sprintf(
+		"%s/%s-%X.%s", topicName, strings.ReplaceAll(lsn, "/", "-"), hash[:8], h.extension,
+	)
+}
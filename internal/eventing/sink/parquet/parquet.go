@@ -0,0 +1,374 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package parquet
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"github.com/go-errors/errors"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/objectstore"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	parquetgo "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"sync"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.Parquet, newParquetSink)
+}
+
+type pendingRow struct {
+	partition string
+	row       map[string]any
+	ack       sink.AcknowledgeFunc
+}
+
+// tableBuffer collects the rows of a single hypertable
+// until they are written as Parquet files
+type tableBuffer struct {
+	directory string
+	schema    *parquetgo.Schema
+	rows      []*pendingRow
+}
+
+type parquetSink struct {
+	store          objectstore.Store
+	codec          compress.Codec
+	bufferSize     int
+	bufferInterval time.Duration
+	bucket         time.Duration
+	integerBucket  int64
+	partitioners   map[string]*partitioner
+	buffers        map[string]*tableBuffer
+	sequence       uint64
+	mutex          sync.Mutex
+	shutdown       chan struct{}
+	waitGroup      sync.WaitGroup
+	logger         *logging.Logger
+}
+
+func newParquetSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	codec, err := compressionCodec(
+		config.GetOrDefault(c, config.PropertyParquetCompression, config.ParquetCompressionSnappy),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := time.ParseDuration(
+		config.GetOrDefault(c, config.PropertyParquetPartitionBucket, "24h"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if bucket <= 0 {
+		return nil, errors.Errorf("Parquet sink needs a positive partition bucket")
+	}
+
+	integerBucket := config.GetOrDefault(c, config.PropertyParquetPartitionIntBucket, int64(1000000))
+	if integerBucket <= 0 {
+		return nil, errors.Errorf("Parquet sink needs a positive integer partition bucket")
+	}
+
+	store, err := objectstore.NewStore(c, objectstore.Properties{
+		Path:               config.PropertyParquetPath,
+		Bucket:             config.PropertyParquetS3Bucket,
+		AwsRegion:          config.PropertyParquetS3AwsRegion,
+		AwsEndpoint:        config.PropertyParquetS3AwsEndpoint,
+		AwsAccessKeyId:     config.PropertyParquetS3AwsAccessKeyId,
+		AwsSecretAccessKey: config.PropertyParquetS3AwsSecretAccessKey,
+		AwsSessionToken:    config.PropertyParquetS3AwsSessionToken,
+	}, "./parquet")
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := logging.NewLogger("ParquetSink")
+	if err != nil {
+		return nil, err
+	}
+
+	return &parquetSink{
+		store: store,
+		codec: codec,
+		bufferSize: config.GetOrDefault(
+			c, config.PropertyParquetBufferSize, 10000,
+		),
+		bufferInterval: time.Duration(config.GetOrDefault(
+			c, config.PropertyParquetBufferInterval, 300,
+		)) * time.Second,
+		bucket:        bucket,
+		integerBucket: integerBucket,
+		partitioners:  make(map[string]*partitioner),
+		buffers:       make(map[string]*tableBuffer),
+		shutdown:      make(chan struct{}),
+		logger:        logger,
+	}, nil
+}
+
+func (p *parquetSink) Start() error {
+	p.waitGroup.Add(1)
+	go p.flushPeriodically()
+	return nil
+}
+
+func (p *parquetSink) Stop() error {
+	close(p.shutdown)
+	p.waitGroup.Wait()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.flushAll()
+}
+
+func (p *parquetSink) OnTableSchema(
+	table schema.TableAlike,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Rows buffered with the previous schema are written before
+	// the buffer is dropped, the next row derives the new schema
+	name := table.CanonicalName()
+	if buffer, present := p.buffers[name]; present {
+		if err := p.flush(buffer); err != nil {
+			return err
+		}
+		delete(p.buffers, name)
+	}
+
+	p.partitioners[name] = newPartitioner(table, p.bucket, p.integerBucket)
+	return nil
+}
+
+func (p *parquetSink) Emit(
+	_ sink.Context, timestamp time.Time, _ string, _, envelope schema.Struct,
+) error {
+
+	// Synchronous emits flush the table's buffer right away, instead
+	// of waiting for the buffer size or interval to be reached
+	done := make(chan error, 1)
+	if err := p.emit(timestamp, envelope, func(err error) {
+		done <- err
+	}, true); err != nil {
+		return err
+	}
+	return <-done
+}
+
+func (p *parquetSink) EmitAsync(
+	_ sink.Context, timestamp time.Time, _ string,
+	_, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	return p.emit(timestamp, envelope, ack, false)
+}
+
+func (p *parquetSink) emit(
+	timestamp time.Time, envelope schema.Struct, ack sink.AcknowledgeFunc, flush bool,
+) error {
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		ack(nil)
+		return nil
+	}
+
+	var values schema.Struct
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	switch operation {
+	case "r", "c", "u":
+		values, _ = payload[schema.FieldNameAfter].(schema.Struct)
+	case "d":
+		values, _ = payload[schema.FieldNameBefore].(schema.Struct)
+	default:
+		// Truncates, messages and control events have no row representation
+		ack(nil)
+		return nil
+	}
+
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	schemaName, _ := source[schema.FieldNameSchema].(string)
+	tableName, _ := source[schema.FieldNameTable].(string)
+	name := systemcatalog.MakeRelationKey(schemaName, tableName)
+
+	row := map[string]any{
+		columnOperation: operation,
+		columnTimestamp: timestamp.UnixMilli(),
+	}
+	if lsn, ok := source[schema.FieldNameLSN].(string); ok {
+		row[columnLSN] = lsn
+	}
+	if txId, ok := source[schema.FieldNameTxId].(*uint32); ok && txId != nil {
+		row[columnTransactionId] = int64(*txId)
+	}
+	for column, value := range values {
+		v, err := parquetValue(value)
+		if err != nil {
+			return err
+		}
+		row[column] = v
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	buffer, present := p.buffers[name]
+	if !present {
+		envelopeSchema, _ := envelope[schema.FieldNameSchema].(schema.Struct)
+		parquetSchema, err := parquetSchema(name, envelopeSchema)
+		if err != nil {
+			return err
+		}
+		buffer = &tableBuffer{
+			directory: fmt.Sprintf("%s.%s", schemaName, tableName),
+			schema:    parquetSchema,
+		}
+		p.buffers[name] = buffer
+	}
+
+	buffer.rows = append(buffer.rows, &pendingRow{
+		partition: p.partitioners[name].partition(values),
+		row:       row,
+		ack:       ack,
+	})
+
+	if flush || len(buffer.rows) >= p.bufferSize {
+		return p.flush(buffer)
+	}
+	return nil
+}
+
+func (p *parquetSink) flushPeriodically() {
+	defer p.waitGroup.Done()
+
+	ticker := time.NewTicker(p.bufferInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.shutdown:
+			return
+		case <-ticker.C:
+			p.mutex.Lock()
+			if err := p.flushAll(); err != nil {
+				p.logger.Errorf("Failed to write Parquet files: %+v", err)
+			}
+			p.mutex.Unlock()
+		}
+	}
+}
+
+func (p *parquetSink) flushAll() error {
+	var errs []error
+	for _, buffer := range p.buffers {
+		if err := p.flush(buffer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// flush writes one Parquet file per partition. The buffered rows are
+// acknowledged after all files are written, or failed altogether
+// if any of the files couldn't be written.
+func (p *parquetSink) flush(
+	buffer *tableBuffer,
+) error {
+
+	if len(buffer.rows) == 0 {
+		return nil
+	}
+
+	rows := buffer.rows
+	buffer.rows = nil
+
+	partitions := make([]string, 0)
+	partitionRows := make(map[string][]map[string]any)
+	for _, row := range rows {
+		if _, present := partitionRows[row.partition]; !present {
+			partitions = append(partitions, row.partition)
+		}
+		partitionRows[row.partition] = append(partitionRows[row.partition], row.row)
+	}
+
+	var err error
+	for _, partition := range partitions {
+		if err = p.writeFile(buffer, partition, partitionRows[partition]); err != nil {
+			break
+		}
+	}
+
+	for _, row := range rows {
+		row.ack(err)
+	}
+	return err
+}
+
+func (p *parquetSink) writeFile(
+	buffer *tableBuffer, partition string, rows []map[string]any,
+) error {
+
+	data := &bytes.Buffer{}
+	writer := parquetgo.NewGenericWriter[map[string]any](
+		data, buffer.schema, parquetgo.Compression(p.codec),
+	)
+	if _, err := writer.Write(rows); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	p.sequence++
+	name := fmt.Sprintf("part-%d-%06d.parquet", time.Now().UnixNano(), p.sequence)
+	if partition != "" {
+		name = fmt.Sprintf("%s/%s", partition, name)
+	}
+
+	p.logger.Debugf("Writing Parquet file %s/%s with %d rows", buffer.directory, name, len(rows))
+	_, err := p.store.Write(fmt.Sprintf("%s/%s", buffer.directory, name), data.Bytes())
+	return err
+}
+
+func compressionCodec(
+	compression config.ParquetCompressionType,
+) (compress.Codec, error) {
+
+	switch compression {
+	case config.ParquetCompressionNone:
+		return &parquetgo.Uncompressed, nil
+	case config.ParquetCompressionSnappy:
+		return &parquetgo.Snappy, nil
+	case config.ParquetCompressionGzip:
+		return &parquetgo.Gzip, nil
+	case config.ParquetCompressionZstd:
+		return &parquetgo.Zstd, nil
+	}
+	return nil, errors.Errorf("illegal Parquet compression type: %s", compression)
+}
@@ -0,0 +1,310 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package parquet
+
+import (
+	"github.com/jackc/pgx/v5/pgtype"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	parquetgo "github.com/parquet-go/parquet-go"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+type testPgType struct {
+	pgtypes.PgType
+	name       string
+	oid        uint32
+	schemaType schema.Type
+}
+
+func (t *testPgType) Name() string {
+	return t.name
+}
+
+func (t *testPgType) Oid() uint32 {
+	return t.oid
+}
+
+func (t *testPgType) IsArray() bool {
+	return false
+}
+
+func (t *testPgType) SchemaType() schema.Type {
+	return t.schemaType
+}
+
+type testRow struct {
+	Operation string   `parquet:"__op"`
+	LSN       *string  `parquet:"__lsn,optional"`
+	Ts        *string  `parquet:"ts,optional"`
+	Value     *float64 `parquet:"value,optional"`
+	Tags      *string  `parquet:"tags,optional"`
+}
+
+func testEnvelopeSchema() schema.Struct {
+	return schema.NewSchemaBuilder(schema.STRUCT).
+		Field(schema.FieldNameAfter, 0, schema.NewSchemaBuilder(schema.STRUCT).
+			Field("ts", 0, schema.String()).
+			Field("value", 1, schema.Float64().Optional()).
+			Field("count", 2, schema.Int16().Optional()).
+			Field("tags", 3, schema.HStore().Optional()),
+		).Build()
+}
+
+func testEnvelope(
+	operation, ts string, value float64,
+) schema.Struct {
+
+	values := schema.Struct{
+		"ts":    ts,
+		"value": value,
+		"count": int16(1),
+		"tags":  map[string]string{"host": "a"},
+	}
+
+	payload := schema.Struct{
+		schema.FieldNameOperation: operation,
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: "public",
+			schema.FieldNameTable:  "metrics",
+			schema.FieldNameLSN:    "0/16B3748",
+		},
+	}
+	if operation == "d" {
+		payload[schema.FieldNameBefore] = values
+	} else {
+		payload[schema.FieldNameAfter] = values
+	}
+
+	return schema.Envelope(testEnvelopeSchema(), payload)
+}
+
+func testHypertable() *systemcatalog.Hypertable {
+	hypertable := systemcatalog.NewHypertable(
+		1, "public", "metrics", "_timescaledb_internal", "_hyper_1", nil, 0, false, nil, nil, pgtypes.DEFAULT,
+	)
+	hypertable.ApplyTableSchema(systemcatalog.Columns{
+		systemcatalog.NewIndexColumn(
+			"ts", pgtype.TimestamptzOID, -1,
+			&testPgType{name: "timestamptz", oid: pgtype.TimestamptzOID, schemaType: schema.STRING},
+			false, true, lo.ToPtr(0), nil, false, nil, systemcatalog.ASC, systemcatalog.NULLS_LAST,
+			true, true, lo.ToPtr("time"), lo.ToPtr(0), nil, nil, 1,
+		),
+		systemcatalog.NewColumn(
+			"value", pgtype.Float8OID, -1,
+			&testPgType{name: "float8", oid: pgtype.Float8OID, schemaType: schema.FLOAT64}, true, nil,
+		),
+	})
+	return hypertable
+}
+
+func Test_Parquet_Schema_Derivation(
+	t *testing.T,
+) {
+
+	parquetSchema, err := parquetSchema("metrics", testEnvelopeSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := map[string]parquetgo.Kind{
+		columnOperation:     parquetgo.ByteArray,
+		columnLSN:           parquetgo.ByteArray,
+		columnTransactionId: parquetgo.Int64,
+		columnTimestamp:     parquetgo.Int64,
+		"ts":                parquetgo.ByteArray,
+		"value":             parquetgo.Double,
+		"count":             parquetgo.Int32,
+		"tags":              parquetgo.ByteArray,
+	}
+	assert.Len(t, parquetSchema.Fields(), len(kinds))
+	for name, kind := range kinds {
+		column, ok := parquetSchema.Lookup(name)
+		if !assert.True(t, ok, name) {
+			continue
+		}
+		assert.Equal(t, kind, column.Node.Type().Kind(), name)
+		assert.Equal(t, name != columnOperation, column.Node.Optional(), name)
+	}
+}
+
+func Test_Parquet_Partitioned_Write(
+	t *testing.T,
+) {
+
+	directory := t.TempDir()
+	s, err := newParquetSink(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.Parquet,
+			Parquet: spiconfig.ParquetSinkConfig{
+				Path: directory,
+				Buffer: spiconfig.ParquetBufferConfig{
+					Size:     100,
+					Interval: 3600,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parquetSink := s.(*parquetSink)
+
+	if err := parquetSink.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := parquetSink.OnTableSchema(testHypertable()); err != nil {
+		t.Fatal(err)
+	}
+
+	acks := 0
+	ack := func(err error) {
+		assert.NoError(t, err)
+		acks++
+	}
+
+	events := []schema.Struct{
+		testEnvelope("c", "2023-10-01T10:00:00Z", 1.0),
+		testEnvelope("c", "2023-10-01T23:59:59.999999Z", 2.0),
+		testEnvelope("c", "2023-10-02T00:00:00Z", 3.0),
+		testEnvelope("d", "2023-10-01T10:00:00Z", 1.0),
+		testEnvelope("t", "2023-10-01T10:00:00Z", 0),
+	}
+	for _, event := range events {
+		if err := parquetSink.EmitAsync(nil, time.Now(), "metrics", nil, event, ack); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the truncate isn't buffered
+	assert.Equal(t, 1, acks)
+
+	if err := parquetSink.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(events), acks)
+
+	files, err := filepath.Glob(filepath.Join(directory, "public.metrics", "*", "*.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	assert.Len(t, files, 2)
+
+	partitions := lo.Map(files, func(file string, _ int) string {
+		return filepath.Base(filepath.Dir(file))
+	})
+	assert.Equal(t, []string{"ts_bucket=20231001T000000Z", "ts_bucket=20231002T000000Z"}, partitions)
+
+	rows, err := parquetgo.ReadFile[testRow](files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rows, 3)
+	assert.Equal(t, []string{"c", "c", "d"}, lo.Map(rows, func(row testRow, _ int) string {
+		return row.Operation
+	}))
+	assert.Equal(t, 2.0, *rows[1].Value)
+	assert.Equal(t, "0/16B3748", *rows[0].LSN)
+	assert.Equal(t, `{"host":"a"}`, *rows[0].Tags)
+
+	rows, err = parquetgo.ReadFile[testRow](files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "2023-10-02T00:00:00Z", *rows[0].Ts)
+
+	leftovers, err := filepath.Glob(filepath.Join(directory, "public.metrics", "*", "*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, leftovers)
+}
+
+func Test_Parquet_Date_Partitioning(
+	t *testing.T,
+) {
+
+	hypertable := systemcatalog.NewHypertable(
+		1, "public", "daily", "_timescaledb_internal", "_hyper_1", nil, 0, false, nil, nil, pgtypes.DEFAULT,
+	)
+	hypertable.ApplyTableSchema(systemcatalog.Columns{
+		systemcatalog.NewIndexColumn(
+			"day", pgtype.DateOID, -1,
+			&testPgType{name: "date", oid: pgtype.DateOID, schemaType: schema.INT32},
+			false, true, lo.ToPtr(0), nil, false, nil, systemcatalog.ASC, systemcatalog.NULLS_LAST,
+			true, true, lo.ToPtr("time"), lo.ToPtr(0), nil, nil, 1,
+		),
+	})
+
+	partitioner := newPartitioner(hypertable, 7*24*time.Hour, 1000)
+	// 2023-10-05 and 2023-10-09 are 19635 and 19639 days since the epoch
+	assert.Equal(t, "day_bucket=20231002T000000Z", partitioner.partition(schema.Struct{"day": int32(19635)}))
+	assert.Equal(t, "day_bucket=20231009T000000Z", partitioner.partition(schema.Struct{"day": int32(19639)}))
+}
+
+func Test_Parquet_Emit_Flushes(
+	t *testing.T,
+) {
+
+	directory := t.TempDir()
+	s, err := newParquetSink(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			Type: spiconfig.Parquet,
+			Parquet: spiconfig.ParquetSinkConfig{
+				Path: directory,
+				Buffer: spiconfig.ParquetBufferConfig{
+					Size:     100,
+					Interval: 3600,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parquetSink := s.(*parquetSink)
+
+	if err := parquetSink.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer parquetSink.Stop()
+	if err := parquetSink.OnTableSchema(testHypertable()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A synchronous emit must not wait for the buffer interval
+	if err := parquetSink.Emit(nil, time.Now(), "metrics", nil,
+		testEnvelope("c", "2023-10-01T10:00:00Z", 1.0)); err != nil {
+
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(directory, "public.metrics", "*", "*.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, files, 1)
+}
@@ -0,0 +1,221 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package parquet
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	parquetgo "github.com/parquet-go/parquet-go"
+	"time"
+)
+
+const (
+	columnOperation     = "__op"
+	columnLSN           = "__lsn"
+	columnTransactionId = "__txid"
+	columnTimestamp     = "__ts_ms"
+
+	dimensionTypeTime = "time"
+	partitionFormat   = "20060102T150405Z"
+	timestampFormat   = "2006-01-02T15:04:05.999999"
+	secondsPerDay     = 24 * 60 * 60
+)
+
+// parquetSchema derives the Parquet schema from the definition of the
+// row (the "after" field) in the envelope schema. All columns are optional,
+// since delete events may only carry the values of the key columns.
+func parquetSchema(
+	name string, envelopeSchema schema.Struct,
+) (*parquetgo.Schema, error) {
+
+	var rowSchema schema.Struct
+	if fields, ok := envelopeSchema[schema.FieldNameFields].([]schema.Struct); ok {
+		for _, field := range fields {
+			if field[schema.FieldNameField] == schema.FieldNameAfter {
+				rowSchema = field
+				break
+			}
+		}
+	}
+	if rowSchema == nil {
+		return nil, errors.Errorf("envelope schema of '%s' has no row definition", name)
+	}
+
+	group := parquetgo.Group{
+		columnOperation:     parquetgo.String(),
+		columnLSN:           parquetgo.Optional(parquetgo.String()),
+		columnTransactionId: parquetgo.Optional(parquetgo.Int(64)),
+		columnTimestamp:     parquetgo.Optional(parquetgo.Int(64)),
+	}
+
+	fields, _ := rowSchema[schema.FieldNameFields].([]schema.Struct)
+	for _, field := range fields {
+		fieldName, _ := field[schema.FieldNameField].(string)
+		group[fieldName] = parquetgo.Optional(parquetNode(field))
+	}
+	return parquetgo.NewSchema(name, group), nil
+}
+
+func parquetNode(
+	field schema.Struct,
+) parquetgo.Node {
+
+	switch schemaTypeOf(field) {
+	case schema.INT8, schema.INT16, schema.INT32:
+		return parquetgo.Int(32)
+	case schema.INT64:
+		return parquetgo.Int(64)
+	case schema.FLOAT32:
+		return parquetgo.Leaf(parquetgo.FloatType)
+	case schema.FLOAT64:
+		return parquetgo.Leaf(parquetgo.DoubleType)
+	case schema.BOOLEAN:
+		return parquetgo.Leaf(parquetgo.BooleanType)
+	case schema.BYTES:
+		return parquetgo.Leaf(parquetgo.ByteArrayType)
+	case schema.ARRAY:
+		if valueSchema, ok := field[schema.FieldNameValueSchema].(schema.Struct); ok {
+			return parquetgo.List(parquetNode(valueSchema))
+		}
+	}
+	// Strings, as well as maps and structs, which are
+	// stored as their JSON representation
+	return parquetgo.String()
+}
+
+func schemaTypeOf(
+	field schema.Struct,
+) schema.Type {
+
+	switch t := field[schema.FieldNameType].(type) {
+	case schema.Type:
+		return t
+	case string:
+		return schema.Type(t)
+	}
+	return schema.STRING
+}
+
+// parquetValue converts values, which can't be represented
+// by a Parquet primitive, into their JSON representation
+func parquetValue(
+	value any,
+) (any, error) {
+
+	switch value.(type) {
+	case map[string]any, map[string]string:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return string(data), nil
+	}
+	return value, nil
+}
+
+// partitioner calculates the partition of a row
+// based on the hypertable's time dimension
+type partitioner struct {
+	column        systemcatalog.Column
+	bucket        time.Duration
+	integerBucket int64
+}
+
+func newPartitioner(
+	table schema.TableAlike, bucket time.Duration, integerBucket int64,
+) *partitioner {
+
+	hypertable, ok := table.(*systemcatalog.Hypertable)
+	if !ok {
+		return nil
+	}
+	for _, column := range hypertable.Columns() {
+		if column.IsDimension() && column.DimensionType() != nil && *column.DimensionType() == dimensionTypeTime {
+			return &partitioner{
+				column:        column,
+				bucket:        bucket,
+				integerBucket: integerBucket,
+			}
+		}
+	}
+	return nil
+}
+
+func (p *partitioner) partition(
+	row schema.Struct,
+) string {
+
+	if p == nil {
+		return ""
+	}
+
+	var bucket string
+	switch v := row[p.column.Name()].(type) {
+	case string:
+		if t, ok := parseTime(v); ok {
+			bucket = t.Truncate(p.bucket).Format(partitionFormat)
+		}
+	case int64:
+		if p.column.DataType() == pgtype.TimestampOID {
+			// Timestamps without time zone are represented as epoch millis
+			bucket = time.UnixMilli(v).UTC().Truncate(p.bucket).Format(partitionFormat)
+		} else {
+			bucket = fmt.Sprintf("%d", p.integerBucketOf(v))
+		}
+	case int32:
+		if p.column.DataType() == pgtype.DateOID {
+			// Dates are represented as days since the epoch
+			bucket = time.Unix(int64(v)*secondsPerDay, 0).UTC().Truncate(p.bucket).Format(partitionFormat)
+		} else {
+			bucket = fmt.Sprintf("%d", p.integerBucketOf(int64(v)))
+		}
+	case int16:
+		bucket = fmt.Sprintf("%d", p.integerBucketOf(int64(v)))
+	}
+
+	if bucket == "" {
+		bucket = "__unknown__"
+	}
+	return fmt.Sprintf("%s_bucket=%s", p.column.Name(), bucket)
+}
+
+func (p *partitioner) integerBucketOf(
+	value int64,
+) int64 {
+
+	remainder := value % p.integerBucket
+	if remainder < 0 {
+		remainder += p.integerBucket
+	}
+	return value - remainder
+}
+
+func parseTime(
+	value string,
+) (time.Time, bool) {
+
+	for _, layout := range []string{time.RFC3339Nano, timestampFormat, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
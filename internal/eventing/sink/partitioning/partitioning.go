@@ -0,0 +1,212 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package partitioning
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/antonmedv/expr"
+	"github.com/go-errors/errors"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Partitioner derives the partition key of an event, e.g. the
+// Kinesis partition key or the SQS FIFO message group id. Events
+// with the same partition key are delivered in order.
+type Partitioner func(
+	topicName string, key, envelope schema.Struct,
+) (string, error)
+
+// NewPartitioner creates the partitioner configured by the
+// given strategy, columns, and expression properties
+func NewPartitioner(
+	c *config.Config, strategyProperty, columnsProperty, expressionProperty string,
+) (Partitioner, error) {
+
+	strategy := config.GetOrDefault(c, strategyProperty, config.TopicPartitioning)
+	switch strategy {
+	case config.TopicPartitioning:
+		return topicPartitioner, nil
+
+	case config.KeyPartitioning:
+		return keyPartitioner, nil
+
+	case config.ColumnPartitioning:
+		columns := config.GetOrDefault(c, columnsProperty, []string{})
+		if len(columns) == 0 {
+			return nil, errors.Errorf("column partitioning needs the columns to be configured")
+		}
+		return newColumnPartitioner(columns), nil
+
+	case config.ExpressionPartitioning:
+		expression := config.GetOrDefault(c, expressionProperty, "")
+		if expression == "" {
+			return nil, errors.Errorf("expression partitioning needs the expression to be configured")
+		}
+		return newExpressionPartitioner(expression)
+	}
+	return nil, errors.Errorf("illegal partitioning strategy: %s", strategy)
+}
+
+// Constrain makes sure a partition key is accepted by the target
+// service. Keys exceeding the maximum length (in characters), or
+// containing illegal characters, are replaced by their SHA-256 hash.
+func Constrain(
+	partitionKey string, maxLength int, valid func(r rune) bool,
+) string {
+
+	if partitionKey != "" && utf8.RuneCountInString(partitionKey) <= maxLength &&
+		(valid == nil || strings.IndexFunc(partitionKey, func(r rune) bool {
+			return !valid(r)
+		}) == -1) {
+
+		return partitionKey
+	}
+
+	hash := sha256.Sum256([]byte(partitionKey))
+	return fmt.Sprintf("%X", hash[:])
+}
+
+func topicPartitioner(
+	topicName string, _, _ schema.Struct,
+) (string, error) {
+
+	return topicName, nil
+}
+
+// keyPartitioner uses the values of the key columns, in the order
+// of the key schema. Tables without a key fall back to the topic.
+func keyPartitioner(
+	topicName string, key, _ schema.Struct,
+) (string, error) {
+
+	keyValues, _ := key[schema.FieldNamePayload].(schema.Struct)
+	if len(keyValues) == 0 {
+		return topicName, nil
+	}
+
+	columns := keyColumns(key, keyValues)
+	return partitionKey(topicName, columns, keyValues, nil), nil
+}
+
+func newColumnPartitioner(
+	columns []string,
+) Partitioner {
+
+	return func(topicName string, key, envelope schema.Struct) (string, error) {
+		keyValues, _ := key[schema.FieldNamePayload].(schema.Struct)
+		return partitionKey(topicName, columns, rowValues(envelope), keyValues), nil
+	}
+}
+
+func newExpressionPartitioner(
+	expression string,
+) (Partitioner, error) {
+
+	prog, err := expr.Compile(expression)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	return func(topicName string, key, envelope schema.Struct) (string, error) {
+		payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+		source, _ := payload[schema.FieldNameSource].(schema.Struct)
+		keyValues, _ := key[schema.FieldNamePayload].(schema.Struct)
+
+		env := map[string]any{
+			"topic":  topicName,
+			"schema": source[schema.FieldNameSchema],
+			"table":  source[schema.FieldNameTable],
+			"key":    keyValues,
+			"value":  rowValues(envelope),
+		}
+		// The sink may be called from multiple goroutines, a
+		// VM can't be shared, expr.Run uses a new one per call
+		result, err := expr.Run(prog, env)
+		if err != nil {
+			return "", errors.Wrap(err, 0)
+		}
+
+		if result == nil || result == "" {
+			return topicName, nil
+		}
+		return fmt.Sprintf("%v", result), nil
+	}, nil
+}
+
+// rowValues returns the new row values, or the
+// old row values in case of a delete event
+func rowValues(
+	envelope schema.Struct,
+) schema.Struct {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	if after, ok := payload[schema.FieldNameAfter].(schema.Struct); ok {
+		return after
+	}
+	before, _ := payload[schema.FieldNameBefore].(schema.Struct)
+	return before
+}
+
+func keyColumns(
+	key, keyValues schema.Struct,
+) []string {
+
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	if fields, ok := keySchema[schema.FieldNameFields].([]schema.Struct); ok && len(fields) > 0 {
+		columns := make([]string, 0, len(fields))
+		for _, field := range fields {
+			if column, ok := field[schema.FieldNameField].(string); ok {
+				columns = append(columns, column)
+			}
+		}
+		return columns
+	}
+
+	columns := make([]string, 0, len(keyValues))
+	for column := range keyValues {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func partitionKey(
+	topicName string, columns []string, values, fallback schema.Struct,
+) string {
+
+	builder := strings.Builder{}
+	builder.WriteString(topicName)
+	builder.WriteString(":")
+	for i, column := range columns {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		value, present := values[column]
+		if !present {
+			value = fallback[column]
+		}
+		if value != nil {
+			builder.WriteString(fmt.Sprint(value))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,216 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package partitioning
+
+import (
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func testKey() schema.Struct {
+	keySchema := schema.NewSchemaBuilder(schema.STRUCT).
+		Field("ts", 0, schema.String()).
+		Field("device_id", 1, schema.Int32()).
+		Build()
+
+	return schema.Envelope(keySchema, schema.Struct{
+		"device_id": int32(42),
+		"ts":        "2023-10-01T10:00:00Z",
+	})
+}
+
+func testEnvelope(
+	operation string,
+) schema.Struct {
+
+	values := schema.Struct{
+		"ts":        "2023-10-01T10:00:00Z",
+		"device_id": int32(42),
+		"location":  "berlin",
+	}
+
+	payload := schema.Struct{
+		schema.FieldNameOperation: operation,
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: "public",
+			schema.FieldNameTable:  "metrics",
+		},
+	}
+	if operation == "d" {
+		payload[schema.FieldNameBefore] = schema.Struct{
+			"ts":        "2023-10-01T10:00:00Z",
+			"device_id": int32(42),
+		}
+	} else {
+		payload[schema.FieldNameAfter] = values
+	}
+	return schema.Envelope(nil, payload)
+}
+
+func newTestPartitioner(
+	t *testing.T, partitioning spiconfig.PartitioningConfig,
+) Partitioner {
+
+	partitioner, err := NewPartitioner(&spiconfig.Config{
+		Sink: spiconfig.SinkConfig{
+			AwsKinesis: spiconfig.AwsKinesisConfig{
+				Partitioning: partitioning,
+			},
+		},
+	},
+		spiconfig.PropertyKinesisPartitioningStrategy,
+		spiconfig.PropertyKinesisPartitioningColumns,
+		spiconfig.PropertyKinesisPartitioningExpression,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return partitioner
+}
+
+func Test_Partitioning_Strategies(
+	t *testing.T,
+) {
+
+	tests := []struct {
+		name         string
+		partitioning spiconfig.PartitioningConfig
+		operation    string
+		expected     string
+	}{
+		{
+			name:         "default",
+			partitioning: spiconfig.PartitioningConfig{},
+			operation:    "c",
+			expected:     "topic",
+		},
+		{
+			name:         "topic",
+			partitioning: spiconfig.PartitioningConfig{Strategy: spiconfig.TopicPartitioning},
+			operation:    "c",
+			expected:     "topic",
+		},
+		{
+			name:         "key",
+			partitioning: spiconfig.PartitioningConfig{Strategy: spiconfig.KeyPartitioning},
+			operation:    "c",
+			expected:     "topic:2023-10-01T10:00:00Z,42",
+		},
+		{
+			name: "column",
+			partitioning: spiconfig.PartitioningConfig{
+				Strategy: spiconfig.ColumnPartitioning,
+				Columns:  []string{"device_id"},
+			},
+			operation: "c",
+			expected:  "topic:42",
+		},
+		{
+			name: "column from key on delete",
+			partitioning: spiconfig.PartitioningConfig{
+				Strategy: spiconfig.ColumnPartitioning,
+				Columns:  []string{"device_id", "location"},
+			},
+			operation: "d",
+			expected:  "topic:42,",
+		},
+		{
+			name: "expression",
+			partitioning: spiconfig.PartitioningConfig{
+				Strategy:   spiconfig.ExpressionPartitioning,
+				Expression: `schema + "." + table + "/" + value.location + "/" + string(key.device_id)`,
+			},
+			operation: "c",
+			expected:  "public.metrics/berlin/42",
+		},
+		{
+			name: "expression with non-string result",
+			partitioning: spiconfig.PartitioningConfig{
+				Strategy:   spiconfig.ExpressionPartitioning,
+				Expression: "key.device_id",
+			},
+			operation: "d",
+			expected:  "42",
+		},
+		{
+			name: "empty expression result",
+			partitioning: spiconfig.PartitioningConfig{
+				Strategy:   spiconfig.ExpressionPartitioning,
+				Expression: "value.missing",
+			},
+			operation: "c",
+			expected:  "topic",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			partitioner := newTestPartitioner(t, test.partitioning)
+			partitionKey, err := partitioner("topic", testKey(), testEnvelope(test.operation))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, test.expected, partitionKey)
+		})
+	}
+}
+
+func Test_Partitioning_Invalid_Configuration(
+	t *testing.T,
+) {
+
+	for _, partitioning := range []spiconfig.PartitioningConfig{
+		{Strategy: "unknown"},
+		{Strategy: spiconfig.ColumnPartitioning},
+		{Strategy: spiconfig.ExpressionPartitioning},
+		{Strategy: spiconfig.ExpressionPartitioning, Expression: "key.("},
+	} {
+		_, err := NewPartitioner(&spiconfig.Config{
+			Sink: spiconfig.SinkConfig{
+				AwsSqs: spiconfig.AwsSqsConfig{
+					Partitioning: partitioning,
+				},
+			},
+		},
+			spiconfig.PropertySqsPartitioningStrategy,
+			spiconfig.PropertySqsPartitioningColumns,
+			spiconfig.PropertySqsPartitioningExpression,
+		)
+		assert.Error(t, err)
+	}
+}
+
+func Test_Partitioning_Constrain(
+	t *testing.T,
+) {
+
+	valid := func(r rune) bool {
+		return r >= '!' && r <= '~'
+	}
+
+	assert.Equal(t, "topic:42", Constrain("topic:42", 128, valid))
+
+	hashed := Constrain("topic:with space", 128, valid)
+	assert.Len(t, hashed, 64)
+	assert.Equal(t, hashed, Constrain("topic:with space", 128, valid))
+
+	assert.Len(t, Constrain(strings.Repeat("a", 129), 128, valid), 64)
+	assert.Equal(t, strings.Repeat("ä", 256), Constrain(strings.Repeat("ä", 256), 256, nil))
+}
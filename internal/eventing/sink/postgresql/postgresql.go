@@ -0,0 +1,310 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package postgresql
+
+import (
+	"context"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"reflect"
+	"sync"
+	"time"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.Postgresql, newPostgresqlSink)
+}
+
+// columnsProvider is implemented by the table definitions
+// of the system catalog (hypertables and vanilla tables)
+type columnsProvider interface {
+	systemcatalog.SystemEntity
+	Columns() systemcatalog.Columns
+}
+
+type targetTable struct {
+	table       columnsProvider
+	columns     systemcatalog.Columns
+	columnNames []string
+	keyColumns  []string
+	upsert      string
+}
+
+func (t *targetTable) column(
+	name string,
+) (systemcatalog.Column, bool) {
+
+	for _, column := range t.columns {
+		if column.Name() == name {
+			return column, true
+		}
+	}
+	return systemcatalog.Column{}, false
+}
+
+type postgresqlSink struct {
+	poolConfig  *pgxpool.Config
+	pool        *pgxpool.Pool
+	autoCreate  bool
+	tables      map[string]*targetTable
+	tablesMutex sync.RWMutex
+	logger      *logging.Logger
+}
+
+func newPostgresqlSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	connection := config.GetOrDefault(c, config.PropertyPostgresqlSinkConnection, "")
+	if connection == "" {
+		return nil, errors.Errorf("PostgreSQL sink needs the connection to be configured")
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(connection)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	password := config.GetOrDefault(c, config.PropertyPostgresqlSinkPassword, "")
+	if password != "" {
+		poolConfig.ConnConfig.Password = password
+	}
+
+	logger, err := logging.NewLogger("PostgresqlSink")
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresqlSink{
+		poolConfig: poolConfig,
+		autoCreate: config.GetOrDefault(c, config.PropertyPostgresqlSinkAutoCreate, true),
+		tables:     make(map[string]*targetTable),
+		logger:     logger,
+	}, nil
+}
+
+func (p *postgresqlSink) Start() error {
+	pool, err := pgxpool.NewWithConfig(context.Background(), p.poolConfig)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	p.pool = pool
+	return nil
+}
+
+func (p *postgresqlSink) Stop() error {
+	if p.pool != nil {
+		p.pool.Close()
+	}
+	return nil
+}
+
+func (p *postgresqlSink) OnTableSchema(
+	table schema.TableAlike,
+) error {
+
+	provider, ok := table.(columnsProvider)
+	if !ok {
+		return errors.Errorf("PostgreSQL sink doesn't support table definition of '%s'", table.CanonicalName())
+	}
+
+	keyColumns := make([]string, 0)
+	for _, column := range table.KeyIndexColumns() {
+		keyColumns = append(keyColumns, column.Name())
+	}
+	if len(keyColumns) == 0 {
+		// Without key columns, redelivered events can't be
+		// deduplicated and would insert duplicate rows
+		return errors.Errorf(
+			"PostgreSQL sink requires a primary key on table '%s'", table.CanonicalName(),
+		)
+	}
+
+	columns := provider.Columns()
+	columnNames := make([]string, 0, len(columns))
+	for _, column := range columns {
+		columnNames = append(columnNames, column.Name())
+	}
+
+	p.tablesMutex.Lock()
+	defer p.tablesMutex.Unlock()
+
+	if p.autoCreate {
+		var statements []string
+		if previous, present := p.tables[table.CanonicalName()]; present {
+			statements = systemcatalog.SchemaChangeStatements(provider, previous.columns, columns)
+		} else {
+			statements = createTableStatements(provider, columns, keyColumns)
+		}
+
+		for _, statement := range statements {
+			p.logger.Debugf("Executing: %s", statement)
+			if _, err := p.pool.Exec(context.Background(), statement); err != nil {
+				return errors.Wrap(err, 0)
+			}
+		}
+	}
+
+	p.tables[table.CanonicalName()] = &targetTable{
+		table:       provider,
+		columns:     columns,
+		columnNames: columnNames,
+		keyColumns:  keyColumns,
+		upsert:      upsertStatement(provider, columnNames, keyColumns),
+	}
+	return nil
+}
+
+func (p *postgresqlSink) Emit(
+	_ sink.Context, _ time.Time, _ string, key, envelope schema.Struct,
+) error {
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return nil
+	}
+
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	switch schema.Operation(operation) {
+	case schema.OP_READ, schema.OP_CREATE, schema.OP_UPDATE,
+		schema.OP_DELETE, schema.OP_TRUNCATE:
+	default:
+		// Messages, compression, and schema change events
+		// have no representation in the target database
+		return nil
+	}
+
+	table, err := p.targetTable(payload)
+	if err != nil {
+		return err
+	}
+
+	before, _ := payload[schema.FieldNameBefore].(schema.Struct)
+	after, _ := payload[schema.FieldNameAfter].(schema.Struct)
+	keyValues, _ := key[schema.FieldNamePayload].(schema.Struct)
+
+	ctx := context.Background()
+	switch schema.Operation(operation) {
+	case schema.OP_READ, schema.OP_CREATE:
+		return p.exec(ctx, p.pool, table.upsert, table.rowValues(after)...)
+
+	case schema.OP_UPDATE:
+		// If the key of the row has changed, the old row has to
+		// be removed, otherwise the upsert would create a new row
+		if before != nil && table.keyChanged(before, after) {
+			return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+				if err := p.exec(ctx, tx,
+					deleteStatement(table.table, table.keyColumns), table.keyValues(before)...,
+				); err != nil {
+					return err
+				}
+				return p.exec(ctx, tx, table.upsert, table.rowValues(after)...)
+			})
+		}
+		return p.exec(ctx, p.pool, table.upsert, table.rowValues(after)...)
+
+	case schema.OP_DELETE:
+		if keyValues == nil {
+			keyValues = before
+		}
+		return p.exec(ctx, p.pool,
+			deleteStatement(table.table, table.keyColumns), table.keyValues(keyValues)...,
+		)
+
+	default:
+		return p.exec(ctx, p.pool, truncateStatement(table.table))
+	}
+}
+
+func (p *postgresqlSink) targetTable(
+	payload schema.Struct,
+) (*targetTable, error) {
+
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	schemaName, _ := source[schema.FieldNameSchema].(string)
+	tableName, _ := source[schema.FieldNameTable].(string)
+	canonicalName := systemcatalog.MakeRelationKey(schemaName, tableName)
+
+	p.tablesMutex.RLock()
+	defer p.tablesMutex.RUnlock()
+	table, present := p.tables[canonicalName]
+	if !present {
+		return nil, errors.Errorf("PostgreSQL sink received event for unknown table '%s'", canonicalName)
+	}
+	return table, nil
+}
+
+type executor interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func (p *postgresqlSink) exec(
+	ctx context.Context, executor executor, statement string, arguments ...any,
+) error {
+
+	p.logger.Tracef("Executing: %s, %+v", statement, arguments)
+	if _, err := executor.Exec(ctx, statement, arguments...); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (t *targetTable) rowValues(
+	row schema.Struct,
+) []any {
+
+	values := make([]any, 0, len(t.columns))
+	for _, column := range t.columns {
+		values = append(values, targetValue(column, row[column.Name()]))
+	}
+	return values
+}
+
+func (t *targetTable) keyValues(
+	row schema.Struct,
+) []any {
+
+	values := make([]any, 0, len(t.keyColumns))
+	for _, keyColumn := range t.keyColumns {
+		value := row[keyColumn]
+		if column, present := t.column(keyColumn); present {
+			value = targetValue(column, value)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func (t *targetTable) keyChanged(
+	before, after schema.Struct,
+) bool {
+
+	for _, keyColumn := range t.keyColumns {
+		if !reflect.DeepEqual(before[keyColumn], after[keyColumn]) {
+			return true
+		}
+	}
+	return false
+}
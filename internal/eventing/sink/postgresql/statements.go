@@ -0,0 +1,184 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package postgresql
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"strings"
+)
+
+const dimensionTypeTime = "time"
+
+// createTableStatements returns the statements necessary to create
+// the target table (and hypertable, if the source table is a hypertable)
+// of the given source table. All statements are idempotent, hence are
+// safe to execute against an already existing target table.
+func createTableStatements(
+	table systemcatalog.SystemEntity, columns systemcatalog.Columns, keyColumns []string,
+) []string {
+
+	tableName := quotedTableName(table)
+
+	columnDefinitions := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		columnDefinition := fmt.Sprintf("%s %s", quoteIdentifier(column.Name()), column.TypeDefinition())
+		if !column.IsNullable() {
+			columnDefinition += " NOT NULL"
+		}
+		columnDefinitions = append(columnDefinitions, columnDefinition)
+	}
+	if len(keyColumns) > 0 {
+		columnDefinitions = append(columnDefinitions, fmt.Sprintf("PRIMARY KEY (%s)", quoteIdentifiers(keyColumns)))
+	}
+
+	statements := []string{
+		fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", quoteIdentifier(table.SchemaName())),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", tableName, strings.Join(columnDefinitions, ", ")),
+	}
+
+	// The target table may have been created with an older schema
+	// version, missing columns are added (but can't be NOT NULL)
+	for _, column := range columns {
+		statements = append(statements, fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s",
+			tableName, quoteIdentifier(column.Name()), column.TypeDefinition(),
+		))
+	}
+
+	if _, ok := table.(*systemcatalog.Hypertable); ok {
+		if timeColumn, present := timeDimension(columns); present {
+			// The chunk interval is passed as an integer, which TimescaleDB
+			// interprets as microseconds for date and time columns and as
+			// is for integer columns, hence works for both
+			chunkTimeInterval := ""
+			if interval := timeColumn.DimensionInterval(); interval != nil {
+				chunkTimeInterval = fmt.Sprintf("chunk_time_interval => %d, ", *interval)
+			}
+			statements = append(statements, fmt.Sprintf(
+				"SELECT create_hypertable(%s, %s, %sif_not_exists => TRUE)",
+				quoteLiteral(tableName), quoteLiteral(timeColumn.Name()), chunkTimeInterval,
+			))
+		}
+	}
+	return statements
+}
+
+// upsertStatement returns an insert statement which updates all non-key
+// columns when a row with the same key already exists. The key columns
+// must not be empty, since redelivered events would otherwise insert
+// duplicate rows.
+func upsertStatement(
+	table systemcatalog.SystemEntity, columns []string, keyColumns []string,
+) string {
+
+	placeholders := make([]string, 0, len(columns))
+	for i := range columns {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+	}
+
+	statement := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		quotedTableName(table), quoteIdentifiers(columns), strings.Join(placeholders, ", "),
+	)
+
+	keys := make(map[string]bool, len(keyColumns))
+	for _, keyColumn := range keyColumns {
+		keys[keyColumn] = true
+	}
+
+	updates := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !keys[column] {
+			quotedColumn := quoteIdentifier(column)
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", quotedColumn, quotedColumn))
+		}
+	}
+
+	if len(updates) == 0 {
+		return fmt.Sprintf("%s ON CONFLICT (%s) DO NOTHING", statement, quoteIdentifiers(keyColumns))
+	}
+	return fmt.Sprintf(
+		"%s ON CONFLICT (%s) DO UPDATE SET %s",
+		statement, quoteIdentifiers(keyColumns), strings.Join(updates, ", "),
+	)
+}
+
+// deleteStatement returns a delete statement matching the given columns.
+// Since NULL never equals NULL, the comparison is null-safe.
+func deleteStatement(
+	table systemcatalog.SystemEntity, columns []string,
+) string {
+
+	conditions := make([]string, 0, len(columns))
+	for i, column := range columns {
+		conditions = append(conditions, fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", quoteIdentifier(column), i+1))
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", quotedTableName(table), strings.Join(conditions, " AND "))
+}
+
+func truncateStatement(
+	table systemcatalog.SystemEntity,
+) string {
+
+	return fmt.Sprintf("TRUNCATE %s", quotedTableName(table))
+}
+
+func timeDimension(
+	columns systemcatalog.Columns,
+) (systemcatalog.Column, bool) {
+
+	for _, column := range columns {
+		if column.IsDimension() && column.DimensionType() != nil && *column.DimensionType() == dimensionTypeTime {
+			return column, true
+		}
+	}
+	return systemcatalog.Column{}, false
+}
+
+func quotedTableName(
+	table systemcatalog.SystemEntity,
+) string {
+
+	return pgx.Identifier{table.SchemaName(), table.TableName()}.Sanitize()
+}
+
+func quoteIdentifier(
+	identifier string,
+) string {
+
+	return pgx.Identifier{identifier}.Sanitize()
+}
+
+func quoteIdentifiers(
+	identifiers []string,
+) string {
+
+	quoted := make([]string, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		quoted = append(quoted, quoteIdentifier(identifier))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func quoteLiteral(
+	literal string,
+) string {
+
+	return "'" + strings.ReplaceAll(literal, "'", "''") + "'"
+}
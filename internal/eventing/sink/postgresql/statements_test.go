@@ -0,0 +1,194 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package postgresql
+
+import (
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type testPgType struct {
+	pgtypes.PgType
+	name       string
+	oid        uint32
+	schemaType schema.Type
+}
+
+func (t *testPgType) Name() string {
+	return t.name
+}
+
+func (t *testPgType) Oid() uint32 {
+	return t.oid
+}
+
+func (t *testPgType) Kind() pgtypes.PgKind {
+	return pgtypes.BaseKind
+}
+
+func (t *testPgType) IsArray() bool {
+	return false
+}
+
+func (t *testPgType) SchemaType() schema.Type {
+	return t.schemaType
+}
+
+var (
+	timestamptzType = &testPgType{name: "timestamptz", oid: pgtype.TimestamptzOID, schemaType: schema.STRING}
+	float8Type      = &testPgType{name: "float8", oid: pgtype.Float8OID, schemaType: schema.FLOAT64}
+	byteaType       = &testPgType{name: "bytea", oid: pgtype.ByteaOID, schemaType: schema.STRING}
+	timestampType   = &testPgType{name: "timestamp", oid: pgtype.TimestampOID, schemaType: schema.INT64}
+)
+
+func testColumns() systemcatalog.Columns {
+	return systemcatalog.Columns{
+		systemcatalog.NewIndexColumn(
+			"ts", pgtype.TimestamptzOID, -1, timestamptzType, false, true, lo.ToPtr(0), nil, false,
+			nil, systemcatalog.ASC, systemcatalog.NULLS_LAST, true, true, lo.ToPtr("time"), lo.ToPtr(0), nil, nil, 1,
+		),
+		systemcatalog.NewColumn("value", pgtype.Float8OID, -1, float8Type, true, nil),
+		systemcatalog.NewColumn("data", pgtype.ByteaOID, -1, byteaType, true, nil),
+	}
+}
+
+func Test_PostgreSQL_Create_Hypertable_Statements(
+	t *testing.T,
+) {
+
+	hypertable := systemcatalog.NewHypertable(
+		1, "public", "metrics", "_timescaledb_internal", "_hyper_1", nil, 0, false, nil, nil, pgtypes.DEFAULT,
+	)
+
+	statements := createTableStatements(hypertable, testColumns(), []string{"ts"})
+	assert.Equal(t, []string{
+		`CREATE SCHEMA IF NOT EXISTS "public"`,
+		`CREATE TABLE IF NOT EXISTS "public"."metrics" ("ts" timestamptz NOT NULL, "value" float8, "data" bytea, PRIMARY KEY ("ts"))`,
+		`ALTER TABLE "public"."metrics" ADD COLUMN IF NOT EXISTS "ts" timestamptz`,
+		`ALTER TABLE "public"."metrics" ADD COLUMN IF NOT EXISTS "value" float8`,
+		`ALTER TABLE "public"."metrics" ADD COLUMN IF NOT EXISTS "data" bytea`,
+		`SELECT create_hypertable('"public"."metrics"', 'ts', if_not_exists => TRUE)`,
+	}, statements)
+}
+
+func Test_PostgreSQL_Create_Hypertable_Chunk_Interval(
+	t *testing.T,
+) {
+
+	hypertable := systemcatalog.NewHypertable(
+		1, "public", "metrics", "_timescaledb_internal", "_hyper_1", nil, 0, false, nil, nil, pgtypes.DEFAULT,
+	)
+
+	columns := testColumns()
+	columns[0] = systemcatalog.NewIndexColumn(
+		"ts", pgtype.TimestamptzOID, -1, timestamptzType, false, true, lo.ToPtr(0), nil, false,
+		nil, systemcatalog.ASC, systemcatalog.NULLS_LAST, true, true, lo.ToPtr("time"), lo.ToPtr(0),
+		lo.ToPtr(int64(86400000000)), nil, 1,
+	)
+
+	statements := createTableStatements(hypertable, columns, []string{"ts"})
+	assert.Equal(t,
+		`SELECT create_hypertable('"public"."metrics"', 'ts', chunk_time_interval => 86400000000, if_not_exists => TRUE)`,
+		statements[len(statements)-1],
+	)
+}
+
+func Test_PostgreSQL_Create_Vanilla_Table_Statements(
+	t *testing.T,
+) {
+
+	table := systemcatalog.NewPgTable(1, "public", "metrics", pgtypes.DEFAULT)
+
+	statements := createTableStatements(table, testColumns(), nil)
+	assert.Equal(t, 5, len(statements))
+	assert.Equal(t,
+		`CREATE TABLE IF NOT EXISTS "public"."metrics" ("ts" timestamptz NOT NULL, "value" float8, "data" bytea)`,
+		statements[1],
+	)
+}
+
+func Test_PostgreSQL_Upsert_Statement(
+	t *testing.T,
+) {
+
+	table := systemcatalog.NewPgTable(1, "public", "metrics", pgtypes.DEFAULT)
+
+	assert.Equal(t,
+		`INSERT INTO "public"."metrics" ("ts", "value") VALUES ($1, $2) `+
+			`ON CONFLICT ("ts") DO UPDATE SET "value" = EXCLUDED."value"`,
+		upsertStatement(table, []string{"ts", "value"}, []string{"ts"}),
+	)
+	assert.Equal(t,
+		`INSERT INTO "public"."metrics" ("ts") VALUES ($1) ON CONFLICT ("ts") DO NOTHING`,
+		upsertStatement(table, []string{"ts"}, []string{"ts"}),
+	)
+}
+
+func Test_PostgreSQL_Rejects_Keyless_Tables(
+	t *testing.T,
+) {
+
+	table := systemcatalog.NewPgTable(1, "public", "metrics", pgtypes.DEFAULT)
+	table.ApplyTableSchema(systemcatalog.Columns{
+		systemcatalog.NewColumn("value", pgtype.Float8OID, -1, float8Type, true, nil),
+	})
+
+	s := &postgresqlSink{tables: make(map[string]*targetTable)}
+	assert.ErrorContains(t, s.OnTableSchema(table), "requires a primary key")
+	assert.Empty(t, s.tables)
+}
+
+func Test_PostgreSQL_Delete_And_Truncate_Statements(
+	t *testing.T,
+) {
+
+	table := systemcatalog.NewPgTable(1, "public", "metrics", pgtypes.DEFAULT)
+
+	assert.Equal(t,
+		`DELETE FROM "public"."metrics" WHERE "ts" IS NOT DISTINCT FROM $1 AND "id" IS NOT DISTINCT FROM $2`,
+		deleteStatement(table, []string{"ts", "id"}),
+	)
+	assert.Equal(t, `TRUNCATE "public"."metrics"`, truncateStatement(table))
+}
+
+func Test_PostgreSQL_Target_Values(
+	t *testing.T,
+) {
+
+	columns := testColumns()
+	table := &targetTable{
+		columns:    columns,
+		keyColumns: []string{"ts"},
+	}
+
+	before := schema.Struct{"ts": "2023-01-01T00:00:00Z", "value": 1.0, "data": "cafe"}
+	after := schema.Struct{"ts": "2023-01-01T00:00:01Z", "value": 2.0, "data": nil}
+
+	assert.Equal(t, []any{"2023-01-01T00:00:00Z", 1.0, []byte{0xca, 0xfe}}, table.rowValues(before))
+	assert.Equal(t, []any{"2023-01-01T00:00:01Z"}, table.keyValues(after))
+	assert.True(t, table.keyChanged(before, after))
+	assert.False(t, table.keyChanged(before, before))
+
+	timestampColumn := systemcatalog.NewColumn("created", pgtype.TimestampOID, -1, timestampType, true, nil)
+	assert.Equal(t, time.UnixMilli(1672531200000).UTC(), targetValue(timestampColumn, int64(1672531200000)))
+}
@@ -0,0 +1,375 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package postgresql
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/ewkbhex"
+	"github.com/twpayne/go-geom/encoding/wkb"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	microsPerDay   = int64(24 * time.Hour / time.Microsecond)
+	microsPerMonth = int64(365.25 / 12 * float64(microsPerDay))
+
+	timestampTextFormat = "2006-01-02 15:04:05.999999"
+)
+
+var arrayElementOids = map[uint32]uint32{
+	pgtype.ByteaArrayOID:     pgtype.ByteaOID,
+	pgtype.TimestampArrayOID: pgtype.TimestampOID,
+	pgtype.DateArrayOID:      pgtype.DateOID,
+	pgtype.IntervalArrayOID:  pgtype.IntervalOID,
+}
+
+// targetValue converts values, which were converted into their event
+// representation, back into a value accepted by the target database
+func targetValue(
+	column systemcatalog.Column, value any,
+) any {
+
+	return convertValue(column.DataType(), column.PgType(), value)
+}
+
+func convertValue(
+	oid uint32, typ pgtypes.PgType, value any,
+) any {
+
+	if value == nil {
+		return nil
+	}
+
+	switch oid {
+	case pgtype.ByteaOID:
+		// Byte arrays are represented as hex strings
+		if v, ok := value.(string); ok {
+			if decoded, err := hex.DecodeString(v); err == nil {
+				return decoded
+			}
+		}
+		return value
+	case pgtype.TimestampOID:
+		// Timestamps without time zone are represented as epoch millis
+		if v, ok := asInt64(value); ok {
+			return time.UnixMilli(v).UTC()
+		}
+		return value
+	case pgtype.DateOID:
+		// Dates are represented as days since the epoch
+		if v, ok := asInt64(value); ok {
+			return time.Unix(v*int64(24*time.Hour/time.Second), 0).UTC()
+		}
+		return value
+	case pgtype.IntervalOID:
+		// Intervals are represented as microseconds, with months
+		// being accounted as an average month of 30.4375 days
+		if v, ok := asInt64(value); ok {
+			months := v / microsPerMonth
+			v -= months * microsPerMonth
+			days := v / microsPerDay
+			return pgtype.Interval{
+				Months:       int32(months),
+				Days:         int32(days),
+				Microseconds: v - days*microsPerDay,
+				Valid:        true,
+			}
+		}
+		return value
+	}
+
+	if elementOid, present := arrayElementOids[oid]; present {
+		return convertArray(value, func(element any) any {
+			return convertValue(elementOid, nil, element)
+		})
+	}
+
+	if typ == nil {
+		return value
+	}
+
+	switch typ.Name() {
+	case "geometry", "geography":
+		return geometryValue(value)
+	case "hstore":
+		return hstoreValue(value)
+	case "_geometry", "_geography", "_hstore":
+		// Arrays of extension types aren't known to the driver
+		// and are passed as array literals instead
+		elementType := typ.ElementType()
+		if literal, ok := arrayLiteral(convertArray(value, func(element any) any {
+			return convertValue(elementType.Oid(), elementType, element)
+		})); ok {
+			return literal
+		}
+		return value
+	}
+
+	switch typ.Kind() {
+	case pgtypes.DomainKind:
+		return convertValue(typ.OidBase(), typ.BaseType(), value)
+	case pgtypes.CompositeKind:
+		if literal, ok := compositeLiteral(typ, value); ok {
+			return literal
+		}
+	}
+	return value
+}
+
+// convertArray converts all elements of the given slice, values
+// which aren't slices are returned unchanged
+func convertArray(
+	value any, converter func(element any) any,
+) any {
+
+	source := reflect.ValueOf(value)
+	if source.Kind() != reflect.Slice {
+		return value
+	}
+
+	var elementType reflect.Type
+	elements := make([]any, source.Len())
+	for i := range elements {
+		element := converter(source.Index(i).Interface())
+		if element != nil {
+			if elementType == nil {
+				elementType = reflect.TypeOf(element)
+			} else if elementType != reflect.TypeOf(element) {
+				return elements
+			}
+		}
+		elements[i] = element
+	}
+
+	// Typed slices give the driver the best chance to find an encoder
+	if elementType == nil {
+		return elements
+	}
+	target := reflect.MakeSlice(reflect.SliceOf(elementType), len(elements), len(elements))
+	for i, element := range elements {
+		if element == nil {
+			if !canBeNil(elementType) {
+				return elements
+			}
+			continue
+		}
+		target.Index(i).Set(reflect.ValueOf(element))
+	}
+	return target.Interface()
+}
+
+// geometryValue converts the WKB and SRID representation of PostGIS
+// types into the hex encoded EWKB accepted by PostGIS as text input
+func geometryValue(
+	value any,
+) any {
+
+	v, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+
+	encoded, ok := v["wkb"].(string)
+	if !ok {
+		return value
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return value
+	}
+	g, err := wkb.Unmarshal(data)
+	if err != nil {
+		return value
+	}
+	if srid, ok := asInt64(v["srid"]); ok && srid != 0 {
+		if g, err = geom.SetSRID(g, int(srid)); err != nil {
+			return value
+		}
+	}
+	ewkb, err := ewkbhex.Encode(g, binary.LittleEndian)
+	if err != nil {
+		return value
+	}
+	return ewkb
+}
+
+func hstoreValue(
+	value any,
+) any {
+
+	v, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+
+	hstore := make(pgtype.Hstore, len(v))
+	for key, val := range v {
+		switch s := val.(type) {
+		case *string:
+			hstore[key] = s
+		case string:
+			hstore[key] = &s
+		case nil:
+			hstore[key] = nil
+		default:
+			return value
+		}
+	}
+	return hstore
+}
+
+// compositeLiteral renders the fields of a composite value as a row
+// literal, since composite types aren't known to the driver
+func compositeLiteral(
+	typ pgtypes.PgType, value any,
+) (string, bool) {
+
+	v, ok := value.(map[string]any)
+	if !ok {
+		return "", false
+	}
+
+	columns, err := typ.CompositeColumns()
+	if err != nil {
+		return "", false
+	}
+
+	fields := make([]string, 0, len(columns))
+	for _, column := range columns {
+		fieldType := column.Type()
+		field := convertValue(fieldType.Oid(), fieldType, v[column.Name()])
+		if field == nil {
+			fields = append(fields, "")
+			continue
+		}
+		text, ok := textValue(field)
+		if !ok {
+			return "", false
+		}
+		fields = append(fields, quoteElement(text, ",()"))
+	}
+	return "(" + strings.Join(fields, ",") + ")", true
+}
+
+func arrayLiteral(
+	value any,
+) (string, bool) {
+
+	source := reflect.ValueOf(value)
+	if source.Kind() != reflect.Slice {
+		return "", false
+	}
+
+	elements := make([]string, source.Len())
+	for i := range elements {
+		element := source.Index(i).Interface()
+		if element == nil {
+			elements[i] = "NULL"
+			continue
+		}
+		text, ok := textValue(element)
+		if !ok {
+			return "", false
+		}
+		elements[i] = quoteElement(text, ",{}")
+	}
+	return "{" + strings.Join(elements, ",") + "}", true
+}
+
+// textValue returns the PostgreSQL text representation of
+// an already converted value
+func textValue(
+	value any,
+) (string, bool) {
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return `\x` + hex.EncodeToString(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case time.Time:
+		return v.Format(timestampTextFormat), true
+	case pgtype.Interval:
+		return fmt.Sprintf("%d mons %d days %d microseconds", v.Months, v.Days, v.Microseconds), true
+	case pgtype.Hstore:
+		text, err := v.Value()
+		if err != nil {
+			return "", false
+		}
+		return text.(string), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), true
+	}
+
+	if reflect.ValueOf(value).Kind() == reflect.Slice {
+		return arrayLiteral(value)
+	}
+	return "", false
+}
+
+// quoteElement quotes an element of a row or array literal if
+// it's empty, or contains whitespace, quotes, backslashes, or
+// any of the given delimiters
+func quoteElement(
+	text, delimiters string,
+) string {
+
+	if text != "" && !strings.ContainsAny(text, delimiters+"\"\\ \t\n\r") && !strings.EqualFold(text, "NULL") {
+		return text
+	}
+	escaped := strings.ReplaceAll(text, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `"`, `\"`)
+	return `"` + escaped + `"`
+}
+
+func asInt64(
+	value any,
+) (int64, bool) {
+
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+func canBeNil(
+	typ reflect.Type,
+) bool {
+
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Pointer, reflect.Interface:
+		return true
+	}
+	return false
+}
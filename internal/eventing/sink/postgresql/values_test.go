@@ -0,0 +1,192 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package postgresql
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/stretchr/testify/assert"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/ewkbhex"
+	"github.com/twpayne/go-geom/encoding/wkb"
+	"testing"
+	"time"
+)
+
+type testCompositeColumn struct {
+	pgtypes.CompositeColumn
+	name string
+	typ  pgtypes.PgType
+}
+
+func (c *testCompositeColumn) Name() string {
+	return c.name
+}
+
+func (c *testCompositeColumn) Type() pgtypes.PgType {
+	return c.typ
+}
+
+type testCompositeType struct {
+	testPgType
+	columns []pgtypes.CompositeColumn
+}
+
+func (t *testCompositeType) Kind() pgtypes.PgKind {
+	return pgtypes.CompositeKind
+}
+
+func (t *testCompositeType) CompositeColumns() ([]pgtypes.CompositeColumn, error) {
+	return t.columns, nil
+}
+
+type testExtensionType struct {
+	testPgType
+	elementType pgtypes.PgType
+}
+
+func (t *testExtensionType) ElementType() pgtypes.PgType {
+	return t.elementType
+}
+
+var (
+	textType     = &testPgType{name: "text", oid: pgtype.TextOID, schemaType: schema.STRING}
+	dateType     = &testPgType{name: "date", oid: pgtype.DateOID, schemaType: schema.INT32}
+	intervalType = &testPgType{name: "interval", oid: pgtype.IntervalOID, schemaType: schema.INT64}
+)
+
+func testValueColumn(
+	oid uint32, typ pgtypes.PgType,
+) systemcatalog.Column {
+
+	return systemcatalog.NewColumn("value", oid, -1, typ, true, nil)
+}
+
+func Test_PostgreSQL_Target_Value_Date(
+	t *testing.T,
+) {
+
+	column := testValueColumn(pgtype.DateOID, dateType)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), targetValue(column, int32(19358)))
+	assert.Equal(t, time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), targetValue(column, int32(-1)))
+	assert.Nil(t, targetValue(column, nil))
+}
+
+func Test_PostgreSQL_Target_Value_Interval(
+	t *testing.T,
+) {
+
+	column := testValueColumn(pgtype.IntervalOID, intervalType)
+
+	// Event values are calculated with an average month of 30.4375 days
+	oneMonth := int64(2629800000000)
+	oneDay := int64(86400000000)
+	threeHours := (3 * time.Hour).Microseconds()
+
+	assert.Equal(t,
+		pgtype.Interval{Months: 1, Days: 2, Microseconds: threeHours, Valid: true},
+		targetValue(column, oneMonth+2*oneDay+threeHours),
+	)
+	assert.Equal(t,
+		pgtype.Interval{Months: 14, Valid: true},
+		targetValue(column, 14*oneMonth),
+	)
+	assert.Equal(t,
+		pgtype.Interval{Days: 30, Valid: true},
+		targetValue(column, 30*oneDay),
+	)
+	assert.Equal(t,
+		pgtype.Interval{Months: -1, Microseconds: -threeHours, Valid: true},
+		targetValue(column, -oneMonth-threeHours),
+	)
+}
+
+func Test_PostgreSQL_Target_Value_Arrays(
+	t *testing.T,
+) {
+
+	assert.Equal(t,
+		[]time.Time{time.UnixMilli(1672531200000).UTC(), time.UnixMilli(1672531201000).UTC()},
+		targetValue(testValueColumn(pgtype.TimestampArrayOID, nil), []int64{1672531200000, 1672531201000}),
+	)
+	assert.Equal(t,
+		[][]byte{{0xca, 0xfe}, {0xba, 0xbe}},
+		targetValue(testValueColumn(pgtype.ByteaArrayOID, nil), []string{"cafe", "babe"}),
+	)
+	assert.Equal(t,
+		[]time.Time{time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		targetValue(testValueColumn(pgtype.DateArrayOID, nil), []int32{19358}),
+	)
+	assert.Equal(t,
+		[]pgtype.Interval{{Months: 1, Valid: true}, {Days: 1, Valid: true}},
+		targetValue(testValueColumn(pgtype.IntervalArrayOID, nil), []int64{2629800000000, 86400000000}),
+	)
+}
+
+func Test_PostgreSQL_Target_Value_Extension_Types(
+	t *testing.T,
+) {
+
+	point := geom.NewPointFlat(geom.XY, []float64{1, 2})
+	data, err := wkb.Marshal(point, binary.BigEndian)
+	assert.NoError(t, err)
+	expected, err := ewkbhex.Encode(geom.NewPointFlat(geom.XY, []float64{1, 2}).SetSRID(4326), binary.LittleEndian)
+	assert.NoError(t, err)
+
+	geometryType := &testExtensionType{testPgType: testPgType{name: "geometry", oid: 50000}}
+	value := map[string]any{"wkb": base64.StdEncoding.EncodeToString(data), "srid": 4326}
+	assert.Equal(t, expected, targetValue(testValueColumn(50000, geometryType), value))
+
+	geometryArrayType := &testExtensionType{testPgType: testPgType{name: "_geometry", oid: 50001}, elementType: geometryType}
+	assert.Equal(t, "{"+expected+"}", targetValue(testValueColumn(50001, geometryArrayType), []map[string]any{value}))
+
+	hstoreType := &testExtensionType{testPgType: testPgType{name: "hstore", oid: 50002}}
+	hstoreValue := "value"
+	assert.Equal(t,
+		pgtype.Hstore{"key": &hstoreValue, "empty": nil},
+		targetValue(testValueColumn(50002, hstoreType), map[string]any{"key": &hstoreValue, "empty": nil}),
+	)
+}
+
+func Test_PostgreSQL_Target_Value_Composite(
+	t *testing.T,
+) {
+
+	compositeType := &testCompositeType{
+		testPgType: testPgType{name: "measurement", oid: 50003},
+		columns: []pgtypes.CompositeColumn{
+			&testCompositeColumn{name: "label", typ: textType},
+			&testCompositeColumn{name: "day", typ: dateType},
+			&testCompositeColumn{name: "period", typ: intervalType},
+			&testCompositeColumn{name: "missing", typ: textType},
+		},
+	}
+
+	value := map[string]any{
+		"label":  `a "quoted", label`,
+		"day":    int32(19358),
+		"period": int64(2629800000000),
+	}
+	assert.Equal(t,
+		`("a \"quoted\", label","2023-01-01 00:00:00","1 mons 0 days 0 microseconds",)`,
+		targetValue(testValueColumn(50003, compositeType), value),
+	)
+}
@@ -0,0 +1,302 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package pulsar
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pglogrepl"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	propertyOperation   = "operation"
+	propertySourceTable = "source.table"
+	propertySourceLSN   = "source.lsn"
+	propertySourceTxId  = "source.txid"
+)
+
+func init() {
+	sinkimpl.RegisterSink(config.Pulsar, newPulsarSink)
+}
+
+type topicProducer struct {
+	producer  pulsar.Producer
+	sequencer sequencer
+	lock      sync.Mutex
+}
+
+type pulsarSink struct {
+	client          pulsar.Client
+	encoder         encoding.Encoder
+	producerOptions pulsar.ProducerOptions
+	tenant          string
+	namespace       string
+	deduplication   bool
+	commitLSN       atomic.Uint64
+	producers       map[string]*topicProducer
+	producersLock   sync.Mutex
+}
+
+func newPulsarSink(
+	c *config.Config,
+) (sink.Sink, error) {
+
+	clientOptions := pulsar.ClientOptions{
+		URL: config.GetOrDefault(c, config.PropertyPulsarUrl, "pulsar://localhost:6650"),
+		TLSAllowInsecureConnection: config.GetOrDefault(
+			c, config.PropertyPulsarTlsSkipVerify, false,
+		),
+		TLSTrustCertsFilePath: config.GetOrDefault(
+			c, config.PropertyPulsarTlsTrustCertsFile, "",
+		),
+	}
+	if token := config.GetOrDefault(c, config.PropertyPulsarToken, ""); token != "" {
+		clientOptions.Authentication = pulsar.NewAuthenticationToken(token)
+	}
+
+	// Key based batching keeps messages with the same key in the same
+	// batch, which is required for consumers with Key_Shared subscriptions
+	producerOptions := pulsar.ProducerOptions{
+		Name: config.GetOrDefault(
+			c, config.PropertyPulsarProducerName, "timescaledb-event-streamer",
+		),
+		DisableBatching: !config.GetOrDefault(c, config.PropertyPulsarBatchEnabled, true),
+		BatchingMaxMessages: config.GetOrDefault(
+			c, config.PropertyPulsarBatchSize, uint(1000),
+		),
+		BatchingMaxSize: config.GetOrDefault(
+			c, config.PropertyPulsarBatchBytes, uint(128*1024),
+		),
+		BatchingMaxPublishDelay: time.Duration(config.GetOrDefault(
+			c, config.PropertyPulsarBatchLinger, 10,
+		)) * time.Millisecond,
+		BatcherBuilderType: pulsar.KeyBasedBatchBuilder,
+	}
+
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := pulsar.NewClient(clientOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	return &pulsarSink{
+		client:          client,
+		encoder:         encoder,
+		producerOptions: producerOptions,
+		tenant:          config.GetOrDefault(c, config.PropertyPulsarTenant, "public"),
+		namespace:       config.GetOrDefault(c, config.PropertyPulsarNamespace, "default"),
+		deduplication:   config.GetOrDefault(c, config.PropertyPulsarDeduplication, true),
+		producers:       make(map[string]*topicProducer),
+	}, nil
+}
+
+func (p *pulsarSink) Start() error {
+	return nil
+}
+
+func (p *pulsarSink) Stop() error {
+	p.producersLock.Lock()
+	defer p.producersLock.Unlock()
+
+	// Closing a producer flushes all pending messages
+	for _, producer := range p.producers {
+		producer.producer.Close()
+	}
+	p.producers = make(map[string]*topicProducer)
+	p.client.Close()
+	return nil
+}
+
+func (p *pulsarSink) Emit(
+	context sink.Context, timestamp time.Time, topicName string, key, envelope schema.Struct,
+) error {
+
+	done := make(chan error, 1)
+	if err := p.EmitAsync(context, timestamp, topicName, key, envelope, func(err error) {
+		done <- err
+	}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+func (p *pulsarSink) EmitAsync(
+	_ sink.Context, timestamp time.Time, topicName string,
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	keyData, err := p.encoder.EncodeKey(topicName, key)
+	if err != nil {
+		return err
+	}
+	envelopeData, err := p.encoder.EncodeEnvelope(topicName, envelope)
+	if err != nil {
+		return err
+	}
+
+	producer, err := p.producer(topicName)
+	if err != nil {
+		return err
+	}
+
+	// Messages with the same key are routed to the same partition
+	message := &pulsar.ProducerMessage{
+		Payload:    envelopeData,
+		Key:        string(keyData),
+		Properties: eventProperties(envelope),
+		EventTime:  timestamp,
+	}
+
+	// Sequence ids must be assigned in the same order as messages are
+	// handed to the producer, otherwise the broker drops messages
+	producer.lock.Lock()
+	defer producer.lock.Unlock()
+
+	if p.deduplication {
+		sequenceId := producer.sequencer.next(p.sequencePosition(envelope))
+		message.SequenceID = &sequenceId
+	}
+
+	producer.producer.SendAsync(context.Background(), message,
+		func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			if err != nil {
+				ack(errors.Wrap(err, 0))
+				return
+			}
+			ack(nil)
+		},
+	)
+	return nil
+}
+
+func (p *pulsarSink) OnBeginTransaction(
+	_ uint32, commitLSN pgtypes.LSN,
+) error {
+
+	p.commitLSN.Store(uint64(commitLSN))
+	return nil
+}
+
+func (p *pulsarSink) OnCommitTransaction(
+	_ pgtypes.LSN,
+) error {
+
+	p.commitLSN.Store(0)
+	return nil
+}
+
+// sequencePosition returns the commit LSN of the current transaction,
+// or the event's LSN if the event isn't part of a transaction
+func (p *pulsarSink) sequencePosition(
+	envelope schema.Struct,
+) pglogrepl.LSN {
+
+	if commitLSN := p.commitLSN.Load(); commitLSN != 0 {
+		return pglogrepl.LSN(commitLSN)
+	}
+	return eventLSN(envelope)
+}
+
+// producer returns the producer for the given topic name, which
+// is mapped to the topic in the configured tenant and namespace
+func (p *pulsarSink) producer(
+	topicName string,
+) (*topicProducer, error) {
+
+	p.producersLock.Lock()
+	defer p.producersLock.Unlock()
+
+	if producer, present := p.producers[topicName]; present {
+		return producer, nil
+	}
+
+	producerOptions := p.producerOptions
+	producerOptions.Topic = fmt.Sprintf("persistent://%s/%s/%s", p.tenant, p.namespace, topicName)
+
+	producer, err := p.client.CreateProducer(producerOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	p.producers[topicName] = &topicProducer{
+		producer: producer,
+	}
+	return p.producers[topicName], nil
+}
+
+// eventLSN returns the LSN of the event, or 0 if the event
+// doesn't carry a (valid) LSN
+func eventLSN(
+	envelope schema.Struct,
+) pglogrepl.LSN {
+
+	payload, _ := envelope[schema.FieldNamePayload].(schema.Struct)
+	source, _ := payload[schema.FieldNameSource].(schema.Struct)
+	if lsn, ok := source[schema.FieldNameLSN].(string); ok {
+		if l, err := pglogrepl.ParseLSN(lsn); err == nil {
+			return l
+		}
+	}
+	return 0
+}
+
+// eventProperties returns the event metadata, which enables
+// consumers to filter events without decoding the payload
+func eventProperties(
+	envelope schema.Struct,
+) map[string]string {
+
+	properties := make(map[string]string)
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return properties
+	}
+
+	if operation, ok := payload[schema.FieldNameOperation].(string); ok {
+		properties[propertyOperation] = operation
+	}
+	if source, ok := payload[schema.FieldNameSource].(schema.Struct); ok {
+		schemaName, _ := source[schema.FieldNameSchema].(string)
+		tableName, _ := source[schema.FieldNameTable].(string)
+		if tableName != "" {
+			properties[propertySourceTable] = fmt.Sprintf("%s.%s", schemaName, tableName)
+		}
+		if lsn, ok := source[schema.FieldNameLSN].(string); ok && lsn != "" {
+			properties[propertySourceLSN] = lsn
+		}
+		if txId, ok := source[schema.FieldNameTxId].(*uint32); ok && txId != nil {
+			properties[propertySourceTxId] = strconv.FormatUint(uint64(*txId), 10)
+		}
+	}
+	return properties
+}
@@ -0,0 +1,126 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package pulsar
+
+import (
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Pulsar_Sequence_Ids(
+	t *testing.T,
+) {
+
+	lsn1 := pglogrepl.LSN(0x16B3748)
+	lsn2 := pglogrepl.LSN(0x16B3800)
+
+	s := &sequencer{}
+	assert.Equal(t, int64(lsn1<<16), s.next(lsn1))
+	assert.Equal(t, int64(lsn1<<16)+1, s.next(lsn1))
+	assert.Equal(t, int64(lsn2<<16), s.next(lsn2))
+
+	// Events without an LSN continue the sequence
+	assert.Equal(t, int64(lsn2<<16)+1, s.next(0))
+
+	// LSNs lower than the previous one must not move the sequence backwards
+	assert.Equal(t, int64(lsn2<<16)+2, s.next(lsn1))
+
+	// Replaying the same events leads to the same sequence ids
+	replay := &sequencer{}
+	assert.Equal(t, int64(lsn1<<16), replay.next(lsn1))
+	assert.Equal(t, int64(lsn1<<16)+1, replay.next(lsn1))
+
+	// Ordinal overflows continue the sequence
+	overflow := &sequencer{}
+	for i := 0; i <= maxOrdinal; i++ {
+		overflow.next(lsn1)
+	}
+	assert.Equal(t, int64(lsn1<<16)+maxOrdinal+1, overflow.next(lsn1))
+	assert.Equal(t, int64(lsn2<<16), overflow.next(lsn2))
+}
+
+func Test_Pulsar_Sequence_Ids_Interleaved_Transactions(
+	t *testing.T,
+) {
+
+	event := func(lsn string) schema.Struct {
+		return schema.Envelope(nil, schema.Struct{
+			schema.FieldNameSource: schema.Struct{schema.FieldNameLSN: lsn},
+		})
+	}
+
+	// Transaction A starts before B, but B commits first, hence B's events
+	// are emitted before A's, even though A's changes have lower LSNs
+	commitB := pgtypes.LSN(0x300)
+	commitA := pgtypes.LSN(0x400)
+	emitTransaction := func(p *pulsarSink, s *sequencer, commitLSN pgtypes.LSN, lsns ...string) []int64 {
+		assert.NoError(t, p.OnBeginTransaction(0, commitLSN))
+		sequenceIds := make([]int64, 0, len(lsns))
+		for _, lsn := range lsns {
+			sequenceIds = append(sequenceIds, s.next(p.sequencePosition(event(lsn))))
+		}
+		assert.NoError(t, p.OnCommitTransaction(commitLSN))
+		return sequenceIds
+	}
+
+	p := &pulsarSink{}
+	s := &sequencer{}
+	idsB := emitTransaction(p, s, commitB, "0/200", "0/210")
+	idsA := emitTransaction(p, s, commitA, "0/100", "0/110")
+	assert.Equal(t, []int64{0x300 << 16, 0x300<<16 + 1}, idsB)
+	assert.Equal(t, []int64{0x400 << 16, 0x400<<16 + 1}, idsA)
+
+	// After a restart between both commits, A is replayed with a fresh
+	// sequencer and must still be above B's last sequence id, otherwise
+	// the broker would drop A's events as duplicates
+	restarted := &pulsarSink{}
+	replayedA := emitTransaction(restarted, &sequencer{}, commitA, "0/100", "0/110")
+	assert.Equal(t, idsA, replayedA)
+	assert.Greater(t, replayedA[0], idsB[len(idsB)-1])
+
+	// Events outside of transactions are positioned at their own LSN
+	assert.Equal(t, pglogrepl.LSN(0x500), restarted.sequencePosition(event("0/500")))
+}
+
+func Test_Pulsar_Event_Properties(
+	t *testing.T,
+) {
+
+	envelope := schema.Envelope(nil, schema.Struct{
+		schema.FieldNameOperation: "u",
+		schema.FieldNameSource: schema.Struct{
+			schema.FieldNameSchema: "public",
+			schema.FieldNameTable:  "metrics",
+			schema.FieldNameLSN:    "0/16B3748",
+			schema.FieldNameTxId:   lo.ToPtr(uint32(742)),
+		},
+	})
+
+	assert.Equal(t, pglogrepl.LSN(0x16B3748), eventLSN(envelope))
+	assert.Equal(t, map[string]string{
+		propertyOperation:   "u",
+		propertySourceTable: "public.metrics",
+		propertySourceLSN:   "0/16B3748",
+		propertySourceTxId:  "742",
+	}, eventProperties(envelope))
+
+	assert.Equal(t, pglogrepl.LSN(0), eventLSN(schema.Envelope(nil, schema.Struct{})))
+}
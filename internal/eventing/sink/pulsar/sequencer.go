@@ -0,0 +1,66 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package pulsar
+
+import "github.com/jackc/pglogrepl"
+
+const (
+	ordinalBits = 16
+	maxOrdinal  = 1<<ordinalBits - 1
+)
+
+// sequencer derives the message sequence ids from the position of the events
+// in the WAL. Pulsar's broker side deduplication drops all messages of a
+// producer with a sequence id lower or equal to the last persisted one, hence
+// replaying events after a restart doesn't produce duplicates.
+//
+// Events of a transaction are positioned at the transaction's commit LSN,
+// since transactions are emitted in commit order, while the LSNs of their
+// changes interleave with concurrent transactions. Events outside of a
+// transaction (e.g. snapshot reads) are positioned at their own LSN.
+//
+// Since multiple events share the same position, the sequence id is the
+// position shifted by 16 bits, plus the ordinal of the event at its position.
+// Sequence ids are strictly increasing, if the ordinal overflows (or an event
+// doesn't have a position), the sequence id is the previous one incremented
+// by one.
+type sequencer struct {
+	position pglogrepl.LSN
+	ordinal  int64
+	last     int64
+}
+
+func (s *sequencer) next(
+	position pglogrepl.LSN,
+) int64 {
+
+	if position != s.position {
+		s.position = position
+		s.ordinal = 0
+	} else {
+		s.ordinal++
+	}
+
+	sequenceId := s.last + 1
+	if position != 0 && s.ordinal <= maxOrdinal {
+		if candidate := int64(position<<ordinalBits) + s.ordinal; candidate > s.last {
+			sequenceId = candidate
+		}
+	}
+	s.last = sequenceId
+	return sequenceId
+}
@@ -0,0 +1,178 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redis
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/go-redis/redis"
+	"github.com/goccy/go-json"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"reflect"
+	"strings"
+)
+
+const scanBatchSize = 1000
+
+// materialize maintains a hash per row, keyed by the topic and the
+// values of the key columns. Inserts and updates replace the hash,
+// deletes remove it, and truncates remove all hashes of the topic.
+func (r *redisSink) materialize(
+	topicName string, key, envelope schema.Struct,
+) error {
+
+	payload, ok := envelope[schema.FieldNamePayload].(schema.Struct)
+	if !ok {
+		return nil
+	}
+
+	before, _ := payload[schema.FieldNameBefore].(schema.Struct)
+	after, _ := payload[schema.FieldNameAfter].(schema.Struct)
+	keyValues, _ := key[schema.FieldNamePayload].(schema.Struct)
+
+	operation, _ := payload[schema.FieldNameOperation].(string)
+	switch operation {
+	case "r", "c", "u":
+		rowKey, ok := hashKey(topicName, key, after)
+		if !ok {
+			r.logger.Warnf("Topic %s has no key columns, events can't be materialized", topicName)
+			return nil
+		}
+
+		fields, err := hashFields(after)
+		if err != nil {
+			return err
+		}
+
+		_, err = r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+			// If the key of the row was changed, the old hash is removed
+			if oldRowKey, ok := hashKey(topicName, key, before); ok && oldRowKey != rowKey {
+				pipe.Del(oldRowKey)
+			}
+			// Columns set to NULL are not part of the new hash
+			pipe.Del(rowKey)
+			if len(fields) > 0 {
+				pipe.HMSet(rowKey, fields)
+			}
+			return nil
+		})
+		return err
+
+	case "d":
+		rowKey, ok := hashKey(topicName, key, keyValues)
+		if !ok {
+			r.logger.Warnf("Topic %s has no key columns, events can't be materialized", topicName)
+			return nil
+		}
+		return r.client.Del(rowKey).Err()
+
+	case "t":
+		return r.flushHashes(topicName)
+	}
+	return nil
+}
+
+// flushHashes removes all hashes of the given topic
+func (r *redisSink) flushHashes(
+	topicName string,
+) error {
+
+	pattern := fmt.Sprintf("%s:*", escapePattern(topicName))
+
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		if len(keys) > 0 {
+			if err := r.client.Del(keys...).Err(); err != nil {
+				return errors.Wrap(err, 0)
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// hashKey builds the key of a row's hash as <topic>:<key values>, with the
+// values in the order of the key schema, separated by colons. Values missing
+// in the given row values are taken from the event key.
+func hashKey(
+	topicName string, key, values schema.Struct,
+) (string, bool) {
+
+	keySchema, _ := key[schema.FieldNameSchema].(schema.Struct)
+	fields, _ := keySchema[schema.FieldNameFields].([]schema.Struct)
+	if len(fields) == 0 || values == nil {
+		return "", false
+	}
+
+	keyValues, _ := key[schema.FieldNamePayload].(schema.Struct)
+
+	builder := strings.Builder{}
+	builder.WriteString(topicName)
+	for _, field := range fields {
+		column, _ := field[schema.FieldNameField].(string)
+		value, present := values[column]
+		if !present {
+			value = keyValues[column]
+		}
+		builder.WriteString(":")
+		if value != nil {
+			builder.WriteString(fmt.Sprint(value))
+		}
+	}
+	return builder.String(), true
+}
+
+// hashFields converts the row values into hash fields. Maps and arrays
+// are stored as their JSON representation, NULL values are omitted.
+func hashFields(
+	values schema.Struct,
+) (map[string]any, error) {
+
+	fields := make(map[string]any, len(values))
+	for column, value := range values {
+		if value == nil {
+			continue
+		}
+
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Map, reflect.Slice:
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+			fields[column] = string(data)
+		default:
+			fields[column] = fmt.Sprint(value)
+		}
+	}
+	return fields, nil
+}
+
+// escapePattern escapes the glob characters used by SCAN's MATCH option
+func escapePattern(
+	value string,
+) string {
+
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(value)
+}
@@ -19,8 +19,10 @@ package redis
 
 import (
 	"crypto/tls"
+	"fmt"
 	"github.com/go-redis/redis"
 	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	config "github.com/noctarius/timescaledb-event-streamer/spi/config"
 	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
@@ -33,8 +35,13 @@ func init() {
 }
 
 type redisSink struct {
-	client  *redis.Client
-	encoder *encoding.JsonEncoder
+	client            *redis.Client
+	encoder           encoding.Encoder
+	mode              config.RedisMode
+	streamMaxLen      int64
+	streamMaxAge      time.Duration
+	streamApproximate bool
+	logger            *logging.Logger
 }
 
 func newRedisSink(
@@ -94,9 +101,39 @@ func newRedisSink(
 		}
 	}
 
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := config.GetOrDefault(c, config.PropertyRedisMode, config.RedisStream)
+	switch mode {
+	case config.RedisStream, config.RedisPubSub, config.RedisHash:
+	default:
+		return nil, fmt.Errorf("Redis mode '%s' doesn't exist", mode)
+	}
+
+	streamMaxLen := config.GetOrDefault(c, config.PropertyRedisStreamMaxLen, int64(0))
+	streamMaxAge := config.GetOrDefault(c, config.PropertyRedisStreamMaxAge, int64(0))
+	if streamMaxLen > 0 && streamMaxAge > 0 {
+		return nil, fmt.Errorf("Redis stream trimming supports either maxlen or maxage")
+	}
+
+	logger, err := logging.NewLogger("RedisSink")
+	if err != nil {
+		return nil, err
+	}
+
 	return &redisSink{
-		client:  redis.NewClient(options),
-		encoder: encoding.NewJsonEncoderWithConfig(c),
+		client:       redis.NewClient(options),
+		encoder:      encoder,
+		mode:         mode,
+		streamMaxLen: streamMaxLen,
+		streamMaxAge: time.Duration(streamMaxAge) * time.Second,
+		streamApproximate: config.GetOrDefault(
+			c, config.PropertyRedisStreamApproximate, true,
+		),
+		logger: logger,
 	}, nil
 }
 
@@ -112,20 +149,55 @@ func (r *redisSink) Emit(
 	_ sink.Context, _ time.Time, topicName string, key, envelope schema.Struct,
 ) error {
 
-	keyData, err := r.encoder.Marshal(key)
+	if r.mode == config.RedisHash {
+		return r.materialize(topicName, key, envelope)
+	}
+
+	envelopeData, err := r.encoder.EncodeEnvelope(topicName, envelope)
 	if err != nil {
 		return err
 	}
-	envelopeData, err := r.encoder.Marshal(envelope)
+
+	if r.mode == config.RedisPubSub {
+		return r.client.Publish(topicName, string(envelopeData)).Err()
+	}
+
+	keyData, err := r.encoder.EncodeKey(topicName, key)
 	if err != nil {
 		return err
 	}
 
-	return r.client.XAdd(&redis.XAddArgs{
-		Stream: topicName,
-		Values: map[string]any{
-			"key":      string(keyData),
-			"envelope": string(envelopeData),
-		},
-	}).Err()
+	return r.client.Do(r.xaddArgs(topicName, time.Now(), keyData, envelopeData)...).Err()
+}
+
+// xaddArgs builds the XADD command, including the trimming strategy. Since
+// the client doesn't support MINID, the command is built manually.
+func (r *redisSink) xaddArgs(
+	stream string, now time.Time, keyData, envelopeData []byte,
+) []any {
+
+	args := []any{"xadd", stream}
+
+	var strategy string
+	var threshold any
+	if r.streamMaxLen > 0 {
+		strategy = "maxlen"
+		threshold = r.streamMaxLen
+	} else if r.streamMaxAge > 0 {
+		// Stream ids start with the millisecond timestamp of the entry
+		strategy = "minid"
+		threshold = fmt.Sprintf("%d-0", now.Add(-r.streamMaxAge).UnixMilli())
+	}
+
+	if strategy != "" {
+		args = append(args, strategy)
+		if r.streamApproximate {
+			// Approximate trimming removes whole macro nodes only,
+			// which is much more efficient
+			args = append(args, "~")
+		}
+		args = append(args, threshold)
+	}
+
+	return append(args, "*", "key", string(keyData), "envelope", string(envelopeData))
 }
@@ -0,0 +1,97 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redis
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Redis_XAdd_Trimming(
+	t *testing.T,
+) {
+
+	now := time.UnixMilli(1679702400000)
+	key := []byte(`{"id":1}`)
+	envelope := []byte(`{}`)
+
+	r := &redisSink{}
+	assert.Equal(t, []any{
+		"xadd", "stream", "*", "key", `{"id":1}`, "envelope", "{}",
+	}, r.xaddArgs("stream", now, key, envelope))
+
+	r = &redisSink{streamMaxLen: 1000, streamApproximate: true}
+	assert.Equal(t, []any{
+		"xadd", "stream", "maxlen", "~", int64(1000), "*", "key", `{"id":1}`, "envelope", "{}",
+	}, r.xaddArgs("stream", now, key, envelope))
+
+	r = &redisSink{streamMaxAge: time.Hour}
+	assert.Equal(t, []any{
+		"xadd", "stream", "minid", "1679698800000-0", "*", "key", `{"id":1}`, "envelope", "{}",
+	}, r.xaddArgs("stream", now, key, envelope))
+}
+
+func Test_Redis_Hash_Key_And_Fields(
+	t *testing.T,
+) {
+
+	keySchema := schema.NewSchemaBuilder(schema.STRUCT).
+		Field("device_id", 0, schema.Int32()).
+		Field("ts", 1, schema.String()).
+		Build()
+	key := schema.Envelope(keySchema, schema.Struct{
+		"device_id": int32(42),
+		"ts":        "2023-03-25T00:00:00Z",
+	})
+
+	row := schema.Struct{
+		"device_id": int32(42),
+		"ts":        "2023-03-25T00:00:00Z",
+		"value":     1.5,
+		"tags":      map[string]string{"site": "a"},
+		"readings":  []int32{1, 2},
+		"comment":   nil,
+	}
+
+	rowKey, ok := hashKey("topic", key, row)
+	assert.True(t, ok)
+	assert.Equal(t, "topic:42:2023-03-25T00:00:00Z", rowKey)
+
+	// Key values not part of the row are taken from the event key
+	rowKey, ok = hashKey("topic", key, schema.Struct{"device_id": int32(7)})
+	assert.True(t, ok)
+	assert.Equal(t, "topic:7:2023-03-25T00:00:00Z", rowKey)
+
+	_, ok = hashKey("topic", schema.Envelope(nil, schema.Struct{}), row)
+	assert.False(t, ok)
+
+	fields, err := hashFields(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]any{
+		"device_id": "42",
+		"ts":        "2023-03-25T00:00:00Z",
+		"value":     "1.5",
+		"tags":      `{"site":"a"}`,
+		"readings":  "[1,2]",
+	}, fields)
+
+	assert.Equal(t, `topic\*\[1\]`, escapePattern("topic*[1]"))
+}
@@ -17,7 +17,10 @@
 
 package sink
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"github.com/go-errors/errors"
+)
 
 type sinkContext struct {
 	attributes          map[string]string
@@ -35,16 +38,27 @@ func (s *sinkContext) UnmarshalBinary(
 	data []byte,
 ) error {
 
+	length := uint64(len(data))
+	if length < 4 {
+		return errors.Errorf("sink context state truncated")
+	}
+
 	offset := uint32(0)
 	numOfItems := binary.BigEndian.Uint32(data[offset:])
 	offset += 4
 
 	for i := uint32(0); i < numOfItems; i++ {
+		if length < uint64(offset)+8 {
+			return errors.Errorf("sink context state truncated")
+		}
 		keyLength := binary.BigEndian.Uint32(data[offset:])
 		offset += 4
 		valueLength := binary.BigEndian.Uint32(data[offset:])
 		offset += 4
 
+		if length < uint64(offset)+uint64(keyLength)+uint64(valueLength) {
+			return errors.Errorf("sink context state truncated")
+		}
 		key := string(data[offset : offset+keyLength])
 		offset += keyLength
 
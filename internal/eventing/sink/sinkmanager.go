@@ -19,6 +19,7 @@ package sink
 
 import (
 	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
 	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
@@ -48,7 +49,9 @@ func NewSinkManager(
 
 func (sm *sinkManager) Start() error {
 	if encodedSinkContextState, present := sm.stateStorageManager.EncodedState(sinkContextStateName); present {
-		return sm.sinkContext.UnmarshalBinary(encodedSinkContextState)
+		if err := sm.sinkContext.UnmarshalBinary(encodedSinkContextState); err != nil {
+			return err
+		}
 	}
 	return sm.sink.Start()
 }
@@ -68,3 +71,92 @@ func (sm *sinkManager) Emit(
 
 	return sm.sink.Emit(sm.sinkContext, timestamp, topicName, key, envelope)
 }
+
+func (sm *sinkManager) EmitAsync(
+	timestamp time.Time, topicName string, key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	return emitAsync(sm.sink, sm.sinkContext, timestamp, topicName, key, envelope, ack)
+}
+
+func (sm *sinkManager) BeginTransaction(
+	xid uint32, commitLSN pgtypes.LSN,
+) error {
+
+	if transactionAwareSink, ok := sm.sink.(sink.TransactionAwareSink); ok {
+		if err := transactionAwareSink.OnBeginTransaction(xid, commitLSN); err != nil {
+			return err
+		}
+	}
+	if transactionalSink, ok := sm.sink.(sink.TransactionalSink); ok {
+		return transactionalSink.BeginTransaction(xid)
+	}
+	return nil
+}
+
+func (sm *sinkManager) CommitTransaction(
+	transactionEndLSN pgtypes.LSN,
+) error {
+
+	if transactionAwareSink, ok := sm.sink.(sink.TransactionAwareSink); ok {
+		if err := transactionAwareSink.OnCommitTransaction(transactionEndLSN); err != nil {
+			return err
+		}
+	}
+	if transactionalSink, ok := sm.sink.(sink.TransactionalSink); ok {
+		return transactionalSink.CommitTransaction(transactionEndLSN)
+	}
+	return nil
+}
+
+func (sm *sinkManager) CommittedLSN() (lsn pgtypes.LSN, present bool, err error) {
+	if transactionalSink, ok := sm.sink.(sink.TransactionalSink); ok {
+		return transactionalSink.CommittedLSN()
+	}
+	return 0, false, nil
+}
+
+func (sm *sinkManager) OnTableSchema(
+	table schema.TableAlike,
+) error {
+
+	if schemaAwareSink, ok := sm.sink.(sink.SchemaAwareSink); ok {
+		return schemaAwareSink.OnTableSchema(table)
+	}
+	return nil
+}
+
+// ReadSinkContextAttributes decodes the sink context attributes
+// persisted by the sink manager from the given state
+func ReadSinkContextAttributes(
+	encodedState func(name string) ([]byte, bool),
+) (attributes map[string]string, present bool, err error) {
+
+	state, present := encodedState(sinkContextStateName)
+	if !present {
+		return nil, false, nil
+	}
+
+	sinkContext := newSinkContext()
+	if err := sinkContext.UnmarshalBinary(state); err != nil {
+		return nil, false, err
+	}
+	return sinkContext.attributes, true, nil
+}
+
+func emitAsync(
+	s sink.Sink, context sink.Context, timestamp time.Time,
+	topicName string, key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	if asyncSink, ok := s.(sink.AsyncSink); ok {
+		return asyncSink.EmitAsync(context, timestamp, topicName, key, envelope, ack)
+	}
+
+	// Synchronous sinks have confirmed the delivery when Emit returns
+	if err := s.Emit(context, timestamp, topicName, key, envelope); err != nil {
+		return err
+	}
+	ack(nil)
+	return nil
+}
@@ -36,14 +36,24 @@ func newStdoutSink(
 	c *spiconfig.Config,
 ) (sink.Sink, error) {
 
-	encoder := encoding.NewJsonEncoderWithConfig(c)
+	encoder, err := encoding.NewEncoderWithConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the JSON output is stripped of the schema, binary
+	// encodings need the schema to be available
+	_, stripSchema := encoder.(*encoding.JsonEncoder)
+
 	return sink.SinkFunc(
 		func(
-			_ sink.Context, _ time.Time, _ string, _, envelope schema.Struct,
+			_ sink.Context, _ time.Time, topicName string, _, envelope schema.Struct,
 		) error {
 
-			delete(envelope, "schema")
-			data, err := encoder.Marshal(envelope)
+			if stripSchema {
+				delete(envelope, "schema")
+			}
+			data, err := encoder.EncodeEnvelope(topicName, envelope)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,185 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package internal
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/erroring"
+	namingstrategyimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/namingstrategy"
+	sidechannelimpl "github.com/noctarius/timescaledb-event-streamer/internal/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog/tablefiltering"
+	"github.com/noctarius/timescaledb-event-streamer/internal/typemanager"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/urfave/cli"
+	"os"
+	"path/filepath"
+)
+
+// DumpProtobufDefinitions reads the hypertables and tables selected for
+// replication from the current catalog and writes the Protobuf definitions
+// (one .proto file per event topic) of their key and envelope schemas into
+// the given output directory.
+func DumpProtobufDefinitions(
+	config *sysconfig.SystemConfig, outputDirectory string,
+) *cli.ExitError {
+
+	// Without a fixed topic prefix the package and message names would change on each run
+	if config.Topic.Prefix == "" {
+		return cli.NewExitError("Topic prefix (topic.prefix) required to generate Protobuf definitions", 6)
+	}
+
+	if err := initializeSystemConfig(config); err != nil {
+		return err
+	}
+
+	tables, err := readReplicatedTables(config)
+	if err != nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to read the catalog", 25)
+	}
+
+	namingStrategy, err := namingstrategyimpl.NewNamingStrategy(
+		spiconfig.GetOrDefault(config.Config, spiconfig.PropertyNamingStrategy, spiconfig.Debezium), config.Config,
+	)
+	if err != nil {
+		return erroring.AdaptError(err, 1)
+	}
+	nameGenerator := schema.NewNameGeneratorFromConfig(config.Config, namingStrategy)
+
+	if err := os.MkdirAll(outputDirectory, 0755); err != nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to create output directory", 7)
+	}
+
+	for _, table := range tables {
+		definition, err := encoding.GenerateProtobufDefinition(
+			nameGenerator.SchemaTopicName(table),
+			schema.KeySchema(nameGenerator, table),
+			schema.EnvelopeSchema(nameGenerator, table),
+		)
+		if err != nil {
+			return erroring.AdaptError(err, 1)
+		}
+
+		protoFile := filepath.Join(outputDirectory, fmt.Sprintf("%s.proto", nameGenerator.EventTopicName(table)))
+		if err := os.WriteFile(protoFile, []byte(definition), 0644); err != nil {
+			return erroring.AdaptErrorWithMessage(err, "failed to write Protobuf definition", 7)
+		}
+		fmt.Fprintf(os.Stderr, "Protobuf definition for %s written to %s\n", table.CanonicalName(), protoFile)
+	}
+
+	return nil
+}
+
+func readReplicatedTables(
+	config *sysconfig.SystemConfig,
+) ([]schema.TableAlike, error) {
+
+	hypertableFilter, err := tablefiltering.NewTableFilter(
+		config.TimescaleDB.Hypertables.Excludes, config.TimescaleDB.Hypertables.Includes, false,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	vanillaTableFilter, err := tablefiltering.NewTableFilter(
+		config.PostgreSQL.Tables.Excludes, config.PostgreSQL.Tables.Includes, false,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	stateStorage, err := statestorage.NewStateStorage(spiconfig.NoneStorage, config.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	sideChannel, err := sidechannelimpl.NewSideChannel(
+		statestorage.NewStateStorageManager(stateStorage), config.PgxConfig,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	typeManager, err := typemanager.NewTypeManager(sideChannel)
+	if err != nil {
+		return nil, err
+	}
+
+	hypertables := make([]*systemcatalog.Hypertable, 0)
+	if err := sideChannel.ReadHypertables(func(hypertable *systemcatalog.Hypertable) error {
+		if !hypertable.IsCompressedTable() && hypertableFilter.Enabled(hypertable) {
+			hypertables = append(hypertables, hypertable)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	vanillaTables := make([]*systemcatalog.PgTable, 0)
+	if err := sideChannel.ReadVanillaTables(func(table *systemcatalog.PgTable) error {
+		if vanillaTableFilter.Enabled(table) {
+			vanillaTables = append(vanillaTables, table)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	applySchema := applyTableSchema(typeManager)
+	if err := sideChannel.ReadHypertableSchema(applySchema, typeManager.ResolveDataType, hypertables...); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if err := sideChannel.ReadVanillaTableSchema(applySchema, typeManager.ResolveDataType, vanillaTables...); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	tables := make([]schema.TableAlike, 0, len(hypertables)+len(vanillaTables))
+	for _, hypertable := range hypertables {
+		tables = append(tables, hypertable)
+	}
+	for _, table := range vanillaTables {
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func applyTableSchema(
+	typeManager pgtypes.TypeManager,
+) sidechannel.TableSchemaCallback {
+
+	return func(table systemcatalog.SystemEntity, columns []systemcatalog.Column) error {
+		switch t := table.(type) {
+		case *systemcatalog.Hypertable:
+			t.ApplyTableSchema(columns)
+		case *systemcatalog.PgTable:
+			t.ApplyTableSchema(columns)
+		}
+		for _, column := range columns {
+			if err := typeManager.RegisterColumnType(column); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -226,7 +226,13 @@ func (l *logicalReplicationResolver) OnBeginEvent(
 
 	l.replicationContext.SetLastBeginLSN(pgtypes.LSN(xld.WALStart))
 	l.replicationContext.SetLastTransactionId(msg.Xid)
-	return nil
+	return l.taskManager.EnqueueTask(func(notificator task.Notificator) {
+		notificator.NotifyRecordReplicationEventHandler(
+			func(handler eventhandlers.RecordReplicationEventHandler) error {
+				return handler.OnBeginEvent(xld, msg)
+			},
+		)
+	})
 }
 
 func (l *logicalReplicationResolver) OnCommitEvent(
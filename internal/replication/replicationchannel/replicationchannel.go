@@ -31,6 +31,7 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/replicationcontext"
 	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
 	"github.com/noctarius/timescaledb-event-streamer/spi/task"
+	"os"
 	"sync/atomic"
 )
 
@@ -46,11 +47,15 @@ type ReplicationChannel struct {
 	statsReporter      *stats.Reporter
 	logger             *logging.Logger
 	shutdownRequested  atomic.Bool
+
+	streamingEnabled        bool
+	streamingMaxMemory      int
+	streamingSpillDirectory string
 }
 
 // NewReplicationChannel instantiates a new instance of the ReplicationChannel.
 func NewReplicationChannel(
-	replicationContext replicationcontext.ReplicationContext, typeManager pgtypes.TypeManager,
+	c *config.Config, replicationContext replicationcontext.ReplicationContext, typeManager pgtypes.TypeManager,
 	taskManager task.TaskManager, publicationManager publication.PublicationManager,
 	statsService *stats.Service,
 ) (*ReplicationChannel, error) {
@@ -68,6 +73,14 @@ func NewReplicationChannel(
 		shutdownAwaiter:    waiting.NewShutdownAwaiter(),
 		logger:             logger,
 		statsReporter:      statsService.NewReporter("streamer_replicationchannel"),
+
+		streamingEnabled: config.GetOrDefault(c, config.PropertyPostgresqlStreamingEnabled, false),
+		streamingMaxMemory: config.GetOrDefault(
+			c, config.PropertyPostgresqlStreamingMaxMemory, 64*1024*1024,
+		),
+		streamingSpillDirectory: config.GetOrDefault(
+			c, config.PropertyPostgresqlStreamingSpillDirectory, os.TempDir(),
+		),
 	}, nil
 }
 
@@ -86,7 +99,10 @@ func (rc *ReplicationChannel) StartReplicationChannel(
 	initialTables []systemcatalog.SystemEntity,
 ) error {
 
-	handler, err := newReplicationHandler(rc.replicationContext, rc.typeManager, rc.taskManager, rc.statsReporter)
+	handler, err := newReplicationHandler(
+		rc.replicationContext, rc.typeManager, rc.taskManager, rc.statsReporter,
+		rc.streamingMaxMemory, rc.streamingSpillDirectory,
+	)
 	if err != nil {
 		return errors.Wrap(err, 0)
 	}
@@ -120,6 +136,12 @@ func (rc *ReplicationChannel) StartReplicationChannel(
 			"messages 'true'",
 			"binary 'true'",
 		)
+
+		// Stream large in-progress transactions instead of the server
+		// decoding (and potentially spilling) them until the commit
+		if rc.streamingEnabled {
+			pluginArguments = append(pluginArguments, "streaming 'on'")
+		}
 	} else {
 		pluginArguments = append(
 			pluginArguments,
@@ -47,8 +47,10 @@ type replicationChannelStats struct {
 		messages  uint64 `metric:"messages" type:"counter"`
 	} `metric:"calls"`
 	statistics struct {
-		transactions       uint64 `metric:"transactions" type:"counter"`
-		largestTransaction uint64 `metric:"largestTransaction" type:"gauge"`
+		transactions         uint64 `metric:"transactions" type:"counter"`
+		streamedTransactions uint64 `metric:"streamedTransactions" type:"counter"`
+		abortedTransactions  uint64 `metric:"abortedTransactions" type:"counter"`
+		largestTransaction   uint64 `metric:"largestTransaction" type:"gauge"`
 	} `metric:"statistics"`
 }
 
@@ -61,6 +63,8 @@ func (rcs *replicationChannelStats) reset() {
 	rcs.calls.skipped = 0
 	rcs.calls.messages = 0
 	rcs.statistics.transactions = 0
+	rcs.statistics.streamedTransactions = 0
+	rcs.statistics.abortedTransactions = 0
 }
 
 type replicationHandler struct {
@@ -75,6 +79,9 @@ type replicationHandler struct {
 	lastTransactionId  *uint32
 	logger             *logging.Logger
 
+	streamedTransactions *streamedTransactions
+	restartLSN           pgtypes.LSN
+
 	stats           *replicationChannelStats
 	transactionSize uint64
 }
@@ -82,7 +89,7 @@ type replicationHandler struct {
 func newReplicationHandler(
 	replicationContext replicationcontext.ReplicationContext,
 	typeManager pgtypes.TypeManager, taskManager task.TaskManager,
-	statsReporter *stats.Reporter,
+	statsReporter *stats.Reporter, streamingMaxMemory int, streamingSpillDirectory string,
 ) (*replicationHandler, error) {
 
 	logger, err := logging.NewLogger("ReplicationHandler")
@@ -100,6 +107,8 @@ func newReplicationHandler(
 		logger:             logger,
 		loopDead:           atomic.Bool{},
 		stats:              &replicationChannelStats{},
+
+		streamedTransactions: newStreamedTransactions(streamingMaxMemory, streamingSpillDirectory),
 	}, nil
 }
 
@@ -116,6 +125,13 @@ func (rh *replicationHandler) startReplicationHandler(
 	replicationConnection *replicationconnection.ReplicationConnection, restartLSN pgtypes.LSN,
 ) error {
 
+	rh.restartLSN = restartLSN
+	defer func() {
+		if err := rh.streamedTransactions.close(); err != nil {
+			rh.logger.Warnf("Failed to remove spilled streamed transactions: %+v", err)
+		}
+	}()
+
 	standbyMessageTimeout := time.Second * 5
 	nextStandbyMessageDeadline := time.Now().Add(standbyMessageTimeout)
 
@@ -193,8 +209,20 @@ func (rh *replicationHandler) startReplicationHandler(
 				Xid:          xid,
 			}
 
-			// Skip all entries that were already replicated before the streamer was shut down
+			// Streamed transactions are buffered and replayed on commit, which also
+			// decides if the transaction was already replicated before
 			msgType := pglogrepl.MessageType(xld.WALData[0])
+			if isStreamControlMessage(msgType) || rh.streamedTransactions.inStream() {
+				if err := rh.handleStreamedXLogData(extendedXld, msgType); err != nil {
+					runtime.UnlockOSThread()
+					rh.loopDead.Store(true)
+					return errors.Wrap(err, 0)
+				}
+				rh.replicationContext.AcknowledgeReceived(extendedXld)
+				continue
+			}
+
+			// Skip all entries that were already replicated before the streamer was shut down
 			if msgType != pglogrepl.MessageTypeRelation && restartLSN > pgtypes.LSN(xld.WALStart) {
 				rh.logger.Debugf("Skipped message, LSN lower than restartLSN: %s < %s", xld.WALStart, restartLSN)
 				rh.stats.reset()
@@ -235,6 +263,112 @@ func (rh *replicationHandler) handleXLogData(
 	return nil
 }
 
+func (rh *replicationHandler) handleStreamedXLogData(
+	xld pgtypes.XLogData, msgType pglogrepl.MessageType,
+) error {
+
+	if !isStreamControlMessage(msgType) {
+		return rh.streamedTransactions.append(xld.XLogData)
+	}
+
+	msg, err := pglogrepl.ParseV2(xld.WALData, false)
+	if err != nil {
+		return fmt.Errorf("parsing logical replication message: %s", err)
+	}
+
+	switch logicalMsg := msg.(type) {
+	case *pglogrepl.StreamStartMessageV2:
+		rh.logger.Debugf("EVENT: StreamStart{xid:%d firstSegment:%d}", logicalMsg.Xid, logicalMsg.FirstSegment)
+		if logicalMsg.FirstSegment == 1 {
+			rh.stats.reset()
+			rh.stats.statistics.streamedTransactions++
+			rh.statsReporter.Report(rh.stats)
+		}
+		rh.streamedTransactions.start(logicalMsg.Xid)
+	case *pglogrepl.StreamStopMessageV2:
+		rh.logger.Debugf("EVENT: StreamStop")
+		rh.streamedTransactions.stop()
+	case *pglogrepl.StreamAbortMessageV2:
+		rh.logger.Debugf("EVENT: StreamAbort{xid:%d subXid:%d}", logicalMsg.Xid, logicalMsg.SubXid)
+		if logicalMsg.Xid == logicalMsg.SubXid {
+			rh.stats.reset()
+			rh.stats.statistics.abortedTransactions++
+			rh.statsReporter.Report(rh.stats)
+		}
+		return rh.streamedTransactions.abort(logicalMsg.Xid, logicalMsg.SubXid)
+	case *pglogrepl.StreamCommitMessageV2:
+		rh.logger.Debugf(
+			"EVENT: StreamCommit{xid:%d commitLSN:%s transactionEndLSN:%s commitTime:%s}",
+			logicalMsg.Xid, logicalMsg.CommitLSN, logicalMsg.TransactionEndLSN, logicalMsg.CommitTime,
+		)
+		return rh.replayStreamedTransaction(xld, logicalMsg)
+	}
+	return nil
+}
+
+// replayStreamedTransaction hands the buffered changes of a committed
+// streamed transaction to the usual handling, framed by synthesized
+// begin and commit messages, as if the transaction wasn't streamed
+func (rh *replicationHandler) replayStreamedTransaction(
+	xld pgtypes.XLogData, msg *pglogrepl.StreamCommitMessageV2,
+) error {
+
+	transaction := rh.streamedTransactions.commit(msg.Xid)
+
+	// Skip transactions that were already replicated before the streamer was shut down
+	if pgtypes.LSN(msg.TransactionEndLSN) <= rh.restartLSN {
+		rh.logger.Debugf(
+			"Skipped streamed transaction, LSN not higher than restartLSN: %s <= %s",
+			msg.TransactionEndLSN, rh.restartLSN,
+		)
+		if transaction != nil {
+			return transaction.close()
+		}
+		return nil
+	}
+
+	if err := rh.handleReplicationEvents(xld, &pglogrepl.BeginMessage{
+		FinalLSN:   msg.CommitLSN,
+		CommitTime: msg.CommitTime,
+		Xid:        msg.Xid,
+	}); err != nil {
+		rh.logger.Warnf("handling replication event message failed: %s => %+v", err, msg)
+	}
+
+	if transaction != nil {
+		if err := transaction.replay(func(change streamedChange) error {
+			return rh.handleXLogData(pgtypes.XLogData{
+				XLogData: pglogrepl.XLogData{
+					WALStart:     change.walStart,
+					ServerWALEnd: change.serverWALEnd,
+					ServerTime:   change.serverTime,
+					WALData:      change.data,
+				},
+				DatabaseName: xld.DatabaseName,
+				LastBegin:    rh.replicationContext.LastBeginLSN(),
+				LastCommit:   rh.replicationContext.LastCommitLSN(),
+				Xid:          msg.Xid,
+			})
+		}); err != nil {
+			_ = transaction.close()
+			return err
+		}
+		if err := transaction.close(); err != nil {
+			return err
+		}
+	}
+
+	if err := rh.handleReplicationEvents(xld, &pglogrepl.CommitMessage{
+		Flags:             msg.Flags,
+		CommitLSN:         msg.CommitLSN,
+		TransactionEndLSN: msg.TransactionEndLSN,
+		CommitTime:        msg.CommitTime,
+	}); err != nil {
+		rh.logger.Warnf("handling replication event message failed: %s => %+v", err, msg)
+	}
+	return nil
+}
+
 func (rh *replicationHandler) handleReplicationEvents(
 	xld pgtypes.XLogData, msg pglogrepl.Message,
 ) error {
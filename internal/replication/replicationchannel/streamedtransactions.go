@@ -0,0 +1,421 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package replicationchannel
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pglogrepl"
+	"io"
+	"os"
+	"time"
+)
+
+const streamedChangeHeaderSize = 32
+
+// microsecFromUnixEpochToPgEpoch is the offset between the Unix epoch
+// and the PostgreSQL epoch (2000-01-01) in microseconds. Server times
+// are spilled as microseconds since the PostgreSQL epoch, like sent by
+// the server.
+const microsecFromUnixEpochToPgEpoch = 946684800 * 1000000
+
+// streamedTransactions buffers the changes of in-progress transactions,
+// streamed by the server (logical replication protocol v2), until their
+// commit or abort is received. Changes are kept in memory until the memory
+// limit is exceeded, in which case the transaction exceeding the limit is
+// spilled to disk.
+type streamedTransactions struct {
+	maxMemory      int
+	spillDirectory string
+	spillPath      string
+	transactions   map[uint32]*streamedTransaction
+	current        *streamedTransaction
+	memory         int
+}
+
+type streamedTransaction struct {
+	xid            uint32
+	changes        []streamedChange
+	memory         int
+	spillFile      *os.File
+	spillWriter    *bufio.Writer
+	abortedSubXids map[uint32]bool
+}
+
+type streamedChange struct {
+	xid          uint32
+	walStart     pglogrepl.LSN
+	serverWALEnd pglogrepl.LSN
+	serverTime   time.Time
+	data         []byte
+}
+
+func newStreamedTransactions(
+	maxMemory int, spillDirectory string,
+) *streamedTransactions {
+
+	return &streamedTransactions{
+		maxMemory:      maxMemory,
+		spillDirectory: spillDirectory,
+		transactions:   make(map[uint32]*streamedTransaction),
+	}
+}
+
+func (st *streamedTransactions) inStream() bool {
+	return st.current != nil
+}
+
+func (st *streamedTransactions) start(
+	xid uint32,
+) {
+
+	transaction, present := st.transactions[xid]
+	if !present {
+		transaction = &streamedTransaction{
+			xid:            xid,
+			abortedSubXids: make(map[uint32]bool),
+		}
+		st.transactions[xid] = transaction
+	}
+	st.current = transaction
+}
+
+func (st *streamedTransactions) stop() {
+	st.current = nil
+}
+
+// append buffers a message of the current stream segment. Messages of
+// the protocol v2 carry the (sub-)transaction id in streams, which is
+// removed to be able to handle the buffered message like a message of
+// a non-streamed transaction.
+func (st *streamedTransactions) append(
+	xld pglogrepl.XLogData,
+) error {
+
+	transaction := st.current
+	if transaction == nil {
+		return errors.Errorf("received streamed message outside of a stream segment")
+	}
+
+	change := streamedChange{
+		xid:          transaction.xid,
+		walStart:     xld.WALStart,
+		serverWALEnd: xld.ServerWALEnd,
+		serverTime:   xld.ServerTime,
+	}
+
+	if carriesXid(pglogrepl.MessageType(xld.WALData[0])) {
+		if len(xld.WALData) < 5 {
+			return errors.Errorf("streamed message truncated")
+		}
+		change.xid = binary.BigEndian.Uint32(xld.WALData[1:5])
+		change.data = make([]byte, 0, len(xld.WALData)-4)
+		change.data = append(change.data, xld.WALData[0])
+		change.data = append(change.data, xld.WALData[5:]...)
+	} else {
+		// The message buffer is reused by the connection
+		change.data = append([]byte(nil), xld.WALData...)
+	}
+
+	if transaction.spillFile != nil {
+		return transaction.writeChange(change)
+	}
+
+	transaction.changes = append(transaction.changes, change)
+	transaction.memory += len(change.data)
+	st.memory += len(change.data)
+
+	if st.memory > st.maxMemory {
+		return st.spill(transaction)
+	}
+	return nil
+}
+
+// abort discards the changes of an aborted sub-transaction, or the
+// whole transaction if the subXid is the transaction's xid
+func (st *streamedTransactions) abort(
+	xid, subXid uint32,
+) error {
+
+	transaction, present := st.transactions[xid]
+	if !present {
+		return nil
+	}
+
+	if xid == subXid {
+		delete(st.transactions, xid)
+		return st.discard(transaction)
+	}
+
+	memory := transaction.memory
+	transaction.abortSubTransaction(subXid)
+	st.memory -= memory - transaction.memory
+	return nil
+}
+
+// commit removes the transaction from the buffered transactions and
+// returns it to be replayed. The returned transaction is nil if no
+// changes were streamed for the transaction.
+func (st *streamedTransactions) commit(
+	xid uint32,
+) *streamedTransaction {
+
+	transaction, present := st.transactions[xid]
+	if !present {
+		return nil
+	}
+	delete(st.transactions, xid)
+	st.memory -= transaction.memory
+	return transaction
+}
+
+func (st *streamedTransactions) discard(
+	transaction *streamedTransaction,
+) error {
+
+	st.memory -= transaction.memory
+	return transaction.close()
+}
+
+// close discards all buffered transactions and removes the
+// spill directory, since the server streams in-progress
+// transactions from the beginning on restart
+func (st *streamedTransactions) close() error {
+	for xid, transaction := range st.transactions {
+		delete(st.transactions, xid)
+		if err := st.discard(transaction); err != nil {
+			return err
+		}
+	}
+	st.current = nil
+	if st.spillPath != "" {
+		if err := os.RemoveAll(st.spillPath); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		st.spillPath = ""
+	}
+	return nil
+}
+
+func (st *streamedTransactions) spill(
+	transaction *streamedTransaction,
+) error {
+
+	if st.spillPath == "" {
+		if err := os.MkdirAll(st.spillDirectory, 0755); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		spillPath, err := os.MkdirTemp(st.spillDirectory, "timescaledb-event-streamer-*")
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		st.spillPath = spillPath
+	}
+
+	spillFile, err := os.CreateTemp(st.spillPath, fmt.Sprintf("xid-%d-*.spill", transaction.xid))
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	transaction.spillFile = spillFile
+	transaction.spillWriter = bufio.NewWriter(spillFile)
+
+	for _, change := range transaction.changes {
+		if err := transaction.writeChange(change); err != nil {
+			return err
+		}
+	}
+
+	st.memory -= transaction.memory
+	transaction.changes = nil
+	transaction.memory = 0
+	return nil
+}
+
+// replay calls the given function for all changes of the transaction
+// in the order they were received, except for changes of aborted
+// sub-transactions
+func (t *streamedTransaction) replay(
+	fn func(change streamedChange) error,
+) error {
+
+	if t.spillFile != nil {
+		if err := t.spillWriter.Flush(); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		if _, err := t.spillFile.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, 0)
+		}
+
+		reader := bufio.NewReader(t.spillFile)
+		for {
+			change, err := readChange(reader)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if t.aborted(change) {
+				continue
+			}
+			if err := fn(change); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, change := range t.changes {
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *streamedTransaction) close() error {
+	t.changes = nil
+	t.memory = 0
+	if t.spillFile == nil {
+		return nil
+	}
+
+	path := t.spillFile.Name()
+	if err := t.spillFile.Close(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	t.spillFile = nil
+	t.spillWriter = nil
+	if err := os.Remove(path); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (t *streamedTransaction) abortSubTransaction(
+	subXid uint32,
+) {
+
+	// Spilled changes are filtered on replay
+	if t.spillFile != nil {
+		t.abortedSubXids[subXid] = true
+		return
+	}
+
+	changes := t.changes[:0]
+	for _, change := range t.changes {
+		if change.xid == subXid && discardable(pglogrepl.MessageType(change.data[0])) {
+			t.memory -= len(change.data)
+			continue
+		}
+		changes = append(changes, change)
+	}
+	t.changes = changes
+}
+
+func (t *streamedTransaction) aborted(
+	change streamedChange,
+) bool {
+
+	return t.abortedSubXids[change.xid] && discardable(pglogrepl.MessageType(change.data[0]))
+}
+
+func (t *streamedTransaction) writeChange(
+	change streamedChange,
+) error {
+
+	header := make([]byte, 0, streamedChangeHeaderSize)
+	header = binary.BigEndian.AppendUint64(header, uint64(change.walStart))
+	header = binary.BigEndian.AppendUint64(header, uint64(change.serverWALEnd))
+	header = binary.BigEndian.AppendUint64(header, uint64(change.serverTime.UnixMicro()-microsecFromUnixEpochToPgEpoch))
+	header = binary.BigEndian.AppendUint32(header, change.xid)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(change.data)))
+	if _, err := t.spillWriter.Write(header); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if _, err := t.spillWriter.Write(change.data); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func readChange(
+	reader io.Reader,
+) (streamedChange, error) {
+
+	header := make([]byte, streamedChangeHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF {
+			return streamedChange{}, err
+		}
+		return streamedChange{}, errors.Wrap(err, 0)
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header[28:32]))
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return streamedChange{}, errors.Wrap(err, 0)
+	}
+
+	return streamedChange{
+		walStart:     pglogrepl.LSN(binary.BigEndian.Uint64(header[0:8])),
+		serverWALEnd: pglogrepl.LSN(binary.BigEndian.Uint64(header[8:16])),
+		serverTime:   time.UnixMicro(int64(binary.BigEndian.Uint64(header[16:24])) + microsecFromUnixEpochToPgEpoch),
+		xid:          binary.BigEndian.Uint32(header[24:28]),
+		data:         data,
+	}, nil
+}
+
+// carriesXid returns true for all message types which carry
+// the (sub-)transaction id when being part of a stream
+func carriesXid(
+	msgType pglogrepl.MessageType,
+) bool {
+
+	switch msgType {
+	case pglogrepl.MessageTypeRelation, pglogrepl.MessageTypeType, pglogrepl.MessageTypeInsert,
+		pglogrepl.MessageTypeUpdate, pglogrepl.MessageTypeDelete, pglogrepl.MessageTypeTruncate,
+		pglogrepl.MessageTypeMessage:
+		return true
+	}
+	return false
+}
+
+// discardable returns true for all message types which are discarded
+// when their sub-transaction is aborted. Relation and type messages
+// are kept, since the server doesn't resend them for later changes
+// of the same transaction.
+func discardable(
+	msgType pglogrepl.MessageType,
+) bool {
+
+	return carriesXid(msgType) && msgType != pglogrepl.MessageTypeRelation && msgType != pglogrepl.MessageTypeType
+}
+
+// isStreamControlMessage returns true for the messages framing
+// the segments and the end of streamed transactions
+func isStreamControlMessage(
+	msgType pglogrepl.MessageType,
+) bool {
+
+	switch msgType {
+	case pglogrepl.MessageTypeStreamStart, pglogrepl.MessageTypeStreamStop,
+		pglogrepl.MessageTypeStreamCommit, pglogrepl.MessageTypeStreamAbort:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package replicationchannel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Streamed_Transaction_Replay(
+	t *testing.T,
+) {
+
+	transactions := newStreamedTransactions(1024, t.TempDir())
+
+	transactions.start(100)
+	assert.True(t, transactions.inStream())
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeRelation, 100, 1, "relation")))
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 100, 2, "insert-1")))
+	transactions.stop()
+	assert.False(t, transactions.inStream())
+
+	transactions.start(100)
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 101, 3, "insert-2")))
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 102, 4, "insert-3")))
+	transactions.stop()
+
+	assert.NoError(t, transactions.abort(100, 101))
+
+	transaction := transactions.commit(100)
+	assert.NotNil(t, transaction)
+	assert.Equal(t, 0, transactions.memory)
+
+	changes := replayChanges(t, transaction)
+	assert.Equal(t, []string{"relation", "insert-1", "insert-3"}, payloads(changes))
+	assert.Equal(t, []uint32{100, 100, 102}, []uint32{changes[0].xid, changes[1].xid, changes[2].xid})
+	assert.Equal(t, pglogrepl.LSN(4), changes[2].walStart)
+
+	// The xid must be removed, to be able to parse the message like a non-streamed one
+	assert.Equal(t, byte(pglogrepl.MessageTypeInsert), changes[1].data[0])
+	assert.Equal(t, "insert-1", string(changes[1].data[1:]))
+
+	assert.Nil(t, transactions.commit(200))
+}
+
+func Test_Streamed_Transaction_Spill(
+	t *testing.T,
+) {
+
+	spillDirectory := t.TempDir()
+	transactions := newStreamedTransactions(20, spillDirectory)
+
+	transactions.start(100)
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeRelation, 101, 1, "relation")))
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 100, 2, "insert-1")))
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 101, 3, "insert-2")))
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeDelete, 100, 4, "delete-1")))
+	transactions.stop()
+
+	transaction := transactions.transactions[100]
+	assert.NotNil(t, transaction.spillFile)
+	assert.Equal(t, 0, transactions.memory)
+
+	assert.NoError(t, transactions.abort(100, 101))
+
+	transaction = transactions.commit(100)
+	changes := replayChanges(t, transaction)
+	assert.Equal(t, []string{"relation", "insert-1", "delete-1"}, payloads(changes))
+	assert.Equal(t, pglogrepl.LSN(4), changes[2].walStart)
+
+	spillFile := transaction.spillFile.Name()
+	assert.NoError(t, transaction.close())
+	_, err := os.Stat(spillFile)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, transactions.close())
+	entries, err := os.ReadDir(spillDirectory)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func Test_Streamed_Change_Server_Time(
+	t *testing.T,
+) {
+
+	serverTimes := []time.Time{
+		time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 9, 12, 10, 11, 12, 123456000, time.UTC),
+		time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	buffer := &bytes.Buffer{}
+	transaction := &streamedTransaction{spillWriter: bufio.NewWriter(buffer)}
+	for _, serverTime := range serverTimes {
+		assert.NoError(t, transaction.writeChange(streamedChange{serverTime: serverTime, data: []byte{'I'}}))
+	}
+	assert.NoError(t, transaction.spillWriter.Flush())
+
+	// server times are stored as microseconds since the PostgreSQL epoch
+	assert.Equal(t, make([]byte, 8), buffer.Bytes()[16:24])
+
+	for _, serverTime := range serverTimes {
+		change, err := readChange(buffer)
+		assert.NoError(t, err)
+		assert.True(t, serverTime.Equal(change.serverTime))
+	}
+}
+
+func Test_Streamed_Transaction_Abort(
+	t *testing.T,
+) {
+
+	transactions := newStreamedTransactions(20, t.TempDir())
+
+	transactions.start(100)
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 100, 1, "insert-1")))
+	transactions.stop()
+
+	transactions.start(200)
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 200, 2, "insert-2")))
+	assert.NoError(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 200, 3, "insert-3")))
+	transactions.stop()
+
+	spillFile := transactions.transactions[200].spillFile.Name()
+
+	assert.NoError(t, transactions.abort(200, 200))
+	assert.Nil(t, transactions.commit(200))
+	_, err := os.Stat(spillFile)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, len("insert-1")+1, transactions.memory)
+	assert.NoError(t, transactions.abort(100, 100))
+	assert.Equal(t, 0, transactions.memory)
+}
+
+func Test_Streamed_Message_Outside_Stream(
+	t *testing.T,
+) {
+
+	transactions := newStreamedTransactions(20, t.TempDir())
+	assert.Error(t, transactions.append(streamedMessage(pglogrepl.MessageTypeInsert, 100, 1, "insert")))
+}
+
+func streamedMessage(
+	msgType pglogrepl.MessageType, xid uint32, lsn pglogrepl.LSN, payload string,
+) pglogrepl.XLogData {
+
+	data := []byte{byte(msgType)}
+	data = binary.BigEndian.AppendUint32(data, xid)
+	data = append(data, payload...)
+	return pglogrepl.XLogData{
+		WALStart:     lsn,
+		ServerWALEnd: lsn,
+		ServerTime:   time.Unix(0, 0),
+		WALData:      data,
+	}
+}
+
+func replayChanges(
+	t *testing.T, transaction *streamedTransaction,
+) []streamedChange {
+
+	changes := make([]streamedChange, 0)
+	assert.NoError(t, transaction.replay(func(change streamedChange) error {
+		changes = append(changes, change)
+		return nil
+	}))
+	return changes
+}
+
+func payloads(
+	changes []streamedChange,
+) []string {
+
+	payloads := make([]string, 0, len(changes))
+	for _, change := range changes {
+		payloads = append(payloads, string(change.data[1:]))
+	}
+	return payloads
+}
@@ -52,6 +52,7 @@ const esPreviouslyKnownTables = "::previously::known::tables"
 type Replicator struct {
 	logger       *logging.Logger
 	config       *sysconfig.SystemConfig
+	failure      chan error
 	shutdownTask func() error
 }
 
@@ -66,8 +67,9 @@ func NewReplicator(
 	}
 
 	return &Replicator{
-		logger: logger,
-		config: config,
+		logger:  logger,
+		config:  config,
+		failure: make(chan error, 1),
 	}, nil
 }
 
@@ -126,6 +128,11 @@ func (r *Replicator) StartReplication() *cli.ExitError {
 		return erroring.AdaptErrorWithMessage(err, "failed to start event emitter", 24)
 	}
 
+	// Replication can't continue after an event failed to be delivered
+	go func() {
+		r.failure <- <-eventEmitter.Failure()
+	}()
+
 	// Start the snapshotter
 	var snapshotter *snapshotting.Snapshotter
 	if err := container.Service(&snapshotter); err != nil {
@@ -199,6 +206,13 @@ func (r *Replicator) StartReplication() *cli.ExitError {
 	return nil
 }
 
+// Failure returns a channel which receives an error when the replication
+// failed and needs to be stopped. After a restart, the replication resumes
+// from the last processed LSN.
+func (r *Replicator) Failure() <-chan error {
+	return r.failure
+}
+
 // StopReplication initiates a clean shutdown of the replication process. This
 // call blocks until the shutdown process has finished.
 func (r *Replicator) StopReplication() *cli.ExitError {
@@ -370,6 +384,40 @@ func getKnownChunks(
 	return allChunks, nil
 }
 
+// ReadKnownChunks decodes the chunks known at the last
+// shutdown from the given state
+func ReadKnownChunks(
+	encodedState func(name string) ([]byte, bool),
+) (chunks []systemcatalog.SystemEntity, present bool, err error) {
+
+	return readKnownTables(encodedState, esPreviouslyKnownChunks)
+}
+
+// ReadKnownTables decodes the vanilla tables known at the
+// last shutdown from the given state
+func ReadKnownTables(
+	encodedState func(name string) ([]byte, bool),
+) (tables []systemcatalog.SystemEntity, present bool, err error) {
+
+	return readKnownTables(encodedState, esPreviouslyKnownTables)
+}
+
+func readKnownTables(
+	encodedState func(name string) ([]byte, bool), name string,
+) ([]systemcatalog.SystemEntity, bool, error) {
+
+	state, present := encodedState(name)
+	if !present {
+		return nil, false, nil
+	}
+
+	tables, err := decodeKnownTables(state)
+	if err != nil {
+		return nil, false, err
+	}
+	return tables, true, nil
+}
+
 func decodeKnownTables(
 	data []byte,
 ) ([]systemcatalog.SystemEntity, error) {
@@ -75,6 +75,9 @@ var DynamicModule = wiring.DefineModule(
 		})
 
 		module.Provide(func(c *config.Config) (sink.Sink, error) {
+			if len(c.Sink.Sinks) > 0 {
+				return sinkimpl.NewFanOutSink(c)
+			}
 			name := config.GetOrDefault(c, config.PropertySink, config.Stdout)
 			return sinkimpl.NewSink(name, c)
 		})
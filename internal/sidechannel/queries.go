@@ -93,6 +93,11 @@ SELECT plugin, slot_type, restart_lsn, confirmed_flush_lsn
 FROM pg_catalog.pg_replication_slots prs
 WHERE slot_name = $1`
 
+const queryCheckReplicationSlotActive = `
+SELECT active
+FROM pg_catalog.pg_replication_slots prs
+WHERE slot_name = $1`
+
 const queryCheckReplicationSlotExists = `
 SELECT true
 FROM pg_catalog.pg_replication_slots prs
@@ -143,7 +148,9 @@ SELECT
    coalesce(d.aligned, false) AS dim_aligned,
    CASE WHEN d.interval_length IS NULL THEN 'space' ELSE 'time' END AS dim_type,
    CASE WHEN d.column_name IS NOT NULL THEN rank() over (order by d.id) END,
-   c.character_maximum_length
+   d.interval_length,
+   c.character_maximum_length,
+   c.ordinal_position::int
 FROM information_schema.columns c
 LEFT JOIN (
     SELECT
@@ -233,7 +240,8 @@ SELECT
    p.index_name,
    CASE o.option & 1 WHEN 1 THEN 'DESC' ELSE 'ASC' END AS index_column_order,
    CASE o.option & 2 WHEN 2 THEN 'NULLS FIRST' ELSE 'NULLS LAST' END AS index_nulls_order,
-   c.character_maximum_length
+   c.character_maximum_length,
+   c.ordinal_position::int
 FROM information_schema.columns c
 LEFT JOIN (
     SELECT
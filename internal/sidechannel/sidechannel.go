@@ -617,6 +617,22 @@ func (sc *sideChannel) ExistsReplicationSlot(
 	return
 }
 
+func (sc *sideChannel) IsReplicationSlotActive(
+	slotName string,
+) (active bool, err error) {
+
+	err = sc.newSession(time.Second*10, func(session *session) error {
+		return session.queryRow(queryCheckReplicationSlotActive, slotName).Scan(&active)
+	})
+	if err == pgx.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		err = errors.Wrap(err, 0)
+	}
+	return
+}
+
 func (sc *sideChannel) ReadPgCompositeTypeSchema(
 	oid uint32, compositeColumnFactory pgtypes.CompositeColumnFactory,
 ) ([]pgtypes.CompositeColumn, error) {
@@ -735,13 +751,13 @@ func (sc *sideChannel) readVanillaTableSchema0(
 	if err := session.queryFunc(func(row pgx.Row) error {
 		var name, sortOrder, nullsOrder string
 		var oid uint32
-		var modifiers int
+		var modifiers, number int
 		var keySeq, maxCharLength *int
 		var nullable, primaryKey, isReplicaIdent bool
 		var defaultValue, indexName *string
 
 		if err := row.Scan(&name, &oid, &modifiers, &nullable, &primaryKey, &keySeq, &defaultValue,
-			&isReplicaIdent, &indexName, &sortOrder, &nullsOrder, &maxCharLength); err != nil {
+			&isReplicaIdent, &indexName, &sortOrder, &nullsOrder, &maxCharLength, &number); err != nil {
 
 			return errors.Wrap(err, 0)
 		}
@@ -754,7 +770,7 @@ func (sc *sideChannel) readVanillaTableSchema0(
 		column := systemcatalog.NewIndexColumn(
 			name, oid, modifiers, dataType, nullable, primaryKey, keySeq, defaultValue, isReplicaIdent, indexName,
 			systemcatalog.IndexSortOrder(sortOrder), systemcatalog.IndexNullsOrder(nullsOrder),
-			false, false, nil, nil, maxCharLength,
+			false, false, nil, nil, nil, maxCharLength, number,
 		)
 		columns = append(columns, column)
 		return nil
@@ -779,14 +795,15 @@ func (sc *sideChannel) readHypertableSchema0(
 	if err := session.queryFunc(func(row pgx.Row) error {
 		var name, sortOrder, nullsOrder string
 		var oid uint32
-		var modifiers int
+		var modifiers, number int
 		var keySeq, dimSeq, maxCharLength *int
+		var dimInterval *int64
 		var nullable, primaryKey, isReplicaIdent, dimension, dimAligned bool
 		var defaultValue, indexName, dimType *string
 
 		if err := row.Scan(&name, &oid, &modifiers, &nullable, &primaryKey, &keySeq,
 			&defaultValue, &isReplicaIdent, &indexName, &sortOrder, &nullsOrder,
-			&dimension, &dimAligned, &dimType, &dimSeq, &maxCharLength); err != nil {
+			&dimension, &dimAligned, &dimType, &dimSeq, &dimInterval, &maxCharLength, &number); err != nil {
 
 			return errors.Wrap(err, 0)
 		}
@@ -799,7 +816,7 @@ func (sc *sideChannel) readHypertableSchema0(
 		column := systemcatalog.NewIndexColumn(
 			name, oid, modifiers, dataType, nullable, primaryKey, keySeq, defaultValue, isReplicaIdent, indexName,
 			systemcatalog.IndexSortOrder(sortOrder), systemcatalog.IndexNullsOrder(nullsOrder),
-			dimension, dimAligned, dimType, dimSeq, maxCharLength,
+			dimension, dimAligned, dimType, dimSeq, dimInterval, maxCharLength, number,
 		)
 		columns = append(columns, column)
 		return nil
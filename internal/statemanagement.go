@@ -0,0 +1,424 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pglogrepl"
+	"github.com/noctarius/timescaledb-event-streamer/internal/erroring"
+	sinkimpl "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink"
+	"github.com/noctarius/timescaledb-event-streamer/internal/replication"
+	sidechannelimpl "github.com/noctarius/timescaledb-event-streamer/internal/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	systemcatalogimpl "github.com/noctarius/timescaledb-event-streamer/internal/systemcatalog"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/noctarius/timescaledb-event-streamer/spi/watermark"
+	"github.com/samber/lo"
+	"github.com/urfave/cli"
+	"io"
+	"time"
+)
+
+const stateExportVersion = 1
+
+// newSideChannel creates the side channel used to read the
+// replication slots, replaceable for testing
+var newSideChannel = func(
+	config *sysconfig.SystemConfig, stateStorage statestorage.Storage,
+) (sidechannel.SideChannel, error) {
+
+	return sidechannelimpl.NewSideChannel(statestorage.NewStateStorageManager(stateStorage), config.PgxConfig)
+}
+
+type offsetView struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Snapshot       bool      `json:"snapshot"`
+	SnapshotName   *string   `json:"snapshot_name,omitempty"`
+	SnapshotOffset int       `json:"snapshot_offset"`
+	LSN            string    `json:"lsn"`
+}
+
+type watermarkView struct {
+	Complete bool           `json:"complete"`
+	High     map[string]any `json:"high"`
+	Low      map[string]any `json:"low,omitempty"`
+}
+
+type snapshotView struct {
+	SnapshotName string                   `json:"snapshot_name"`
+	Complete     bool                     `json:"complete"`
+	Watermarks   map[string]watermarkView `json:"watermarks"`
+}
+
+type stateView struct {
+	Offsets        map[string]offsetView `json:"offsets"`
+	Snapshot       *snapshotView         `json:"snapshot,omitempty"`
+	KnownChunks    []string              `json:"known_chunks,omitempty"`
+	KnownTables    []string              `json:"known_tables,omitempty"`
+	SchemaVersions map[string]uint32     `json:"schema_versions,omitempty"`
+	SinkContext    map[string]string     `json:"sink_context,omitempty"`
+	States         map[string]int        `json:"states"`
+}
+
+type stateExport struct {
+	Version int                   `json:"version"`
+	Offsets map[string]offsetView `json:"offsets"`
+	States  map[string][]byte     `json:"states"`
+}
+
+// InspectState writes the offsets and all decodable states of
+// the configured state storage as human-readable JSON
+func InspectState(
+	config *sysconfig.SystemConfig, writer io.Writer,
+) *cli.ExitError {
+
+	return withLoadedStateStorage(config, func(stateStorage statestorage.Storage) *cli.ExitError {
+		view, err := newStateView(stateStorage)
+		if err != nil {
+			return erroring.AdaptErrorWithMessage(err, "failed to decode state", 1)
+		}
+		return writeJson(writer, view)
+	})
+}
+
+// ExportState writes the offsets and the raw encoded states of the
+// configured state storage as JSON, which can be read by ImportState
+func ExportState(
+	config *sysconfig.SystemConfig, writer io.Writer,
+) *cli.ExitError {
+
+	return withLoadedStateStorage(config, func(stateStorage statestorage.Storage) *cli.ExitError {
+		offsets, err := stateStorage.Get()
+		if err != nil {
+			return erroring.AdaptError(err, 1)
+		}
+		return writeJson(writer, &stateExport{
+			Version: stateExportVersion,
+			Offsets: lo.MapValues(offsets, toOffsetView),
+			States:  stateStorage.EncodedStates(),
+		})
+	})
+}
+
+// ImportState reads a state previously written by ExportState into
+// the configured state storage. Offsets and states contained in the
+// export replace existing ones with the same name. The import is
+// rejected while any of the replication slots is in use.
+func ImportState(
+	config *sysconfig.SystemConfig, reader io.Reader,
+) *cli.ExitError {
+
+	export := &stateExport{}
+	if err := json.NewDecoder(reader).Decode(export); err != nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to read state export", 7)
+	}
+	if export.Version != stateExportVersion {
+		return cli.NewExitError(fmt.Sprintf("Unsupported state export version %d", export.Version), 6)
+	}
+
+	offsets := make(map[string]*statestorage.Offset, len(export.Offsets))
+	for name, view := range export.Offsets {
+		offset, err := fromOffsetView(view)
+		if err != nil {
+			return erroring.AdaptErrorWithMessage(err, fmt.Sprintf("illegal offset for '%s'", name), 6)
+		}
+		offsets[name] = offset
+	}
+
+	return withStateStorage(config, func(stateStorage statestorage.Storage) *cli.ExitError {
+		slotNames := lo.Keys(offsets)
+		if slotName := spiconfig.GetOrDefault(
+			config.Config, spiconfig.PropertyPostgresqlReplicationSlotName, "",
+		); slotName != "" && !lo.Contains(slotNames, slotName) {
+
+			slotNames = append(slotNames, slotName)
+		}
+		if len(slotNames) > 0 {
+			sideChannel, err := newSideChannel(config, stateStorage)
+			if err != nil {
+				return erroring.AdaptError(err, 1)
+			}
+			if err := ensureReplicationSlotsInactive(sideChannel, slotNames...); err != nil {
+				return err
+			}
+		}
+
+		for name, offset := range offsets {
+			if err := stateStorage.Set(name, offset); err != nil {
+				return erroring.AdaptError(err, 1)
+			}
+		}
+		for name, encodedState := range export.States {
+			stateStorage.SetEncodedState(name, encodedState)
+		}
+		return nil
+	})
+}
+
+// RewindState sets the offset LSN of the given replication slot, which
+// defaults to the configured one. PostgreSQL can't replay changes before
+// the slot's confirmed_flush_lsn, hence earlier LSNs are rejected, as
+// well as rewinding a replication slot in use.
+func RewindState(
+	config *sysconfig.SystemConfig, slotName, lsn string,
+) *cli.ExitError {
+
+	if slotName == "" {
+		slotName = spiconfig.GetOrDefault(config.Config, spiconfig.PropertyPostgresqlReplicationSlotName, "")
+	}
+	if slotName == "" {
+		return cli.NewExitError(
+			"Replication slot name (postgresql.replicationslot.name) required to rewind the state", 6,
+		)
+	}
+
+	targetLSN, err := pglogrepl.ParseLSN(lsn)
+	if err != nil {
+		return erroring.AdaptErrorWithMessage(err, fmt.Sprintf("illegal LSN '%s'", lsn), 6)
+	}
+
+	return withStateStorage(config, func(stateStorage statestorage.Storage) *cli.ExitError {
+		sideChannel, err := newSideChannel(config, stateStorage)
+		if err != nil {
+			return erroring.AdaptError(err, 1)
+		}
+
+		pluginName, _, _, confirmedFlushLSN, err := sideChannel.ReadReplicationSlot(slotName)
+		if err != nil {
+			return erroring.AdaptErrorWithMessage(err, "failed to read replication slot", 25)
+		}
+		if pluginName == "" {
+			return cli.NewExitError(fmt.Sprintf("Replication slot '%s' doesn't exist", slotName), 6)
+		}
+		if err := ensureReplicationSlotsInactive(sideChannel, slotName); err != nil {
+			return err
+		}
+		if pgtypes.LSN(targetLSN) < confirmedFlushLSN {
+			return cli.NewExitError(fmt.Sprintf(
+				"LSN %s is before the confirmed flush LSN %s of replication slot '%s' and can't be replayed",
+				targetLSN, confirmedFlushLSN, slotName,
+			), 6)
+		}
+
+		offsets, err := stateStorage.Get()
+		if err != nil {
+			return erroring.AdaptError(err, 1)
+		}
+
+		offset := &statestorage.Offset{}
+		if existing, present := offsets[slotName]; present {
+			*offset = *existing
+		}
+		offset.Timestamp = time.Now()
+		offset.LSN = pgtypes.LSN(targetLSN)
+		if err := stateStorage.Set(slotName, offset); err != nil {
+			return erroring.AdaptError(err, 1)
+		}
+		return nil
+	})
+}
+
+// ensureReplicationSlotsInactive rejects changing the state of replication
+// slots in use, since the running streamer overwrites the state on shutdown.
+func ensureReplicationSlotsInactive(
+	sideChannel sidechannel.SideChannel, slotNames ...string,
+) *cli.ExitError {
+
+	for _, slotName := range slotNames {
+		active, err := sideChannel.IsReplicationSlotActive(slotName)
+		if err != nil {
+			return erroring.AdaptErrorWithMessage(err, "failed to read replication slot", 25)
+		}
+		if active {
+			return cli.NewExitError(fmt.Sprintf(
+				"Replication slot '%s' is in use, the streamer must be stopped to change its state", slotName,
+			), 6)
+		}
+	}
+	return nil
+}
+
+// withStateStorage starts the state storage and stops it afterwards,
+// which saves the state. Saving overwrites the state of a running
+// streamer, hence it must only be used to change the state of
+// replication slots not in use.
+func withStateStorage(
+	config *sysconfig.SystemConfig, fn func(stateStorage statestorage.Storage) *cli.ExitError,
+) *cli.ExitError {
+
+	stateStorage, exitErr := newConfiguredStateStorage(config)
+	if exitErr != nil {
+		return exitErr
+	}
+	if err := stateStorage.Start(); err != nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to load state", 7)
+	}
+
+	exitErr = fn(stateStorage)
+	if err := stateStorage.Stop(); err != nil && exitErr == nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to store state", 7)
+	}
+	return exitErr
+}
+
+// withLoadedStateStorage only loads the state, which is never saved
+// afterwards, hence can be used while the streamer is running
+func withLoadedStateStorage(
+	config *sysconfig.SystemConfig, fn func(stateStorage statestorage.Storage) *cli.ExitError,
+) *cli.ExitError {
+
+	stateStorage, exitErr := newConfiguredStateStorage(config)
+	if exitErr != nil {
+		return exitErr
+	}
+	if closableStorage, ok := stateStorage.(statestorage.ClosableStorage); ok {
+		defer closableStorage.Close()
+	}
+	if err := stateStorage.Load(); err != nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to load state", 7)
+	}
+	return fn(stateStorage)
+}
+
+func newConfiguredStateStorage(
+	config *sysconfig.SystemConfig,
+) (statestorage.Storage, *cli.ExitError) {
+
+	if err := initializeSystemConfig(config); err != nil {
+		return nil, err
+	}
+
+	name := spiconfig.GetOrDefault(config.Config, spiconfig.PropertyStateStorageType, spiconfig.NoneStorage)
+	if name == spiconfig.NoneStorage {
+		return nil, cli.NewExitError("State storage (statestorage.type) required to access the state", 6)
+	}
+
+	stateStorage, err := statestorage.NewStateStorage(name, config.Config)
+	if err != nil {
+		return nil, erroring.AdaptError(err, 6)
+	}
+	return stateStorage, nil
+}
+
+func newStateView(
+	stateStorage statestorage.Storage,
+) (*stateView, error) {
+
+	offsets, err := stateStorage.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	view := &stateView{
+		Offsets: lo.MapValues(offsets, toOffsetView),
+		States: lo.MapValues(stateStorage.EncodedStates(), func(encodedState []byte, _ string) int {
+			return len(encodedState)
+		}),
+	}
+
+	snapshotContext, err := statestorage.NewStateStorageManager(stateStorage).SnapshotContext()
+	if err != nil {
+		return nil, err
+	}
+	if snapshotContext != nil {
+		view.Snapshot = &snapshotView{
+			SnapshotName: snapshotContext.SnapshotName(),
+			Complete:     snapshotContext.Complete(),
+			Watermarks: lo.MapValues(snapshotContext.Watermarks(), func(w *watermark.Watermark, _ string) watermarkView {
+				return watermarkView{
+					Complete: w.Complete(),
+					High:     w.HighWatermark(),
+					Low:      w.LowWatermark(),
+				}
+			}),
+		}
+	}
+
+	canonicalNames := func(entities []systemcatalog.SystemEntity) []string {
+		return lo.Map(entities, func(entity systemcatalog.SystemEntity, _ int) string {
+			return entity.CanonicalName()
+		})
+	}
+
+	knownChunks, _, err := replication.ReadKnownChunks(stateStorage.EncodedState)
+	if err != nil {
+		return nil, err
+	}
+	view.KnownChunks = canonicalNames(knownChunks)
+
+	knownTables, _, err := replication.ReadKnownTables(stateStorage.EncodedState)
+	if err != nil {
+		return nil, err
+	}
+	view.KnownTables = canonicalNames(knownTables)
+
+	if view.SchemaVersions, _, err = systemcatalogimpl.ReadSchemaVersions(stateStorage.EncodedState); err != nil {
+		return nil, err
+	}
+	if view.SinkContext, _, err = sinkimpl.ReadSinkContextAttributes(stateStorage.EncodedState); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func toOffsetView(
+	offset *statestorage.Offset, _ string,
+) offsetView {
+
+	return offsetView{
+		Timestamp:      offset.Timestamp,
+		Snapshot:       offset.Snapshot,
+		SnapshotName:   offset.SnapshotName,
+		SnapshotOffset: offset.SnapshotOffset,
+		LSN:            offset.LSN.String(),
+	}
+}
+
+func fromOffsetView(
+	view offsetView,
+) (*statestorage.Offset, error) {
+
+	lsn, err := pglogrepl.ParseLSN(view.LSN)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return &statestorage.Offset{
+		Timestamp:      view.Timestamp,
+		Snapshot:       view.Snapshot,
+		SnapshotName:   view.SnapshotName,
+		SnapshotOffset: view.SnapshotOffset,
+		LSN:            pgtypes.LSN(lsn),
+	}, nil
+}
+
+func writeJson(
+	writer io.Writer, value any,
+) *cli.ExitError {
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return erroring.AdaptErrorWithMessage(err, "failed to write state", 7)
+	}
+	return nil
+}
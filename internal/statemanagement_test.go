@@ -0,0 +1,221 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func Test_State_Export_Import(
+	t *testing.T,
+) {
+
+	export := `{
+		"version": 1,
+		"offsets": {
+			"slot": {"timestamp": "2023-01-01T00:00:00Z", "snapshot": false, "snapshot_offset": 0, "lsn": "0/16B3748"}
+		},
+		"states": {"SinkContextState": "AAAAAQAAAAMAAAADZm9vYmFy"}
+	}`
+
+	useTestSideChannel(t)
+
+	config := newFileStateConfig(t)
+	assert.Nil(t, ImportState(config, bytes.NewBufferString(export)))
+
+	config = newFileStateConfig(t, config.StateStorage.FileStorage.Path)
+	buffer := &bytes.Buffer{}
+	assert.Nil(t, InspectState(config, buffer))
+
+	view := &stateView{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), view))
+	assert.Equal(t, "0/16B3748", view.Offsets["slot"].LSN)
+	assert.Equal(t, map[string]string{"foo": "bar"}, view.SinkContext)
+	assert.Equal(t, map[string]int{"SinkContextState": 18}, view.States)
+
+	config = newFileStateConfig(t, config.StateStorage.FileStorage.Path)
+	buffer.Reset()
+	assert.Nil(t, ExportState(config, buffer))
+
+	exported := &stateExport{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), exported))
+	assert.Equal(t, stateExportVersion, exported.Version)
+	assert.Equal(t, "0/16B3748", exported.Offsets["slot"].LSN)
+	assert.Equal(t, []byte{0, 0, 0, 1, 0, 0, 0, 3, 0, 0, 0, 3, 'f', 'o', 'o', 'b', 'a', 'r'},
+		exported.States["SinkContextState"])
+}
+
+type recordingStateStorage struct {
+	statestorage.Storage
+	calls []string
+}
+
+func (r *recordingStateStorage) Start() error {
+	r.calls = append(r.calls, "start")
+	return r.Storage.Start()
+}
+
+func (r *recordingStateStorage) Stop() error {
+	r.calls = append(r.calls, "stop")
+	return r.Storage.Stop()
+}
+
+func (r *recordingStateStorage) Save() error {
+	r.calls = append(r.calls, "save")
+	return r.Storage.Save()
+}
+
+func (r *recordingStateStorage) Load() error {
+	r.calls = append(r.calls, "load")
+	return r.Storage.Load()
+}
+
+func (r *recordingStateStorage) Close() error {
+	r.calls = append(r.calls, "close")
+	return nil
+}
+
+func Test_State_Inspect_And_Export_Dont_Save(
+	t *testing.T,
+) {
+
+	storage := &recordingStateStorage{Storage: statestorage.NewDummyStateStorage()}
+	storageType := spiconfig.StateStorageType("recording")
+	statestorage.RegisterStateStorage(storageType, func(_ *spiconfig.Config) (statestorage.Storage, error) {
+		return storage, nil
+	})
+
+	config := newFileStateConfig(t)
+	config.StateStorage.Type = storageType
+
+	assert.Nil(t, InspectState(config, &bytes.Buffer{}))
+	assert.Nil(t, ExportState(config, &bytes.Buffer{}))
+
+	// Saving would overwrite the state of a running streamer
+	assert.Equal(t, []string{"load", "close", "load", "close"}, storage.calls)
+}
+
+func Test_State_Import_Illegal_Export(
+	t *testing.T,
+) {
+
+	config := newFileStateConfig(t)
+	assert.NotNil(t, ImportState(config, bytes.NewBufferString(`{"version": 2}`)))
+	assert.NotNil(t, ImportState(config, bytes.NewBufferString(
+		`{"version": 1, "offsets": {"slot": {"lsn": "foo"}}}`,
+	)))
+}
+
+func Test_State_Import_Active_Replication_Slot(
+	t *testing.T,
+) {
+
+	useTestSideChannel(t, "slot")
+
+	config := newFileStateConfig(t)
+	assert.NotNil(t, ImportState(config, bytes.NewBufferString(
+		`{"version": 1, "offsets": {"slot": {"lsn": "0/16B3748"}}}`,
+	)))
+
+	config = newFileStateConfig(t, config.StateStorage.FileStorage.Path)
+	buffer := &bytes.Buffer{}
+	assert.Nil(t, InspectState(config, buffer))
+
+	view := &stateView{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), view))
+	assert.Empty(t, view.Offsets)
+}
+
+func Test_State_Rewind(
+	t *testing.T,
+) {
+
+	useTestSideChannel(t, "active")
+
+	config := newFileStateConfig(t)
+	assert.Nil(t, RewindState(config, "slot", "0/16B3748"))
+	assert.NotNil(t, RewindState(newFileStateConfig(t, config.StateStorage.FileStorage.Path), "active", "0/16B3748"))
+
+	config = newFileStateConfig(t, config.StateStorage.FileStorage.Path)
+	buffer := &bytes.Buffer{}
+	assert.Nil(t, InspectState(config, buffer))
+
+	view := &stateView{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), view))
+	assert.Equal(t, "0/16B3748", view.Offsets["slot"].LSN)
+	assert.NotContains(t, view.Offsets, "active")
+}
+
+type testSideChannel struct {
+	sidechannel.SideChannel
+	activeSlots []string
+}
+
+func (t *testSideChannel) ReadReplicationSlot(
+	_ string,
+) (pluginName, slotType string, restartLsn, confirmedFlushLsn pgtypes.LSN, err error) {
+
+	return "pgoutput", "logical", 0, 0, nil
+}
+
+func (t *testSideChannel) IsReplicationSlotActive(
+	slotName string,
+) (bool, error) {
+
+	for _, activeSlot := range t.activeSlots {
+		if activeSlot == slotName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func useTestSideChannel(
+	t *testing.T, activeSlots ...string,
+) {
+
+	original := newSideChannel
+	newSideChannel = func(_ *sysconfig.SystemConfig, _ statestorage.Storage) (sidechannel.SideChannel, error) {
+		return &testSideChannel{activeSlots: activeSlots}, nil
+	}
+	t.Cleanup(func() {
+		newSideChannel = original
+	})
+}
+
+func newFileStateConfig(
+	t *testing.T, path ...string,
+) *sysconfig.SystemConfig {
+
+	config := &spiconfig.Config{}
+	config.PostgreSQL.Connection = "host=localhost user=repl_user"
+	config.StateStorage.Type = spiconfig.FileStorage
+	config.StateStorage.FileStorage.Path = filepath.Join(t.TempDir(), "statestorage.dat")
+	if len(path) > 0 {
+		config.StateStorage.FileStorage.Path = path[0]
+	}
+	return sysconfig.NewSystemConfig(config)
+}
@@ -35,10 +35,19 @@ import (
 	_ "github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
 
 	// Register built-in sinks
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/amqp"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/awskinesis"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/awssqs"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/file"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/grpc"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/http"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/kafka"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/livefeed"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/mqtt"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/nats"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/parquet"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/postgresql"
+	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/pulsar"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/redis"
 	_ "github.com/noctarius/timescaledb-event-streamer/internal/eventing/sink/stdout"
 )
@@ -53,6 +62,40 @@ func NewStreamer(
 	config *sysconfig.SystemConfig,
 ) (*Streamer, *cli.ExitError) {
 
+	if err := initializeSystemConfig(config); err != nil {
+		return nil, err
+	}
+
+	if config.Topic.Prefix == "" {
+		config.Topic.Prefix = lo.RandomString(20, lo.LowerCaseLettersCharset)
+	}
+
+	replicator, err := replication.NewReplicator(config)
+	if err != nil {
+		return nil, erroring.AdaptError(err, 21)
+	}
+
+	return &Streamer{
+		replicator: replicator,
+	}, nil
+}
+
+func (s *Streamer) Start() *cli.ExitError {
+	return s.replicator.StartReplication()
+}
+
+func (s *Streamer) Failure() <-chan error {
+	return s.replicator.Failure()
+}
+
+func (s *Streamer) Stop() *cli.ExitError {
+	return s.replicator.StopReplication()
+}
+
+func initializeSystemConfig(
+	config *sysconfig.SystemConfig,
+) *cli.ExitError {
+
 	if config.PgxConfig == nil {
 		connection := spiconfig.GetOrDefault(
 			config.Config, spiconfig.PropertyPostgresqlConnection, "host=localhost user=repl_user",
@@ -60,7 +103,7 @@ func NewStreamer(
 
 		connConfig, err := pgx.ParseConfig(connection)
 		if err != nil {
-			return nil, cli.NewExitError(
+			return cli.NewExitError(
 				fmt.Sprintf("PostgreSQL connection string failed to parse: %s", err.Error()), 6)
 		}
 
@@ -77,30 +120,10 @@ func NewStreamer(
 		config.PostgreSQL.Publication.Name = publicationName
 	}
 
-	if config.Topic.Prefix == "" {
-		config.Topic.Prefix = lo.RandomString(20, lo.LowerCaseLettersCharset)
-	}
-
 	// Start all potential plugins, to make sure they're registered
 	// before we try to access any of the interface implementations
 	if err := plugins.LoadPlugins(config.Config); err != nil {
-		return nil, erroring.AdaptError(err, 50)
-	}
-
-	replicator, err := replication.NewReplicator(config)
-	if err != nil {
-		return nil, erroring.AdaptError(err, 21)
+		return erroring.AdaptError(err, 50)
 	}
-
-	return &Streamer{
-		replicator: replicator,
-	}, nil
-}
-
-func (s *Streamer) Start() *cli.ExitError {
-	return s.replicator.StartReplication()
-}
-
-func (s *Streamer) Stop() *cli.ExitError {
-	return s.replicator.StopReplication()
+	return nil
 }
@@ -85,7 +85,7 @@ type SnapshotterProvider = func(
 ) (*snapshotting.Snapshotter, error)
 
 type ReplicationChannelProvider = func(
-	replicationcontext.ReplicationContext, pgtypes.TypeManager,
+	*config.Config, replicationcontext.ReplicationContext, pgtypes.TypeManager,
 	task.TaskManager, publication.PublicationManager, *stats.Service,
 ) (*replicationchannel.ReplicationChannel, error)
 
@@ -38,19 +38,43 @@ type systemCatalogReplicationEventHandler struct {
 }
 
 func (s *systemCatalogReplicationEventHandler) OnRelationEvent(
-	_ pgtypes.XLogData, msg *pgtypes.RelationMessage,
+	xld pgtypes.XLogData, msg *pgtypes.RelationMessage,
 ) error {
 
-	if msg.Namespace != "_timescaledb_catalog" {
-		if hypertable, present := s.systemCatalog.FindHypertableByName(msg.Namespace, msg.RelationName); present {
-			if !hypertable.IsContinuousAggregate() && msg.Namespace != "_timescaledb_internal" {
-				return nil
-			}
+	if msg.Namespace == "_timescaledb_catalog" {
+		return nil
+	}
 
-			return s.systemCatalog.sideChannel.ReadHypertableSchema(
-				s.systemCatalog.ApplySchemaUpdate, s.systemCatalog.typeManager.ResolveDataType, hypertable,
-			)
+	schemaUpdateCallback := s.systemCatalog.schemaUpdateWithChangeEvents(xld)
+	typeResolver := s.systemCatalog.typeManager.ResolveDataType
+
+	if hypertable, present := s.systemCatalog.FindHypertableByName(msg.Namespace, msg.RelationName); present {
+		if !hypertable.IsContinuousAggregate() && msg.Namespace != "_timescaledb_internal" {
+			return nil
+		}
+		return s.systemCatalog.sideChannel.ReadHypertableSchema(schemaUpdateCallback, typeResolver, hypertable)
+	}
+
+	// Relation messages are sent for chunks, not the hypertable itself,
+	// hence schema changes of hypertables are detected through their chunks
+	if chunk, present := s.systemCatalog.FindChunkByName(msg.Namespace, msg.RelationName); present {
+		hypertable, present := s.systemCatalog.FindHypertableById(chunk.HypertableId())
+		if !present || hypertable.IsCompressedTable() {
+			return nil
+		}
+
+		// Every chunk sends its own relation message, only refresh on actual changes
+		if relationMatchesColumns(msg, hypertable.Columns()) {
+			return nil
+		}
+		return s.systemCatalog.sideChannel.ReadHypertableSchema(schemaUpdateCallback, typeResolver, hypertable)
+	}
+
+	if table, present := s.systemCatalog.FindVanillaTableById(msg.RelationID); present {
+		if relationMatchesColumns(msg, table.Columns()) {
+			return nil
 		}
+		return s.systemCatalog.sideChannel.ReadVanillaTableSchema(schemaUpdateCallback, typeResolver, table)
 	}
 	return nil
 }
@@ -0,0 +1,219 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package systemcatalog
+
+import (
+	"bytes"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/encoding"
+	"github.com/noctarius/timescaledb-event-streamer/spi/eventhandlers"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/noctarius/timescaledb-event-streamer/spi/sidechannel"
+	"github.com/noctarius/timescaledb-event-streamer/spi/systemcatalog"
+	"github.com/noctarius/timescaledb-event-streamer/spi/task"
+)
+
+const esSchemaVersions = "::schema::versions"
+
+type columnsProvider interface {
+	Columns() systemcatalog.Columns
+}
+
+// schemaUpdateWithChangeEvents returns a schema update callback which, in
+// addition to applying the new table schema, notifies the schema change
+// handlers about changes to a previously known table schema.
+func (sc *systemCatalog) schemaUpdateWithChangeEvents(
+	xld pgtypes.XLogData,
+) sidechannel.TableSchemaCallback {
+
+	return func(table systemcatalog.SystemEntity, columns []systemcatalog.Column) error {
+		var oldColumns []systemcatalog.Column
+		if provider, ok := table.(columnsProvider); ok {
+			oldColumns = provider.Columns()
+		}
+
+		if err := sc.ApplySchemaUpdate(table, columns); err != nil {
+			return err
+		}
+
+		// No previously known schema, nothing to report
+		if len(oldColumns) == 0 {
+			return nil
+		}
+
+		statements := systemcatalog.SchemaChangeStatements(table, oldColumns, columns)
+		if len(statements) == 0 {
+			return nil
+		}
+
+		tableAlike, ok := table.(schema.TableAlike)
+		if !ok {
+			return nil
+		}
+
+		version, err := sc.nextSchemaVersion(table)
+		if err != nil {
+			return err
+		}
+
+		sc.logger.Infof("Schema of %s changed (version %d): %+v", table.CanonicalName(), version, statements)
+
+		// Schema change events need to be handled before any further event of
+		// the table is processed, therefore the handlers are notified immediately
+		return sc.taskManager.RunTask(func(notificator task.Notificator) {
+			notificator.NotifySchemaChangeEventHandler(
+				func(handler eventhandlers.SchemaChangeEventHandler) error {
+					return handler.OnSchemaChangedEvent(xld, tableAlike, version, oldColumns, columns, statements)
+				},
+			)
+		})
+	}
+}
+
+// nextSchemaVersion increments and returns the schema version of the
+// given table. Schema versions are stored in the state storage to keep
+// them stable across restarts.
+func (sc *systemCatalog) nextSchemaVersion(
+	table systemcatalog.SystemEntity,
+) (uint32, error) {
+
+	if sc.schemaVersions == nil {
+		schemaVersions, err := sc.readSchemaVersions()
+		if err != nil {
+			return 0, err
+		}
+		sc.schemaVersions = schemaVersions
+	}
+
+	// Initial schema is version 1
+	version, present := sc.schemaVersions[table.CanonicalName()]
+	if !present {
+		version = 1
+	}
+	version++
+	sc.schemaVersions[table.CanonicalName()] = version
+
+	state, err := encodeSchemaVersions(sc.schemaVersions)
+	if err != nil {
+		return 0, err
+	}
+	sc.stateStorageManager.SetEncodedState(esSchemaVersions, state)
+	return version, nil
+}
+
+func (sc *systemCatalog) readSchemaVersions() (map[string]uint32, error) {
+	state, present := sc.stateStorageManager.EncodedState(esSchemaVersions)
+	if !present {
+		return make(map[string]uint32), nil
+	}
+	return decodeSchemaVersions(state)
+}
+
+// relationMatchesColumns returns true if the relation message's columns
+// (names, types and type modifiers) match the known columns. Chunks may
+// order their columns differently from the parent hypertable, therefore
+// columns are matched by name.
+func relationMatchesColumns(
+	msg *pgtypes.RelationMessage, columns []systemcatalog.Column,
+) bool {
+
+	if len(msg.Columns) != len(columns) {
+		return false
+	}
+
+	knownColumns := make(map[string]systemcatalog.Column, len(columns))
+	for _, column := range columns {
+		knownColumns[column.Name()] = column
+	}
+
+	for _, column := range msg.Columns {
+		knownColumn, present := knownColumns[column.Name]
+		if !present ||
+			column.DataType != knownColumn.DataType() ||
+			int(column.TypeModifier) != knownColumn.Modifiers() {
+
+			return false
+		}
+	}
+	return true
+}
+
+// ReadSchemaVersions decodes the schema versions of all
+// tables, keyed by their canonical name, from the given state
+func ReadSchemaVersions(
+	encodedState func(name string) ([]byte, bool),
+) (schemaVersions map[string]uint32, present bool, err error) {
+
+	state, present := encodedState(esSchemaVersions)
+	if !present {
+		return nil, false, nil
+	}
+
+	schemaVersions, err = decodeSchemaVersions(state)
+	if err != nil {
+		return nil, false, err
+	}
+	return schemaVersions, true, nil
+}
+
+func decodeSchemaVersions(
+	data []byte,
+) (map[string]uint32, error) {
+
+	buffer := encoding.NewReadBuffer(bytes.NewBuffer(data))
+
+	numOfTables, err := buffer.ReadUint32()
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	schemaVersions := make(map[string]uint32, numOfTables)
+	for i := 0; i < int(numOfTables); i++ {
+		canonicalName, err := buffer.ReadString()
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		version, err := buffer.ReadUint32()
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		schemaVersions[canonicalName] = version
+	}
+	return schemaVersions, nil
+}
+
+func encodeSchemaVersions(
+	schemaVersions map[string]uint32,
+) ([]byte, error) {
+
+	buffer := encoding.NewWriteBuffer(1024)
+
+	if err := buffer.PutUint32(uint32(len(schemaVersions))); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	for canonicalName, version := range schemaVersions {
+		if err := buffer.PutString(canonicalName); err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		if err := buffer.PutUint32(version); err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+	}
+	return buffer.Bytes(), nil
+}
@@ -50,6 +50,7 @@ type systemCatalog struct {
 	hypertable2chunks     map[int32][]int32
 	hypertable2compressed map[int32]int32
 	compressed2hypertable map[int32]int32
+	schemaVersions        map[string]uint32
 
 	username string
 
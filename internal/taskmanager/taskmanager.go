@@ -38,6 +38,7 @@ type taskManager struct {
 	recordHandlers      []eventhandlers.RecordReplicationEventHandler
 	logicalHandlers     []eventhandlers.LogicalReplicationEventHandler
 	snapshotHandlers    []eventhandlers.SnapshottingEventHandler
+	schemaHandlers      []eventhandlers.SchemaChangeEventHandler
 	shutdownAwaiter     *waiting.ShutdownAwaiter
 	shutdownActive      bool
 }
@@ -64,6 +65,7 @@ func NewTaskManager(
 		recordHandlers:      make([]eventhandlers.RecordReplicationEventHandler, 0),
 		logicalHandlers:     make([]eventhandlers.LogicalReplicationEventHandler, 0),
 		snapshotHandlers:    make([]eventhandlers.SnapshottingEventHandler, 0),
+		schemaHandlers:      make([]eventhandlers.SchemaChangeEventHandler, 0),
 		shutdownAwaiter:     waiting.NewShutdownAwaiter(),
 	}
 	return d, nil
@@ -124,6 +126,15 @@ func (d *taskManager) RegisterReplicationEventHandler(
 		}
 		d.snapshotHandlers = append(d.snapshotHandlers, h)
 	}
+
+	if h, ok := handler.(eventhandlers.SchemaChangeEventHandler); ok {
+		for _, candidate := range d.schemaHandlers {
+			if candidate == h {
+				return
+			}
+		}
+		d.schemaHandlers = append(d.schemaHandlers, h)
+	}
 }
 
 func (d *taskManager) UnregisterReplicationEventHandler(
@@ -187,6 +198,16 @@ func (d *taskManager) UnregisterReplicationEventHandler(
 			}
 		}
 	}
+
+	if h, ok := handler.(eventhandlers.SchemaChangeEventHandler); ok {
+		for index, candidate := range d.schemaHandlers {
+			if candidate == h {
+				// Erase element (zero value) to prevent memory leak
+				d.schemaHandlers[index] = nil
+				d.schemaHandlers = append(d.schemaHandlers[:index], d.schemaHandlers[index+1:]...)
+			}
+		}
+	}
 }
 
 func (d *taskManager) StartDispatcher() {
@@ -324,6 +345,17 @@ func (n *notificator) NotifySnapshottingEventHandler(
 	}
 }
 
+func (n *notificator) NotifySchemaChangeEventHandler(
+	fn func(handler eventhandlers.SchemaChangeEventHandler) error,
+) {
+
+	for _, handler := range n.dispatcher.schemaHandlers {
+		if err := fn(handler); err != nil {
+			n.handleError(err)
+		}
+	}
+}
+
 func (n *notificator) handleError(
 	err error,
 ) {
@@ -407,6 +439,17 @@ func (n *immediateNotificator) NotifySnapshottingEventHandler(
 	}
 }
 
+func (n *immediateNotificator) NotifySchemaChangeEventHandler(
+	fn func(handler eventhandlers.SchemaChangeEventHandler) error,
+) {
+
+	for _, handler := range n.dispatcher.schemaHandlers {
+		if err := fn(handler); err != nil {
+			n.handleError(err)
+		}
+	}
+}
+
 func (n *immediateNotificator) handleError(
 	err error,
 ) {
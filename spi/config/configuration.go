@@ -28,8 +28,11 @@ import (
 type StateStorageType string
 
 const (
-	NoneStorage StateStorageType = "none"
-	FileStorage StateStorageType = "file"
+	NoneStorage       StateStorageType = "none"
+	FileStorage       StateStorageType = "file"
+	PostgresqlStorage StateStorageType = "postgresql"
+	RedisStorage      StateStorageType = "redis"
+	HttpStorage       StateStorageType = "http"
 )
 
 type SinkType string
@@ -41,6 +44,23 @@ const (
 	Redis      SinkType = "redis"
 	AwsKinesis SinkType = "kinesis"
 	AwsSQS     SinkType = "sqs"
+	Http       SinkType = "http"
+	Postgresql SinkType = "postgresql"
+	File       SinkType = "file"
+	Parquet    SinkType = "parquet"
+	AMQP       SinkType = "amqp"
+	MQTT       SinkType = "mqtt"
+	Pulsar     SinkType = "pulsar"
+	Grpc       SinkType = "grpc"
+	LiveFeed   SinkType = "livefeed"
+)
+
+type EncodingType string
+
+const (
+	JsonEncoding     EncodingType = "json"
+	AvroEncoding     EncodingType = "avro"
+	ProtobufEncoding EncodingType = "protobuf"
 )
 
 type NamingStrategyType string
@@ -57,6 +77,105 @@ const (
 	Jwt         NatsAuthorizationType = "jwt"
 )
 
+type NatsMode string
+
+const (
+	NatsJetStream NatsMode = "jetstream"
+	NatsCore      NatsMode = "core"
+)
+
+type NatsRetentionType string
+
+const (
+	NatsRetentionLimits    NatsRetentionType = "limits"
+	NatsRetentionInterest  NatsRetentionType = "interest"
+	NatsRetentionWorkQueue NatsRetentionType = "workqueue"
+)
+
+type RedisMode string
+
+const (
+	RedisStream RedisMode = "stream"
+	RedisPubSub RedisMode = "pubsub"
+	RedisHash   RedisMode = "hash"
+)
+
+type MqttVersion string
+
+const (
+	Mqtt311 MqttVersion = "3.1.1"
+	Mqtt5   MqttVersion = "5"
+)
+
+type KafkaCompressionType string
+
+const (
+	KafkaCompressionNone   KafkaCompressionType = "none"
+	KafkaCompressionGzip   KafkaCompressionType = "gzip"
+	KafkaCompressionSnappy KafkaCompressionType = "snappy"
+	KafkaCompressionLz4    KafkaCompressionType = "lz4"
+	KafkaCompressionZstd   KafkaCompressionType = "zstd"
+)
+
+type KafkaAcksType string
+
+const (
+	KafkaAcksNone  KafkaAcksType = "none"
+	KafkaAcksLocal KafkaAcksType = "local"
+	KafkaAcksAll   KafkaAcksType = "all"
+)
+
+type KafkaPartitionerType string
+
+const (
+	KafkaPartitionerHash       KafkaPartitionerType = "hash"
+	KafkaPartitionerHypertable KafkaPartitionerType = "hypertable"
+	KafkaPartitionerExpression KafkaPartitionerType = "expression"
+)
+
+type HttpAuthenticationType string
+
+const (
+	HttpAuthenticationNone   HttpAuthenticationType = "none"
+	HttpAuthenticationBasic  HttpAuthenticationType = "basic"
+	HttpAuthenticationBearer HttpAuthenticationType = "bearer"
+	HttpAuthenticationHmac   HttpAuthenticationType = "hmac"
+)
+
+type FileCompressionType string
+
+const (
+	FileCompressionNone FileCompressionType = "none"
+	FileCompressionGzip FileCompressionType = "gzip"
+	FileCompressionZstd FileCompressionType = "zstd"
+)
+
+type ParquetCompressionType string
+
+const (
+	ParquetCompressionNone   ParquetCompressionType = "none"
+	ParquetCompressionSnappy ParquetCompressionType = "snappy"
+	ParquetCompressionGzip   ParquetCompressionType = "gzip"
+	ParquetCompressionZstd   ParquetCompressionType = "zstd"
+)
+
+type PartitioningStrategy string
+
+const (
+	TopicPartitioning      PartitioningStrategy = "topic"
+	KeyPartitioning        PartitioningStrategy = "key"
+	ColumnPartitioning     PartitioningStrategy = "column"
+	ExpressionPartitioning PartitioningStrategy = "expression"
+)
+
+type OversizeStrategy string
+
+const (
+	OversizeFail       OversizeStrategy = "fail"
+	OversizeDeadLetter OversizeStrategy = "deadletter"
+	OversizeOffload    OversizeStrategy = "offload"
+)
+
 type InitialSnapshotMode string
 
 const (
@@ -121,7 +240,8 @@ type ReplicationSlotConfig struct {
 }
 
 type TransactionConfig struct {
-	Window TransactionWindowConfig `toml:"window" yaml:"window"`
+	Window    TransactionWindowConfig    `toml:"window" yaml:"window"`
+	Streaming TransactionStreamingConfig `toml:"streaming" yaml:"streaming"`
 }
 
 type TransactionWindowConfig struct {
@@ -130,15 +250,63 @@ type TransactionWindowConfig struct {
 	MaxSize uint  `toml:"maxsize" yaml:"maxSize"`
 }
 
+type TransactionStreamingConfig struct {
+	Enabled        *bool  `toml:"enabled" yaml:"enabled"`
+	MaxMemory      int    `toml:"maxmemory" yaml:"maxMemory"`
+	SpillDirectory string `toml:"spilldirectory" yaml:"spillDirectory"`
+}
+
 type SinkConfig struct {
 	Type       SinkType                     `toml:"type" yaml:"type"`
 	Tombstone  *bool                        `toml:"tombstone" yaml:"tombstone"`
 	Filters    map[string]EventFilterConfig `toml:"filters" yaml:"filters"`
+	Encoding   SinkEncodingConfig           `toml:"encoding" yaml:"encoding"`
 	Nats       NatsConfig                   `toml:"nats" yaml:"nats"`
 	Kafka      KafkaConfig                  `toml:"kafka" yaml:"kafka"`
 	Redis      RedisConfig                  `toml:"redis" yaml:"redis"`
 	AwsKinesis AwsKinesisConfig             `toml:"kinesis" yaml:"kinesis"`
 	AwsSqs     AwsSqsConfig                 `toml:"sqs" yaml:"sqs"`
+	Http       HttpConfig                   `toml:"http" yaml:"http"`
+	Postgresql PostgresqlSinkConfig         `toml:"postgresql" yaml:"postgresql"`
+	File       FileSinkConfig               `toml:"file" yaml:"file"`
+	Parquet    ParquetSinkConfig            `toml:"parquet" yaml:"parquet"`
+	Amqp       AmqpConfig                   `toml:"amqp" yaml:"amqp"`
+	Mqtt       MqttConfig                   `toml:"mqtt" yaml:"mqtt"`
+	Pulsar     PulsarConfig                 `toml:"pulsar" yaml:"pulsar"`
+	Grpc       GrpcSinkConfig               `toml:"grpc" yaml:"grpc"`
+	LiveFeed   LiveFeedSinkConfig           `toml:"livefeed" yaml:"liveFeed"`
+	Sinks      map[string]NamedSinkConfig   `toml:"sinks" yaml:"sinks"`
+}
+
+// NamedSinkConfig configures one of multiple sinks receiving events at
+// the same time. Besides the sink specific settings, which are the same
+// as for a single sink, events can be restricted to certain tables and
+// topic names can use a different prefix.
+type NamedSinkConfig struct {
+	SinkConfig `yaml:",inline"`
+	Tables     IncludedTablesConfig `toml:"tables" yaml:"tables"`
+	Topic      NamedSinkTopicConfig `toml:"topic" yaml:"topic"`
+}
+
+type NamedSinkTopicConfig struct {
+	Prefix string `toml:"prefix" yaml:"prefix"`
+}
+
+type SinkEncodingConfig struct {
+	Type EncodingType       `toml:"type" yaml:"type"`
+	Avro AvroEncodingConfig `toml:"avro" yaml:"avro"`
+}
+
+type AvroEncodingConfig struct {
+	SchemaRegistry SchemaRegistryConfig `toml:"schemaregistry" yaml:"schemaRegistry"`
+}
+
+type SchemaRegistryConfig struct {
+	Url      string    `toml:"url" yaml:"url"`
+	Username string    `toml:"username" yaml:"username"`
+	Password string    `toml:"password" yaml:"password"`
+	Timeout  int       `toml:"timeout" yaml:"timeout"`
+	TLS      TLSConfig `toml:"tls" yaml:"tls"`
 }
 
 type EventFilterConfig struct {
@@ -172,12 +340,105 @@ type NatsJWTConfig struct {
 	Seed string `toml:"seed" yaml:"Seed"`
 }
 
+type NatsStreamConfig struct {
+	Create     *bool             `toml:"create" yaml:"create"`
+	Name       string            `toml:"name" yaml:"name"`
+	Subjects   []string          `toml:"subjects" yaml:"subjects"`
+	Retention  NatsRetentionType `toml:"retention" yaml:"retention"`
+	Replicas   int               `toml:"replicas" yaml:"replicas"`
+	MaxAge     int               `toml:"maxage" yaml:"maxAge"`
+	Duplicates int               `toml:"duplicates" yaml:"duplicates"`
+}
+
 type NatsConfig struct {
 	Address       string                `toml:"address" yaml:"address"`
 	Authorization NatsAuthorizationType `toml:"authorization" yaml:"authorization"`
 	UserInfo      NatsUserInfoConfig    `toml:"userinfo" yaml:"userInfo"`
 	Credentials   NatsCredentialsConfig `toml:"credentials" yaml:"credentials"`
 	JWT           NatsJWTConfig         `toml:"jwt" yaml:"jwt"`
+	Mode          NatsMode              `toml:"mode" yaml:"mode"`
+	Stream        NatsStreamConfig      `toml:"stream" yaml:"stream"`
+}
+
+type AmqpConfig struct {
+	Address    string             `toml:"address" yaml:"address"`
+	Exchange   AmqpExchangeConfig `toml:"exchange" yaml:"exchange"`
+	Persistent *bool              `toml:"persistent" yaml:"persistent"`
+	TLS        TLSConfig          `toml:"tls" yaml:"tls"`
+}
+
+type AmqpExchangeConfig struct {
+	Name    string `toml:"name" yaml:"name"`
+	Type    string `toml:"type" yaml:"type"`
+	Declare bool   `toml:"declare" yaml:"declare"`
+	Durable *bool  `toml:"durable" yaml:"durable"`
+}
+
+type MqttConfig struct {
+	Address   string          `toml:"address" yaml:"address"`
+	Version   MqttVersion     `toml:"version" yaml:"version"`
+	ClientId  string          `toml:"clientid" yaml:"clientId"`
+	Username  string          `toml:"username" yaml:"username"`
+	Password  string          `toml:"password" yaml:"password"`
+	KeepAlive int             `toml:"keepalive" yaml:"keepAlive"`
+	QoS       *int            `toml:"qos" yaml:"qos"`
+	Retained  bool            `toml:"retained" yaml:"retained"`
+	Topic     MqttTopicConfig `toml:"topic" yaml:"topic"`
+	TLS       TLSConfig       `toml:"tls" yaml:"tls"`
+}
+
+type MqttTopicConfig struct {
+	Key *bool `toml:"key" yaml:"key"`
+}
+
+type PulsarConfig struct {
+	Url           string            `toml:"url" yaml:"url"`
+	Token         string            `toml:"token" yaml:"token"`
+	Tenant        string            `toml:"tenant" yaml:"tenant"`
+	Namespace     string            `toml:"namespace" yaml:"namespace"`
+	ProducerName  string            `toml:"producername" yaml:"producerName"`
+	Deduplication *bool             `toml:"deduplication" yaml:"deduplication"`
+	Batch         PulsarBatchConfig `toml:"batch" yaml:"batch"`
+	TLS           PulsarTLSConfig   `toml:"tls" yaml:"tls"`
+}
+
+type PulsarBatchConfig struct {
+	Enabled *bool `toml:"enabled" yaml:"enabled"`
+	Size    uint  `toml:"size" yaml:"size"`
+	Bytes   uint  `toml:"bytes" yaml:"bytes"`
+	Linger  int   `toml:"linger" yaml:"linger"`
+}
+
+type PulsarTLSConfig struct {
+	SkipVerify     bool   `toml:"skipverify" yaml:"skipVerify"`
+	TrustCertsFile string `toml:"trustcertsfile" yaml:"trustCertsFile"`
+}
+
+type GrpcSinkConfig struct {
+	Address string           `toml:"address" yaml:"address"`
+	Buffer  GrpcBufferConfig `toml:"buffer" yaml:"buffer"`
+	TLS     GrpcTLSConfig    `toml:"tls" yaml:"tls"`
+}
+
+type GrpcBufferConfig struct {
+	Size int `toml:"size" yaml:"size"`
+}
+
+type GrpcTLSConfig struct {
+	CertFile string `toml:"certfile" yaml:"certFile"`
+	KeyFile  string `toml:"keyfile" yaml:"keyFile"`
+}
+
+type LiveFeedSinkConfig struct {
+	Address        string              `toml:"address" yaml:"address"`
+	Paths          LiveFeedPathsConfig `toml:"paths" yaml:"paths"`
+	AllowedOrigins []string            `toml:"allowedorigins" yaml:"allowedOrigins"`
+	Buffer         int                 `toml:"buffer" yaml:"buffer"`
+}
+
+type LiveFeedPathsConfig struct {
+	WebSocket string `toml:"websocket" yaml:"webSocket"`
+	Sse       string `toml:"sse" yaml:"sse"`
 }
 
 type KafkaSaslConfig struct {
@@ -187,11 +448,44 @@ type KafkaSaslConfig struct {
 	Mechanism sarama.SASLMechanism `toml:"mechanism" yaml:"mechanism"`
 }
 
+type KafkaBatchConfig struct {
+	Size   int `toml:"size" yaml:"size"`
+	Bytes  int `toml:"bytes" yaml:"bytes"`
+	Linger int `toml:"linger" yaml:"linger"`
+}
+
+type KafkaPartitionerConfig struct {
+	Type       KafkaPartitionerType `toml:"type" yaml:"type"`
+	Expression string               `toml:"expression" yaml:"expression"`
+}
+
+type KafkaHeadersConfig struct {
+	Static map[string]string `toml:"static" yaml:"static"`
+	Event  *bool             `toml:"event" yaml:"event"`
+}
+
+type KafkaTransactionConfig struct {
+	Enabled      *bool  `toml:"enabled" yaml:"enabled"`
+	Id           string `toml:"id" yaml:"id"`
+	OffsetsTopic string `toml:"offsetstopic" yaml:"offsetsTopic"`
+	Timeout      int    `toml:"timeout" yaml:"timeout"`
+}
+
 type KafkaConfig struct {
-	Brokers    []string        `toml:"brokers" yaml:"brokers"`
-	Idempotent *bool           `toml:"idempotent" yaml:"idempotent"`
-	Sasl       KafkaSaslConfig `toml:"sasl" yaml:"sasl"`
-	TLS        TLSConfig       `toml:"tls" yaml:"tls"`
+	Brokers         []string               `toml:"brokers" yaml:"brokers"`
+	ClientId        string                 `toml:"clientid" yaml:"clientId"`
+	Idempotent      *bool                  `toml:"idempotent" yaml:"idempotent"`
+	Acks            KafkaAcksType          `toml:"acks" yaml:"acks"`
+	Retries         *int                   `toml:"retries" yaml:"retries"`
+	MaxMessageBytes int                    `toml:"maxmessagebytes" yaml:"maxMessageBytes"`
+	Async           *bool                  `toml:"async" yaml:"async"`
+	Compression     KafkaCompressionType   `toml:"compression" yaml:"compression"`
+	Batch           KafkaBatchConfig       `toml:"batch" yaml:"batch"`
+	Partitioner     KafkaPartitionerConfig `toml:"partitioner" yaml:"partitioner"`
+	Headers         KafkaHeadersConfig     `toml:"headers" yaml:"headers"`
+	Transaction     KafkaTransactionConfig `toml:"transaction" yaml:"transaction"`
+	Sasl            KafkaSaslConfig        `toml:"sasl" yaml:"sasl"`
+	TLS             TLSConfig              `toml:"tls" yaml:"tls"`
 }
 
 type RedisConfig struct {
@@ -203,6 +497,14 @@ type RedisConfig struct {
 	Timeouts RedisTimeoutConfig `toml:"timeouts" yaml:"timeouts"`
 	PoolSize int                `toml:"poolsize" yaml:"poolSize"`
 	TLS      TLSConfig          `toml:"tls" yaml:"tls"`
+	Mode     RedisMode          `toml:"mode" yaml:"mode"`
+	Stream   RedisStreamConfig  `toml:"stream" yaml:"stream"`
+}
+
+type RedisStreamConfig struct {
+	MaxLen      int64 `toml:"maxlen" yaml:"maxLen"`
+	MaxAge      int64 `toml:"maxage" yaml:"maxAge"`
+	Approximate *bool `toml:"approximate" yaml:"approximate"`
 }
 
 type RedisRetryConfig struct {
@@ -223,6 +525,90 @@ type RedisTimeoutConfig struct {
 	Idle  int `toml:"idle" yaml:"idle"`
 }
 
+type HttpBasicAuthenticationConfig struct {
+	Username string `toml:"username" yaml:"username"`
+	Password string `toml:"password" yaml:"password"`
+}
+
+type HttpBearerAuthenticationConfig struct {
+	Token string `toml:"token" yaml:"token"`
+}
+
+type HttpHmacAuthenticationConfig struct {
+	Secret string `toml:"secret" yaml:"secret"`
+	Header string `toml:"header" yaml:"header"`
+}
+
+type HttpAuthenticationConfig struct {
+	Type   HttpAuthenticationType         `toml:"type" yaml:"type"`
+	Basic  HttpBasicAuthenticationConfig  `toml:"basic" yaml:"basic"`
+	Bearer HttpBearerAuthenticationConfig `toml:"bearer" yaml:"bearer"`
+	Hmac   HttpHmacAuthenticationConfig   `toml:"hmac" yaml:"hmac"`
+}
+
+type HttpBatchConfig struct {
+	Size   int `toml:"size" yaml:"size"`
+	Bytes  int `toml:"bytes" yaml:"bytes"`
+	Linger int `toml:"linger" yaml:"linger"`
+}
+
+type HttpRetryConfig struct {
+	MaxAttempts int                    `toml:"maxattempts" yaml:"maxAttempts"`
+	Backoff     HttpRetryBackoffConfig `toml:"backoff" yaml:"backoff"`
+	StatusCodes []int                  `toml:"statuscodes" yaml:"statusCodes"`
+}
+
+type HttpRetryBackoffConfig struct {
+	Min int `toml:"min" yaml:"min"`
+	Max int `toml:"max" yaml:"max"`
+}
+
+type HttpConfig struct {
+	Url            string                   `toml:"url" yaml:"url"`
+	Headers        map[string]string        `toml:"headers" yaml:"headers"`
+	Timeout        int                      `toml:"timeout" yaml:"timeout"`
+	Authentication HttpAuthenticationConfig `toml:"authentication" yaml:"authentication"`
+	Batch          HttpBatchConfig          `toml:"batch" yaml:"batch"`
+	Retries        HttpRetryConfig          `toml:"retries" yaml:"retries"`
+	TLS            TLSConfig                `toml:"tls" yaml:"tls"`
+}
+
+type PostgresqlSinkConfig struct {
+	Connection string `toml:"connection" yaml:"connection"`
+	Password   string `toml:"password" yaml:"password"`
+	AutoCreate *bool  `toml:"autocreate" yaml:"autoCreate"`
+}
+
+type FileSinkConfig struct {
+	Path        string              `toml:"path" yaml:"path"`
+	MaxSize     *string             `toml:"maxsize" yaml:"maxSize"`
+	MaxDuration *int                `toml:"maxduration" yaml:"maxDuration"`
+	Compression FileCompressionType `toml:"compression" yaml:"compression"`
+}
+
+type ParquetBufferConfig struct {
+	Size     int `toml:"size" yaml:"size"`
+	Interval int `toml:"interval" yaml:"interval"`
+}
+
+type ParquetPartitionConfig struct {
+	Bucket        string `toml:"bucket" yaml:"bucket"`
+	IntegerBucket int64  `toml:"integerbucket" yaml:"integerBucket"`
+}
+
+type S3Config struct {
+	Bucket string              `toml:"bucket" yaml:"bucket"`
+	Aws    AwsConnectionConfig `toml:"aws" yaml:"aws"`
+}
+
+type ParquetSinkConfig struct {
+	Path        string                 `toml:"path" yaml:"path"`
+	Compression ParquetCompressionType `toml:"compression" yaml:"compression"`
+	Buffer      ParquetBufferConfig    `toml:"buffer" yaml:"buffer"`
+	Partition   ParquetPartitionConfig `toml:"partition" yaml:"partition"`
+	S3          S3Config               `toml:"s3" yaml:"s3"`
+}
+
 type TopicNamingStrategyConfig struct {
 	Type NamingStrategyType `toml:"type" yaml:"type"`
 }
@@ -247,6 +633,7 @@ type TimescaleEventsConfig struct {
 	Message       *bool `toml:"message" yaml:"message"` // deprecated
 	Compression   *bool `toml:"compression" yaml:"compression"`
 	Decompression *bool `toml:"decompression" yaml:"decompression"`
+	Schema        *bool `toml:"schema" yaml:"schema"`
 }
 
 type PostgresqlEventsConfig struct {
@@ -256,11 +643,16 @@ type PostgresqlEventsConfig struct {
 	Delete   *bool `toml:"delete" yaml:"delete"`
 	Truncate *bool `toml:"truncate" yaml:"truncate"`
 	Message  *bool `toml:"message" yaml:"message"`
+	Schema   *bool `toml:"schema" yaml:"schema"`
 }
 
 type AwsKinesisConfig struct {
-	Stream AwsKinesisStreamConfig `toml:"stream" yaml:"stream"`
-	Aws    AwsConnectionConfig    `toml:"aws" yaml:"aws"`
+	Stream       AwsKinesisStreamConfig `toml:"stream" yaml:"stream"`
+	Partitioning PartitioningConfig     `toml:"partitioning" yaml:"partitioning"`
+	Batch        AwsBatchConfig         `toml:"batch" yaml:"batch"`
+	Retries      AwsRetryConfig         `toml:"retries" yaml:"retries"`
+	Oversize     AwsOversizeConfig      `toml:"oversize" yaml:"oversize"`
+	Aws          AwsConnectionConfig    `toml:"aws" yaml:"aws"`
 }
 
 type AwsKinesisStreamConfig struct {
@@ -271,14 +663,45 @@ type AwsKinesisStreamConfig struct {
 }
 
 type AwsSqsConfig struct {
-	Queue AwsSqsQueueConfig   `toml:"queue" yaml:"queue"`
-	Aws   AwsConnectionConfig `toml:"aws" yaml:"aws"`
+	Queue        AwsSqsQueueConfig   `toml:"queue" yaml:"queue"`
+	Partitioning PartitioningConfig  `toml:"partitioning" yaml:"partitioning"`
+	Batch        AwsBatchConfig      `toml:"batch" yaml:"batch"`
+	Retries      AwsRetryConfig      `toml:"retries" yaml:"retries"`
+	Oversize     AwsOversizeConfig   `toml:"oversize" yaml:"oversize"`
+	Aws          AwsConnectionConfig `toml:"aws" yaml:"aws"`
 }
 
 type AwsSqsQueueConfig struct {
 	Url *string `toml:"url" yaml:"url"`
 }
 
+type PartitioningConfig struct {
+	Strategy   PartitioningStrategy `toml:"strategy" yaml:"strategy"`
+	Columns    []string             `toml:"columns" yaml:"columns"`
+	Expression string               `toml:"expression" yaml:"expression"`
+}
+
+type AwsBatchConfig struct {
+	Size   int `toml:"size" yaml:"size"`
+	Linger int `toml:"linger" yaml:"linger"`
+}
+
+type AwsRetryConfig struct {
+	MaxAttempts int                   `toml:"maxattempts" yaml:"maxAttempts"`
+	Backoff     AwsRetryBackoffConfig `toml:"backoff" yaml:"backoff"`
+}
+
+type AwsRetryBackoffConfig struct {
+	Min int `toml:"min" yaml:"min"`
+	Max int `toml:"max" yaml:"max"`
+}
+
+type AwsOversizeConfig struct {
+	Strategy OversizeStrategy `toml:"strategy" yaml:"strategy"`
+	Path     string           `toml:"path" yaml:"path"`
+	S3       S3Config         `toml:"s3" yaml:"s3"`
+}
+
 type AwsConnectionConfig struct {
 	Region          *string `toml:"region" yaml:"region"`
 	Endpoint        string  `toml:"endpoint" yaml:"endpoint"`
@@ -300,12 +723,47 @@ type Config struct {
 }
 
 type StateStorageConfig struct {
-	Type        StateStorageType  `toml:"type" yaml:"type"`
-	FileStorage FileStorageConfig `toml:"file" yaml:"file"`
+	Type              StateStorageType        `toml:"type" yaml:"type"`
+	FileStorage       FileStorageConfig       `toml:"file" yaml:"file"`
+	PostgresqlStorage PostgresqlStorageConfig `toml:"postgresql" yaml:"postgresql"`
+	RedisStorage      RedisStorageConfig      `toml:"redis" yaml:"redis"`
+	HttpStorage       HttpStorageConfig       `toml:"http" yaml:"http"`
 }
 
 type FileStorageConfig struct {
-	Path string `toml:"path" yaml:"path"`
+	Path        string `toml:"path" yaml:"path"`
+	Generations *int   `toml:"generations" yaml:"generations"`
+}
+
+type PostgresqlStorageConfig struct {
+	Connection string `toml:"connection" yaml:"connection"`
+	Password   string `toml:"password" yaml:"password"`
+	Table      string `toml:"table" yaml:"table"`
+	Id         string `toml:"id" yaml:"id"`
+	Interval   int    `toml:"interval" yaml:"interval"`
+}
+
+type RedisStorageConfig struct {
+	Address  string `toml:"address" yaml:"address"`
+	Password string `toml:"password" yaml:"password"`
+	Database int    `toml:"database" yaml:"database"`
+	Key      string `toml:"key" yaml:"key"`
+	Interval int    `toml:"interval" yaml:"interval"`
+}
+
+type HttpStorageMode string
+
+const (
+	HttpStorageETag   HttpStorageMode = "etag"
+	HttpStorageConsul HttpStorageMode = "consul"
+)
+
+type HttpStorageConfig struct {
+	Url      string            `toml:"url" yaml:"url"`
+	Mode     HttpStorageMode   `toml:"mode" yaml:"mode"`
+	Headers  map[string]string `toml:"headers" yaml:"headers"`
+	Timeout  int               `toml:"timeout" yaml:"timeout"`
+	Interval int               `toml:"interval" yaml:"interval"`
 }
 
 type LoggerConfig struct {
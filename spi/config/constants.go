@@ -31,15 +31,46 @@ const (
 	PropertyPostgresqlTxwindowEnabled         = "postgresql.transaction.window.enabled"
 	PropertyPostgresqlTxwindowTimeout         = "postgresql.transaction.window.timeout"
 	PropertyPostgresqlTxwindowMaxsize         = "postgresql.transaction.window.maxsize"
+	PropertyPostgresqlStreamingEnabled        = "postgresql.transaction.streaming.enabled"
+	PropertyPostgresqlStreamingMaxMemory      = "postgresql.transaction.streaming.maxmemory"
+	PropertyPostgresqlStreamingSpillDirectory = "postgresql.transaction.streaming.spilldirectory"
 
 	PropertySink          = "sink.type"
 	PropertySinkTombstone = "sink.tombstone"
 
+	PropertyEncodingType                    = "sink.encoding.type"
+	PropertyAvroSchemaRegistryUrl           = "sink.encoding.avro.schemaregistry.url"
+	PropertyAvroSchemaRegistryUsername      = "sink.encoding.avro.schemaregistry.username"
+	PropertyAvroSchemaRegistryPassword      = "sink.encoding.avro.schemaregistry.password"
+	PropertyAvroSchemaRegistryTimeout       = "sink.encoding.avro.schemaregistry.timeout"
+	PropertyAvroSchemaRegistryTlsEnabled    = "sink.encoding.avro.schemaregistry.tls.enabled"
+	PropertyAvroSchemaRegistryTlsSkipVerify = "sink.encoding.avro.schemaregistry.tls.skipverify"
+	PropertyAvroSchemaRegistryTlsClientAuth = "sink.encoding.avro.schemaregistry.tls.clientauth"
+
 	PropertyStatsEnabled        = "stats.enabled"
 	PropertyRuntimeStatsEnabled = "stats.runtime.enabled"
 
-	PropertyStateStorageType     = "statestorage.type"
-	PropertyFileStateStoragePath = "statestorage.file.path"
+	PropertyStateStorageType            = "statestorage.type"
+	PropertyFileStateStoragePath        = "statestorage.file.path"
+	PropertyFileStateStorageGenerations = "statestorage.file.generations"
+
+	PropertyPostgresqlStateStorageConnection = "statestorage.postgresql.connection"
+	PropertyPostgresqlStateStoragePassword   = "statestorage.postgresql.password"
+	PropertyPostgresqlStateStorageTable      = "statestorage.postgresql.table"
+	PropertyPostgresqlStateStorageId         = "statestorage.postgresql.id"
+	PropertyPostgresqlStateStorageInterval   = "statestorage.postgresql.interval"
+
+	PropertyRedisStateStorageAddress  = "statestorage.redis.address"
+	PropertyRedisStateStoragePassword = "statestorage.redis.password"
+	PropertyRedisStateStorageDatabase = "statestorage.redis.database"
+	PropertyRedisStateStorageKey      = "statestorage.redis.key"
+	PropertyRedisStateStorageInterval = "statestorage.redis.interval"
+
+	PropertyHttpStateStorageUrl      = "statestorage.http.url"
+	PropertyHttpStateStorageMode     = "statestorage.http.mode"
+	PropertyHttpStateStorageHeaders  = "statestorage.http.headers"
+	PropertyHttpStateStorageTimeout  = "statestorage.http.timeout"
+	PropertyHttpStateStorageInterval = "statestorage.http.interval"
 
 	PropertyDispatcherInitialQueueCapacity = "internal.dispatcher.initialqueuecapacity"
 	PropertySnapshotterParallelism         = "internal.snapshotter.parallelism"
@@ -53,6 +84,7 @@ const (
 	PropertyHypertableEventsCompression   = "timescaledb.events.compression"
 	PropertyHypertableEventsDecompression = "timescaledb.events.decompression"
 	PropertyHypertableEventsMessage       = "timescaledb.events.message" // FIXME: deprecated
+	PropertyHypertableEventsSchema        = "timescaledb.events.schema"
 
 	PropertyPostgresqlEventsRead     = "postgresql.events.read"
 	PropertyPostgresqlEventsInsert   = "postgresql.events.insert"
@@ -60,17 +92,36 @@ const (
 	PropertyPostgresqlEventsDelete   = "postgresql.events.delete"
 	PropertyPostgresqlEventsTruncate = "postgresql.events.truncate"
 	PropertyPostgresqlEventsMessage  = "postgresql.events.message"
+	PropertyPostgresqlEventsSchema   = "postgresql.events.schema"
 
 	PropertyNamingStrategy = "topic.namingstrategy.type"
 
-	PropertyKafkaBrokers       = "sink.kafka.brokers"
-	PropertyKafkaSaslEnabled   = "sink.kafka.sasl.enabled"
-	PropertyKafkaSaslUser      = "sink.kafka.sasl.user"
-	PropertyKafkaSaslPassword  = "sink.kafka.sasl.password"
-	PropertyKafkaSaslMechanism = "sink.kafka.sasl.mechanism"
-	PropertyKafkaTlsEnabled    = "sink.kafka.tls.enabled"
-	PropertyKafkaTlsSkipVerify = "sink.kafka.tls.skipverify"
-	PropertyKafkaTlsClientAuth = "sink.kafka.tls.clientauth"
+	PropertyKafkaBrokers               = "sink.kafka.brokers"
+	PropertyKafkaSaslEnabled           = "sink.kafka.sasl.enabled"
+	PropertyKafkaSaslUser              = "sink.kafka.sasl.user"
+	PropertyKafkaSaslPassword          = "sink.kafka.sasl.password"
+	PropertyKafkaSaslMechanism         = "sink.kafka.sasl.mechanism"
+	PropertyKafkaTlsEnabled            = "sink.kafka.tls.enabled"
+	PropertyKafkaTlsSkipVerify         = "sink.kafka.tls.skipverify"
+	PropertyKafkaTlsClientAuth         = "sink.kafka.tls.clientauth"
+	PropertyKafkaIdempotent            = "sink.kafka.idempotent"
+	PropertyKafkaAsync                 = "sink.kafka.async"
+	PropertyKafkaCompression           = "sink.kafka.compression"
+	PropertyKafkaBatchSize             = "sink.kafka.batch.size"
+	PropertyKafkaBatchBytes            = "sink.kafka.batch.bytes"
+	PropertyKafkaBatchLinger           = "sink.kafka.batch.linger"
+	PropertyKafkaClientId              = "sink.kafka.clientid"
+	PropertyKafkaAcks                  = "sink.kafka.acks"
+	PropertyKafkaRetries               = "sink.kafka.retries"
+	PropertyKafkaMaxMessageBytes       = "sink.kafka.maxmessagebytes"
+	PropertyKafkaPartitionerType       = "sink.kafka.partitioner.type"
+	PropertyKafkaPartitionerExpression = "sink.kafka.partitioner.expression"
+	PropertyKafkaHeadersStatic         = "sink.kafka.headers.static"
+	PropertyKafkaHeadersEvent          = "sink.kafka.headers.event"
+	PropertyKafkaTransactionEnabled    = "sink.kafka.transaction.enabled"
+	PropertyKafkaTransactionId         = "sink.kafka.transaction.id"
+	PropertyKafkaTransactionOffsets    = "sink.kafka.transaction.offsetstopic"
+	PropertyKafkaTransactionTimeout    = "sink.kafka.transaction.timeout"
 
 	PropertyNatsAddress                = "sink.nats.address"
 	PropertyNatsAuthorization          = "sink.nats.authorization"
@@ -80,6 +131,14 @@ const (
 	PropertyNatsCredentialsSeeds       = "sink.nats.credentials.seeds"
 	PropertyNatsJwt                    = "sink.nats.jwt.jwt"
 	PropertyNatsJwtSeed                = "sink.nats.jwt.seed"
+	PropertyNatsMode                   = "sink.nats.mode"
+	PropertyNatsStreamCreate           = "sink.nats.stream.create"
+	PropertyNatsStreamName             = "sink.nats.stream.name"
+	PropertyNatsStreamSubjects         = "sink.nats.stream.subjects"
+	PropertyNatsStreamRetention        = "sink.nats.stream.retention"
+	PropertyNatsStreamReplicas         = "sink.nats.stream.replicas"
+	PropertyNatsStreamMaxAge           = "sink.nats.stream.maxage"
+	PropertyNatsStreamDuplicates       = "sink.nats.stream.duplicates"
 
 	PropertyRedisNetwork           = "sink.redis.network"
 	PropertyRedisAddress           = "sink.redis.address"
@@ -96,21 +155,146 @@ const (
 	PropertyRedisTimeoutIdle       = "sink.redis.timeouts.idle"
 	PropertyRedisTlsSkipVerify     = "sink.redis.tls.skipverify"
 	PropertyRedisTlsClientAuth     = "sink.redis.tls.clientauth"
+	PropertyRedisMode              = "sink.redis.mode"
+	PropertyRedisStreamMaxLen      = "sink.redis.stream.maxlen"
+	PropertyRedisStreamMaxAge      = "sink.redis.stream.maxage"
+	PropertyRedisStreamApproximate = "sink.redis.stream.approximate"
+
+	PropertyAmqpAddress         = "sink.amqp.address"
+	PropertyAmqpExchangeName    = "sink.amqp.exchange.name"
+	PropertyAmqpExchangeType    = "sink.amqp.exchange.type"
+	PropertyAmqpExchangeDeclare = "sink.amqp.exchange.declare"
+	PropertyAmqpExchangeDurable = "sink.amqp.exchange.durable"
+	PropertyAmqpPersistent      = "sink.amqp.persistent"
+	PropertyAmqpTlsEnabled      = "sink.amqp.tls.enabled"
+	PropertyAmqpTlsSkipVerify   = "sink.amqp.tls.skipverify"
+	PropertyAmqpTlsClientAuth   = "sink.amqp.tls.clientauth"
+
+	PropertyMqttAddress       = "sink.mqtt.address"
+	PropertyMqttVersion       = "sink.mqtt.version"
+	PropertyMqttClientId      = "sink.mqtt.clientid"
+	PropertyMqttUsername      = "sink.mqtt.username"
+	PropertyMqttPassword      = "sink.mqtt.password"
+	PropertyMqttKeepAlive     = "sink.mqtt.keepalive"
+	PropertyMqttQoS           = "sink.mqtt.qos"
+	PropertyMqttRetained      = "sink.mqtt.retained"
+	PropertyMqttTopicKey      = "sink.mqtt.topic.key"
+	PropertyMqttTlsEnabled    = "sink.mqtt.tls.enabled"
+	PropertyMqttTlsSkipVerify = "sink.mqtt.tls.skipverify"
+	PropertyMqttTlsClientAuth = "sink.mqtt.tls.clientauth"
+
+	PropertyPulsarUrl               = "sink.pulsar.url"
+	PropertyPulsarToken             = "sink.pulsar.token"
+	PropertyPulsarTenant            = "sink.pulsar.tenant"
+	PropertyPulsarNamespace         = "sink.pulsar.namespace"
+	PropertyPulsarProducerName      = "sink.pulsar.producername"
+	PropertyPulsarDeduplication     = "sink.pulsar.deduplication"
+	PropertyPulsarBatchEnabled      = "sink.pulsar.batch.enabled"
+	PropertyPulsarBatchSize         = "sink.pulsar.batch.size"
+	PropertyPulsarBatchBytes        = "sink.pulsar.batch.bytes"
+	PropertyPulsarBatchLinger       = "sink.pulsar.batch.linger"
+	PropertyPulsarTlsSkipVerify     = "sink.pulsar.tls.skipverify"
+	PropertyPulsarTlsTrustCertsFile = "sink.pulsar.tls.trustcertsfile"
+
+	PropertyGrpcAddress     = "sink.grpc.address"
+	PropertyGrpcBufferSize  = "sink.grpc.buffer.size"
+	PropertyGrpcTlsCertFile = "sink.grpc.tls.certfile"
+	PropertyGrpcTlsKeyFile  = "sink.grpc.tls.keyfile"
+
+	PropertyLiveFeedAddress        = "sink.livefeed.address"
+	PropertyLiveFeedPathWebSocket  = "sink.livefeed.paths.websocket"
+	PropertyLiveFeedPathSse        = "sink.livefeed.paths.sse"
+	PropertyLiveFeedAllowedOrigins = "sink.livefeed.allowedorigins"
+	PropertyLiveFeedBuffer         = "sink.livefeed.buffer"
+
+	PropertyKinesisStreamName                   = "sink.kinesis.stream.name"
+	PropertyKinesisStreamCreate                 = "sink.kinesis.stream.create"
+	PropertyKinesisStreamShardCount             = "sink.kinesis.stream.shardcount"
+	PropertyKinesisStreamMode                   = "sink.kinesis.stream.mode"
+	PropertyKinesisPartitioningStrategy         = "sink.kinesis.partitioning.strategy"
+	PropertyKinesisPartitioningColumns          = "sink.kinesis.partitioning.columns"
+	PropertyKinesisPartitioningExpression       = "sink.kinesis.partitioning.expression"
+	PropertyKinesisBatchSize                    = "sink.kinesis.batch.size"
+	PropertyKinesisBatchLinger                  = "sink.kinesis.batch.linger"
+	PropertyKinesisRetriesMax                   = "sink.kinesis.retries.maxattempts"
+	PropertyKinesisRetriesBackoffMin            = "sink.kinesis.retries.backoff.min"
+	PropertyKinesisRetriesBackoffMax            = "sink.kinesis.retries.backoff.max"
+	PropertyKinesisOversizeStrategy             = "sink.kinesis.oversize.strategy"
+	PropertyKinesisOversizePath                 = "sink.kinesis.oversize.path"
+	PropertyKinesisOversizeS3Bucket             = "sink.kinesis.oversize.s3.bucket"
+	PropertyKinesisOversizeS3AwsRegion          = "sink.kinesis.oversize.s3.aws.region"
+	PropertyKinesisOversizeS3AwsEndpoint        = "sink.kinesis.oversize.s3.aws.endpoint"
+	PropertyKinesisOversizeS3AwsAccessKeyId     = "sink.kinesis.oversize.s3.aws.accesskeyid"
+	PropertyKinesisOversizeS3AwsSecretAccessKey = "sink.kinesis.oversize.s3.aws.secretaccesskey"
+	PropertyKinesisOversizeS3AwsSessionToken    = "sink.kinesis.oversize.s3.aws.sessiontoken"
+	PropertyKinesisRegion                       = "sink.kinesis.aws.region"
+	PropertyKinesisAwsEndpoint                  = "sink.kinesis.aws.endpoint"
+	PropertyKinesisAwsAccessKeyId               = "sink.kinesis.aws.accesskeyid"
+	PropertyKinesisAwsSecretAccessKey           = "sink.kinesis.aws.secretaccesskey"
+	PropertyKinesisAwsSessionToken              = "sink.kinesis.aws.sessiontoken"
+
+	PropertySqsQueueUrl                     = "sink.sqs.queue.url"
+	PropertySqsPartitioningStrategy         = "sink.sqs.partitioning.strategy"
+	PropertySqsPartitioningColumns          = "sink.sqs.partitioning.columns"
+	PropertySqsPartitioningExpression       = "sink.sqs.partitioning.expression"
+	PropertySqsBatchSize                    = "sink.sqs.batch.size"
+	PropertySqsBatchLinger                  = "sink.sqs.batch.linger"
+	PropertySqsRetriesMax                   = "sink.sqs.retries.maxattempts"
+	PropertySqsRetriesBackoffMin            = "sink.sqs.retries.backoff.min"
+	PropertySqsRetriesBackoffMax            = "sink.sqs.retries.backoff.max"
+	PropertySqsOversizeStrategy             = "sink.sqs.oversize.strategy"
+	PropertySqsOversizePath                 = "sink.sqs.oversize.path"
+	PropertySqsOversizeS3Bucket             = "sink.sqs.oversize.s3.bucket"
+	PropertySqsOversizeS3AwsRegion          = "sink.sqs.oversize.s3.aws.region"
+	PropertySqsOversizeS3AwsEndpoint        = "sink.sqs.oversize.s3.aws.endpoint"
+	PropertySqsOversizeS3AwsAccessKeyId     = "sink.sqs.oversize.s3.aws.accesskeyid"
+	PropertySqsOversizeS3AwsSecretAccessKey = "sink.sqs.oversize.s3.aws.secretaccesskey"
+	PropertySqsOversizeS3AwsSessionToken    = "sink.sqs.oversize.s3.aws.sessiontoken"
+	PropertySqsAwsRegion                    = "sink.sqs.aws.region"
+	PropertySqsAwsEndpoint                  = "sink.sqs.aws.endpoint"
+	PropertySqsAwsAccessKeyId               = "sink.sqs.aws.accesskeyid"
+	PropertySqsAwsSecretAccessKey           = "sink.sqs.aws.secretaccesskey"
+	PropertySqsAwsSessionToken              = "sink.sqs.aws.sessiontoken"
+
+	PropertyHttpUrl                = "sink.http.url"
+	PropertyHttpHeaders            = "sink.http.headers"
+	PropertyHttpTimeout            = "sink.http.timeout"
+	PropertyHttpAuthenticationType = "sink.http.authentication.type"
+	PropertyHttpBasicUsername      = "sink.http.authentication.basic.username"
+	PropertyHttpBasicPassword      = "sink.http.authentication.basic.password"
+	PropertyHttpBearerToken        = "sink.http.authentication.bearer.token"
+	PropertyHttpHmacSecret         = "sink.http.authentication.hmac.secret"
+	PropertyHttpHmacHeader         = "sink.http.authentication.hmac.header"
+	PropertyHttpBatchSize          = "sink.http.batch.size"
+	PropertyHttpBatchBytes         = "sink.http.batch.bytes"
+	PropertyHttpBatchLinger        = "sink.http.batch.linger"
+	PropertyHttpRetriesMax         = "sink.http.retries.maxattempts"
+	PropertyHttpRetriesBackoffMin  = "sink.http.retries.backoff.min"
+	PropertyHttpRetriesBackoffMax  = "sink.http.retries.backoff.max"
+	PropertyHttpRetriesStatusCodes = "sink.http.retries.statuscodes"
+	PropertyHttpTlsEnabled         = "sink.http.tls.enabled"
+	PropertyHttpTlsSkipVerify      = "sink.http.tls.skipverify"
+	PropertyHttpTlsClientAuth      = "sink.http.tls.clientauth"
+
+	PropertyPostgresqlSinkConnection = "sink.postgresql.connection"
+	PropertyPostgresqlSinkPassword   = "sink.postgresql.password"
+	PropertyPostgresqlSinkAutoCreate = "sink.postgresql.autocreate"
+
+	PropertyFileSinkPath        = "sink.file.path"
+	PropertyFileSinkMaxSize     = "sink.file.maxsize"
+	PropertyFileSinkMaxDuration = "sink.file.maxduration"
+	PropertyFileSinkCompression = "sink.file.compression"
 
-	PropertyKinesisStreamName         = "sink.kinesis.stream.name"
-	PropertyKinesisStreamCreate       = "sink.kinesis.stream.create"
-	PropertyKinesisStreamShardCount   = "sink.kinesis.stream.shardcount"
-	PropertyKinesisStreamMode         = "sink.kinesis.stream.mode"
-	PropertyKinesisRegion             = "sink.kinesis.aws.region"
-	PropertyKinesisAwsEndpoint        = "sink.kinesis.aws.endpoint"
-	PropertyKinesisAwsAccessKeyId     = "sink.kinesis.aws.accesskeyid"
-	PropertyKinesisAwsSecretAccessKey = "sink.kinesis.aws.secretaccesskey"
-	PropertyKinesisAwsSessionToken    = "sink.kinesis.aws.sessiontoken"
-
-	PropertySqsQueueUrl           = "sink.sqs.queue.url"
-	PropertySqsAwsRegion          = "sink.sqs.aws.region"
-	PropertySqsAwsEndpoint        = "sink.sqs.aws.endpoint"
-	PropertySqsAwsAccessKeyId     = "sink.sqs.aws.accesskeyid"
-	PropertySqsAwsSecretAccessKey = "sink.sqs.aws.secretaccesskey"
-	PropertySqsAwsSessionToken    = "sink.sqs.aws.sessiontoken"
+	PropertyParquetPath                 = "sink.parquet.path"
+	PropertyParquetCompression          = "sink.parquet.compression"
+	PropertyParquetBufferSize           = "sink.parquet.buffer.size"
+	PropertyParquetBufferInterval       = "sink.parquet.buffer.interval"
+	PropertyParquetPartitionBucket      = "sink.parquet.partition.bucket"
+	PropertyParquetPartitionIntBucket   = "sink.parquet.partition.integerbucket"
+	PropertyParquetS3Bucket             = "sink.parquet.s3.bucket"
+	PropertyParquetS3AwsRegion          = "sink.parquet.s3.aws.region"
+	PropertyParquetS3AwsEndpoint        = "sink.parquet.s3.aws.endpoint"
+	PropertyParquetS3AwsAccessKeyId     = "sink.parquet.s3.aws.accesskeyid"
+	PropertyParquetS3AwsSecretAccessKey = "sink.parquet.s3.aws.secretaccesskey"
+	PropertyParquetS3AwsSessionToken    = "sink.parquet.s3.aws.sessiontoken"
 )
@@ -0,0 +1,644 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encoding
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/goccy/go-json"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	avroMagicByte = byte(0)
+)
+
+func init() {
+	RegisterEncoder(config.AvroEncoding, func(c *config.Config) (Encoder, error) {
+		schemaRegistryClient, err := NewSchemaRegistryClientWithConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		return NewAvroEncoder(schemaRegistryClient), nil
+	})
+}
+
+// avroSchemaEntry caches the latest schema of a subject. Only a
+// single schema is kept per subject, replaced when the schema of
+// the topic changes.
+type avroSchemaEntry struct {
+	schemaPtr uintptr
+	// schemaStruct keeps a reference to the schema to
+	// prevent the pointer from being reused while cached
+	schemaStruct schema.Struct
+	definition   string
+	schemaId     int32
+	avroType     *avroType
+}
+
+// AvroEncoder encodes keys and envelopes into the Avro binary format,
+// prefixed by the Confluent wire format header (magic byte and 4-byte
+// schema id). The Avro schemas are derived from the schema.Struct schema
+// definitions and registered with the schema registry using the topic
+// name strategy (<topic>-key and <topic>-value).
+type AvroEncoder struct {
+	schemaRegistryClient *SchemaRegistryClient
+
+	mutex   sync.Mutex
+	schemas map[string]*avroSchemaEntry
+}
+
+func NewAvroEncoder(
+	schemaRegistryClient *SchemaRegistryClient,
+) *AvroEncoder {
+
+	return &AvroEncoder{
+		schemaRegistryClient: schemaRegistryClient,
+		schemas:              make(map[string]*avroSchemaEntry),
+	}
+}
+
+func (a *AvroEncoder) EncodeKey(
+	topicName string, key schema.Struct,
+) ([]byte, error) {
+
+	return a.encode(fmt.Sprintf("%s-key", topicName), key)
+}
+
+func (a *AvroEncoder) EncodeEnvelope(
+	topicName string, envelope schema.Struct,
+) ([]byte, error) {
+
+	return a.encode(fmt.Sprintf("%s-value", topicName), envelope)
+}
+
+func (a *AvroEncoder) encode(
+	subject string, envelope schema.Struct,
+) ([]byte, error) {
+
+	// Null values are encoded as null (no header), same as the
+	// Confluent serializers, to keep tombstones intact
+	payload := indirectValue(envelope[schema.FieldNamePayload])
+	if payload == nil {
+		return nil, nil
+	}
+
+	schemaStruct, ok := envelope[schema.FieldNameSchema].(schema.Struct)
+	if !ok {
+		return nil, errors.Errorf("Avro encoding requires a schema for subject '%s'", subject)
+	}
+
+	entry, err := a.resolveSchema(subject, schemaStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 5, 512)
+	data[0] = avroMagicByte
+	binary.BigEndian.PutUint32(data[1:], uint32(entry.schemaId))
+	return entry.avroType.appendValue(data, payload)
+}
+
+func (a *AvroEncoder) resolveSchema(
+	subject string, schemaStruct schema.Struct,
+) (*avroSchemaEntry, error) {
+
+	schemaPtr := reflect.ValueOf(schemaStruct).Pointer()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry, present := a.schemas[subject]
+	if present && entry.schemaPtr == schemaPtr {
+		return entry, nil
+	}
+
+	avroType, definition, err := convertToAvroSchema(schemaStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	// Schemas are rebuilt when a stream is recreated, which doesn't
+	// necessarily mean the schema itself has changed
+	if !present || entry.definition != definition {
+		schemaId, err := a.schemaRegistryClient.Register(subject, "", definition)
+		if err != nil {
+			return nil, err
+		}
+
+		entry = &avroSchemaEntry{
+			definition: definition,
+			schemaId:   schemaId,
+			avroType:   avroType,
+		}
+		a.schemas[subject] = entry
+	}
+
+	entry.schemaPtr = schemaPtr
+	entry.schemaStruct = schemaStruct
+	return entry, nil
+}
+
+type avroType struct {
+	kind     string
+	name     string
+	fields   []*avroField
+	items    *avroType
+	nullable bool
+}
+
+type avroField struct {
+	name       string
+	sourceName string
+	avroType   *avroType
+}
+
+// convertToAvroSchema converts a schema.Struct schema definition into
+// its Avro schema definition (JSON) representation.
+func convertToAvroSchema(
+	schemaStruct schema.Struct,
+) (*avroType, string, error) {
+
+	converter := &avroSchemaConverter{
+		definedTypes: make(map[string]*avroType),
+	}
+
+	avroType, definition, err := converter.convert(schemaStruct, "", "", true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return nil, "", errors.Wrap(err, 0)
+	}
+	return avroType, string(data), nil
+}
+
+type avroSchemaConverter struct {
+	definedTypes map[string]*avroType
+}
+
+func (c *avroSchemaConverter) convert(
+	schemaStruct schema.Struct, namespace, fieldName string, topLevel bool,
+) (*avroType, any, error) {
+
+	typeSchema, schemaType := resolveSchemaType(schemaStruct)
+	optional := isOptionalSchema(schemaStruct) || isOptionalSchema(typeSchema)
+
+	var t *avroType
+	var definition any
+	switch schemaType {
+	case schema.INT8, schema.INT16, schema.INT32:
+		t, definition = &avroType{kind: "int"}, "int"
+	case schema.INT64:
+		t, definition = &avroType{kind: "long"}, "long"
+	case schema.FLOAT32:
+		t, definition = &avroType{kind: "float"}, "float"
+	case schema.FLOAT64:
+		t, definition = &avroType{kind: "double"}, "double"
+	case schema.BOOLEAN:
+		t, definition = &avroType{kind: "boolean"}, "boolean"
+	case schema.BYTES:
+		t, definition = &avroType{kind: "bytes"}, "bytes"
+	case schema.ARRAY, schema.MAP:
+		valueSchema, _ := typeSchema[schema.FieldNameValueSchema].(schema.Struct)
+		if valueSchema == nil {
+			valueSchema = schema.Struct{schema.FieldNameType: schema.STRING}
+		}
+		items, itemsDefinition, err := c.convert(valueSchema, namespace, fieldName, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if schemaType == schema.ARRAY {
+			t = &avroType{kind: "array", items: items}
+			definition = map[string]any{"type": "array", "items": itemsDefinition}
+		} else {
+			t = &avroType{kind: "map", items: items}
+			definition = map[string]any{"type": "map", "values": itemsDefinition}
+		}
+	case schema.STRUCT:
+		var err error
+		t, definition, err = c.convertRecord(schemaStruct, typeSchema, namespace, fieldName, topLevel)
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		t, definition = &avroType{kind: "string"}, "string"
+	}
+
+	if optional && !topLevel {
+		t = &avroType{
+			kind:     t.kind,
+			name:     t.name,
+			fields:   t.fields,
+			items:    t.items,
+			nullable: true,
+		}
+		definition = []any{"null", definition}
+	}
+	return t, definition, nil
+}
+
+func (c *avroSchemaConverter) convertRecord(
+	schemaStruct, typeSchema schema.Struct, namespace, fieldName string, topLevel bool,
+) (*avroType, any, error) {
+
+	// Field elements carry the field name in "name" if the type
+	// is defined in a nested schema, otherwise "name" is the
+	// schema name of the record
+	name := ""
+	if _, hasField := schemaStruct[schema.FieldNameField]; topLevel || hasField {
+		name, _ = typeSchema[schema.FieldNameName].(string)
+	} else if !isSameStruct(schemaStruct, typeSchema) {
+		name, _ = typeSchema[schema.FieldNameName].(string)
+	}
+	if name == "" {
+		if namespace == "" {
+			name = "Record"
+		} else {
+			name = fmt.Sprintf("%s.%s", namespace, fieldName)
+		}
+	}
+
+	fullName := sanitizeAvroName(name)
+	if t, present := c.definedTypes[fullName]; present {
+		return t, fullName, nil
+	}
+
+	t := &avroType{kind: "record", name: fullName}
+	c.definedTypes[fullName] = t
+
+	fieldSchemas := make([]schema.Struct, 0)
+	switch fields := typeSchema[schema.FieldNameFields].(type) {
+	case []schema.Struct:
+		fieldSchemas = fields
+	case []any:
+		for _, field := range fields {
+			if fieldSchema, ok := field.(schema.Struct); ok {
+				fieldSchemas = append(fieldSchemas, fieldSchema)
+			}
+		}
+	}
+
+	fieldNames := make(map[string]bool)
+	fieldDefinitions := make([]any, 0, len(fieldSchemas))
+	for _, fieldSchema := range fieldSchemas {
+		sourceName, _ := fieldSchema[schema.FieldNameField].(string)
+		if sourceName == "" {
+			sourceName, _ = fieldSchema[schema.FieldNameName].(string)
+		}
+
+		avroFieldName := sanitizeIdentifier(sourceName)
+		for fieldNames[avroFieldName] {
+			avroFieldName = fmt.Sprintf("%s_", avroFieldName)
+		}
+		fieldNames[avroFieldName] = true
+
+		fieldType, fieldTypeDefinition, err := c.convert(fieldSchema, fullName, avroFieldName, false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		t.fields = append(t.fields, &avroField{
+			name:       avroFieldName,
+			sourceName: sourceName,
+			avroType:   fieldType,
+		})
+
+		fieldDefinition := map[string]any{
+			"name": avroFieldName,
+			"type": fieldTypeDefinition,
+		}
+		if fieldType.nullable {
+			fieldDefinition["default"] = nil
+		}
+		fieldDefinitions = append(fieldDefinitions, fieldDefinition)
+	}
+
+	return t, map[string]any{
+		"type":   "record",
+		"name":   fullName,
+		"fields": fieldDefinitions,
+	}, nil
+}
+
+// appendValue appends the Avro binary encoding of the value. Missing values
+// for non-nullable types are encoded as the type's zero value.
+func (t *avroType) appendValue(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	value = indirectValue(value)
+	if t.nullable {
+		if value == nil {
+			return binary.AppendVarint(buffer, 0), nil
+		}
+		buffer = binary.AppendVarint(buffer, 1)
+	}
+
+	switch t.kind {
+	case "boolean":
+		v := false
+		if value != nil {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, errors.Errorf("Avro value %v cannot be encoded as boolean", value)
+			}
+			v = b
+		}
+		if v {
+			return append(buffer, 1), nil
+		}
+		return append(buffer, 0), nil
+
+	case "int", "long":
+		v, err := avroInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		return binary.AppendVarint(buffer, v), nil
+
+	case "float":
+		v, err := avroFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buffer, math.Float32bits(float32(v))), nil
+
+	case "double":
+		v, err := avroFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buffer, math.Float64bits(v)), nil
+
+	case "bytes":
+		var v []byte
+		switch b := value.(type) {
+		case []byte:
+			v = b
+		case string:
+			v = []byte(b)
+		case nil:
+		default:
+			return nil, errors.Errorf("Avro value %v cannot be encoded as bytes", value)
+		}
+		buffer = binary.AppendVarint(buffer, int64(len(v)))
+		return append(buffer, v...), nil
+
+	case "string":
+		v := avroString(value)
+		buffer = binary.AppendVarint(buffer, int64(len(v)))
+		return append(buffer, v...), nil
+
+	case "record":
+		values := reflect.ValueOf(value)
+		if value != nil && values.Kind() != reflect.Map {
+			return nil, errors.Errorf("Avro value %v cannot be encoded as record '%s'", value, t.name)
+		}
+		var err error
+		for _, field := range t.fields {
+			var fieldValue any
+			if value != nil {
+				if v := values.MapIndex(reflect.ValueOf(field.sourceName)); v.IsValid() {
+					fieldValue = v.Interface()
+				}
+			}
+			if buffer, err = field.avroType.appendValue(buffer, fieldValue); err != nil {
+				return nil, err
+			}
+		}
+		return buffer, nil
+
+	case "array":
+		values := reflect.ValueOf(value)
+		if value == nil || values.Len() == 0 {
+			return binary.AppendVarint(buffer, 0), nil
+		}
+		if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+			return nil, errors.Errorf("Avro value %v cannot be encoded as array", value)
+		}
+		buffer = binary.AppendVarint(buffer, int64(values.Len()))
+		var err error
+		for i := 0; i < values.Len(); i++ {
+			if buffer, err = t.items.appendValue(buffer, values.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+		return binary.AppendVarint(buffer, 0), nil
+
+	case "map":
+		values := reflect.ValueOf(value)
+		if value == nil || values.Len() == 0 {
+			return binary.AppendVarint(buffer, 0), nil
+		}
+		if values.Kind() != reflect.Map {
+			return nil, errors.Errorf("Avro value %v cannot be encoded as map", value)
+		}
+		buffer = binary.AppendVarint(buffer, int64(values.Len()))
+		iterator := values.MapRange()
+		var err error
+		for iterator.Next() {
+			key := avroString(iterator.Key().Interface())
+			buffer = binary.AppendVarint(buffer, int64(len(key)))
+			buffer = append(buffer, key...)
+			if buffer, err = t.items.appendValue(buffer, iterator.Value().Interface()); err != nil {
+				return nil, err
+			}
+		}
+		return binary.AppendVarint(buffer, 0), nil
+	}
+	return nil, errors.Errorf("Avro type '%s' not supported", t.kind)
+}
+
+func resolveSchemaType(
+	schemaStruct schema.Struct,
+) (schema.Struct, schema.Type) {
+
+	typeSchema := schemaStruct
+	if _, present := schemaStruct[schema.FieldNameType]; !present {
+		if nested, ok := schemaStruct[schema.FieldNameSchema].(schema.Struct); ok {
+			typeSchema = nested
+		} else if nested, ok := schemaStruct[schema.FieldNameMessage].(schema.Struct); ok {
+			typeSchema = nested
+		}
+	}
+
+	switch t := typeSchema[schema.FieldNameType].(type) {
+	case schema.Type:
+		return typeSchema, t
+	case string:
+		return typeSchema, schema.Type(t)
+	}
+
+	if _, present := typeSchema[schema.FieldNameFields]; present {
+		return typeSchema, schema.STRUCT
+	}
+	return typeSchema, schema.STRING
+}
+
+func isOptionalSchema(
+	schemaStruct schema.Struct,
+) bool {
+
+	optional, _ := schemaStruct[schema.FieldNameOptional].(bool)
+	return optional
+}
+
+func isSameStruct(
+	this, other schema.Struct,
+) bool {
+
+	return reflect.ValueOf(this).Pointer() == reflect.ValueOf(other).Pointer()
+}
+
+func sanitizeAvroName(
+	name string,
+) string {
+
+	components := make([]string, 0)
+	for _, component := range strings.Split(name, ".") {
+		if component == "" {
+			continue
+		}
+		components = append(components, sanitizeIdentifier(component))
+	}
+	return strings.Join(components, ".")
+}
+
+func sanitizeIdentifier(
+	name string,
+) string {
+
+	builder := strings.Builder{}
+	for i, r := range name {
+		if r > unicode.MaxASCII || !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			builder.WriteRune('_')
+			continue
+		}
+		if i == 0 && unicode.IsDigit(r) {
+			builder.WriteRune('_')
+		}
+		builder.WriteRune(r)
+	}
+	if builder.Len() == 0 {
+		return "_"
+	}
+	return builder.String()
+}
+
+func indirectValue(
+	value any,
+) any {
+
+	if value == nil {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func avroInt64(
+	value any,
+) (int64, error) {
+
+	if value == nil {
+		return 0, nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(v.Float()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.String:
+		i, err := strconv.ParseInt(v.String(), 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("Avro value %v cannot be encoded as integer", value)
+		}
+		return i, nil
+	}
+	return 0, errors.Errorf("Avro value %v cannot be encoded as integer", value)
+}
+
+func avroFloat64(
+	value any,
+) (float64, error) {
+
+	if value == nil {
+		return 0, nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return 0, errors.Errorf("Avro value %v cannot be encoded as floating point", value)
+		}
+		return f, nil
+	}
+	return 0, errors.Errorf("Avro value %v cannot be encoded as floating point", value)
+}
+
+func avroString(
+	value any,
+) string {
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
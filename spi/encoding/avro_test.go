@@ -0,0 +1,168 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encoding
+
+import (
+	"encoding/binary"
+	"github.com/goccy/go-json"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_Avro_Schema_Conversion(
+	t *testing.T,
+) {
+
+	valueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Value").
+		Field("id", 0, schema.Int32()).
+		Field("device-name", 1, schema.String().Optional()).
+		Field("tags", 2, schema.NewSchemaBuilder(schema.ARRAY).ValueSchema(schema.String())).
+		Build()
+
+	_, definition, err := convertToAvroSchema(valueSchema)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "record",
+		"name": "prefix.public.metrics.Value",
+		"fields": [
+			{"name": "id", "type": "int"},
+			{"name": "device_name", "type": ["null", "string"], "default": null},
+			{"name": "tags", "type": {"type": "array", "items": "string"}}
+		]
+	}`, definition)
+}
+
+func Test_Avro_Schema_Conversion_Reuses_Named_Records(
+	t *testing.T,
+) {
+
+	tableSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Value").
+		Field("id", 0, schema.Int32())
+
+	envelopeSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Envelope").
+		Field(schema.FieldNameBefore, 0, tableSchema.Clone().Optional()).
+		Field(schema.FieldNameAfter, 1, tableSchema.Clone()).
+		Build()
+
+	_, definition, err := convertToAvroSchema(envelopeSchema)
+	assert.NoError(t, err)
+
+	var avroSchema map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(definition), &avroSchema))
+
+	fields := avroSchema["fields"].([]any)
+	after := fields[1].(map[string]any)
+	assert.Equal(t, "prefix.public.metrics.Value", after["type"])
+}
+
+func Test_Avro_Encoding_With_Schema_Registry(
+	t *testing.T,
+) {
+
+	registrations := atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/subjects/prefix.public.metrics-key/versions", r.URL.Path)
+		assert.Equal(t, schemaRegistryContentType, r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := struct {
+			Schema string `json:"schema"`
+		}{}
+		assert.NoError(t, json.Unmarshal(body, &request))
+		assert.Contains(t, request.Schema, `"name":"prefix.public.metrics.Key"`)
+
+		registrations.Add(1)
+		w.Header().Set("Content-Type", schemaRegistryContentType)
+		_, _ = w.Write([]byte(`{"id":42}`))
+	}))
+	defer server.Close()
+
+	encoder := NewAvroEncoder(NewSchemaRegistryClient(server.URL, "", "", server.Client()))
+
+	keySchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Key").
+		Field("id", 0, schema.Int64()).
+		Field("name", 1, schema.String().Optional()).
+		Build()
+
+	key := schema.Envelope(keySchema, schema.Struct{
+		"id":   lo.ToPtr(uint32(1)),
+		"name": "foo",
+	})
+
+	data, err := encoder.EncodeKey("prefix.public.metrics", key)
+	assert.NoError(t, err)
+
+	expected := []byte{avroMagicByte, 0, 0, 0, 42}
+	expected = binary.AppendVarint(expected, 1)
+	expected = binary.AppendVarint(expected, 1)
+	expected = binary.AppendVarint(expected, 3)
+	expected = append(expected, "foo"...)
+	assert.Equal(t, expected, data)
+
+	// Second encoding uses the cached schema id
+	_, err = encoder.EncodeKey("prefix.public.metrics", key)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), registrations.Load())
+
+	// A rebuilt, but identical, schema replaces the cached one without
+	// registering it again, a changed schema is registered
+	for i := 0; i < 3; i++ {
+		rebuiltKeySchema := schema.NewSchemaBuilder(schema.STRUCT).
+			SchemaName("prefix.public.metrics.Key").
+			Field("id", 0, schema.Int64()).
+			Field("name", 1, schema.String().Optional()).
+			Build()
+
+		_, err = encoder.EncodeKey("prefix.public.metrics", schema.Envelope(rebuiltKeySchema, schema.Struct{
+			"id":   lo.ToPtr(uint32(1)),
+			"name": "foo",
+		}))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), registrations.Load())
+	assert.Len(t, encoder.schemas, 1)
+
+	changedKeySchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Key").
+		Field("id", 0, schema.Int64()).
+		Build()
+
+	_, err = encoder.EncodeKey("prefix.public.metrics", schema.Envelope(changedKeySchema, schema.Struct{
+		"id": lo.ToPtr(uint32(1)),
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), registrations.Load())
+	assert.Len(t, encoder.schemas, 1)
+
+	// Null payloads are encoded as null values
+	data, err = encoder.EncodeKey("prefix.public.metrics", schema.Envelope(keySchema, nil))
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+}
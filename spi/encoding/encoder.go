@@ -0,0 +1,94 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encoding
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"sync"
+)
+
+type EncoderFactory = func(config *config.Config) (Encoder, error)
+
+// Encoder encodes event keys and envelopes into the wire
+// format handed to the sinks. Both, the key and the envelope,
+// are passed in as schema.Struct envelopes, containing the
+// schema and payload.
+type Encoder interface {
+	// EncodeKey encodes the key envelope of an event
+	// for the given topic name
+	EncodeKey(
+		topicName string, key schema.Struct,
+	) ([]byte, error)
+	// EncodeEnvelope encodes the event envelope for
+	// the given topic name
+	EncodeEnvelope(
+		topicName string, envelope schema.Struct,
+	) ([]byte, error)
+}
+
+var encoderRegistry = &registry{
+	mutex:     sync.Mutex{},
+	factories: make(map[config.EncodingType]EncoderFactory),
+}
+
+type registry struct {
+	mutex     sync.Mutex
+	factories map[config.EncodingType]EncoderFactory
+}
+
+// RegisterEncoder registers a config.EncodingType to a
+// EncoderFactory implementation which creates the Encoder
+// when requested
+func RegisterEncoder(
+	name config.EncodingType, factory EncoderFactory,
+) bool {
+
+	encoderRegistry.mutex.Lock()
+	defer encoderRegistry.mutex.Unlock()
+	if _, present := encoderRegistry.factories[name]; !present {
+		encoderRegistry.factories[name] = factory
+		return true
+	}
+	return false
+}
+
+// NewEncoder instantiates a new instance of the requested
+// Encoder when available, otherwise returns an error.
+func NewEncoder(
+	name config.EncodingType, config *config.Config,
+) (Encoder, error) {
+
+	encoderRegistry.mutex.Lock()
+	defer encoderRegistry.mutex.Unlock()
+	if f, present := encoderRegistry.factories[name]; present {
+		return f(config)
+	}
+	return nil, errors.Errorf("EncodingType '%s' doesn't exist", name)
+}
+
+// NewEncoderWithConfig instantiates the Encoder configured
+// for the sink, defaulting to the JSON encoder.
+func NewEncoderWithConfig(
+	c *config.Config,
+) (Encoder, error) {
+
+	name := config.GetOrDefault(c, config.PropertyEncodingType, config.JsonEncoding)
+	return NewEncoder(name, c)
+}
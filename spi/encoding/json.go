@@ -20,8 +20,15 @@ package encoding
 import (
 	"github.com/goccy/go-json"
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 )
 
+func init() {
+	RegisterEncoder(config.JsonEncoding, func(c *config.Config) (Encoder, error) {
+		return NewJsonEncoderWithConfig(c), nil
+	})
+}
+
 type JsonEncoder struct {
 	marshallerFunction func(value any) ([]byte, error)
 }
@@ -57,6 +64,20 @@ func (j *JsonEncoder) Marshal(
 	return j.marshallerFunction(value)
 }
 
+func (j *JsonEncoder) EncodeKey(
+	_ string, key schema.Struct,
+) ([]byte, error) {
+
+	return j.Marshal(key)
+}
+
+func (j *JsonEncoder) EncodeEnvelope(
+	_ string, envelope schema.Struct,
+) ([]byte, error) {
+
+	return j.Marshal(envelope)
+}
+
 type JsonDecoder struct {
 	unmarshallerFunction func(data []byte, v any) error
 }
@@ -0,0 +1,684 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+func init() {
+	RegisterEncoder(config.ProtobufEncoding, func(_ *config.Config) (Encoder, error) {
+		return NewProtobufEncoder(), nil
+	})
+}
+
+type protobufKind string
+
+const (
+	protobufKindInt32    protobufKind = "int32"
+	protobufKindInt64    protobufKind = "int64"
+	protobufKindFloat    protobufKind = "float"
+	protobufKindDouble   protobufKind = "double"
+	protobufKindBool     protobufKind = "bool"
+	protobufKindString   protobufKind = "string"
+	protobufKindBytes    protobufKind = "bytes"
+	protobufKindMessage  protobufKind = "message"
+	protobufKindRepeated protobufKind = "repeated"
+	protobufKindMap      protobufKind = "map"
+)
+
+// protobufSchemaEntry caches the latest schema of the key or envelope
+// of a topic, replaced when the schema of the topic changes.
+type protobufSchemaEntry struct {
+	schemaPtr uintptr
+	// schemaStruct keeps a reference to the schema to
+	// prevent the pointer from being reused while cached
+	schemaStruct schema.Struct
+	message      *protobufMessage
+}
+
+// ProtobufEncoder encodes keys and envelopes into the Protobuf binary
+// format. The message descriptors are derived from the schema.Struct
+// schema definitions, with field numbers derived from the field indexes
+// (or the order of the schema fields, if not all fields carry an index).
+// The matching .proto definitions can be generated using
+// GenerateProtobufDefinition.
+type ProtobufEncoder struct {
+	mutex   sync.Mutex
+	schemas map[string]*protobufSchemaEntry
+}
+
+func NewProtobufEncoder() *ProtobufEncoder {
+	return &ProtobufEncoder{
+		schemas: make(map[string]*protobufSchemaEntry),
+	}
+}
+
+func (p *ProtobufEncoder) EncodeKey(
+	topicName string, key schema.Struct,
+) ([]byte, error) {
+
+	return p.encode(fmt.Sprintf("%s-key", topicName), key)
+}
+
+func (p *ProtobufEncoder) EncodeEnvelope(
+	topicName string, envelope schema.Struct,
+) ([]byte, error) {
+
+	return p.encode(fmt.Sprintf("%s-value", topicName), envelope)
+}
+
+func (p *ProtobufEncoder) encode(
+	subject string, envelope schema.Struct,
+) ([]byte, error) {
+
+	// Null values are encoded as null to keep tombstones intact
+	payload := indirectValue(envelope[schema.FieldNamePayload])
+	if payload == nil {
+		return nil, nil
+	}
+
+	schemaStruct, ok := envelope[schema.FieldNameSchema].(schema.Struct)
+	if !ok {
+		return nil, errors.Errorf("Protobuf encoding requires a schema for subject '%s'", subject)
+	}
+
+	message, err := p.resolveSchema(subject, schemaStruct)
+	if err != nil {
+		return nil, err
+	}
+	return message.appendMessage(make([]byte, 0, 512), payload)
+}
+
+func (p *ProtobufEncoder) resolveSchema(
+	subject string, schemaStruct schema.Struct,
+) (*protobufMessage, error) {
+
+	schemaPtr := reflect.ValueOf(schemaStruct).Pointer()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if entry, present := p.schemas[subject]; present && entry.schemaPtr == schemaPtr {
+		return entry.message, nil
+	}
+
+	converter := newProtobufSchemaConverter()
+	message, err := converter.convertTopLevel(schemaStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	p.schemas[subject] = &protobufSchemaEntry{
+		schemaPtr:    schemaPtr,
+		schemaStruct: schemaStruct,
+		message:      message,
+	}
+	return message, nil
+}
+
+// GenerateProtobufDefinition generates the proto3 definition (.proto file
+// content) for the given schema definitions, as used by the ProtobufEncoder.
+// The package name is sanitized to a valid Protobuf package name.
+func GenerateProtobufDefinition(
+	packageName string, schemaStructs ...schema.Struct,
+) (string, error) {
+
+	converter := newProtobufSchemaConverter()
+	for _, schemaStruct := range schemaStructs {
+		if _, err := converter.convertTopLevel(schemaStruct); err != nil {
+			return "", err
+		}
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("// Generated by timescaledb-event-streamer. DO NOT EDIT.\n")
+	builder.WriteString("syntax = \"proto3\";\n")
+	if packageName = sanitizeProtobufPackageName(packageName); packageName != "" {
+		builder.WriteString(fmt.Sprintf("\npackage %s;\n", packageName))
+	}
+
+	for _, message := range converter.messages {
+		builder.WriteString(fmt.Sprintf("\nmessage %s {\n", message.typeName))
+		if len(message.reserved) > 0 {
+			numbers := make([]string, 0, len(message.reserved))
+			for _, number := range message.reserved {
+				numbers = append(numbers, fmt.Sprintf("%d", number))
+			}
+			builder.WriteString(fmt.Sprintf("  reserved %s;\n", strings.Join(numbers, ", ")))
+		}
+		for _, field := range message.fields {
+			builder.WriteString(fmt.Sprintf("  %s %s = %d;\n", field.definition(), field.name, field.number))
+		}
+		builder.WriteString("}\n")
+	}
+	return builder.String(), nil
+}
+
+type protobufMessage struct {
+	typeName string
+	fields   []*protobufField
+	// field numbers of dropped columns, which must not be reused
+	reserved []protowire.Number
+	// wrapper messages hold a single repeated or map field to
+	// represent nested collections, which Protobuf doesn't support
+	wrapper bool
+}
+
+type protobufField struct {
+	name       string
+	sourceName string
+	number     protowire.Number
+	fieldType  *protobufType
+	optional   bool
+}
+
+type protobufType struct {
+	kind    protobufKind
+	message *protobufMessage
+	items   *protobufType
+}
+
+func (f *protobufField) definition() string {
+	switch f.fieldType.kind {
+	case protobufKindRepeated:
+		return fmt.Sprintf("repeated %s", f.fieldType.items.typeName())
+	case protobufKindMap:
+		return fmt.Sprintf("map<string, %s>", f.fieldType.items.typeName())
+	case protobufKindMessage:
+		return f.fieldType.typeName()
+	}
+	if f.optional {
+		return fmt.Sprintf("optional %s", f.fieldType.typeName())
+	}
+	return f.fieldType.typeName()
+}
+
+func (t *protobufType) typeName() string {
+	if t.kind == protobufKindMessage {
+		return t.message.typeName
+	}
+	return string(t.kind)
+}
+
+func (t *protobufType) isCollection() bool {
+	return t.kind == protobufKindRepeated || t.kind == protobufKindMap
+}
+
+func (t *protobufType) isPackable() bool {
+	switch t.kind {
+	case protobufKindInt32, protobufKindInt64, protobufKindFloat, protobufKindDouble, protobufKindBool:
+		return true
+	}
+	return false
+}
+
+func (t *protobufType) wireType() protowire.Type {
+	switch t.kind {
+	case protobufKindInt32, protobufKindInt64, protobufKindBool:
+		return protowire.VarintType
+	case protobufKindFloat:
+		return protowire.Fixed32Type
+	case protobufKindDouble:
+		return protowire.Fixed64Type
+	}
+	return protowire.BytesType
+}
+
+type protobufSchemaConverter struct {
+	messages     []*protobufMessage
+	definedTypes map[string]*protobufMessage
+	typeNames    map[string]string
+}
+
+func newProtobufSchemaConverter() *protobufSchemaConverter {
+	return &protobufSchemaConverter{
+		messages:     make([]*protobufMessage, 0),
+		definedTypes: make(map[string]*protobufMessage),
+		typeNames:    make(map[string]string),
+	}
+}
+
+func (c *protobufSchemaConverter) convertTopLevel(
+	schemaStruct schema.Struct,
+) (*protobufMessage, error) {
+
+	t, err := c.convert(schemaStruct, "", "", true)
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != protobufKindMessage {
+		return nil, errors.Errorf("Protobuf encoding requires a struct schema, found '%s'", t.kind)
+	}
+	return t.message, nil
+}
+
+func (c *protobufSchemaConverter) convert(
+	schemaStruct schema.Struct, parentTypeName, fieldName string, topLevel bool,
+) (*protobufType, error) {
+
+	typeSchema, schemaType := resolveSchemaType(schemaStruct)
+
+	switch schemaType {
+	case schema.INT8, schema.INT16, schema.INT32:
+		return &protobufType{kind: protobufKindInt32}, nil
+	case schema.INT64:
+		return &protobufType{kind: protobufKindInt64}, nil
+	case schema.FLOAT32:
+		return &protobufType{kind: protobufKindFloat}, nil
+	case schema.FLOAT64:
+		return &protobufType{kind: protobufKindDouble}, nil
+	case schema.BOOLEAN:
+		return &protobufType{kind: protobufKindBool}, nil
+	case schema.BYTES:
+		return &protobufType{kind: protobufKindBytes}, nil
+	case schema.ARRAY, schema.MAP:
+		valueSchema, _ := typeSchema[schema.FieldNameValueSchema].(schema.Struct)
+		if valueSchema == nil {
+			valueSchema = schema.Struct{schema.FieldNameType: schema.STRING}
+		}
+		items, err := c.convert(valueSchema, parentTypeName, fieldName, false)
+		if err != nil {
+			return nil, err
+		}
+		// Nested collections need to be wrapped into a message
+		if items.isCollection() {
+			items = c.wrapCollection(items, parentTypeName, fieldName)
+		}
+		if schemaType == schema.ARRAY {
+			return &protobufType{kind: protobufKindRepeated, items: items}, nil
+		}
+		return &protobufType{kind: protobufKindMap, items: items}, nil
+	case schema.STRUCT:
+		return c.convertMessage(schemaStruct, typeSchema, parentTypeName, fieldName, topLevel)
+	}
+	return &protobufType{kind: protobufKindString}, nil
+}
+
+func (c *protobufSchemaConverter) convertMessage(
+	schemaStruct, typeSchema schema.Struct, parentTypeName, fieldName string, topLevel bool,
+) (*protobufType, error) {
+
+	// Field elements carry the field name in "name" if the type
+	// is defined in a nested schema, otherwise "name" is the
+	// schema name of the record
+	name := ""
+	if _, hasField := schemaStruct[schema.FieldNameField]; topLevel || hasField {
+		name, _ = typeSchema[schema.FieldNameName].(string)
+	} else if !isSameStruct(schemaStruct, typeSchema) {
+		name, _ = typeSchema[schema.FieldNameName].(string)
+	}
+
+	if name != "" {
+		if message, present := c.definedTypes[name]; present {
+			return &protobufType{kind: protobufKindMessage, message: message}, nil
+		}
+	}
+
+	message := &protobufMessage{typeName: c.messageTypeName(name, parentTypeName, fieldName)}
+	if name != "" {
+		c.definedTypes[name] = message
+	}
+	c.messages = append(c.messages, message)
+
+	fieldSchemas := make([]schema.Struct, 0)
+	switch fields := typeSchema[schema.FieldNameFields].(type) {
+	case []schema.Struct:
+		fieldSchemas = fields
+	case []any:
+		for _, field := range fields {
+			if fieldSchema, ok := field.(schema.Struct); ok {
+				fieldSchemas = append(fieldSchemas, fieldSchema)
+			}
+		}
+	}
+
+	fieldNumbers, reserved := protobufFieldNumbers(fieldSchemas)
+	message.reserved = reserved
+
+	fieldNames := make(map[string]bool)
+	for i, fieldSchema := range fieldSchemas {
+		sourceName, _ := fieldSchema[schema.FieldNameField].(string)
+		if sourceName == "" {
+			sourceName, _ = fieldSchema[schema.FieldNameName].(string)
+		}
+
+		protobufFieldName := sanitizeIdentifier(sourceName)
+		for fieldNames[protobufFieldName] {
+			protobufFieldName = fmt.Sprintf("%s_", protobufFieldName)
+		}
+		fieldNames[protobufFieldName] = true
+
+		fieldType, err := c.convert(fieldSchema, message.typeName, protobufFieldName, false)
+		if err != nil {
+			return nil, err
+		}
+
+		fieldTypeSchema, _ := resolveSchemaType(fieldSchema)
+		message.fields = append(message.fields, &protobufField{
+			name:       protobufFieldName,
+			sourceName: sourceName,
+			number:     fieldNumbers[i],
+			fieldType:  fieldType,
+			optional:   isOptionalSchema(fieldSchema) || isOptionalSchema(fieldTypeSchema),
+		})
+	}
+
+	return &protobufType{kind: protobufKindMessage, message: message}, nil
+}
+
+// protobufFieldNumbers derives the field numbers from the field indexes
+// of the schema fields. Table columns carry an index derived from their
+// attribute number, which keeps the field numbers stable when other
+// columns are added or dropped. The numbers of dropped columns are
+// returned as reserved. If any field has no (or a duplicate) index,
+// the field numbers are assigned in the order of the fields.
+func protobufFieldNumbers(
+	fieldSchemas []schema.Struct,
+) (numbers []protowire.Number, reserved []protowire.Number) {
+
+	numbers = make([]protowire.Number, 0, len(fieldSchemas))
+	used := make(map[protowire.Number]bool, len(fieldSchemas))
+	maxNumber := protowire.Number(0)
+	for _, fieldSchema := range fieldSchemas {
+		index, ok := fieldSchema[schema.FieldNameIndex].(int)
+		number := protowire.Number(index + 1)
+		if !ok || index < 0 || used[number] {
+			numbers = numbers[:0]
+			for i := range fieldSchemas {
+				numbers = append(numbers, protowire.Number(i+1))
+			}
+			return numbers, nil
+		}
+		numbers = append(numbers, number)
+		used[number] = true
+		maxNumber = max(maxNumber, number)
+	}
+
+	for number := protowire.Number(1); number < maxNumber; number++ {
+		if !used[number] {
+			reserved = append(reserved, number)
+		}
+	}
+	return numbers, reserved
+}
+
+func (c *protobufSchemaConverter) wrapCollection(
+	collection *protobufType, parentTypeName, fieldName string,
+) *protobufType {
+
+	message := &protobufMessage{
+		typeName: c.messageTypeName("", parentTypeName, fmt.Sprintf("%s_values", fieldName)),
+		wrapper:  true,
+		fields: []*protobufField{{
+			name:      "values",
+			number:    1,
+			fieldType: collection,
+		}},
+	}
+	c.messages = append(c.messages, message)
+	return &protobufType{kind: protobufKindMessage, message: message}
+}
+
+// messageTypeName generates a unique message name from the last component
+// of the schema name. If the name is already taken, or the schema is unnamed,
+// the name is derived from the full schema name or the parent message and
+// field name.
+func (c *protobufSchemaConverter) messageTypeName(
+	name, parentTypeName, fieldName string,
+) string {
+
+	candidates := make([]string, 0, 2)
+	if name != "" {
+		components := strings.Split(name, ".")
+		candidates = append(candidates, toProtobufTypeName(components[len(components)-1]))
+		candidates = append(candidates, toProtobufTypeName(strings.Join(components, "_")))
+	} else if parentTypeName != "" {
+		candidates = append(candidates, parentTypeName+toProtobufTypeName(fieldName))
+	} else {
+		candidates = append(candidates, "Message")
+	}
+
+	for _, candidate := range candidates {
+		if _, present := c.typeNames[candidate]; !present {
+			c.typeNames[candidate] = name
+			return candidate
+		}
+	}
+
+	base := candidates[len(candidates)-1]
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s%d", base, i)
+		if _, present := c.typeNames[candidate]; !present {
+			c.typeNames[candidate] = name
+			return candidate
+		}
+	}
+}
+
+func (m *protobufMessage) appendMessage(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	if m.wrapper {
+		return m.fields[0].appendField(buffer, value)
+	}
+
+	value = indirectValue(value)
+	if value == nil {
+		return buffer, nil
+	}
+
+	values := reflect.ValueOf(value)
+	if values.Kind() != reflect.Map {
+		return nil, errors.Errorf("Protobuf value %v cannot be encoded as message '%s'", value, m.typeName)
+	}
+
+	var err error
+	for _, field := range m.fields {
+		if v := values.MapIndex(reflect.ValueOf(field.sourceName)); v.IsValid() {
+			if buffer, err = field.appendField(buffer, v.Interface()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buffer, nil
+}
+
+// appendField appends the tagged field value. Missing (nil) values are
+// not written, which Protobuf decodes as absent or the zero value.
+func (f *protobufField) appendField(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	value = indirectValue(value)
+	if value == nil {
+		return buffer, nil
+	}
+
+	switch f.fieldType.kind {
+	case protobufKindRepeated:
+		values := reflect.ValueOf(value)
+		if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+			return nil, errors.Errorf("Protobuf value %v cannot be encoded as repeated field", value)
+		}
+		if values.Len() == 0 {
+			return buffer, nil
+		}
+
+		items := f.fieldType.items
+		if items.isPackable() {
+			packed := make([]byte, 0, values.Len()*8)
+			var err error
+			for i := 0; i < values.Len(); i++ {
+				if packed, err = items.appendValue(packed, values.Index(i).Interface()); err != nil {
+					return nil, err
+				}
+			}
+			buffer = protowire.AppendTag(buffer, f.number, protowire.BytesType)
+			return protowire.AppendBytes(buffer, packed), nil
+		}
+
+		var err error
+		for i := 0; i < values.Len(); i++ {
+			buffer = protowire.AppendTag(buffer, f.number, items.wireType())
+			if buffer, err = items.appendValue(buffer, values.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+		return buffer, nil
+
+	case protobufKindMap:
+		values := reflect.ValueOf(value)
+		if values.Kind() != reflect.Map {
+			return nil, errors.Errorf("Protobuf value %v cannot be encoded as map field", value)
+		}
+
+		items := f.fieldType.items
+		iterator := values.MapRange()
+		for iterator.Next() {
+			entry := protowire.AppendTag(make([]byte, 0, 64), 1, protowire.BytesType)
+			entry = protowire.AppendString(entry, avroString(iterator.Key().Interface()))
+			if entryValue := indirectValue(iterator.Value().Interface()); entryValue != nil {
+				var err error
+				entry = protowire.AppendTag(entry, 2, items.wireType())
+				if entry, err = items.appendValue(entry, entryValue); err != nil {
+					return nil, err
+				}
+			}
+			buffer = protowire.AppendTag(buffer, f.number, protowire.BytesType)
+			buffer = protowire.AppendBytes(buffer, entry)
+		}
+		return buffer, nil
+	}
+
+	buffer = protowire.AppendTag(buffer, f.number, f.fieldType.wireType())
+	return f.fieldType.appendValue(buffer, value)
+}
+
+// appendValue appends the untagged value. Missing values are
+// encoded as the type's zero value.
+func (t *protobufType) appendValue(
+	buffer []byte, value any,
+) ([]byte, error) {
+
+	value = indirectValue(value)
+	switch t.kind {
+	case protobufKindBool:
+		v := false
+		if value != nil {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, errors.Errorf("Protobuf value %v cannot be encoded as bool", value)
+			}
+			v = b
+		}
+		return protowire.AppendVarint(buffer, protowire.EncodeBool(v)), nil
+
+	case protobufKindInt32, protobufKindInt64:
+		v, err := avroInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == protobufKindInt32 {
+			v = int64(int32(v))
+		}
+		return protowire.AppendVarint(buffer, uint64(v)), nil
+
+	case protobufKindFloat:
+		v, err := avroFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendFixed32(buffer, math.Float32bits(float32(v))), nil
+
+	case protobufKindDouble:
+		v, err := avroFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendFixed64(buffer, math.Float64bits(v)), nil
+
+	case protobufKindBytes:
+		switch b := value.(type) {
+		case []byte:
+			return protowire.AppendBytes(buffer, b), nil
+		case string:
+			return protowire.AppendString(buffer, b), nil
+		case nil:
+			return protowire.AppendBytes(buffer, nil), nil
+		}
+		return nil, errors.Errorf("Protobuf value %v cannot be encoded as bytes", value)
+
+	case protobufKindString:
+		return protowire.AppendString(buffer, avroString(value)), nil
+
+	case protobufKindMessage:
+		message, err := t.message.appendMessage(make([]byte, 0, 128), value)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendBytes(buffer, message), nil
+	}
+	return nil, errors.Errorf("Protobuf type '%s' not supported", t.kind)
+}
+
+func sanitizeProtobufPackageName(
+	packageName string,
+) string {
+
+	components := make([]string, 0)
+	for _, component := range strings.Split(packageName, ".") {
+		if component == "" {
+			continue
+		}
+		components = append(components, strings.ToLower(sanitizeIdentifier(component)))
+	}
+	return strings.Join(components, ".")
+}
+
+func toProtobufTypeName(
+	name string,
+) string {
+
+	builder := strings.Builder{}
+	upper := true
+	for _, r := range sanitizeIdentifier(name) {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		builder.WriteRune(r)
+	}
+	if builder.Len() == 0 || unicode.IsDigit([]rune(builder.String())[0]) {
+		return "M" + builder.String()
+	}
+	return builder.String()
+}
@@ -0,0 +1,182 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package encoding
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"testing"
+)
+
+func Test_Protobuf_Definition_Generation(
+	t *testing.T,
+) {
+
+	tableSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Value").
+		Field("id", 0, schema.Int32()).
+		Field("device-name", 1, schema.String().Optional()).
+		Field("tags", 2, schema.NewSchemaBuilder(schema.ARRAY).ValueSchema(schema.String())).
+		Field("matrix", 3, schema.NewSchemaBuilder(schema.ARRAY).
+			ValueSchema(schema.NewSchemaBuilder(schema.ARRAY).ValueSchema(schema.Float64()))).
+		Field("attributes", 4, schema.HStore())
+
+	keySchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Key").
+		Field("id", 0, schema.Int32()).
+		Build()
+
+	envelopeSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Envelope").
+		Field(schema.FieldNameBefore, 0, tableSchema.Clone().Optional()).
+		Field(schema.FieldNameAfter, 1, tableSchema.Clone()).
+		Field(schema.FieldNameOperation, 2, schema.String()).
+		Build()
+
+	definition, err := GenerateProtobufDefinition("prefix.public.metrics", keySchema, envelopeSchema)
+	assert.NoError(t, err)
+	assert.Equal(t, `// Generated by timescaledb-event-streamer. DO NOT EDIT.
+syntax = "proto3";
+
+package prefix.public.metrics;
+
+message Key {
+  int32 id = 1;
+}
+
+message Envelope {
+  Value before = 1;
+  Value after = 2;
+  string op = 3;
+}
+
+message Value {
+  int32 id = 1;
+  optional string device_name = 2;
+  repeated string tags = 3;
+  repeated ValueMatrixValues matrix = 4;
+  map<string, string> attributes = 5;
+}
+
+message ValueMatrixValues {
+  repeated double values = 1;
+}
+`, definition)
+}
+
+func Test_Protobuf_Stable_Field_Numbers(
+	t *testing.T,
+) {
+
+	// "name" (index 1) and "value" (index 3) were dropped, "added" was
+	// appended afterward
+	valueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Value").
+		Field("id", 0, schema.Int32()).
+		Field("samples", 2, schema.Int64()).
+		Field("added", 4, schema.String()).
+		Build()
+
+	definition, err := GenerateProtobufDefinition("prefix.public.metrics", valueSchema)
+	assert.NoError(t, err)
+	assert.Equal(t, `// Generated by timescaledb-event-streamer. DO NOT EDIT.
+syntax = "proto3";
+
+package prefix.public.metrics;
+
+message Value {
+  reserved 2, 4;
+  int32 id = 1;
+  int64 samples = 3;
+  string added = 5;
+}
+`, definition)
+
+	encoder := NewProtobufEncoder()
+	data, err := encoder.EncodeEnvelope("prefix.public.metrics", schema.Envelope(valueSchema, schema.Struct{
+		"id":      int32(1),
+		"samples": int64(2),
+		"added":   "foo",
+	}))
+	assert.NoError(t, err)
+
+	expected := protowire.AppendTag(nil, 1, protowire.VarintType)
+	expected = protowire.AppendVarint(expected, 1)
+	expected = protowire.AppendTag(expected, 3, protowire.VarintType)
+	expected = protowire.AppendVarint(expected, 2)
+	expected = protowire.AppendTag(expected, 5, protowire.BytesType)
+	expected = protowire.AppendString(expected, "foo")
+	assert.Equal(t, expected, data)
+}
+
+func Test_Protobuf_Encoding(
+	t *testing.T,
+) {
+
+	valueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Value").
+		Field("id", 0, schema.Int32()).
+		Field("name", 1, schema.String().Optional()).
+		Field("value", 2, schema.Float64().Optional()).
+		Field("samples", 3, schema.NewSchemaBuilder(schema.ARRAY).ValueSchema(schema.Int64())).
+		Field("attributes", 4, schema.HStore()).
+		Build()
+
+	encoder := NewProtobufEncoder()
+	data, err := encoder.EncodeEnvelope("prefix.public.metrics", schema.Envelope(valueSchema, schema.Struct{
+		"id":         lo.ToPtr(int32(-1)),
+		"name":       nil,
+		"value":      12.5,
+		"samples":    []int64{1, 2},
+		"attributes": map[string]*string{"foo": lo.ToPtr("bar")},
+	}))
+	assert.NoError(t, err)
+
+	expected := protowire.AppendTag(nil, 1, protowire.VarintType)
+	expected = protowire.AppendVarint(expected, math.MaxUint64)
+	expected = protowire.AppendTag(expected, 3, protowire.Fixed64Type)
+	expected = protowire.AppendFixed64(expected, math.Float64bits(12.5))
+	expected = protowire.AppendTag(expected, 4, protowire.BytesType)
+	expected = protowire.AppendBytes(expected, []byte{1, 2})
+	entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, "foo")
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendString(entry, "bar")
+	expected = protowire.AppendTag(expected, 5, protowire.BytesType)
+	expected = protowire.AppendBytes(expected, entry)
+	assert.Equal(t, expected, data)
+
+	// Only the latest schema of a topic is cached
+	rebuiltValueSchema := schema.NewSchemaBuilder(schema.STRUCT).
+		SchemaName("prefix.public.metrics.Value").
+		Field("id", 0, schema.Int32()).
+		Build()
+
+	_, err = encoder.EncodeEnvelope("prefix.public.metrics", schema.Envelope(rebuiltValueSchema, schema.Struct{
+		"id": int32(1),
+	}))
+	assert.NoError(t, err)
+	assert.Len(t, encoder.schemas, 1)
+
+	// Null payloads are encoded as null values
+	data, err = encoder.EncodeEnvelope("prefix.public.metrics", schema.Envelope(valueSchema, nil))
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+}
@@ -0,0 +1,170 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package encoding
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/goccy/go-json"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+)
+
+// SchemaRegistryClient is a minimal client for Confluent-compatible
+// schema registries. Registered schemas are cached by subject and
+// schema definition, to prevent unnecessary roundtrips.
+type SchemaRegistryClient struct {
+	baseUrl    string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	mutex     sync.Mutex
+	schemaIds map[string]int32
+}
+
+func NewSchemaRegistryClientWithConfig(
+	c *config.Config,
+) (*SchemaRegistryClient, error) {
+
+	baseUrl := config.GetOrDefault(c, config.PropertyAvroSchemaRegistryUrl, "")
+	if baseUrl == "" {
+		return nil, errors.Errorf("Schema registry needs the url to be configured")
+	}
+
+	username := config.GetOrDefault(c, config.PropertyAvroSchemaRegistryUsername, "")
+	password := config.GetOrDefault(c, config.PropertyAvroSchemaRegistryPassword, "")
+	timeout := config.GetOrDefault(c, config.PropertyAvroSchemaRegistryTimeout, time.Duration(30))
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.GetOrDefault(c, config.PropertyAvroSchemaRegistryTlsEnabled, false) {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: config.GetOrDefault(
+				c, config.PropertyAvroSchemaRegistryTlsSkipVerify, false,
+			),
+			ClientAuth: config.GetOrDefault(
+				c, config.PropertyAvroSchemaRegistryTlsClientAuth, tls.NoClientCert,
+			),
+		}
+	}
+
+	httpClient := &http.Client{
+		Transport: transport,
+		Timeout:   timeout * time.Second,
+	}
+
+	return NewSchemaRegistryClient(baseUrl, username, password, httpClient), nil
+}
+
+func NewSchemaRegistryClient(
+	baseUrl, username, password string, httpClient *http.Client,
+) *SchemaRegistryClient {
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &SchemaRegistryClient{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		username:   username,
+		password:   password,
+		httpClient: httpClient,
+		schemaIds:  make(map[string]int32),
+	}
+}
+
+// Register registers the schema definition for the given subject
+// and returns the global schema id assigned by the registry. If the
+// schema is already known to the registry, the existing id is returned.
+// An empty schemaType defaults to AVRO.
+func (s *SchemaRegistryClient) Register(
+	subject, schemaType, schemaDefinition string,
+) (int32, error) {
+
+	cacheKey := subject + "\x00" + schemaType + "\x00" + schemaDefinition
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if schemaId, present := s.schemaIds[cacheKey]; present {
+		return schemaId, nil
+	}
+
+	request := struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType,omitempty"`
+	}{
+		Schema:     schemaDefinition,
+		SchemaType: schemaType,
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+
+	endpoint := fmt.Sprintf("%s/subjects/%s/versions", s.baseUrl, url.PathEscape(subject))
+	httpRequest, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+	httpRequest.Header.Set("Content-Type", schemaRegistryContentType)
+	httpRequest.Header.Set("Accept", schemaRegistryContentType)
+	if s.username != "" {
+		httpRequest.SetBasicAuth(s.username, s.password)
+	}
+
+	httpResponse, err := s.httpClient.Do(httpRequest)
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+	defer httpResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		return 0, errors.Errorf(
+			"Schema registry failed to register subject '%s' (status: %d): %s",
+			subject, httpResponse.StatusCode, string(responseBody),
+		)
+	}
+
+	response := struct {
+		Id int32 `json:"id"`
+	}{}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+
+	s.schemaIds[cacheKey] = response.Id
+	return response.Id, nil
+}
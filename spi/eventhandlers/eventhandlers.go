@@ -152,3 +152,11 @@ type SystemCatalogReplicationEventHandler interface {
 		xld pgtypes.XLogData, relationId uint32, oldValues map[string]any,
 	) error
 }
+
+type SchemaChangeEventHandler interface {
+	BaseReplicationEventHandler
+	OnSchemaChangedEvent(
+		xld pgtypes.XLogData, table schema.TableAlike, version uint32,
+		oldColumns, newColumns []systemcatalog.Column, statements []string,
+	) error
+}
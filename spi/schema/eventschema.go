@@ -30,6 +30,7 @@ const MessageBlockSchemaName = "io.debezium.connector.postgresql.Message"
 const MessageKeySchemaName = "io.debezium.connector.postgresql.MessageKey"
 const MessageValueSchemaName = "io.debezium.connector.postgresql.MessageValue"
 const TimescaleEventSchemaName = "com.timescale.Event"
+const SchemaChangeColumnSchemaName = "com.timescale.SchemaChangeColumn"
 
 type Operation string
 
@@ -41,6 +42,7 @@ const (
 	OP_TRUNCATE  Operation = "t"
 	OP_MESSAGE   Operation = "m"
 	OP_TIMESCALE Operation = "$"
+	OP_SCHEMA    Operation = "s"
 )
 
 type TimescaleOperation string
@@ -177,6 +179,43 @@ func DecompressionEvent(
 	return event
 }
 
+func SchemaChangeEvent(
+	version uint32, before, after []Struct, ddl []string, source Struct,
+) Struct {
+
+	event := make(Struct)
+	event[FieldNameOperation] = string(OP_SCHEMA)
+	event[FieldNameVersion] = int32(version)
+	if before != nil {
+		event[FieldNameBefore] = before
+	}
+	event[FieldNameAfter] = after
+	event[FieldNameDDL] = ddl
+	if source != nil {
+		event[FieldNameSource] = source
+	}
+	event[FieldNameTimestamp] = time.Now().UnixMilli()
+	return event
+}
+
+func SchemaChangeColumn(
+	name, typeDefinition string, dataType uint32, nullable, primaryKey, dimension bool, defaultValue *string,
+) Struct {
+
+	column := Struct{
+		FieldNameName:       name,
+		FieldNameTypeDef:    typeDefinition,
+		FieldNameDataType:   int64(dataType),
+		FieldNameNullable:   nullable,
+		FieldNamePrimaryKey: primaryKey,
+		FieldNameDimension:  dimension,
+	}
+	if defaultValue != nil {
+		column[FieldNameDefault] = *defaultValue
+	}
+	return column
+}
+
 func MessageKey(
 	prefix string,
 ) Struct {
@@ -206,8 +245,11 @@ func Envelope(
 	}
 }
 
+// Source creates the source block of an event. The lsn is the
+// position the event was received at, which may be shared by many
+// events, while the sequence uniquely identifies the event's change.
 func Source(
-	lsn pglogrepl.LSN, timestamp time.Time, snapshot bool,
+	lsn pglogrepl.LSN, sequence string, timestamp time.Time, snapshot bool,
 	databaseName, schemaName, hypertableName string, transactionId *uint32,
 ) Struct {
 
@@ -222,6 +264,7 @@ func Source(
 		FieldNameTable:     hypertableName,
 		FieldNameTxId:      transactionId,
 		FieldNameLSN:       lsn.String(),
+		FieldNameSequence:  sequence,
 	}
 }
 
@@ -284,6 +327,39 @@ func EnvelopeSchema(
 		Build()
 }
 
+func SchemaChangeEnvelopeSchema(
+	nameGenerator NameGenerator, table TableAlike,
+) Struct {
+
+	schemaTopicName := nameGenerator.SchemaTopicName(table)
+	envelopeSchemaName := fmt.Sprintf("%s.SchemaChange", schemaTopicName)
+
+	return NewSchemaBuilder(STRUCT).
+		SchemaName(envelopeSchemaName).
+		Required().
+		Field(FieldNameVersion, -1, Int32().Required()).
+		Field(FieldNameBefore, -1, NewSchemaBuilder(ARRAY).ValueSchema(SchemaChangeColumnSchema())).
+		Field(FieldNameAfter, -1, NewSchemaBuilder(ARRAY).ValueSchema(SchemaChangeColumnSchema()).Required()).
+		Field(FieldNameDDL, -1, NewSchemaBuilder(ARRAY).ValueSchema(String().Required()).Required()).
+		Field(FieldNameSource, -1, SourceSchema()).
+		Field(FieldNameOperation, -1, String().Required()).
+		Field(FieldNameTimestamp, -1, Int64()).
+		Build()
+}
+
+func SchemaChangeColumnSchema() Builder {
+	return NewSchemaBuilder(STRUCT).
+		SchemaName(SchemaChangeColumnSchemaName).
+		Required().
+		Field(FieldNameName, -1, String().Required()).
+		Field(FieldNameTypeDef, -1, String().Required()).
+		Field(FieldNameDataType, -1, Int64().Required()).
+		Field(FieldNameNullable, -1, Boolean().Required()).
+		Field(FieldNamePrimaryKey, -1, Boolean().Required()).
+		Field(FieldNameDimension, -1, Boolean().Required()).
+		Field(FieldNameDefault, -1, String())
+}
+
 func EnvelopeMessageSchema(
 	nameGenerator NameGenerator,
 ) Struct {
@@ -313,12 +389,13 @@ func SourceSchema() Builder {
 		Field(FieldNameVersion, -1, String().Required()).
 		Field(FieldNameConnector, -1, String().Required()).
 		Field(FieldNameName, -1, String().Required()).
-		Field(FieldNameTimestamp, -1, String().Required()).
+		Field(FieldNameTimestamp, -1, Int64().Required()).
 		Field(FieldNameSnapshot, -1, Boolean().DefaultValue(lo.ToPtr("false"))).
 		Field(FieldNameSchema, -1, String().Required()).
 		Field(FieldNameTable, -1, String().Required()).
 		Field(FieldNameTxId, -1, Int64()).
-		Field(FieldNameLSN, -1, Int64()).
+		Field(FieldNameLSN, -1, String()).
+		Field(FieldNameSequence, -1, String()).
 		Field(FieldNameXmin, -1, Int64())
 }
 
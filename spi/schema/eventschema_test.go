@@ -0,0 +1,52 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package schema
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_SourceSchema_Json(
+	t *testing.T,
+) {
+
+	data, err := json.Marshal(SourceSchema().Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields without explicit index are ordered by name
+	assert.JSONEq(t, `{
+		"type": "struct",
+		"name": "io.debezium.connector.postgresql.Source",
+		"field": "source",
+		"fields": [
+			{"type": "string", "field": "connector"},
+			{"type": "string", "field": "lsn"},
+			{"type": "string", "field": "name"},
+			{"type": "string", "field": "schema"},
+			{"type": "string", "field": "sequence"},
+			{"type": "boolean", "field": "snapshot", "default": false},
+			{"type": "string", "field": "table"},
+			{"type": "int64", "field": "ts_ms"},
+			{"type": "int64", "field": "txId"},
+			{"type": "string", "field": "version"},
+			{"type": "int64", "field": "xmin"}
+		]
+	}`, string(data))
+}
@@ -421,6 +421,10 @@ func (s *schemaBuilderImpl) Build() Struct {
 		schemaStruct[FieldNameValueSchema] = s.valueSchemaBuilder.Build()
 	case STRUCT:
 		fields := functional.Sort(lo.Values(s.fields), func(this, other Field) bool {
+			// Fields without explicit index are ordered by name to keep a stable order
+			if this.Index() == other.Index() {
+				return this.SchemaBuilder().GetFieldName() < other.SchemaBuilder().GetFieldName()
+			}
 			return this.Index() < other.Index()
 		})
 
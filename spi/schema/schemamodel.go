@@ -79,6 +79,12 @@ const (
 	FieldNameValueSchema FieldName = "valueSchema"
 	FieldNameAllowed     FieldName = "allowed"
 	FieldNameLength      FieldName = "length"
+	FieldNameDDL         FieldName = "ddl"
+	FieldNameDataType    FieldName = "dataType"
+	FieldNameTypeDef     FieldName = "typeDefinition"
+	FieldNameNullable    FieldName = "nullable"
+	FieldNamePrimaryKey  FieldName = "primaryKey"
+	FieldNameDimension   FieldName = "dimension"
 )
 
 type Struct = map[FieldName]any
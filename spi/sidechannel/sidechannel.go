@@ -116,6 +116,9 @@ type SideChannel interface {
 	ExistsReplicationSlot(
 		slotName string,
 	) (found bool, err error)
+	IsReplicationSlotActive(
+		slotName string,
+	) (active bool, err error)
 	ReadPgTypes(
 		factory pgtypes.TypeFactory, cb func(typ pgtypes.PgType) error, oids ...uint32,
 	) error
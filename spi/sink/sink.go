@@ -19,6 +19,7 @@ package sink
 
 import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"time"
 )
@@ -33,6 +34,64 @@ type Sink interface {
 	) error
 }
 
+// AcknowledgeFunc is called by asynchronous sinks when the delivery
+// of an event was confirmed (err is nil) or has finally failed.
+type AcknowledgeFunc func(err error)
+
+// AsyncSink is an optional extension of Sink for sinks which publish
+// events asynchronously. If EmitAsync returns an error, the event wasn't
+// accepted and the AcknowledgeFunc is never called. Otherwise, the
+// AcknowledgeFunc is called exactly once, potentially from another
+// goroutine and not necessarily in emit order.
+type AsyncSink interface {
+	Sink
+	EmitAsync(
+		context Context, timestamp time.Time, topicName string, key, envelope schema.Struct, ack AcknowledgeFunc,
+	) error
+}
+
+// TransactionalSink is an optional extension of Sink for sinks which
+// publish all events of a PostgreSQL transaction atomically. Events are
+// only acknowledged after the transaction was committed. The sink stores
+// the end LSN of each committed transaction and provides the last one
+// as the restart point after a restart.
+type TransactionalSink interface {
+	Sink
+	BeginTransaction(
+		xid uint32,
+	) error
+	CommitTransaction(
+		transactionEndLSN pgtypes.LSN,
+	) error
+	CommittedLSN() (lsn pgtypes.LSN, present bool, err error)
+}
+
+// TransactionAwareSink is an optional extension of Sink for sinks which
+// need to know the transaction an event belongs to, without publishing
+// transactions atomically. OnBeginTransaction is called before the first
+// event of a transaction with the LSN of the transaction's commit record,
+// OnCommitTransaction after the last one.
+type TransactionAwareSink interface {
+	Sink
+	OnBeginTransaction(
+		xid uint32, commitLSN pgtypes.LSN,
+	) error
+	OnCommitTransaction(
+		transactionEndLSN pgtypes.LSN,
+	) error
+}
+
+// SchemaAwareSink is an optional extension of Sink for sinks which need
+// to know the definition of the tables they receive events for, e.g. to
+// create the target table. OnTableSchema is called before the first event
+// of a table is emitted, and again after the table's schema has changed.
+type SchemaAwareSink interface {
+	Sink
+	OnTableSchema(
+		table schema.TableAlike,
+	) error
+}
+
 type SinkFunc func(context Context, timestamp time.Time, topicName string, key, envelope schema.Struct) error
 
 func (sf SinkFunc) Start() error {
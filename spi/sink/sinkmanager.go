@@ -18,6 +18,7 @@
 package sink
 
 import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"time"
 )
@@ -28,4 +29,17 @@ type Manager interface {
 	Emit(
 		timestamp time.Time, topicName string, key, envelope schema.Struct,
 	) error
+	EmitAsync(
+		timestamp time.Time, topicName string, key, envelope schema.Struct, ack AcknowledgeFunc,
+	) error
+	BeginTransaction(
+		xid uint32, commitLSN pgtypes.LSN,
+	) error
+	CommitTransaction(
+		transactionEndLSN pgtypes.LSN,
+	) error
+	CommittedLSN() (lsn pgtypes.LSN, present bool, err error)
+	OnTableSchema(
+		table schema.TableAlike,
+	) error
 }
@@ -21,6 +21,7 @@ import (
 	"encoding"
 	"github.com/go-errors/errors"
 	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"maps"
 )
 
 func init() {
@@ -108,3 +109,7 @@ func (d *dummyStateStorage) SetEncodedState(
 
 	d.encodedStates[key] = encodedState
 }
+
+func (d *dummyStateStorage) EncodedStates() map[string][]byte {
+	return maps.Clone(d.encodedStates)
+}
@@ -18,28 +18,41 @@
 package statestorage
 
 import (
+	"bytes"
 	"encoding"
 	"encoding/binary"
-	"github.com/docker/docker/pkg/ioutils"
+	"fmt"
 	"github.com/go-errors/errors"
 	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
 	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"hash/crc32"
+	"maps"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
 	"time"
 )
 
+const (
+	stateFileMagic      = "TSES"
+	stateFileVersion    = 2
+	stateFileHeaderSize = 14
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
 func init() {
 	RegisterStateStorage(spiconfig.FileStorage, newFileStateStorage)
 }
 
 type fileStateStorage struct {
-	path    string
-	mutex   sync.Mutex
-	logger  *logging.Logger
-	offsets map[string]*Offset
+	path        string
+	generations int
+	mutex       sync.Mutex
+	logger      *logging.Logger
+	offsets     map[string]*Offset
 
 	encodedStates map[string][]byte
 
@@ -55,11 +68,19 @@ func newFileStateStorage(
 	if path == "" {
 		return nil, errors.Errorf("FileStateStorage needs a path to be configured")
 	}
-	return NewFileStateStorage(path)
+
+	generations := spiconfig.GetOrDefault(config, spiconfig.PropertyFileStateStorageGenerations, 5)
+	if generations < 0 {
+		return nil, errors.Errorf("FileStateStorage generations must not be negative, but was %d", generations)
+	}
+	return NewFileStateStorage(path, generations)
 }
 
+// NewFileStateStorage creates a file based Storage, which keeps
+// the given number of previous generations of the state file
+// next to it (<path>.1 being the most recent one)
 func NewFileStateStorage(
-	path string,
+	path string, generations int,
 ) (Storage, error) {
 
 	logger, err := logging.NewLogger("FileStateStorage")
@@ -98,6 +119,7 @@ func NewFileStateStorage(
 
 	return &fileStateStorage{
 		path:           path,
+		generations:    generations,
 		logger:         logger,
 		shutdownWaiter: waiting.NewShutdownAwaiter(),
 		offsets:        make(map[string]*Offset),
@@ -137,44 +159,20 @@ func (f *fileStateStorage) Save() error {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
-	writer, err := ioutils.NewAtomicFileWriter(f.path, 0777)
+	data, err := encodeState(f.offsets, f.encodedStates)
 	if err != nil {
-		return errors.Wrap(err, 0)
-	}
-	defer writer.Close()
-
-	data := make([]byte, 0)
-	data = binary.BigEndian.AppendUint32(data, uint32(len(f.offsets)))
-	for key, value := range f.offsets {
-		keyBytes := []byte(key)
-		data = binary.BigEndian.AppendUint32(data, uint32(len(keyBytes)))
-		data = append(data, keyBytes...)
-
-		valueBytes, err := value.MarshalBinary()
-		if err != nil {
-			return err
-		}
-		data = binary.BigEndian.AppendUint32(data, uint32(len(valueBytes)))
-		data = append(data, valueBytes...)
+		return err
 	}
 
-	encodedStates := make(map[string][]byte)
-	for name, encodedState := range f.encodedStates {
-		encodedStates[name] = encodedState
+	// Unchanged state would only push the previous generations out
+	if current, err := readStateFilePayload(f.path); err == nil && bytes.Equal(current, data) {
+		return nil
 	}
 
-	data = binary.BigEndian.AppendUint32(data, uint32(len(encodedStates)))
-	for name, encodedState := range encodedStates {
-		nameBytes := []byte(name)
-		data = binary.BigEndian.AppendUint32(data, uint32(len(nameBytes)))
-		data = append(data, nameBytes...)
-
-		data = binary.BigEndian.AppendUint32(data, uint32(len(encodedState)))
-		data = append(data, encodedState...)
+	if err := f.rotateGenerations(); err != nil {
+		return err
 	}
-
-	_, err = writer.Write(data)
-	return err
+	return writeFileAtomically(f.path, encodeStateFile(data))
 }
 
 func (f *fileStateStorage) Load() error {
@@ -204,64 +202,27 @@ func (f *fileStateStorage) Load() error {
 		return nil
 	}
 
-	file, err := os.Open(f.path)
+	buffer, err := os.ReadFile(f.path)
 	if err != nil {
 		return errors.Wrap(err, 0)
 	}
 
-	buffer := make([]byte, fi.Size())
-	if _, err := file.Read(buffer); err != nil {
-		return errors.Wrap(err, 0)
-	}
-
-	readerOffset := int64(0)
-	readUint32 := func() uint32 {
-		val := binary.BigEndian.Uint32(buffer[readerOffset : readerOffset+4])
-		readerOffset += 4
-		return val
-	}
-
-	readString := func() string {
-		length := readUint32()
-		val := string(buffer[readerOffset : readerOffset+int64(length)])
-		readerOffset += int64(length)
-		return val
-	}
-
-	readOffset := func() (*Offset, error) {
-		length := readUint32()
-		o := &Offset{}
-		if err := o.UnmarshalBinary(buffer[readerOffset : readerOffset+int64(length)]); err != nil {
-			return nil, err
-		}
-		readerOffset += int64(length)
-		return o, nil
+	data, err := decodeStateFile(buffer)
+	if err != nil {
+		return errors.Errorf(
+			"state file '%s' can't be read, previous generations are available as '%s.<n>': %s",
+			f.path, f.path, err.Error(),
+		)
 	}
 
-	readEncodedState := func() ([]byte, error) {
-		length := readUint32()
-		data := buffer[readerOffset : readerOffset+int64(length)]
-		readerOffset += int64(length)
-		return data, nil
+	offsets, encodedStates, err := decodeState(data)
+	if err != nil {
+		return errors.Wrap(err, 0)
 	}
-
-	numOfOffsets := readUint32()
-	for i := uint32(0); i < numOfOffsets; i++ {
-		key := readString()
-		value, err := readOffset()
-		if err != nil {
-			return errors.Wrap(err, 0)
-		}
+	for key, value := range offsets {
 		f.offsets[key] = value
 	}
-
-	numOfEncodedStates := readUint32()
-	for i := uint32(0); i < numOfEncodedStates; i++ {
-		name := readString()
-		encodedState, err := readEncodedState()
-		if err != nil {
-			return errors.Wrap(err, 0)
-		}
+	for name, encodedState := range encodedStates {
 		f.encodedStates[name] = encodedState
 	}
 	return nil
@@ -327,6 +288,12 @@ func (f *fileStateStorage) SetEncodedState(
 	f.encodedStates[key] = encodedState
 }
 
+func (f *fileStateStorage) EncodedStates() map[string][]byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return maps.Clone(f.encodedStates)
+}
+
 func (f *fileStateStorage) autoStoreHandler() {
 	for {
 		select {
@@ -343,3 +310,157 @@ func (f *fileStateStorage) autoStoreHandler() {
 		}
 	}
 }
+
+// rotateGenerations shifts all previous generations by one and
+// copies the current state file into the first generation. Every
+// step replaces a single file atomically, which keeps the current
+// state file intact if the streamer crashes in between.
+func (f *fileStateStorage) rotateGenerations() error {
+	if f.generations == 0 {
+		return nil
+	}
+
+	current, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, 0)
+	}
+
+	for i := f.generations - 1; i > 0; i-- {
+		if err := os.Rename(GenerationPath(f.path, i), GenerationPath(f.path, i+1)); err != nil {
+			if !os.IsNotExist(err) {
+				return errors.Wrap(err, 0)
+			}
+		}
+	}
+	return writeFileAtomically(GenerationPath(f.path, 1), current)
+}
+
+// GenerationPath returns the path of the given previous
+// generation of the state file at path
+func GenerationPath(
+	path string, generation int,
+) string {
+
+	return fmt.Sprintf("%s.%d", path, generation)
+}
+
+// encodeStateFile prepends the file header to the encoded state:
+// magic (4) | version (2) | payload length (4) | payload CRC-32C (4)
+func encodeStateFile(
+	payload []byte,
+) []byte {
+
+	data := make([]byte, 0, stateFileHeaderSize+len(payload))
+	data = append(data, stateFileMagic...)
+	data = binary.BigEndian.AppendUint16(data, stateFileVersion)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(payload)))
+	data = binary.BigEndian.AppendUint32(data, crc32.Checksum(payload, crcTable))
+	return append(data, payload...)
+}
+
+// decodeStateFile validates the file header and returns the
+// encoded state. Files written before the header was introduced
+// are returned as is.
+func decodeStateFile(
+	data []byte,
+) ([]byte, error) {
+
+	if len(data) < len(stateFileMagic) || string(data[:len(stateFileMagic)]) != stateFileMagic {
+		return data, nil
+	}
+
+	if len(data) < stateFileHeaderSize {
+		return nil, errors.Errorf("header truncated")
+	}
+	if version := binary.BigEndian.Uint16(data[4:6]); version != stateFileVersion {
+		return nil, errors.Errorf("unsupported file format version %d", version)
+	}
+	length := binary.BigEndian.Uint32(data[6:10])
+	payload := data[stateFileHeaderSize:]
+	if uint32(len(payload)) != length {
+		return nil, errors.Errorf("expected %d bytes of state, found %d", length, len(payload))
+	}
+	if checksum := crc32.Checksum(payload, crcTable); checksum != binary.BigEndian.Uint32(data[10:14]) {
+		return nil, errors.Errorf("checksum mismatch")
+	}
+	return payload, nil
+}
+
+// ReadStateFile reads the offsets and encoded states from a
+// state file or one of its generations, e.g. for inspection
+func ReadStateFile(
+	path string,
+) (offsets map[string]*Offset, encodedStates map[string][]byte, err error) {
+
+	data, err := readStateFilePayload(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decodeState(data)
+}
+
+func readStateFilePayload(
+	path string,
+) ([]byte, error) {
+
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return decodeStateFile(buffer)
+}
+
+// writeFileAtomically writes the data into a temporary file, syncs
+// it to disk and renames it to the target path. The directory is
+// synced afterwards to persist the rename.
+func writeFileAtomically(
+	path string, data []byte,
+) error {
+
+	directory := filepath.Dir(path)
+	file, err := os.CreateTemp(directory, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	tempPath := file.Name()
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return errors.Wrap(err, 0)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return errors.Wrap(err, 0)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return errors.Wrap(err, 0)
+	}
+	if err := os.Chmod(tempPath, 0644); err != nil {
+		os.Remove(tempPath)
+		return errors.Wrap(err, 0)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return errors.Wrap(err, 0)
+	}
+
+	// Directories can't be synced on Windows
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	dir, err := os.Open(directory)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
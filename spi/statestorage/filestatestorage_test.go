@@ -22,6 +22,7 @@ import (
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
@@ -62,7 +63,7 @@ func Test_Writing_Reading(
 		LSN:            pgtypes.LSN(3000000),
 	}
 
-	offsetStorage, err := NewFileStateStorage(f.Name())
+	offsetStorage, err := NewFileStateStorage(f.Name(), 0)
 	assert.NoError(t, err, "failed to instantiate FileOffsetStorage")
 
 	err = offsetStorage.Start()
@@ -88,7 +89,7 @@ func Test_Writing_Reading(
 	err = offsetStorage.Stop()
 	assert.NoError(t, err, "failed stopping FileOffsetStorage")
 
-	secondOffsetStorage, err := NewFileStateStorage(f.Name())
+	secondOffsetStorage, err := NewFileStateStorage(f.Name(), 0)
 	assert.NoError(t, err, "failed to instantiate FileOffsetStorage")
 
 	err = secondOffsetStorage.Start()
@@ -101,3 +102,95 @@ func Test_Writing_Reading(
 	assert.Equal(t, bar, offsets["bar"])
 	assert.Equal(t, baz, offsets["baz"])
 }
+
+func Test_Generations(
+	t *testing.T,
+) {
+
+	path := filepath.Join(t.TempDir(), "statestorage.dat")
+
+	storage, err := NewFileStateStorage(path, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Start())
+
+	for i := 1; i <= 4; i++ {
+		assert.NoError(t, storage.Set("slot", &Offset{
+			Timestamp: time.Date(2023, 01, 01, 0, 0, 0, 0, time.UTC),
+			LSN:       pgtypes.LSN(i),
+		}))
+		assert.NoError(t, storage.Save())
+	}
+	assert.NoError(t, storage.Stop())
+
+	// The final save in Stop didn't change the state
+	expected := map[string]pgtypes.LSN{
+		path:                    4,
+		GenerationPath(path, 1): 3,
+		GenerationPath(path, 2): 2,
+	}
+	for file, lsn := range expected {
+		offsets, _, err := ReadStateFile(file)
+		assert.NoError(t, err)
+		assert.Equal(t, lsn, offsets["slot"].LSN, file)
+	}
+
+	_, err = os.Stat(GenerationPath(path, 3))
+	assert.True(t, os.IsNotExist(err))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(entries), "temporary files left behind")
+}
+
+func Test_Corrupted_State_File(
+	t *testing.T,
+) {
+
+	path := filepath.Join(t.TempDir(), "statestorage.dat")
+
+	storage, err := NewFileStateStorage(path, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Set("slot", &Offset{LSN: pgtypes.LSN(1000)}))
+	assert.NoError(t, storage.Save())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xFF
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+
+	storage, err = NewFileStateStorage(path, 0)
+	assert.NoError(t, err)
+	err = storage.Load()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+
+	assert.NoError(t, os.WriteFile(path, data[:len(data)-2], 0644))
+	assert.Error(t, storage.Load())
+}
+
+func Test_Legacy_State_File(
+	t *testing.T,
+) {
+
+	path := filepath.Join(t.TempDir(), "statestorage.dat")
+
+	offset := &Offset{
+		Timestamp: time.Date(2023, 01, 01, 0, 0, 0, 0, time.UTC),
+		LSN:       pgtypes.LSN(1000),
+	}
+	data, err := encodeState(map[string]*Offset{"slot": offset}, map[string][]byte{"state": {1, 2, 3}})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+
+	storage, err := NewFileStateStorage(path, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Load())
+
+	offsets, err := storage.Get()
+	assert.NoError(t, err)
+	assert.True(t, offset.Equal(offsets["slot"]))
+
+	state, present := storage.EncodedState("state")
+	assert.True(t, present)
+	assert.Equal(t, []byte{1, 2, 3}, state)
+}
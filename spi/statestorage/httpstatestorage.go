@@ -0,0 +1,221 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"bytes"
+	"github.com/go-errors/errors"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterStateStorage(spiconfig.HttpStorage, newHttpStateStorage)
+}
+
+// httpStore stores the state at a URL of an HTTP key-value store.
+// In etag mode, versions are ETags and writes are conditional by
+// If-Match and If-None-Match headers. In consul mode, versions are
+// Consul modify indexes and writes use the cas query parameter.
+type httpStore struct {
+	url     *url.URL
+	mode    spiconfig.HttpStorageMode
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHttpStateStorage(
+	config *spiconfig.Config,
+) (Storage, error) {
+
+	address := spiconfig.GetOrDefault(config, spiconfig.PropertyHttpStateStorageUrl, "")
+	if address == "" {
+		return nil, errors.Errorf("HttpStateStorage needs a url to be configured")
+	}
+
+	interval := spiconfig.GetOrDefault(config, spiconfig.PropertyHttpStateStorageInterval, 5)
+	if interval <= 0 {
+		return nil, errors.Errorf("HttpStateStorage interval must be positive, but was %d", interval)
+	}
+
+	return NewHttpStateStorage(
+		address,
+		spiconfig.GetOrDefault(config, spiconfig.PropertyHttpStateStorageMode, spiconfig.HttpStorageETag),
+		spiconfig.GetOrDefault(config, spiconfig.PropertyHttpStateStorageHeaders, map[string]string{}),
+		time.Second*time.Duration(spiconfig.GetOrDefault(config, spiconfig.PropertyHttpStateStorageTimeout, 10)),
+		time.Second*time.Duration(interval),
+	)
+}
+
+func NewHttpStateStorage(
+	address string, mode spiconfig.HttpStorageMode, headers map[string]string,
+	timeout, interval time.Duration,
+) (Storage, error) {
+
+	if mode != spiconfig.HttpStorageETag && mode != spiconfig.HttpStorageConsul {
+		return nil, errors.Errorf("HttpStateStorage mode '%s' is unknown", mode)
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	return newKvStateStorage("HttpStateStorage", &httpStore{
+		url:     u,
+		mode:    mode,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+	}, interval)
+}
+
+func (h *httpStore) load() ([]byte, string, error) {
+	query := url.Values{}
+	if h.mode == spiconfig.HttpStorageConsul {
+		query.Set("raw", "")
+	}
+
+	response, err := h.do(http.MethodGet, query, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, "", errors.Errorf("loading state from %s failed with status %s", h, response.Status)
+	}
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", errors.Wrap(err, 0)
+	}
+
+	version := h.version(response)
+	if version == "" {
+		return nil, "", errors.Errorf("%s didn't return a version of the state", h)
+	}
+	return data, version, nil
+}
+
+func (h *httpStore) compareAndSwap(
+	data []byte, version string,
+) (string, error) {
+
+	query := url.Values{}
+	headers := make(map[string]string)
+	if h.mode == spiconfig.HttpStorageConsul {
+		// A cas index of 0 only writes if the key doesn't exist
+		if version == "" {
+			version = "0"
+		}
+		query.Set("cas", version)
+	} else if version == "" {
+		headers["If-None-Match"] = "*"
+	} else {
+		headers["If-Match"] = version
+	}
+
+	response, err := h.do(http.MethodPut, query, headers, data)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusPreconditionFailed {
+		return "", errStateModified
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return "", errors.Errorf("storing state at %s failed with status %s", h, response.Status)
+	}
+
+	if h.mode == spiconfig.HttpStorageConsul {
+		// Consul answers with false if the cas index didn't match,
+		// but doesn't return the new index
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return "", errors.Wrap(err, 0)
+		}
+		if strings.TrimSpace(string(body)) != "true" {
+			return "", errStateModified
+		}
+		return "", nil
+	}
+	return response.Header.Get("ETag"), nil
+}
+
+func (h *httpStore) close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+func (h *httpStore) String() string {
+	return h.url.Redacted()
+}
+
+func (h *httpStore) version(
+	response *http.Response,
+) string {
+
+	if h.mode == spiconfig.HttpStorageConsul {
+		return response.Header.Get("X-Consul-Index")
+	}
+	return response.Header.Get("ETag")
+}
+
+func (h *httpStore) do(
+	method string, query url.Values, headers map[string]string, body []byte,
+) (*http.Response, error) {
+
+	u := *h.url
+	values := u.Query()
+	for key, value := range query {
+		values[key] = value
+	}
+	u.RawQuery = values.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	for key, value := range h.headers {
+		request.Header.Set(key, value)
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return response, nil
+}
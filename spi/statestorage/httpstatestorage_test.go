@@ -0,0 +1,142 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"fmt"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kvServer is a minimal key-value store supporting
+// the ETag and the Consul compare-and-swap semantics
+type kvServer struct {
+	mutex   sync.Mutex
+	data    []byte
+	version int
+}
+
+func (k *kvServer) ServeHTTP(
+	w http.ResponseWriter, r *http.Request,
+) {
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	consul := r.URL.Query().Has("raw") || r.URL.Query().Has("cas")
+	switch r.Method {
+	case http.MethodGet:
+		if k.data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if consul {
+			w.Header().Set("X-Consul-Index", strconv.Itoa(k.version))
+		} else {
+			w.Header().Set("ETag", fmt.Sprintf(`"%d"`, k.version))
+		}
+		_, _ = w.Write(k.data)
+
+	case http.MethodPut:
+		var matches bool
+		if consul {
+			cas := r.URL.Query().Get("cas")
+			matches = (cas == "0" && k.data == nil) || (k.data != nil && cas == strconv.Itoa(k.version))
+		} else if r.Header.Get("If-None-Match") == "*" {
+			matches = k.data == nil
+		} else {
+			matches = k.data != nil && r.Header.Get("If-Match") == fmt.Sprintf(`"%d"`, k.version)
+		}
+
+		if !matches {
+			if consul {
+				_, _ = w.Write([]byte("false"))
+			} else {
+				w.WriteHeader(http.StatusPreconditionFailed)
+			}
+			return
+		}
+
+		k.data, _ = io.ReadAll(r.Body)
+		k.version++
+		if consul {
+			_, _ = w.Write([]byte("true"))
+		} else {
+			w.Header().Set("ETag", fmt.Sprintf(`"%d"`, k.version))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+func Test_Http_State_Storage(
+	t *testing.T,
+) {
+
+	for _, mode := range []config.HttpStorageMode{config.HttpStorageETag, config.HttpStorageConsul} {
+		t.Run(string(mode), func(t *testing.T) {
+			server := httptest.NewServer(&kvServer{})
+			defer server.Close()
+
+			newStorage := func() Storage {
+				storage, err := NewHttpStateStorage(server.URL+"/v1/kv/state", mode, nil, time.Second, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := storage.Start(); err != nil {
+					t.Fatal(err)
+				}
+				return storage
+			}
+
+			offset := &Offset{
+				Timestamp: time.Date(2023, 01, 01, 0, 0, 0, 0, time.UTC),
+				LSN:       pgtypes.LSN(1000000),
+			}
+
+			storage := newStorage()
+			assert.NoError(t, storage.Set("slot", offset))
+			storage.SetEncodedState("snapshotContext", []byte{1, 2, 3})
+			assert.NoError(t, storage.Save())
+			// Consecutive saves continue with the new version
+			assert.NoError(t, storage.Stop())
+
+			storage = newStorage()
+			offsets, err := storage.Get()
+			assert.NoError(t, err)
+			assert.True(t, offset.Equal(offsets["slot"]))
+			encodedState, present := storage.EncodedState("snapshotContext")
+			assert.True(t, present)
+			assert.Equal(t, []byte{1, 2, 3}, encodedState)
+
+			// A second instance writing the same state is detected
+			other := newStorage()
+			assert.NoError(t, other.Save())
+			assert.Error(t, storage.Save())
+			assert.Error(t, storage.Save())
+			assert.NoError(t, other.Save())
+			assert.NoError(t, other.Stop())
+		})
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"bytes"
+	"encoding"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	"maps"
+	"sync"
+	"time"
+)
+
+// errStateModified is returned by a kvStore if the
+// stored state doesn't match the expected version
+var errStateModified = errors.New("state was modified concurrently")
+
+// kvStore stores the whole state as a single versioned record
+type kvStore interface {
+	// load returns the stored state and its version, or
+	// nil if no state is stored yet
+	load() (data []byte, version string, err error)
+	// compareAndSwap stores the state, if the stored version still
+	// matches the given version. An empty version requires that no
+	// state is stored yet. If the store doesn't provide the new
+	// version, an empty version is returned.
+	compareAndSwap(
+		data []byte, version string,
+	) (newVersion string, err error)
+	close() error
+	String() string
+}
+
+// kvStateStorage is the base of all storages writing the state
+// into a key-value store with compare-and-swap semantics. Every
+// write is conditional on the state not being modified since it
+// was read, which detects a second streamer instance accidentally
+// writing the same state. Once detected, the state isn't written
+// anymore to not overwrite the other instance's state.
+type kvStateStorage struct {
+	store    kvStore
+	interval time.Duration
+	logger   *logging.Logger
+
+	mutex         sync.Mutex
+	saveMutex     sync.Mutex
+	offsets       map[string]*Offset
+	encodedStates map[string][]byte
+	version       string
+	dirty         bool
+	modified      bool
+
+	ticker         *time.Ticker
+	shutdownWaiter *waiting.ShutdownAwaiter
+}
+
+func newKvStateStorage(
+	name string, store kvStore, interval time.Duration,
+) (*kvStateStorage, error) {
+
+	logger, err := logging.NewLogger(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kvStateStorage{
+		store:          store,
+		interval:       interval,
+		logger:         logger,
+		offsets:        make(map[string]*Offset),
+		encodedStates:  make(map[string][]byte),
+		shutdownWaiter: waiting.NewShutdownAwaiter(),
+	}, nil
+}
+
+func (k *kvStateStorage) Start() error {
+	k.logger.Infof("Starting state storage at %s", k.store)
+	if err := k.Load(); err != nil {
+		return err
+	}
+
+	if k.ticker == nil {
+		k.ticker = time.NewTicker(k.interval)
+		go k.autoStoreHandler()
+	}
+	return nil
+}
+
+func (k *kvStateStorage) Stop() error {
+	k.logger.Infof("Stopping state storage at %s", k.store)
+	k.logger.Debugln("Last processed LSNs:")
+	for name, offset := range k.offsets {
+		k.logger.Debugf("  * %s: %s", name, offset.LSN)
+	}
+	if k.ticker != nil {
+		k.shutdownWaiter.SignalShutdown()
+		if err := k.shutdownWaiter.AwaitDone(); err != nil {
+			k.logger.Warnln("Failed to shutdown auto storage in time")
+		}
+	}
+	saveErr := k.Save()
+	if err := k.store.close(); err != nil {
+		k.logger.Warnf("Failed to close state storage: %+v", err)
+	}
+	return saveErr
+}
+
+// Close releases the store without saving the state
+func (k *kvStateStorage) Close() error {
+	return k.store.close()
+}
+
+func (k *kvStateStorage) Save() error {
+	k.saveMutex.Lock()
+	defer k.saveMutex.Unlock()
+
+	// Take a copy to not block the replication while writing
+	k.mutex.Lock()
+	if k.modified {
+		k.mutex.Unlock()
+		return errors.Errorf("state at %s was modified by another instance, refusing to overwrite it", k.store)
+	}
+	data, err := encodeState(k.offsets, k.encodedStates)
+	version := k.version
+	k.dirty = false
+	k.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	k.logger.Debugf("Storing state at %s", k.store)
+
+	newVersion, err := k.store.compareAndSwap(data, version)
+	if err == nil && newVersion == "" {
+		// The store didn't provide the new version, reading the state
+		// back detects an instance writing in between
+		var stored []byte
+		if stored, newVersion, err = k.store.load(); err == nil && !bytes.Equal(stored, data) {
+			err = errStateModified
+		}
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err != nil {
+		if errors.Is(err, errStateModified) {
+			k.modified = true
+			return errors.Errorf(
+				"state at %s was modified by another instance, is a second streamer using the same state?",
+				k.store,
+			)
+		}
+		// Retry with the next save
+		k.dirty = true
+		return err
+	}
+	k.version = newVersion
+	return nil
+}
+
+func (k *kvStateStorage) Load() error {
+	k.logger.Infof("Loading state from %s", k.store)
+
+	data, version, err := k.store.load()
+	if err != nil {
+		return err
+	}
+
+	offsets := make(map[string]*Offset)
+	encodedStates := make(map[string][]byte)
+	if data != nil {
+		if offsets, encodedStates, err = decodeState(data); err != nil {
+			return err
+		}
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.offsets = offsets
+	k.encodedStates = encodedStates
+	k.version = version
+	k.dirty = false
+	k.modified = false
+	return nil
+}
+
+func (k *kvStateStorage) Get() (map[string]*Offset, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.offsets, nil
+}
+
+func (k *kvStateStorage) Set(
+	key string, value *Offset,
+) error {
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.offsets[key] = value
+	k.dirty = true
+	return nil
+}
+
+func (k *kvStateStorage) StateEncoder(
+	name string, encoder encoding.BinaryMarshaler,
+) error {
+
+	data, err := encoder.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	k.SetEncodedState(name, data)
+	return nil
+}
+
+func (k *kvStateStorage) StateDecoder(
+	name string, decoder encoding.BinaryUnmarshaler,
+) (bool, error) {
+
+	if data, present := k.EncodedState(name); present {
+		if err := decoder.UnmarshalBinary(data); err != nil {
+			return true, errors.Wrap(err, 0)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (k *kvStateStorage) EncodedState(
+	key string,
+) (encodedState []byte, present bool) {
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	encodedState, present = k.encodedStates[key]
+	return
+}
+
+func (k *kvStateStorage) SetEncodedState(
+	key string, encodedState []byte,
+) {
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.encodedStates[key] = encodedState
+	k.dirty = true
+}
+
+func (k *kvStateStorage) EncodedStates() map[string][]byte {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return maps.Clone(k.encodedStates)
+}
+
+func (k *kvStateStorage) autoStoreHandler() {
+	for {
+		select {
+		case <-k.shutdownWaiter.AwaitShutdownChan():
+			k.ticker.Stop()
+			k.shutdownWaiter.SignalDone()
+			return
+
+		case <-k.ticker.C:
+			k.mutex.Lock()
+			dirty := k.dirty && !k.modified
+			k.mutex.Unlock()
+			if !dirty {
+				continue
+			}
+
+			if err := k.Save(); err != nil {
+				k.logger.Errorf("failed to auto storage state: %s", err.Error())
+			}
+		}
+	}
+}
@@ -19,8 +19,10 @@ package statestorage
 
 import (
 	"encoding/binary"
+	"github.com/go-errors/errors"
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/samber/lo"
+	"math"
 	"time"
 )
 
@@ -32,46 +34,103 @@ type Offset struct {
 	LSN            pgtypes.LSN `json:"lsn"`
 }
 
+const (
+	// offsetFormatMarker starts all versioned offsets. The legacy
+	// format starts with a timestamp, which never begins with 0xFF
+	// for any time between 1678 and 2262
+	offsetFormatMarker  = 0xFF
+	offsetFormatVersion = 2
+	offsetV2HeaderSize  = 29
+)
+
 func (o *Offset) UnmarshalBinary(
 	data []byte,
 ) error {
 
-	o.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(data[:8]))).In(time.UTC)
-	o.Snapshot = data[8] == 1
-	o.SnapshotOffset = int(binary.BigEndian.Uint32(data[9:]))
-	o.LSN = pgtypes.LSN(binary.BigEndian.Uint64(data[13:]))
-	if o.Snapshot {
-		snapshotNameLength := int(data[21])
-		if snapshotNameLength > 0 {
-			o.SnapshotName = lo.ToPtr(string(data[22 : 22+snapshotNameLength]))
+	if len(data) >= 2 && data[0] == offsetFormatMarker {
+		if data[1] != offsetFormatVersion {
+			return errors.Errorf("unsupported offset format version %d", data[1])
 		}
+		return o.unmarshalV2(data)
 	}
-	return nil
+	return o.unmarshalV1(data)
 }
 
+// MarshalBinary writes the offset in the version 2 format:
+// marker (1) | version (1) | timestamp (8) | snapshot flag (1) |
+// snapshot offset (8) | lsn (8) | snapshot name length (2) | snapshot name
 func (o *Offset) MarshalBinary() ([]byte, error) {
-	size := 21
+	var snapshotName []byte
 	if o.SnapshotName != nil {
-		size++
-		size += len([]byte(*o.SnapshotName))
+		snapshotName = []byte(*o.SnapshotName)
 	}
-	data := make([]byte, size)
-	binary.BigEndian.PutUint64(data[:8], uint64(o.Timestamp.UnixNano()))
-	data[8] = 0
-	if o.Snapshot {
-		data[8] = 1
+	if len(snapshotName) > math.MaxUint16 {
+		return nil, errors.Errorf("snapshot name exceeds %d bytes", math.MaxUint16)
 	}
-	binary.BigEndian.PutUint32(data[9:], uint32(o.SnapshotOffset))
-	binary.BigEndian.PutUint64(data[13:], uint64(o.LSN))
-	if o.SnapshotName != nil {
-		snapshotName := []byte(*o.SnapshotName)
-		snapshotNameLength := len(snapshotName)
-		data[21] = byte(snapshotNameLength)
-		copy(data[22:], snapshotName)
+
+	data := make([]byte, 0, offsetV2HeaderSize+len(snapshotName))
+	data = append(data, offsetFormatMarker, offsetFormatVersion)
+	data = binary.BigEndian.AppendUint64(data, uint64(o.Timestamp.UnixNano()))
+	if o.Snapshot {
+		data = append(data, 1)
+	} else {
+		data = append(data, 0)
 	}
+	data = binary.BigEndian.AppendUint64(data, uint64(o.SnapshotOffset))
+	data = binary.BigEndian.AppendUint64(data, uint64(o.LSN))
+	data = binary.BigEndian.AppendUint16(data, uint16(len(snapshotName)))
+	data = append(data, snapshotName...)
 	return data, nil
 }
 
+func (o *Offset) unmarshalV2(
+	data []byte,
+) error {
+
+	if len(data) < offsetV2HeaderSize {
+		return errors.Errorf("offset truncated, expected at least %d bytes, got %d", offsetV2HeaderSize, len(data))
+	}
+
+	o.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(data[2:10]))).In(time.UTC)
+	o.Snapshot = data[10] == 1
+	o.SnapshotOffset = int(binary.BigEndian.Uint64(data[11:19]))
+	o.LSN = pgtypes.LSN(binary.BigEndian.Uint64(data[19:27]))
+	o.SnapshotName = nil
+	snapshotNameLength := int(binary.BigEndian.Uint16(data[27:29]))
+	if snapshotNameLength > 0 {
+		if len(data) < offsetV2HeaderSize+snapshotNameLength {
+			return errors.Errorf("offset truncated, snapshot name is incomplete")
+		}
+		o.SnapshotName = lo.ToPtr(string(data[offsetV2HeaderSize : offsetV2HeaderSize+snapshotNameLength]))
+	}
+	return nil
+}
+
+// unmarshalV1 reads the legacy, unversioned offset format
+func (o *Offset) unmarshalV1(
+	data []byte,
+) error {
+
+	if len(data) < 21 {
+		return errors.Errorf("offset truncated, expected at least 21 bytes, got %d", len(data))
+	}
+
+	o.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(data[:8]))).In(time.UTC)
+	o.Snapshot = data[8] == 1
+	o.SnapshotOffset = int(binary.BigEndian.Uint32(data[9:]))
+	o.LSN = pgtypes.LSN(binary.BigEndian.Uint64(data[13:]))
+	if o.Snapshot && len(data) > 21 {
+		snapshotNameLength := int(data[21])
+		if snapshotNameLength > 0 {
+			if len(data) < 22+snapshotNameLength {
+				return errors.Errorf("offset truncated, snapshot name is incomplete")
+			}
+			o.SnapshotName = lo.ToPtr(string(data[22 : 22+snapshotNameLength]))
+		}
+	}
+	return nil
+}
+
 func (o *Offset) Equal(
 	other *Offset,
 ) bool {
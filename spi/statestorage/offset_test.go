@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"encoding/binary"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Offset_Roundtrip(
+	t *testing.T,
+) {
+
+	offsets := []*Offset{
+		{
+			Timestamp:      time.Date(2023, 01, 01, 0, 0, 0, 0, time.UTC),
+			Snapshot:       true,
+			SnapshotOffset: 1000,
+			LSN:            pgtypes.LSN(1000000),
+			SnapshotName:   lo.ToPtr("foo-12345-12345"),
+		},
+		{
+			Timestamp:      time.Date(2023, 02, 01, 1, 0, 0, 0, time.UTC),
+			SnapshotOffset: 3000,
+			LSN:            pgtypes.LSN(3000000),
+		},
+		{
+			Timestamp:    time.Date(2023, 03, 01, 1, 0, 0, 0, time.UTC),
+			Snapshot:     true,
+			LSN:          pgtypes.LSN(4000000),
+			SnapshotName: lo.ToPtr(strings.Repeat("x", 300)),
+		},
+	}
+
+	for _, offset := range offsets {
+		data, err := offset.MarshalBinary()
+		assert.NoError(t, err)
+		assert.Equal(t, byte(offsetFormatMarker), data[0])
+		assert.Equal(t, byte(offsetFormatVersion), data[1])
+
+		decoded := &Offset{}
+		assert.NoError(t, decoded.UnmarshalBinary(data))
+		assert.True(t, offset.Equal(decoded))
+	}
+}
+
+func Test_Offset_Legacy_Format(
+	t *testing.T,
+) {
+
+	timestamp := time.Date(2023, 01, 01, 0, 0, 0, 0, time.UTC)
+	snapshotName := "foo-12345-12345"
+
+	data := binary.BigEndian.AppendUint64(nil, uint64(timestamp.UnixNano()))
+	data = append(data, 1)
+	data = binary.BigEndian.AppendUint32(data, 1000)
+	data = binary.BigEndian.AppendUint64(data, 1000000)
+	data = append(data, byte(len(snapshotName)))
+	data = append(data, snapshotName...)
+
+	offset := &Offset{}
+	assert.NoError(t, offset.UnmarshalBinary(data))
+	assert.True(t, offset.Equal(&Offset{
+		Timestamp:      timestamp,
+		Snapshot:       true,
+		SnapshotOffset: 1000,
+		LSN:            pgtypes.LSN(1000000),
+		SnapshotName:   lo.ToPtr(snapshotName),
+	}))
+
+	assert.Error(t, offset.UnmarshalBinary(data[:len(data)-1]))
+	assert.Error(t, offset.UnmarshalBinary(data[:20]))
+}
+
+func Test_Offset_Unsupported_Version(
+	t *testing.T,
+) {
+
+	data, err := (&Offset{Timestamp: time.Now()}).MarshalBinary()
+	assert.NoError(t, err)
+
+	data[1] = offsetFormatVersion + 1
+	assert.Error(t, (&Offset{}).UnmarshalBinary(data))
+}
@@ -0,0 +1,399 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stateKindOffset       = "offset"
+	stateKindEncodedState = "state"
+)
+
+func init() {
+	RegisterStateStorage(spiconfig.PostgresqlStorage, newPostgresqlStateStorage)
+}
+
+type postgresqlStateStorage struct {
+	poolConfig *pgxpool.Config
+	pool       *pgxpool.Pool
+	table      string
+	id         string
+	interval   time.Duration
+	logger     *logging.Logger
+
+	mutex         sync.Mutex
+	saveMutex     sync.Mutex
+	offsets       map[string]*Offset
+	encodedStates map[string][]byte
+	dirty         bool
+
+	ticker         *time.Ticker
+	shutdownWaiter *waiting.ShutdownAwaiter
+}
+
+func newPostgresqlStateStorage(
+	config *spiconfig.Config,
+) (Storage, error) {
+
+	// Without a dedicated connection, the state is stored in the source database
+	connection := spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlStateStorageConnection, "")
+	password := spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlStateStoragePassword, "")
+	if connection == "" {
+		connection = spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlConnection, "")
+		if password == "" {
+			password = spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlPassword, "")
+		}
+	}
+	if connection == "" {
+		return nil, errors.Errorf("PostgresqlStateStorage needs a connection to be configured")
+	}
+
+	// The replication slot can only be used by a single streamer
+	// at a time, which makes it a natural identifier of the state
+	id := spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlStateStorageId, "")
+	if id == "" {
+		id = spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlReplicationSlotName, "")
+	}
+	if id == "" {
+		return nil, errors.Errorf(
+			"PostgresqlStateStorage needs an id or a replication slot name to be configured",
+		)
+	}
+
+	interval := spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlStateStorageInterval, 5)
+	if interval <= 0 {
+		return nil, errors.Errorf("PostgresqlStateStorage interval must be positive, but was %d", interval)
+	}
+
+	table := spiconfig.GetOrDefault(
+		config, spiconfig.PropertyPostgresqlStateStorageTable, "public.timescaledb_event_streamer_state",
+	)
+
+	return NewPostgresqlStateStorage(connection, password, table, id, time.Second*time.Duration(interval))
+}
+
+func NewPostgresqlStateStorage(
+	connection, password, table, id string, interval time.Duration,
+) (Storage, error) {
+
+	poolConfig, err := pgxpool.ParseConfig(connection)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if password != "" {
+		poolConfig.ConnConfig.Password = password
+	}
+
+	tableIdentifier := pgx.Identifier(strings.Split(table, "."))
+	if len(tableIdentifier) > 2 {
+		return nil, errors.Errorf("PostgresqlStateStorage table '%s' isn't a valid table name", table)
+	}
+
+	logger, err := logging.NewLogger("PostgresqlStateStorage")
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresqlStateStorage{
+		poolConfig:     poolConfig,
+		table:          tableIdentifier.Sanitize(),
+		id:             id,
+		interval:       interval,
+		logger:         logger,
+		offsets:        make(map[string]*Offset),
+		encodedStates:  make(map[string][]byte),
+		shutdownWaiter: waiting.NewShutdownAwaiter(),
+	}, nil
+}
+
+func (p *postgresqlStateStorage) Start() error {
+	p.logger.Infof("Starting PostgresqlStateStorage in %s with id %s", p.table, p.id)
+
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	if _, err := p.pool.Exec(context.Background(), fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (
+			storage_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			name TEXT NOT NULL,
+			data BYTEA NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (storage_id, kind, name)
+		)`, p.table,
+	)); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	if err := p.Load(); err != nil {
+		return err
+	}
+
+	if p.ticker == nil {
+		p.ticker = time.NewTicker(p.interval)
+		go p.autoStoreHandler()
+	}
+	return nil
+}
+
+func (p *postgresqlStateStorage) Stop() error {
+	p.logger.Infof("Stopping PostgresqlStateStorage in %s with id %s", p.table, p.id)
+	p.logger.Debugln("Last processed LSNs:")
+	for name, offset := range p.offsets {
+		p.logger.Debugf("  * %s: %s", name, offset.LSN)
+	}
+	if p.ticker != nil {
+		p.shutdownWaiter.SignalShutdown()
+		if err := p.shutdownWaiter.AwaitDone(); err != nil {
+			p.logger.Warnln("Failed to shutdown auto storage in time")
+		}
+	}
+	if p.pool == nil {
+		return nil
+	}
+	defer p.pool.Close()
+	return p.Save()
+}
+
+// Close releases the connection pool without saving the state
+func (p *postgresqlStateStorage) Close() error {
+	if p.pool != nil {
+		p.pool.Close()
+		p.pool = nil
+	}
+	return nil
+}
+
+// Save replaces the stored state with the current state
+// in a single transaction, which makes sure a restarted
+// streamer never sees a partially written state
+func (p *postgresqlStateStorage) Save() error {
+	p.saveMutex.Lock()
+	defer p.saveMutex.Unlock()
+
+	// Take a copy to not block the replication while writing
+	p.mutex.Lock()
+	offsets := make(map[string][]byte, len(p.offsets))
+	for key, value := range p.offsets {
+		data, err := value.MarshalBinary()
+		if err != nil {
+			p.mutex.Unlock()
+			return err
+		}
+		offsets[key] = data
+	}
+	encodedStates := make(map[string][]byte, len(p.encodedStates))
+	for name, encodedState := range p.encodedStates {
+		encodedStates[name] = encodedState
+	}
+	p.dirty = false
+	p.mutex.Unlock()
+
+	p.logger.Debugf("Storing PostgresqlStateStorage in %s with id %s", p.table, p.id)
+
+	upsert := fmt.Sprintf(
+		`INSERT INTO %s (storage_id, kind, name, data, updated_at) VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (storage_id, kind, name) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`,
+		p.table,
+	)
+
+	if err := pgx.BeginFunc(context.Background(), p.pool, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		batch.Queue(fmt.Sprintf("DELETE FROM %s WHERE storage_id = $1", p.table), p.id)
+		for key, data := range offsets {
+			batch.Queue(upsert, p.id, stateKindOffset, key, data)
+		}
+		for name, data := range encodedStates {
+			batch.Queue(upsert, p.id, stateKindEncodedState, name, data)
+		}
+		return tx.SendBatch(context.Background(), batch).Close()
+	}); err != nil {
+		// Retry with the next save
+		p.mutex.Lock()
+		p.dirty = true
+		p.mutex.Unlock()
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+func (p *postgresqlStateStorage) Load() error {
+	p.logger.Infof("Loading PostgresqlStateStorage from %s with id %s", p.table, p.id)
+
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	rows, err := p.pool.Query(context.Background(), fmt.Sprintf(
+		"SELECT kind, name, data FROM %s WHERE storage_id = $1", p.table,
+	), p.id)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer rows.Close()
+
+	offsets := make(map[string]*Offset)
+	encodedStates := make(map[string][]byte)
+	for rows.Next() {
+		var kind, name string
+		var data []byte
+		if err := rows.Scan(&kind, &name, &data); err != nil {
+			return errors.Wrap(err, 0)
+		}
+
+		switch kind {
+		case stateKindOffset:
+			offset := &Offset{}
+			if err := offset.UnmarshalBinary(data); err != nil {
+				return errors.Wrap(err, 0)
+			}
+			offsets[name] = offset
+		case stateKindEncodedState:
+			encodedStates[name] = data
+		default:
+			p.logger.Warnf("Ignoring state '%s' of unknown kind '%s'", name, kind)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.offsets = offsets
+	p.encodedStates = encodedStates
+	p.dirty = false
+	return nil
+}
+
+func (p *postgresqlStateStorage) connect() error {
+	if p.pool != nil {
+		return nil
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), p.poolConfig)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	p.pool = pool
+	return nil
+}
+
+func (p *postgresqlStateStorage) Get() (map[string]*Offset, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.offsets, nil
+}
+
+func (p *postgresqlStateStorage) Set(
+	key string, value *Offset,
+) error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.offsets[key] = value
+	p.dirty = true
+	return nil
+}
+
+func (p *postgresqlStateStorage) StateEncoder(
+	name string, encoder encoding.BinaryMarshaler,
+) error {
+
+	data, err := encoder.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	p.SetEncodedState(name, data)
+	return nil
+}
+
+func (p *postgresqlStateStorage) StateDecoder(
+	name string, decoder encoding.BinaryUnmarshaler,
+) (bool, error) {
+
+	if data, present := p.EncodedState(name); present {
+		if err := decoder.UnmarshalBinary(data); err != nil {
+			return true, errors.Wrap(err, 0)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *postgresqlStateStorage) EncodedState(
+	key string,
+) (encodedState []byte, present bool) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	encodedState, present = p.encodedStates[key]
+	return
+}
+
+func (p *postgresqlStateStorage) SetEncodedState(
+	key string, encodedState []byte,
+) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.encodedStates[key] = encodedState
+	p.dirty = true
+}
+
+func (p *postgresqlStateStorage) EncodedStates() map[string][]byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return maps.Clone(p.encodedStates)
+}
+
+func (p *postgresqlStateStorage) autoStoreHandler() {
+	for {
+		select {
+		case <-p.shutdownWaiter.AwaitShutdownChan():
+			p.ticker.Stop()
+			p.shutdownWaiter.SignalDone()
+			return
+
+		case <-p.ticker.C:
+			p.mutex.Lock()
+			dirty := p.dirty
+			p.mutex.Unlock()
+			if !dirty {
+				continue
+			}
+
+			if err := p.Save(); err != nil {
+				p.logger.Warnf("failed to auto storage state: %s", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/go-redis/redis"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"strconv"
+	"time"
+)
+
+// compareAndSwapScript writes the state only if the stored
+// version matches the expected one and increments the version
+var compareAndSwapScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'version')
+if current == false then
+	current = ''
+end
+if current ~= ARGV[1] then
+	return -1
+end
+local version = redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('HSET', KEYS[1], 'data', ARGV[2])
+return version
+`)
+
+func init() {
+	RegisterStateStorage(spiconfig.RedisStorage, newRedisStateStorage)
+}
+
+type redisStore struct {
+	client *redis.Client
+	key    string
+}
+
+func newRedisStateStorage(
+	config *spiconfig.Config,
+) (Storage, error) {
+
+	key := spiconfig.GetOrDefault(config, spiconfig.PropertyRedisStateStorageKey, "")
+	if key == "" {
+		slotName := spiconfig.GetOrDefault(config, spiconfig.PropertyPostgresqlReplicationSlotName, "")
+		if slotName == "" {
+			return nil, errors.Errorf("RedisStateStorage needs a key or a replication slot name to be configured")
+		}
+		key = fmt.Sprintf("timescaledb-event-streamer:state:%s", slotName)
+	}
+
+	interval := spiconfig.GetOrDefault(config, spiconfig.PropertyRedisStateStorageInterval, 5)
+	if interval <= 0 {
+		return nil, errors.Errorf("RedisStateStorage interval must be positive, but was %d", interval)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     spiconfig.GetOrDefault(config, spiconfig.PropertyRedisStateStorageAddress, "localhost:6379"),
+		Password: spiconfig.GetOrDefault(config, spiconfig.PropertyRedisStateStoragePassword, ""),
+		DB:       spiconfig.GetOrDefault(config, spiconfig.PropertyRedisStateStorageDatabase, 0),
+	})
+
+	return newKvStateStorage(
+		"RedisStateStorage", &redisStore{client: client, key: key}, time.Second*time.Duration(interval),
+	)
+}
+
+func (r *redisStore) load() ([]byte, string, error) {
+	values, err := r.client.HMGet(r.key, "version", "data").Result()
+	if err != nil {
+		return nil, "", errors.Wrap(err, 0)
+	}
+	version, _ := values[0].(string)
+	data, _ := values[1].(string)
+	if version == "" {
+		return nil, "", nil
+	}
+	return []byte(data), version, nil
+}
+
+func (r *redisStore) compareAndSwap(
+	data []byte, version string,
+) (string, error) {
+
+	result, err := compareAndSwapScript.Run(r.client, []string{r.key}, version, data).Int64()
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	if result < 0 {
+		return "", errStateModified
+	}
+	return strconv.FormatInt(result, 10), nil
+}
+
+func (r *redisStore) close() error {
+	return r.client.Close()
+}
+
+func (r *redisStore) String() string {
+	return fmt.Sprintf("redis://%s/%s", r.client.Options().Addr, r.key)
+}
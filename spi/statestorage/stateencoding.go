@@ -0,0 +1,140 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"encoding/binary"
+	"github.com/go-errors/errors"
+	"github.com/samber/lo"
+	"sort"
+)
+
+// encodeState serializes offsets and encoded states into the
+// binary format shared by all storages persisting the state
+// as a single record. Entries are written in key order, which
+// makes the output stable for unchanged state
+func encodeState(
+	offsets map[string]*Offset, encodedStates map[string][]byte,
+) ([]byte, error) {
+
+	data := make([]byte, 0)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(offsets)))
+	for _, key := range sortedKeys(offsets) {
+		value := offsets[key]
+		keyBytes := []byte(key)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(keyBytes)))
+		data = append(data, keyBytes...)
+
+		valueBytes, err := value.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = binary.BigEndian.AppendUint32(data, uint32(len(valueBytes)))
+		data = append(data, valueBytes...)
+	}
+
+	data = binary.BigEndian.AppendUint32(data, uint32(len(encodedStates)))
+	for _, name := range sortedKeys(encodedStates) {
+		encodedState := encodedStates[name]
+		nameBytes := []byte(name)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(nameBytes)))
+		data = append(data, nameBytes...)
+
+		data = binary.BigEndian.AppendUint32(data, uint32(len(encodedState)))
+		data = append(data, encodedState...)
+	}
+	return data, nil
+}
+
+// decodeState deserializes offsets and encoded states
+// from the binary format written by encodeState
+func decodeState(
+	buffer []byte,
+) (offsets map[string]*Offset, encodedStates map[string][]byte, err error) {
+
+	readerOffset := int64(0)
+	readBytes := func() ([]byte, error) {
+		if int64(len(buffer)) < readerOffset+4 {
+			return nil, errors.Errorf("state truncated at offset %d", readerOffset)
+		}
+		length := int64(binary.BigEndian.Uint32(buffer[readerOffset : readerOffset+4]))
+		readerOffset += 4
+		if int64(len(buffer)) < readerOffset+length {
+			return nil, errors.Errorf("state truncated at offset %d", readerOffset)
+		}
+		val := buffer[readerOffset : readerOffset+length]
+		readerOffset += length
+		return val, nil
+	}
+
+	readUint32 := func() (uint32, error) {
+		if int64(len(buffer)) < readerOffset+4 {
+			return 0, errors.Errorf("state truncated at offset %d", readerOffset)
+		}
+		val := binary.BigEndian.Uint32(buffer[readerOffset : readerOffset+4])
+		readerOffset += 4
+		return val, nil
+	}
+
+	offsets = make(map[string]*Offset)
+	numOfOffsets, err := readUint32()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := uint32(0); i < numOfOffsets; i++ {
+		key, err := readBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := readBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		o := &Offset{}
+		if err := o.UnmarshalBinary(value); err != nil {
+			return nil, nil, errors.Wrap(err, 0)
+		}
+		offsets[string(key)] = o
+	}
+
+	encodedStates = make(map[string][]byte)
+	numOfEncodedStates, err := readUint32()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := uint32(0); i < numOfEncodedStates; i++ {
+		name, err := readBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		encodedState, err := readBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		encodedStates[string(name)] = encodedState
+	}
+	return offsets, encodedStates, nil
+}
+
+func sortedKeys[V any](
+	m map[string]V,
+) []string {
+
+	keys := lo.Keys(m)
+	sort.Strings(keys)
+	return keys
+}
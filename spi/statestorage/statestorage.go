@@ -51,4 +51,14 @@ type Storage interface {
 	SetEncodedState(
 		name string, encodedState []byte,
 	)
+	EncodedStates() map[string][]byte
+}
+
+// ClosableStorage is implemented by storages holding resources, like
+// connections, after the state was loaded. Close releases them without
+// saving the state, which makes it possible to read the state (Load
+// instead of Start) without overwriting changes of another instance.
+type ClosableStorage interface {
+	Storage
+	Close() error
 }
@@ -22,6 +22,7 @@ import (
 	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
 	"github.com/noctarius/timescaledb-event-streamer/spi/schema"
 	"github.com/noctarius/timescaledb-event-streamer/spi/sink"
+	"sync"
 	"time"
 )
 
@@ -34,6 +35,9 @@ type Stream interface {
 	Emit(
 		key, envelope schema.Struct,
 	) error
+	EmitAsync(
+		key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+	) error
 }
 
 type tableStreamImpl struct {
@@ -42,6 +46,9 @@ type tableStreamImpl struct {
 	tableDefinition schema.TableAlike
 	tableKeyColumns []schema.ColumnAlike
 
+	schemaAnnounced bool
+	schemaMutex     sync.Mutex
+
 	topicName      string
 	keySchema      schema.Struct
 	envelopeSchema schema.Struct
@@ -101,9 +108,38 @@ func (s *tableStreamImpl) Emit(
 	key, envelope schema.Struct,
 ) error {
 
+	if err := s.announceSchema(); err != nil {
+		return err
+	}
 	return s.sinkManager.Emit(time.Now(), s.topicName, key, envelope)
 }
 
+func (s *tableStreamImpl) EmitAsync(
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	if err := s.announceSchema(); err != nil {
+		return err
+	}
+	return s.sinkManager.EmitAsync(time.Now(), s.topicName, key, envelope, ack)
+}
+
+// announceSchema passes the table definition to the sink before the
+// first event is emitted. Streams are recreated on schema changes,
+// which makes sure the sink is notified about the new definition.
+func (s *tableStreamImpl) announceSchema() error {
+	s.schemaMutex.Lock()
+	defer s.schemaMutex.Unlock()
+	if s.schemaAnnounced {
+		return nil
+	}
+	if err := s.sinkManager.OnTableSchema(s.tableDefinition); err != nil {
+		return err
+	}
+	s.schemaAnnounced = true
+	return nil
+}
+
 type messageStreamImpl struct {
 	sinkManager sink.Manager
 
@@ -152,3 +188,62 @@ func (m *messageStreamImpl) Emit(
 
 	return m.sinkManager.Emit(time.Now(), m.topicName, key, envelope)
 }
+
+func (m *messageStreamImpl) EmitAsync(
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	return m.sinkManager.EmitAsync(time.Now(), m.topicName, key, envelope, ack)
+}
+
+type schemaStreamImpl struct {
+	sinkManager     sink.Manager
+	tableDefinition schema.TableAlike
+
+	topicName      string
+	keySchema      schema.Struct
+	envelopeSchema schema.Struct
+}
+
+func NewSchemaStream(
+	nameGenerator schema.NameGenerator, sinkManager sink.Manager, tableDefinition schema.TableAlike,
+) Stream {
+
+	return &schemaStreamImpl{
+		sinkManager:     sinkManager,
+		tableDefinition: tableDefinition,
+
+		topicName:      nameGenerator.SchemaTopicName(tableDefinition),
+		keySchema:      schema.TimescaleEventKeySchema(),
+		envelopeSchema: schema.SchemaChangeEnvelopeSchema(nameGenerator, tableDefinition),
+	}
+}
+
+func (s *schemaStreamImpl) KeySchema() schema.Struct {
+	return s.keySchema
+}
+
+func (s *schemaStreamImpl) PayloadSchema() schema.Struct {
+	return s.envelopeSchema
+}
+
+func (s *schemaStreamImpl) Key(
+	_ map[string]any,
+) (schema.Struct, error) {
+
+	return schema.TimescaleKey(s.tableDefinition.SchemaName(), s.tableDefinition.TableName()), nil
+}
+
+func (s *schemaStreamImpl) Emit(
+	key, envelope schema.Struct,
+) error {
+
+	return s.sinkManager.Emit(time.Now(), s.topicName, key, envelope)
+}
+
+func (s *schemaStreamImpl) EmitAsync(
+	key, envelope schema.Struct, ack sink.AcknowledgeFunc,
+) error {
+
+	return s.sinkManager.EmitAsync(time.Now(), s.topicName, key, envelope, ack)
+}
@@ -25,7 +25,8 @@ import (
 )
 
 const (
-	messageStreamName = "::internal::message::stream::"
+	messageStreamName      = "::internal::message::stream::"
+	schemaStreamNamePrefix = "::internal::schema::stream::"
 )
 
 type Manager interface {
@@ -37,6 +38,19 @@ type Manager interface {
 	GetOrCreateStream(
 		table schema.TableAlike,
 	) Stream
+	GetOrCreateSchemaStream(
+		table schema.TableAlike,
+	) Stream
+	InvalidateStream(
+		table schema.TableAlike,
+	)
+	BeginTransaction(
+		xid uint32, commitLSN pgtypes.LSN,
+	) error
+	CommitTransaction(
+		transactionEndLSN pgtypes.LSN,
+	) error
+	CommittedLSN() (lsn pgtypes.LSN, present bool, err error)
 }
 
 type streamManager struct {
@@ -70,6 +84,24 @@ func (s *streamManager) Stop() error {
 	return s.sinkManager.Stop()
 }
 
+func (s *streamManager) BeginTransaction(
+	xid uint32, commitLSN pgtypes.LSN,
+) error {
+
+	return s.sinkManager.BeginTransaction(xid, commitLSN)
+}
+
+func (s *streamManager) CommitTransaction(
+	transactionEndLSN pgtypes.LSN,
+) error {
+
+	return s.sinkManager.CommitTransaction(transactionEndLSN)
+}
+
+func (s *streamManager) CommittedLSN() (lsn pgtypes.LSN, present bool, err error) {
+	return s.sinkManager.CommittedLSN()
+}
+
 func (s *streamManager) GetStream(
 	table schema.TableAlike,
 ) (stream Stream, present bool) {
@@ -92,6 +124,32 @@ func (s *streamManager) GetOrCreateStream(
 	return s.createStream(table)
 }
 
+func (s *streamManager) GetOrCreateSchemaStream(
+	table schema.TableAlike,
+) Stream {
+
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+	streamName := schemaStreamNamePrefix + table.CanonicalName()
+	if stream, present := s.streams[streamName]; present {
+		return stream
+	}
+	stream := NewSchemaStream(s.nameGenerator, s.sinkManager, table)
+	s.streams[streamName] = stream
+	return stream
+}
+
+// InvalidateStream removes the cached stream of the given table,
+// forcing the stream (and its schemas) to be recreated on next use
+func (s *streamManager) InvalidateStream(
+	table schema.TableAlike,
+) {
+
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+	delete(s.streams, table.CanonicalName())
+}
+
 func (s *streamManager) getStream(
 	table schema.TableAlike,
 ) (stream Stream, present bool) {
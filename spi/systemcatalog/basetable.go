@@ -65,13 +65,19 @@ func (bt *BaseTable) ReplicaIdentity() pgtypes.ReplicaIdentity {
 }
 
 // SchemaBuilder returns a SchemaBuilder instance, preconfigured
-// for this table
+// for this table. The field index of a column is derived from
+// its attribute number, to keep it stable when other columns
+// are added or dropped.
 func (bt *BaseTable) SchemaBuilder() schema.Builder {
 	schemaBuilder := schema.NewSchemaBuilder(schema.STRUCT).
 		FieldName(bt.CanonicalName())
 
 	for i, column := range bt.columns {
-		schemaBuilder.Field(column.Name(), i, column.SchemaBuilder())
+		index := i
+		if column.Number() > 0 {
+			index = column.Number() - 1
+		}
+		schemaBuilder.Field(column.Name(), index, column.SchemaBuilder())
 	}
 	return schemaBuilder
 }
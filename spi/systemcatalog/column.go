@@ -131,7 +131,9 @@ type Column struct {
 	dimAligned    bool
 	dimType       *string
 	dimSeq        *int
+	dimInterval   *int64
 	maxCharLength *int
+	number        int
 }
 
 // NewColumn instantiates a new Column instance which isn't
@@ -144,16 +146,20 @@ func NewColumn(
 	return NewIndexColumn(
 		name, dataType, modifiers, pgType, nullable, false, nil,
 		defaultValue, false, nil, ASC, NULLS_LAST,
-		false, false, nil, nil, nil,
+		false, false, nil, nil, nil, nil, 0,
 	)
 }
 
-// NewIndexColumn instantiates a new Column instance
+// NewIndexColumn instantiates a new Column instance. The
+// dimInterval is the chunk interval of a time dimension (nil
+// for other columns) and the number is the PostgreSQL attribute
+// number of the column, or 0 if unknown
 func NewIndexColumn(
 	name string, dataType uint32, modifiers int, pgType pgtypes.PgType,
 	nullable, primaryKey bool, keySeq *int, defaultValue *string, isReplicaIdent bool,
 	indexName *string, sortOrder IndexSortOrder, nullsOrder IndexNullsOrder,
-	dimension, dimAligned bool, dimType *string, dimSeq, maxCharLength *int,
+	dimension, dimAligned bool, dimType *string, dimSeq *int, dimInterval *int64,
+	maxCharLength *int, number int,
 ) Column {
 
 	return Column{
@@ -173,7 +179,9 @@ func NewIndexColumn(
 		dimAligned:    dimAligned,
 		dimType:       dimType,
 		dimSeq:        dimSeq,
+		dimInterval:   dimInterval,
 		maxCharLength: maxCharLength,
+		number:        number,
 	}
 }
 
@@ -241,6 +249,14 @@ func (c Column) DimensionType() *string {
 	return c.dimType
 }
 
+// DimensionInterval returns the chunk interval of a time
+// dimension, in microseconds for date and time columns or
+// in the column's own unit for integer columns. For other
+// columns, this function returns nil.
+func (c Column) DimensionInterval() *int64 {
+	return c.dimInterval
+}
+
 // MaxCharLength returns the maximum number of
 // characters necessary to represent the value
 // as a string (if the type is type limited),
@@ -249,6 +265,14 @@ func (c Column) MaxCharLength() *int {
 	return c.maxCharLength
 }
 
+// Number returns the PostgreSQL attribute number of the
+// column (starting at 1), or 0 if unknown. Attribute numbers
+// are stable for the lifetime of the column and aren't reused
+// after a column is dropped
+func (c Column) Number() int {
+	return c.number
+}
+
 func (c Column) SchemaType() schema.Type {
 	return c.pgType.SchemaType()
 }
@@ -271,9 +295,14 @@ func (c Column) SchemaBuilder() schema.Builder {
 }
 
 func (c Column) Format() string {
+	return fmt.Sprintf("%s:%s", c.name, c.TypeDefinition())
+}
+
+// TypeDefinition returns the PostgreSQL type definition of the
+// column, including the value length (if applicable), such as
+// varchar(255) or int4[]
+func (c Column) TypeDefinition() string {
 	builder := strings.Builder{}
-	builder.WriteString(c.name)
-	builder.WriteString(":")
 	if c.pgType.IsArray() {
 		builder.WriteString(c.pgType.ElementType().Name())
 	} else {
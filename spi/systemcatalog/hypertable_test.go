@@ -184,6 +184,33 @@ func TestSchemaDifferences_Dropped_Last_Column(
 	t.Fatalf("should have a difference for key 'test3' but doesn't")
 }
 
+func TestSchemaBuilder_Field_Index_From_Attribute_Number(
+	t *testing.T,
+) {
+
+	// test2 (attribute number 2) was dropped, test4 added afterward
+	columns := []Column{
+		NewIndexColumn("test1", 10, -1, fooType, false, false, nil, nil, false, nil,
+			ASC, NULLS_LAST, false, false, nil, nil, nil, nil, 1),
+		NewIndexColumn("test3", 10, -1, fooType, false, false, nil, nil, false, nil,
+			ASC, NULLS_LAST, false, false, nil, nil, nil, nil, 3),
+		NewIndexColumn("test4", 10, -1, fooType, false, false, nil, nil, false, nil,
+			ASC, NULLS_LAST, false, false, nil, nil, nil, nil, 4),
+	}
+	hypertable := NewHypertable(1, "", "", "", "", nil, 0, false, nil, nil, pgtypes.DEFAULT)
+	hypertable.ApplyTableSchema(columns)
+
+	fields := hypertable.SchemaBuilder().Build()[schema.FieldNameFields].([]schema.Struct)
+	if len(fields) != 3 {
+		t.Fatalf("should have 3 fields but got %d", len(fields))
+	}
+	for i, expected := range []int{0, 2, 3} {
+		if index := fields[i][schema.FieldNameIndex]; index != expected {
+			t.Fatalf("field %d was supposed to have index %d but had %v", i, expected, index)
+		}
+	}
+}
+
 type testPgType struct {
 }
 
@@ -256,7 +283,7 @@ func (t *testPgType) SchemaType() schema.Type {
 }
 
 func (t *testPgType) SchemaBuilder() schema.Builder {
-	return nil
+	return schema.Int16()
 }
 
 func (t *testPgType) Format() string {
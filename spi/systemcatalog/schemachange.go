@@ -0,0 +1,130 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package systemcatalog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SchemaChangeStatements generates DDL-like statements describing
+// the changes between the old and new column layout of the given
+// table. Columns are matched by name, dropped and added columns
+// at the same position with an otherwise identical definition are
+// reported as renamed.
+func SchemaChangeStatements(
+	table SystemEntity, oldColumns, newColumns []Column,
+) []string {
+
+	alterTable := fmt.Sprintf("ALTER TABLE %s", quotedCanonicalName(table))
+
+	oldColumnsByName := make(map[string]Column, len(oldColumns))
+	for _, column := range oldColumns {
+		oldColumnsByName[column.Name()] = column
+	}
+	newColumnsByName := make(map[string]Column, len(newColumns))
+	for _, column := range newColumns {
+		newColumnsByName[column.Name()] = column
+	}
+
+	renamed := make(map[string]string)
+	for i, oldColumn := range oldColumns {
+		if _, present := newColumnsByName[oldColumn.Name()]; present || i >= len(newColumns) {
+			continue
+		}
+		newColumn := newColumns[i]
+		if _, present := oldColumnsByName[newColumn.Name()]; !present && oldColumn.equalsExceptName(newColumn) {
+			renamed[oldColumn.Name()] = newColumn.Name()
+		}
+	}
+	renamedTo := make(map[string]bool, len(renamed))
+	for _, newName := range renamed {
+		renamedTo[newName] = true
+	}
+
+	statements := make([]string, 0)
+	for _, oldColumn := range oldColumns {
+		if newName, present := renamed[oldColumn.Name()]; present {
+			statements = append(statements, fmt.Sprintf(
+				"%s RENAME COLUMN %s TO %s", alterTable, quoteIdentifier(oldColumn.Name()), quoteIdentifier(newName),
+			))
+			continue
+		}
+
+		newColumn, present := newColumnsByName[oldColumn.Name()]
+		if !present {
+			statements = append(statements, fmt.Sprintf(
+				"%s DROP COLUMN %s", alterTable, quoteIdentifier(oldColumn.Name()),
+			))
+			continue
+		}
+
+		alterColumn := fmt.Sprintf("%s ALTER COLUMN %s", alterTable, quoteIdentifier(oldColumn.Name()))
+		if oldColumn.DataType() != newColumn.DataType() || oldColumn.Modifiers() != newColumn.Modifiers() ||
+			oldColumn.TypeDefinition() != newColumn.TypeDefinition() {
+
+			statements = append(statements, fmt.Sprintf("%s TYPE %s", alterColumn, newColumn.TypeDefinition()))
+		}
+		if oldColumn.IsNullable() != newColumn.IsNullable() {
+			if newColumn.IsNullable() {
+				statements = append(statements, fmt.Sprintf("%s DROP NOT NULL", alterColumn))
+			} else {
+				statements = append(statements, fmt.Sprintf("%s SET NOT NULL", alterColumn))
+			}
+		}
+		oldDefault := oldColumn.DefaultValue()
+		newDefault := newColumn.DefaultValue()
+		if newDefault == nil && oldDefault != nil {
+			statements = append(statements, fmt.Sprintf("%s DROP DEFAULT", alterColumn))
+		} else if newDefault != nil && (oldDefault == nil || *oldDefault != *newDefault) {
+			statements = append(statements, fmt.Sprintf("%s SET DEFAULT %s", alterColumn, *newDefault))
+		}
+	}
+
+	for _, newColumn := range newColumns {
+		if _, present := oldColumnsByName[newColumn.Name()]; present || renamedTo[newColumn.Name()] {
+			continue
+		}
+
+		builder := strings.Builder{}
+		builder.WriteString(fmt.Sprintf(
+			"%s ADD COLUMN %s %s", alterTable, quoteIdentifier(newColumn.Name()), newColumn.TypeDefinition(),
+		))
+		if !newColumn.IsNullable() {
+			builder.WriteString(" NOT NULL")
+		}
+		if newColumn.DefaultValue() != nil {
+			builder.WriteString(fmt.Sprintf(" DEFAULT %s", *newColumn.DefaultValue()))
+		}
+		statements = append(statements, builder.String())
+	}
+	return statements
+}
+
+func quotedCanonicalName(
+	entity SystemEntity,
+) string {
+
+	return fmt.Sprintf("%s.%s", quoteIdentifier(entity.SchemaName()), quoteIdentifier(entity.TableName()))
+}
+
+func quoteIdentifier(
+	identifier string,
+) string {
+
+	return fmt.Sprintf("\"%s\"", strings.ReplaceAll(identifier, "\"", "\"\""))
+}
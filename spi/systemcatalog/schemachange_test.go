@@ -0,0 +1,104 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package systemcatalog
+
+import (
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_SchemaChangeStatements_Add_Drop_Columns(
+	t *testing.T,
+) {
+
+	oldColumns := []Column{
+		NewColumn("test1", 10, -1, fooType, false, nil),
+		NewColumn("test2", 10, -1, fooType, false, nil),
+	}
+	newColumns := []Column{
+		NewColumn("test1", 10, -1, fooType, false, nil),
+		NewColumn("test3", 11, -1, fooType, true, lo.ToPtr("42")),
+		NewColumn("test4", 11, -1, fooType, false, nil),
+	}
+	hypertable := NewHypertable(1, "public", "metrics", "", "", nil, 0, false, nil, nil, pgtypes.DEFAULT)
+
+	statements := SchemaChangeStatements(hypertable, oldColumns, newColumns)
+	assert.Equal(t, []string{
+		`ALTER TABLE "public"."metrics" DROP COLUMN "test2"`,
+		`ALTER TABLE "public"."metrics" ADD COLUMN "test3" foo DEFAULT 42`,
+		`ALTER TABLE "public"."metrics" ADD COLUMN "test4" foo NOT NULL`,
+	}, statements)
+}
+
+func Test_SchemaChangeStatements_Rename_Column(
+	t *testing.T,
+) {
+
+	oldColumns := []Column{
+		NewColumn("test1", 10, -1, fooType, false, nil),
+		NewColumn("test2", 10, -1, fooType, false, nil),
+		NewColumn("test3", 10, -1, fooType, false, nil),
+	}
+	newColumns := []Column{
+		NewColumn("test1", 10, -1, fooType, false, nil),
+		NewColumn("test4", 10, -1, fooType, false, nil),
+		NewColumn("test3", 10, -1, fooType, false, nil),
+	}
+	hypertable := NewHypertable(1, "public", "metrics", "", "", nil, 0, false, nil, nil, pgtypes.DEFAULT)
+
+	statements := SchemaChangeStatements(hypertable, oldColumns, newColumns)
+	assert.Equal(t, []string{
+		`ALTER TABLE "public"."metrics" RENAME COLUMN "test2" TO "test4"`,
+	}, statements)
+}
+
+func Test_SchemaChangeStatements_Alter_Column(
+	t *testing.T,
+) {
+
+	oldColumns := []Column{
+		NewColumn("test1", 10, -1, fooType, false, nil),
+		NewColumn("test2", 10, -1, fooType, true, lo.ToPtr("1")),
+	}
+	newColumns := []Column{
+		NewColumn("test1", 10, 20, fooType, true, nil),
+		NewColumn("test2", 10, -1, fooType, false, nil),
+	}
+	hypertable := NewHypertable(1, "public", "metrics", "", "", nil, 0, false, nil, nil, pgtypes.DEFAULT)
+
+	statements := SchemaChangeStatements(hypertable, oldColumns, newColumns)
+	assert.Equal(t, []string{
+		`ALTER TABLE "public"."metrics" ALTER COLUMN "test1" TYPE foo`,
+		`ALTER TABLE "public"."metrics" ALTER COLUMN "test1" DROP NOT NULL`,
+		`ALTER TABLE "public"."metrics" ALTER COLUMN "test2" SET NOT NULL`,
+		`ALTER TABLE "public"."metrics" ALTER COLUMN "test2" DROP DEFAULT`,
+	}, statements)
+}
+
+func Test_SchemaChangeStatements_No_Changes(
+	t *testing.T,
+) {
+
+	columns := []Column{
+		NewColumn("test1", 10, -1, fooType, false, nil),
+	}
+	hypertable := NewHypertable(1, "public", "metrics", "", "", nil, 0, false, nil, nil, pgtypes.DEFAULT)
+
+	assert.Empty(t, SchemaChangeStatements(hypertable, columns, columns))
+}
@@ -40,4 +40,7 @@ type Notificator interface {
 	NotifySnapshottingEventHandler(
 		fn func(handler eventhandlers.SnapshottingEventHandler) error,
 	)
+	NotifySchemaChangeEventHandler(
+		fn func(handler eventhandlers.SchemaChangeEventHandler) error,
+	)
 }
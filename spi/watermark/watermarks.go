@@ -42,6 +42,20 @@ func NewSnapshotContext(
 	}
 }
 
+func (sc *SnapshotContext) SnapshotName() string {
+	return sc.snapshotName
+}
+
+func (sc *SnapshotContext) Complete() bool {
+	return sc.complete
+}
+
+// Watermarks returns the watermarks of all snapshotted
+// tables, keyed by their canonical name
+func (sc *SnapshotContext) Watermarks() map[string]*Watermark {
+	return sc.watermarks
+}
+
 func (sc *SnapshotContext) GetWatermark(
 	hypertable *systemcatalog.Hypertable,
 ) (watermark *Watermark, present bool) {
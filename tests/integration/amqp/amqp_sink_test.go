@@ -0,0 +1,174 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"testing"
+	"time"
+)
+
+type AmqpIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestAmqpIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(AmqpIntegrationTestSuite))
+}
+
+func (aits *AmqpIntegrationTestSuite) Test_Amqp_Sink() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+	exchangeName := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	amqpLogger, err := logging.NewLogger("Test_Amqp_Sink")
+	if err != nil {
+		aits.T().Error(err)
+	}
+
+	var amqpUrl string
+	var amqpContainer testcontainers.Container
+
+	aits.RunTest(
+		func(ctx testrunner.Context) error {
+			connection, err := amqp091.Dial(amqpUrl)
+			if err != nil {
+				return err
+			}
+			defer connection.Close()
+
+			channel, err := connection.Channel()
+			if err != nil {
+				return err
+			}
+
+			routingKey := fmt.Sprintf(
+				"%s.%s.%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+			if err != nil {
+				return err
+			}
+			if err := channel.QueueBind(queue.Name, routingKey, exchangeName, false, nil); err != nil {
+				return err
+			}
+
+			deliveries, err := channel.Consume(queue.Name, "", false, true, false, false, nil)
+			if err != nil {
+				return err
+			}
+
+			waiter := waiting.NewWaiterWithTimeout(time.Minute)
+			envelopes := make([]testsupport.Envelope, 0)
+			go func() {
+				for delivery := range deliveries {
+					envelope := testsupport.Envelope{}
+					if err := json.Unmarshal(delivery.Body, &envelope); err != nil {
+						aits.T().Error(err)
+					}
+					amqpLogger.Debugf("EVENT: %+v", envelope)
+					assert.Equal(aits.T(), uint8(amqp091.Persistent), delivery.DeliveryMode)
+					assert.Equal(aits.T(), "c", delivery.Headers["operation"])
+					envelopes = append(envelopes, envelope)
+					if len(envelopes) >= 10 {
+						waiter.Signal()
+					}
+					delivery.Ack(false)
+				}
+			}()
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := waiter.Await(); err != nil {
+				return err
+			}
+
+			for i, envelope := range envelopes {
+				assert.Equal(aits.T(), i+1, int(envelope.Payload.After["val"].(float64)))
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, false, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			aC, aU, err := containers.SetupRabbitMQContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			amqpUrl = aU
+			amqpContainer = aC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.AMQP
+				config.Sink.Amqp = spiconfig.AmqpConfig{
+					Address: amqpUrl,
+					Exchange: spiconfig.AmqpExchangeConfig{
+						Name:    exchangeName,
+						Type:    "topic",
+						Declare: true,
+					},
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if amqpContainer != nil {
+				amqpContainer.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
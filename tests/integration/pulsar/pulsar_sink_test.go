@@ -0,0 +1,162 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package pulsar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/go-errors/errors"
+	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
+	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
+	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
+	spiconfig "github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/testrunner"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"testing"
+	"time"
+)
+
+type PulsarIntegrationTestSuite struct {
+	testrunner.TestRunner
+}
+
+func TestPulsarIntegrationTestSuite(
+	t *testing.T,
+) {
+
+	suite.Run(t, new(PulsarIntegrationTestSuite))
+}
+
+func (pits *PulsarIntegrationTestSuite) Test_Pulsar_Sink() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	pulsarLogger, err := logging.NewLogger("Test_Pulsar_Sink")
+	if err != nil {
+		pits.T().Error(err)
+	}
+
+	var pulsarUrl string
+	var pulsarContainer testcontainers.Container
+
+	pits.RunTest(
+		func(ctx testrunner.Context) error {
+			client, err := pulsar.NewClient(pulsar.ClientOptions{
+				URL: pulsarUrl,
+			})
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			topicName := fmt.Sprintf(
+				"persistent://public/default/%s.%s.%s", topicPrefix,
+				testrunner.GetAttribute[string](ctx, "schemaName"),
+				testrunner.GetAttribute[string](ctx, "tableName"),
+			)
+
+			consumer, err := client.Subscribe(pulsar.ConsumerOptions{
+				Topic:                       topicName,
+				SubscriptionName:            lo.RandomString(10, lo.LowerCaseLettersCharset),
+				Type:                        pulsar.KeyShared,
+				SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
+			})
+			if err != nil {
+				return err
+			}
+			defer consumer.Close()
+
+			waiter := waiting.NewWaiterWithTimeout(time.Minute)
+			envelopes := make([]testsupport.Envelope, 0)
+			go func() {
+				for message := range consumer.Chan() {
+					envelope := testsupport.Envelope{}
+					if err := json.Unmarshal(message.Payload(), &envelope); err != nil {
+						pits.T().Error(err)
+					}
+					pulsarLogger.Debugf("EVENT: %+v", envelope)
+					assert.Equal(pits.T(), "c", message.Properties()["operation"])
+					envelopes = append(envelopes, envelope)
+					if len(envelopes) >= 10 {
+						waiter.Signal()
+					}
+					consumer.Ack(message)
+				}
+			}()
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					testrunner.GetAttribute[string](ctx, "tableName"),
+				),
+			); err != nil {
+				return err
+			}
+
+			if err := waiter.Await(); err != nil {
+				return err
+			}
+
+			for i, envelope := range envelopes {
+				assert.Equal(pits.T(), i+1, int(envelope.Payload.After["val"].(float64)))
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			pC, pU, err := containers.SetupPulsarContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			pulsarUrl = pU
+			pulsarContainer = pC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.Pulsar
+				config.Sink.Pulsar = spiconfig.PulsarConfig{
+					Url: pulsarUrl,
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if pulsarContainer != nil {
+				pulsarContainer.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
@@ -168,3 +168,114 @@ func (rits *RedisIntegrationTestSuite) Test_Redis_Sink() {
 		}),
 	)
 }
+
+func (rits *RedisIntegrationTestSuite) Test_Redis_Hash_Sink() {
+	topicPrefix := lo.RandomString(10, lo.LowerCaseLettersCharset)
+
+	var address string
+	var container testcontainers.Container
+
+	rits.RunTest(
+		func(ctx testrunner.Context) error {
+			client := redis.NewClient(&redis.Options{
+				Addr: address,
+			})
+
+			tableName := testrunner.GetAttribute[string](ctx, "tableName")
+			topicName := fmt.Sprintf(
+				"%s.%s.%s", topicPrefix, testrunner.GetAttribute[string](ctx, "schemaName"), tableName,
+			)
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf(
+					"INSERT INTO \"%s\" SELECT ts, ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('2023-03-25 00:00:00'::TIMESTAMPTZ, '2023-03-25 00:09:59'::TIMESTAMPTZ, INTERVAL '1 minute') t(ts)",
+					tableName,
+				),
+			); err != nil {
+				return err
+			}
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf("UPDATE \"%s\" SET val = 100 WHERE ts = '2023-03-25 00:00:00'::TIMESTAMPTZ", tableName),
+			); err != nil {
+				return err
+			}
+
+			if _, err := ctx.Exec(context.Background(),
+				fmt.Sprintf("DELETE FROM \"%s\" WHERE ts = '2023-03-25 00:01:00'::TIMESTAMPTZ", tableName),
+			); err != nil {
+				return err
+			}
+
+			firstRow := fmt.Sprintf("%s:2023-03-25T00:00:00Z", topicName)
+			deletedRow := fmt.Sprintf("%s:2023-03-25T00:01:00Z", topicName)
+
+			// Wait for the delete (the last change) to be materialized
+			deadline := time.Now().Add(time.Minute)
+			for {
+				keys, err := client.Keys(fmt.Sprintf("%s:*", topicName)).Result()
+				if err != nil {
+					return err
+				}
+				if len(keys) == 9 {
+					break
+				}
+				if time.Now().After(deadline) {
+					return errors.Errorf("expected 9 materialized rows, found %d", len(keys))
+				}
+				time.Sleep(time.Millisecond * 100)
+			}
+
+			values, err := client.HGetAll(firstRow).Result()
+			if err != nil {
+				return err
+			}
+			assert.Equal(rits.T(), "100", values["val"])
+			assert.Equal(rits.T(), "2023-03-25T00:00:00Z", values["ts"])
+
+			exists, err := client.Exists(deletedRow).Result()
+			if err != nil {
+				return err
+			}
+			assert.Equal(rits.T(), int64(0), exists)
+			return nil
+		},
+
+		testrunner.WithSetup(func(setupContext testrunner.SetupContext) error {
+			sn, tn, err := setupContext.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, true, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(setupContext, "schemaName", sn)
+			testrunner.Attribute(setupContext, "tableName", tn)
+
+			rC, rA, err := containers.SetupRedisContainer()
+			if err != nil {
+				return errors.Wrap(err, 0)
+			}
+			address = rA
+			container = rC
+
+			setupContext.AddSystemConfigConfigurator(func(config *sysconfig.SystemConfig) {
+				config.Topic.Prefix = topicPrefix
+				config.Sink.Type = spiconfig.Redis
+				config.Sink.Redis = spiconfig.RedisConfig{
+					Address: address,
+					Mode:    spiconfig.RedisHash,
+				}
+			})
+
+			return nil
+		}),
+
+		testrunner.WithTearDown(func(ctx testrunner.Context) error {
+			if container != nil {
+				container.Terminate(context.Background())
+			}
+			return nil
+		}),
+	)
+}
@@ -0,0 +1,98 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"context"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Postgresql_State_Storage(
+	t *testing.T,
+) {
+
+	container, configProvider, err := containers.SetupTimescaleContainer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Terminate(context.Background())
+
+	poolConfig, err := configProvider.UserConnConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection := poolConfig.ConnString()
+
+	newStorage := func(id string) statestorage.Storage {
+		storage, err := statestorage.NewPostgresqlStateStorage(
+			connection, "", "public.state_storage_test", id, time.Second,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return storage
+	}
+
+	offset := &statestorage.Offset{
+		Timestamp:      time.Date(2023, 01, 01, 0, 0, 0, 0, time.UTC),
+		Snapshot:       true,
+		SnapshotOffset: 1000,
+		LSN:            pgtypes.LSN(1000000),
+		SnapshotName:   lo.ToPtr("foo-12345-12345"),
+	}
+
+	storage := newStorage("first")
+	assert.NoError(t, storage.Set("slot", offset))
+	storage.SetEncodedState("snapshotContext", []byte{1, 2, 3})
+	assert.NoError(t, storage.Stop())
+
+	// A new instance, e.g. after rescheduling the pod, continues with the stored state
+	storage = newStorage("first")
+	offsets, err := storage.Get()
+	assert.NoError(t, err)
+	assert.Len(t, offsets, 1)
+	assert.True(t, offset.Equal(offsets["slot"]))
+	encodedState, present := storage.EncodedState("snapshotContext")
+	assert.True(t, present)
+	assert.Equal(t, []byte{1, 2, 3}, encodedState)
+
+	// Overwritten states replace the previous ones
+	storage.SetEncodedState("snapshotContext", []byte{4})
+	assert.NoError(t, storage.Save())
+	assert.NoError(t, storage.Stop())
+
+	storage = newStorage("first")
+	encodedState, _ = storage.EncodedState("snapshotContext")
+	assert.Equal(t, []byte{4}, encodedState)
+	assert.NoError(t, storage.Stop())
+
+	// States of different streamers are separated
+	storage = newStorage("second")
+	offsets, err = storage.Get()
+	assert.NoError(t, err)
+	assert.Len(t, offsets, 0)
+	assert.NoError(t, storage.Stop())
+}
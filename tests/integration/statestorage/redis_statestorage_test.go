@@ -0,0 +1,81 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package statestorage
+
+import (
+	"context"
+	"github.com/noctarius/timescaledb-event-streamer/spi/config"
+	"github.com/noctarius/timescaledb-event-streamer/spi/pgtypes"
+	"github.com/noctarius/timescaledb-event-streamer/spi/statestorage"
+	"github.com/noctarius/timescaledb-event-streamer/testsupport/containers"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Redis_State_Storage(
+	t *testing.T,
+) {
+
+	container, address, err := containers.SetupRedisContainer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Terminate(context.Background())
+
+	newStorage := func() statestorage.Storage {
+		storage, err := statestorage.NewStateStorage(config.RedisStorage, &config.Config{
+			StateStorage: config.StateStorageConfig{
+				RedisStorage: config.RedisStorageConfig{
+					Address: address,
+					Key:     "state:test",
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return storage
+	}
+
+	offset := &statestorage.Offset{
+		Timestamp: time.Date(2023, 01, 01, 0, 0, 0, 0, time.UTC),
+		LSN:       pgtypes.LSN(1000000),
+	}
+
+	storage := newStorage()
+	assert.NoError(t, storage.Set("slot", offset))
+	storage.SetEncodedState("snapshotContext", []byte{1, 2, 3})
+	assert.NoError(t, storage.Stop())
+
+	storage = newStorage()
+	offsets, err := storage.Get()
+	assert.NoError(t, err)
+	assert.True(t, offset.Equal(offsets["slot"]))
+	encodedState, present := storage.EncodedState("snapshotContext")
+	assert.True(t, present)
+	assert.Equal(t, []byte{1, 2, 3}, encodedState)
+
+	// A second instance writing the same state is detected
+	other := newStorage()
+	assert.NoError(t, other.Save())
+	assert.Error(t, storage.Save())
+	assert.NoError(t, other.Stop())
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
 	"github.com/noctarius/timescaledb-event-streamer/internal/logging"
 	"github.com/noctarius/timescaledb-event-streamer/internal/sysconfig"
 	"github.com/noctarius/timescaledb-event-streamer/internal/waiting"
@@ -1740,3 +1741,130 @@ func (its *IntegrationTestSuite) TestVanillaTruncateEvents() {
 		}),
 	)
 }
+
+func (its *IntegrationTestSuite) Test_Streamed_Transaction_Events() {
+	waiter := waiting.NewWaiterWithTimeout(time.Second * 60)
+	testSink := testsupport.NewEventCollectorSink(
+		testsupport.WithFilter(
+			func(_ time.Time, _ string, envelope testsupport.Envelope) bool {
+				return envelope.Payload.Op == schema.OP_CREATE
+			},
+		),
+		testsupport.WithPostHook(func(sink *testsupport.EventCollectorSink, _ testsupport.Envelope) {
+			if sink.NumOfEvents() == 5000 {
+				waiter.Signal()
+			}
+		}),
+	)
+
+	its.RunTest(
+		func(ctx testrunner.Context) error {
+			pgVersion := ctx.PostgresqlVersion()
+			if pgVersion < version.PG_14_VERSION {
+				fmt.Printf("Skipped test, because of PostgreSQL version <14.0 (%s)", pgVersion)
+				return nil
+			}
+
+			// Force the server to stream the transactions
+			if err := ctx.PrivilegedContext(func(ctx testrunner.PrivilegedContext) error {
+				if _, err := ctx.Exec(context.Background(), "ALTER SYSTEM SET logical_decoding_work_mem = '64kB'"); err != nil {
+					return err
+				}
+				_, err := ctx.Exec(context.Background(), "SELECT pg_reload_conf()")
+				return err
+			}); err != nil {
+				return err
+			}
+			defer ctx.PrivilegedContext(func(ctx testrunner.PrivilegedContext) error {
+				if _, err := ctx.Exec(context.Background(), "ALTER SYSTEM RESET logical_decoding_work_mem"); err != nil {
+					return err
+				}
+				_, err := ctx.Exec(context.Background(), "SELECT pg_reload_conf()")
+				return err
+			})
+
+			tableName := testrunner.GetAttribute[string](ctx, "tableName")
+			insert := func(tx pgx.Tx, from, to string, sign int) error {
+				_, err := tx.Exec(context.Background(),
+					fmt.Sprintf(
+						"INSERT INTO \"%s\" SELECT ts, %d * ROW_NUMBER() OVER (ORDER BY ts) AS val FROM GENERATE_SERIES('%s'::TIMESTAMPTZ, '%s'::TIMESTAMPTZ, INTERVAL '1 second') t(ts)",
+						tableName, sign, from, to,
+					),
+				)
+				return err
+			}
+
+			// Aborted transaction, must not be replicated
+			tx, err := ctx.Begin(context.Background())
+			if err != nil {
+				return err
+			}
+			if err := insert(tx, "2023-03-25 00:00:00", "2023-03-25 01:23:19", -1); err != nil {
+				return err
+			}
+			if err := tx.Rollback(context.Background()); err != nil {
+				return err
+			}
+
+			// Committed transaction with an aborted subtransaction
+			tx, err = ctx.Begin(context.Background())
+			if err != nil {
+				return err
+			}
+			if err := insert(tx, "2023-03-25 00:00:00", "2023-03-25 00:41:39", 1); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(context.Background(), "SAVEPOINT aborted"); err != nil {
+				return err
+			}
+			if err := insert(tx, "2023-03-25 02:00:00", "2023-03-25 02:41:39", -1); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(context.Background(), "ROLLBACK TO SAVEPOINT aborted"); err != nil {
+				return err
+			}
+			if err := insert(tx, "2023-03-25 00:41:40", "2023-03-25 01:23:19", 1); err != nil {
+				return err
+			}
+			if err := tx.Commit(context.Background()); err != nil {
+				return err
+			}
+
+			if err := waiter.Await(); err != nil {
+				return err
+			}
+
+			// Wait for potentially wrongly replicated events of aborted (sub)transactions
+			time.Sleep(time.Second * 5)
+
+			events := testSink.Events()
+			if len(events) != 5000 {
+				its.T().Errorf("expected 5000 events but got %d", len(events))
+				return nil
+			}
+			for i, event := range events {
+				expected := (i % 2500) + 1
+				val := int(event.Envelope.Payload.After["val"].(float64))
+				if expected != val {
+					its.T().Errorf("event order inconsistent %d != %d", expected, val)
+					return nil
+				}
+			}
+			return nil
+		},
+
+		testrunner.WithSetup(func(ctx testrunner.SetupContext) error {
+			_, tn, err := ctx.CreateHypertable("ts", time.Hour*24,
+				testsupport.NewColumn("ts", "timestamptz", false, false, nil),
+				testsupport.NewColumn("val", "integer", false, false, nil),
+			)
+			if err != nil {
+				return err
+			}
+			testrunner.Attribute(ctx, "tableName", tn)
+
+			ctx.AddSystemConfigConfigurator(testSink.SystemConfigConfigurator)
+			return nil
+		}),
+	)
+}